@@ -0,0 +1,304 @@
+// This application aggregates raw logs into per-window statistics published to log-metrics
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"kafka-logging-system/internal/aggregator"
+	"kafka-logging-system/internal/buildinfo"
+	"kafka-logging-system/internal/debugserver"
+	"kafka-logging-system/internal/envelope"
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/selflog"
+	"kafka-logging-system/internal/tracing"
+	"kafka-logging-system/pkg/consumer"
+	"kafka-logging-system/pkg/producer"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+type Aggregator struct {
+	ready    chan bool
+	handler  consumer.Handler
+	agg      *aggregator.Aggregator
+	latency  *aggregator.LatencyMetrics
+	producer *producer.Producer
+
+	topic              string
+	checkpointPath     string
+	checkpointInterval time.Duration
+	//format decodes messages without a content-type header
+	format models.Format
+
+	//mu makes counting and checkpointing exclusive, so the saved windows
+	//always match the offsets marked with them
+	mu      sync.Mutex
+	pending map[int32]*sarama.ConsumerMessage //last counted message per partition
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (a *Aggregator) Setup(session sarama.ConsumerGroupSession) error {
+	a.pending = make(map[int32]*sarama.ConsumerMessage)
+
+	go func() {
+		ticker := time.NewTicker(a.checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.checkpoint(session)
+			case <-session.Context().Done():
+				return
+			}
+		}
+	}()
+
+	//Mark the aggregator as ready
+	close(a.ready)
+	return nil
+}
+
+// Cleanup is run at the end of the session, once all ConsumeClaim goroutines have exited
+func (a *Aggregator) Cleanup(session sarama.ConsumerGroupSession) error {
+	a.checkpoint(session)
+	return nil
+}
+
+// ConsumeClaim counts messages into windows. Offsets are only marked when a
+// checkpoint is written, so a restart resumes exactly where the saved windows end.
+func (a *Aggregator) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case message := <-claim.Messages():
+			if message == nil {
+				return nil
+			}
+
+			a.mu.Lock()
+			err := a.handler.Handle(session.Context(), message)
+			if err == nil {
+				a.pending[message.Partition] = message
+			}
+			a.mu.Unlock()
+			if err != nil && session.Context().Err() == nil {
+				return err
+			}
+
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// count adds a message to its window
+func (a *Aggregator) count(_ context.Context, message *sarama.ConsumerMessage) error {
+	messages, err := envelope.Unpack(message)
+	if err != nil {
+		slog.Error("Error unpacking the log batch", "err", err)
+		return nil
+	}
+	for _, message := range messages {
+		//Only counts are kept, so the entry is recycled
+		entry := models.AcquireEntry()
+		if err := envelope.DecodeInto(message, a.format, entry); err != nil {
+			slog.Error("Error parsing the log message", "err", err)
+		} else {
+			a.agg.Add(entry, time.Now())
+		}
+		entry.Release()
+	}
+	return nil
+}
+
+// checkpoint publishes closed windows, saves the open ones and marks the
+// messages they include
+func (a *Aggregator) checkpoint(session sarama.ConsumerGroupSession) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	summaries, keys := a.agg.Closed(time.Now())
+	for _, summary := range summaries {
+		if err := a.publish(summary); err != nil {
+			slog.Error("Error publishing window summary, retrying at next checkpoint", "err", err)
+			return
+		}
+	}
+	a.agg.Remove(keys)
+	a.latency.Update(summaries)
+
+	if err := a.agg.Save(a.checkpointPath); err != nil {
+		slog.Error("Error saving checkpoint", "err", err)
+		return
+	}
+
+	for partition, message := range a.pending {
+		session.MarkMessage(message, "")
+		delete(a.pending, partition)
+	}
+}
+
+func (a *Aggregator) publish(summary aggregator.Summary) error {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return fmt.Errorf("failed to marshal summary %w", err)
+	}
+
+	_, _, err = a.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: a.topic,
+		Key:   sarama.StringEncoder(summary.Application),
+		Value: sarama.ByteEncoder(data),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte(models.HeaderContentType), Value: []byte(models.ContentTypeJSON)},
+		},
+		Timestamp: summary.WindowEnd,
+	})
+	return err
+}
+
+func main() {
+	group := flag.String("group", "log-aggregator-group", "consumer group id")
+	input := flag.String("input", producer.DefaultTopic, "topic to consume logs from")
+	output := flag.String("output", aggregator.DefaultTopic, "topic window summaries are published to")
+	windowSize := flag.Duration("window", time.Minute, "tumbling window size")
+	grace := flag.Duration("grace", 30*time.Second, "how long windows stay open after they end for late entries")
+	topN := flag.Int("top", 5, "top messages and patterns kept per application and window")
+	checkpointPath := flag.String("checkpoint", "aggregator-checkpoint.json", "file open windows are saved to")
+	checkpointInterval := flag.Duration("checkpoint-interval", 10*time.Second, "how often windows are published and saved")
+	metricsAddr := flag.String("metrics-addr", "", "address serving per-application latency quantiles to Prometheus on /metrics, such as :9103")
+	formatName := flag.String("format", string(models.FormatJSON), "wire format of messages without a content-type header: json, protobuf, logfmt, msgpack or cbor")
+	kafka := kafkaconfig.Default()
+	kafka.ClientID = "log-aggregator"
+	kafka.RegisterFlags(flag.CommandLine, "")
+	membership := kafkaconfig.DefaultGroup()
+	membership.RegisterFlags(flag.CommandLine, "")
+	traces := tracing.Default()
+	traces.RegisterFlags(flag.CommandLine)
+	logs := selflog.Default()
+	logs.RegisterFlags(flag.CommandLine)
+	var debug debugserver.Config
+	debug.RegisterFlags(flag.CommandLine)
+	buildinfo.RegisterFlag(flag.CommandLine, "log-aggregator")
+	flag.Parse()
+
+	closeLogs, err := selflog.Setup(logs, "log-aggregator", kafka, *input)
+	if err != nil {
+		selflog.Fatal("Error setting up logging", "err", err)
+	}
+	defer closeLogs()
+	slog.Info("Starting", buildinfo.Get().Attrs()...)
+
+	closeDebug, err := debugserver.Start(debug, "log-aggregator")
+	if err != nil {
+		selflog.Fatal("Error starting debug server", "err", err)
+	}
+	defer closeDebug()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), traces, "log-aggregator")
+	if err != nil {
+		selflog.Fatal("Error setting up tracing", "err", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	format, err := models.ParseFormat(*formatName)
+	if err != nil {
+		selflog.Fatal(err.Error())
+	}
+
+	agg := aggregator.New(*windowSize, *grace, *topN)
+	if err := agg.Load(*checkpointPath); err != nil {
+		selflog.Fatal("Error loading checkpoint", "err", err)
+	}
+
+	producerConfig := producer.DefaultConfig()
+	producerConfig.Kafka = kafka
+	producerConfig.Topic = *output
+	out, err := producer.New(producerConfig)
+	if err != nil {
+		selflog.Fatal("Error creating producer", "err", err)
+	}
+	defer out.Close()
+
+	//Kafka Consumer Configuration
+	config := kafka.Sarama()
+	if err := membership.Apply(config); err != nil {
+		selflog.Fatal(err.Error())
+	}
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest //start from the beginning if no offset
+
+	brokers, err := kafka.Addrs(context.Background())
+	if err != nil {
+		selflog.Fatal(err.Error())
+	}
+	client, err := sarama.NewConsumerGroup(brokers, *group, config)
+	if err != nil {
+		selflog.Fatal("Error creating consumerGroup client", "err", err)
+	}
+	defer client.Close()
+
+	handler := &Aggregator{
+		ready:              make(chan bool),
+		agg:                agg,
+		latency:            aggregator.NewLatencyMetrics(),
+		producer:           out,
+		topic:              *output,
+		checkpointPath:     *checkpointPath,
+		checkpointInterval: *checkpointInterval,
+		format:             format,
+	}
+	handler.handler = consumer.Wrap(consumer.HandlerFunc(handler.count), consumer.Recover(), tracing.Middleware(*group))
+
+	//Cancel consumption on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", handler.latency)
+		server := &http.Server{Addr: *metricsAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Error from metrics server", "err", err)
+			}
+		}()
+		defer server.Close()
+		slog.Info("Serving latency metrics", "addr", *metricsAddr)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			if err := client.Consume(ctx, []string{*input}, handler); err != nil {
+				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+					return
+				}
+				slog.Error("Error from aggregator session, retrying", "err", err)
+				time.Sleep(time.Second)
+			}
+			handler.ready = make(chan bool)
+		}
+	}()
+
+	select {
+	case <-handler.ready:
+		slog.Info("Aggregator started", "group", *group, "input", *input, "output", *output, "window", *windowSize)
+	case <-ctx.Done():
+	}
+
+	<-ctx.Done()
+	slog.Info("Terminating Aggregator...")
+	<-done
+	if late := agg.Late(); late > 0 {
+		slog.Warn("Entries arrived after their window closed and were not counted", "late", late)
+	}
+}
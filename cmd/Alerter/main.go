@@ -0,0 +1,265 @@
+// This application fires alerts when logs match threshold rules or their volume turns anomalous
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"kafka-logging-system/internal/aggregator"
+	"kafka-logging-system/internal/alerting"
+	"kafka-logging-system/internal/buildinfo"
+	"kafka-logging-system/internal/debugserver"
+	"kafka-logging-system/internal/envelope"
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/selflog"
+	"kafka-logging-system/internal/tracing"
+	"kafka-logging-system/pkg/consumer"
+	"kafka-logging-system/pkg/producer"
+	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Sources the alerter can evaluate rules against
+const (
+	sourceLogs    = "logs"
+	sourceMetrics = "metrics"
+)
+
+type Alerter struct {
+	ready   chan bool
+	handler consumer.Handler
+	engine  *alerting.Engine
+	//anomalies learns the volume of each application from window summaries
+	anomalies *alerting.AnomalyDetector
+	alerts    chan<- alerting.Alert
+	source    string
+	//format decodes messages without a content-type header
+	format models.Format
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (a *Alerter) Setup(sarama.ConsumerGroupSession) error {
+	//Mark the alerter as ready
+	close(a.ready)
+	return nil
+}
+
+// Cleanup is run at the end of the session, once all ConsumeClaim goroutines have exited
+func (a *Alerter) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim feeds messages to the rule engine
+func (a *Alerter) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	return consumer.ConsumeClaim(session, claim, a.handler)
+}
+
+func (a *Alerter) handle(_ context.Context, message *sarama.ConsumerMessage) error {
+	for _, alert := range a.observe(message) {
+		a.alerts <- alert
+	}
+	return nil
+}
+
+func (a *Alerter) observe(message *sarama.ConsumerMessage) []alerting.Alert {
+	now := time.Now()
+
+	if a.source == sourceMetrics {
+		var summary aggregator.Summary
+		if err := json.Unmarshal(message.Value, &summary); err != nil {
+			slog.Error("Error parsing the window summary", "err", err)
+			return nil
+		}
+
+		alerts := a.anomalies.Observe(summary, now)
+		for level, count := range summary.Counts {
+			alerts = append(alerts, a.engine.ObserveCount(summary.Application, level, "", count, summary.WindowEnd, now)...)
+		}
+		return alerts
+	}
+
+	messages, err := envelope.Unpack(message)
+	if err != nil {
+		slog.Error("Error unpacking the log batch", "err", err)
+		return nil
+	}
+	var alerts []alerting.Alert
+	for _, message := range messages {
+		entry, err := envelope.Decode(message, a.format)
+		if err != nil {
+			slog.Error("Error parsing the log message", "err", err)
+			continue
+		}
+		alerts = append(alerts, a.engine.Observe(entry, now)...)
+	}
+	return alerts
+}
+
+func main() {
+	group := flag.String("group", "log-alerter-group", "consumer group id")
+	source := flag.String("source", sourceLogs, "evaluate rules against raw logs or aggregator window summaries: logs or metrics")
+	input := flag.String("input", "", "topic to consume (default raw-logs for logs, log-metrics for metrics)")
+	rulesPath := flag.String("rules", "config/alerts.yaml", "YAML alert rules and notifier settings")
+	tick := flag.Duration("tick", 10*time.Second, "how often incidents are checked for resolution")
+	formatName := flag.String("format", string(models.FormatJSON), "wire format of messages without a content-type header: json, protobuf, logfmt, msgpack or cbor")
+	kafka := kafkaconfig.Default()
+	kafka.ClientID = "log-alerter"
+	kafka.RegisterFlags(flag.CommandLine, "")
+	membership := kafkaconfig.DefaultGroup()
+	membership.RegisterFlags(flag.CommandLine, "")
+	traces := tracing.Default()
+	traces.RegisterFlags(flag.CommandLine)
+	logs := selflog.Default()
+	logs.RegisterFlags(flag.CommandLine)
+	var debug debugserver.Config
+	debug.RegisterFlags(flag.CommandLine)
+	buildinfo.RegisterFlag(flag.CommandLine, "log-alerter")
+	flag.Parse()
+
+	//Resolved before logging is set up, so logs are never shipped to the consumed topic
+	topic := *input
+	switch {
+	case *source != sourceLogs && *source != sourceMetrics:
+		selflog.Fatal("Unknown source, expected logs or metrics", "source", *source)
+	case topic == "" && *source == sourceMetrics:
+		topic = aggregator.DefaultTopic
+	case topic == "":
+		topic = producer.DefaultTopic
+	}
+
+	closeLogs, err := selflog.Setup(logs, "log-alerter", kafka, topic)
+	if err != nil {
+		selflog.Fatal("Error setting up logging", "err", err)
+	}
+	defer closeLogs()
+	slog.Info("Starting", buildinfo.Get().Attrs()...)
+
+	closeDebug, err := debugserver.Start(debug, "log-alerter")
+	if err != nil {
+		selflog.Fatal("Error starting debug server", "err", err)
+	}
+	defer closeDebug()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), traces, "log-alerter")
+	if err != nil {
+		selflog.Fatal("Error setting up tracing", "err", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	format, err := models.ParseFormat(*formatName)
+	if err != nil {
+		selflog.Fatal(err.Error())
+	}
+
+	cfg, err := alerting.LoadConfig(*rulesPath)
+	if err != nil {
+		selflog.Fatal("Error loading alert rules", "err", err)
+	}
+	notifiers, err := cfg.Notifiers.Build()
+	if err != nil {
+		selflog.Fatal("Error configuring notifiers", "err", err)
+	}
+	if err := cfg.CheckNotify(notifiers); err != nil {
+		selflog.Fatal("Error configuring notifiers", "err", err)
+	}
+	if len(cfg.Anomalies) > 0 && *source != sourceMetrics {
+		slog.Warn("Anomaly rules only run against window summaries, use -source metrics", "rules", len(cfg.Anomalies))
+	}
+	engine := alerting.NewEngine(cfg.Rules)
+	anomalies := alerting.NewAnomalyDetector(cfg.Anomalies)
+	dispatcher := alerting.NewDispatcher(notifiers...)
+
+	//Kafka Consumer Configuration
+	config := kafka.Sarama()
+	if err := membership.Apply(config); err != nil {
+		selflog.Fatal(err.Error())
+	}
+	config.Consumer.Offsets.Initial = sarama.OffsetNewest //alert on what happens from now on
+
+	brokers, err := kafka.Addrs(context.Background())
+	if err != nil {
+		selflog.Fatal(err.Error())
+	}
+	client, err := sarama.NewConsumerGroup(brokers, *group, config)
+	if err != nil {
+		selflog.Fatal("Error creating consumerGroup client", "err", err)
+	}
+	defer client.Close()
+
+	//Cancel consumption on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	//Notifications are sent from one goroutine so slow channels don't stall consumption
+	alerts := make(chan alerting.Alert, 100)
+	notified := make(chan struct{})
+	go func() {
+		defer close(notified)
+		for alert := range alerts {
+			if err := dispatcher.Dispatch(context.Background(), alert); err != nil {
+				slog.Error("Error sending alert notification", "err", err)
+			}
+		}
+	}()
+
+	handler := &Alerter{
+		ready:     make(chan bool),
+		engine:    engine,
+		anomalies: anomalies,
+		alerts:    alerts,
+		source:    *source,
+		format:    format,
+	}
+	handler.handler = consumer.Wrap(consumer.HandlerFunc(handler.handle), consumer.Recover(), tracing.Middleware(*group))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			if err := client.Consume(ctx, []string{topic}, handler); err != nil {
+				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+					return
+				}
+				slog.Error("Error from alerter session, retrying", "err", err)
+				time.Sleep(time.Second)
+			}
+			handler.ready = make(chan bool)
+		}
+	}()
+
+	ticked := make(chan struct{})
+	go func() {
+		defer close(ticked)
+		ticker := time.NewTicker(*tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				for _, alert := range append(engine.Tick(now), anomalies.Tick(now)...) {
+					alerts <- alert
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-handler.ready:
+		slog.Info("Alerter started", "group", *group, "rules", len(cfg.Rules), "anomalies", len(cfg.Anomalies), "input", topic)
+	case <-ctx.Done():
+	}
+
+	<-ctx.Done()
+	slog.Info("Terminating Alerter...")
+	<-done
+	<-ticked
+	close(alerts)
+	<-notified
+}
@@ -0,0 +1,176 @@
+// This application compares compression codecs on representative log payloads
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"kafka-logging-system/internal/generator"
+	"kafka-logging-system/internal/models"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/IBM/sarama"
+	snappy "github.com/eapache/go-xerial-snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+type codec struct {
+	name       string
+	compress   func(data []byte) ([]byte, error)
+	decompress func(data []byte) ([]byte, error)
+}
+
+func codecs(level int) []codec {
+	gzipLevel := gzip.DefaultCompression
+	zstdLevel := zstd.SpeedDefault
+	if level != sarama.CompressionLevelDefault {
+		gzipLevel = level
+		zstdLevel = zstd.EncoderLevelFromZstd(level)
+	}
+
+	zstdEncoder, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstdLevel))
+	zstdDecoder, _ := zstd.NewReader(nil)
+
+	return []codec{
+		{
+			name: "gzip",
+			compress: func(data []byte) ([]byte, error) {
+				var buf bytes.Buffer
+				writer, err := gzip.NewWriterLevel(&buf, gzipLevel)
+				if err != nil {
+					return nil, err
+				}
+				if _, err := writer.Write(data); err != nil {
+					return nil, err
+				}
+				err = writer.Close()
+				return buf.Bytes(), err
+			},
+			decompress: func(data []byte) ([]byte, error) {
+				reader, err := gzip.NewReader(bytes.NewReader(data))
+				if err != nil {
+					return nil, err
+				}
+				return io.ReadAll(reader)
+			},
+		},
+		{
+			name: "snappy",
+			compress: func(data []byte) ([]byte, error) {
+				return snappy.Encode(data), nil
+			},
+			decompress: snappy.Decode,
+		},
+		{
+			name: "lz4",
+			compress: func(data []byte) ([]byte, error) {
+				var buf bytes.Buffer
+				writer := lz4.NewWriter(&buf)
+				if _, err := writer.Write(data); err != nil {
+					return nil, err
+				}
+				err := writer.Close()
+				return buf.Bytes(), err
+			},
+			decompress: func(data []byte) ([]byte, error) {
+				return io.ReadAll(lz4.NewReader(bytes.NewReader(data)))
+			},
+		},
+		{
+			name: "zstd",
+			compress: func(data []byte) ([]byte, error) {
+				return zstdEncoder.EncodeAll(data, nil), nil
+			},
+			decompress: func(data []byte) ([]byte, error) {
+				return zstdDecoder.DecodeAll(data, nil)
+			},
+		},
+	}
+}
+
+// buildBatches encodes generated entries in format into batches, mirroring how the producer groups messages
+func buildBatches(messages, batchSize int, format models.Format) [][]byte {
+	rnd := rand.New(rand.NewSource(1))
+	generators := make([]*generator.Generator, 0, len(generator.AppNames))
+	for _, app := range generator.AppNames {
+		generators = append(generators, generator.New(app, rnd))
+	}
+
+	var batches [][]byte
+	var batch bytes.Buffer
+	for i := 0; i < messages; i++ {
+		data, err := generators[i%len(generators)].Next().Encode(format)
+		if err != nil {
+			log.Fatalln("Error encoding log entry ", err)
+		}
+		batch.Write(data)
+
+		if (i+1)%batchSize == 0 || i == messages-1 {
+			batches = append(batches, bytes.Clone(batch.Bytes()))
+			batch.Reset()
+		}
+	}
+	return batches
+}
+
+func main() {
+	messages := flag.Int("messages", 100000, "number of log entries to compress")
+	batchSize := flag.Int("batch", 100, "log entries per compressed batch")
+	level := flag.Int("level", sarama.CompressionLevelDefault, "compression level for gzip and zstd")
+	formatName := flag.String("format", string(models.FormatJSON), "wire format of the entries: json, protobuf, logfmt, msgpack or cbor")
+	flag.Parse()
+
+	format, err := models.ParseFormat(*formatName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	batches := buildBatches(*messages, *batchSize, format)
+	rawBytes := 0
+	for _, batch := range batches {
+		rawBytes += len(batch)
+	}
+
+	fmt.Printf("%d %s messages in %d batches, %d bytes uncompressed\n\n", *messages, format, len(batches), rawBytes)
+	fmt.Printf("%-8s %12s %8s %14s %14s\n", "codec", "bytes", "ratio", "compress MB/s", "decomp MB/s")
+
+	for _, c := range codecs(*level) {
+		compressed := make([][]byte, 0, len(batches))
+		compressedBytes := 0
+
+		start := time.Now()
+		for _, batch := range batches {
+			out, err := c.compress(batch)
+			if err != nil {
+				log.Fatalf("Error compressing with %s %v", c.name, err)
+			}
+			compressed = append(compressed, out)
+			compressedBytes += len(out)
+		}
+		compressTime := time.Since(start)
+
+		start = time.Now()
+		for _, batch := range compressed {
+			if _, err := c.decompress(batch); err != nil {
+				log.Fatalf("Error decompressing with %s %v", c.name, err)
+			}
+		}
+		decompressTime := time.Since(start)
+
+		fmt.Printf("%-8s %12d %8.2f %14.1f %14.1f\n",
+			c.name,
+			compressedBytes,
+			float64(rawBytes)/float64(compressedBytes),
+			mbPerSecond(rawBytes, compressTime),
+			mbPerSecond(rawBytes, decompressTime),
+		)
+	}
+}
+
+func mbPerSecond(bytes int, elapsed time.Duration) float64 {
+	return float64(bytes) / (1 << 20) / elapsed.Seconds()
+}
@@ -0,0 +1,181 @@
+// This application compares log entry decoders on generated payloads, reporting
+// throughput, allocations and payload size per message
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"kafka-logging-system/internal/generator"
+	"kafka-logging-system/internal/models"
+	"log"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"time"
+)
+
+// stdEntry has the fields of LogEntry without its UnmarshalJSON, so
+// encoding/json decodes it with reflection like before the fast path
+type stdEntry models.LogEntry
+
+type decoder struct {
+	name   string
+	format models.Format
+	decode func(data []byte) error
+}
+
+var decoders = []decoder{
+	{
+		name:   "encoding/json",
+		format: models.FormatJSON,
+		decode: func(data []byte) error {
+			var entry stdEntry
+			return json.Unmarshal(data, &entry)
+		},
+	},
+	{
+		name:   "fast",
+		format: models.FormatJSON,
+		decode: func(data []byte) error {
+			_, err := models.FromJson(data)
+			return err
+		},
+	},
+	{
+		name:   "fast+pool",
+		format: models.FormatJSON,
+		decode: func(data []byte) error {
+			entry := models.AcquireEntry()
+			defer entry.Release()
+			return models.DecodeInto(data, models.FormatJSON, entry)
+		},
+	},
+	{
+		name:   "protobuf",
+		format: models.FormatProtobuf,
+		decode: func(data []byte) error {
+			_, err := models.FromProto(data)
+			return err
+		},
+	},
+	{
+		name:   "msgpack",
+		format: models.FormatMsgpack,
+		decode: func(data []byte) error {
+			_, err := models.FromMsgpack(data)
+			return err
+		},
+	},
+	{
+		name:   "cbor",
+		format: models.FormatCBOR,
+		decode: func(data []byte) error {
+			_, err := models.FromCBOR(data)
+			return err
+		},
+	},
+}
+
+// buildPayloads encodes generated entries, with a share carrying metadata and escaped text
+func buildPayloads(messages int, format models.Format) [][]byte {
+	rnd := rand.New(rand.NewSource(1))
+	generators := make([]*generator.Generator, 0, len(generator.AppNames))
+	for _, app := range generator.AppNames {
+		generators = append(generators, generator.New(app, rnd))
+	}
+
+	payloads := make([][]byte, 0, messages)
+	for i := 0; i < messages; i++ {
+		entry := generators[i%len(generators)].Next()
+		if i%4 == 0 {
+			entry.WithField("user_id", rnd.Intn(10000)).
+				WithField("path", "/api/v1/orders").
+				WithField("tags", []any{"checkout", "eu"})
+			entry.Message += "\n\t\"quoted\" détail"
+		}
+		data, err := entry.Encode(format)
+		if err != nil {
+			log.Fatalln("Error encoding log entry ", err)
+		}
+		payloads = append(payloads, data)
+	}
+	return payloads
+}
+
+// verify checks the fast decoder returns what encoding/json returns
+func verify(payloads [][]byte) int {
+	mismatches := 0
+	for _, data := range payloads {
+		var want stdEntry
+		if err := json.Unmarshal(data, &want); err != nil {
+			log.Fatalln("Error decoding payload ", err)
+		}
+		got, err := models.FromJson(data)
+		if err != nil || !reflect.DeepEqual((*models.LogEntry)(&want), got) {
+			mismatches++
+		}
+	}
+	return mismatches
+}
+
+func main() {
+	messages := flag.Int("messages", 100000, "number of log entries to decode")
+	rounds := flag.Int("rounds", 3, "passes over the entries, the fastest is reported")
+	flag.Parse()
+
+	payloads := map[models.Format][][]byte{
+		models.FormatJSON:     buildPayloads(*messages, models.FormatJSON),
+		models.FormatProtobuf: buildPayloads(*messages, models.FormatProtobuf),
+		models.FormatMsgpack:  buildPayloads(*messages, models.FormatMsgpack),
+		models.FormatCBOR:     buildPayloads(*messages, models.FormatCBOR),
+	}
+
+	if mismatches := verify(payloads[models.FormatJSON]); mismatches > 0 {
+		log.Fatalf("fast decoder differs from encoding/json on %d of %d entries", mismatches, *messages)
+	}
+
+	fmt.Printf("%d messages, fastest of %d rounds\n\n", *messages, *rounds)
+	fmt.Printf("%-14s %12s %12s %12s %12s %12s\n", "decoder", "ns/msg", "msgs/s", "allocs/msg", "bytes/msg", "size/msg")
+
+	for _, d := range decoders {
+		data := payloads[d.format]
+		size := 0
+		for _, payload := range data {
+			size += len(payload)
+		}
+		var best time.Duration
+		var allocs, bytes uint64
+
+		for round := 0; round < *rounds; round++ {
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			start := time.Now()
+			for _, payload := range data {
+				if err := d.decode(payload); err != nil {
+					log.Fatalf("Error decoding with %s %v", d.name, err)
+				}
+			}
+			elapsed := time.Since(start)
+			runtime.ReadMemStats(&after)
+
+			if round == 0 || elapsed < best {
+				best = elapsed
+				allocs = after.Mallocs - before.Mallocs
+				bytes = after.TotalAlloc - before.TotalAlloc
+			}
+		}
+
+		n := float64(len(data))
+		fmt.Printf("%-14s %12.0f %12.0f %12.1f %12.0f %12.0f\n",
+			d.name,
+			float64(best.Nanoseconds())/n,
+			n/best.Seconds(),
+			float64(allocs)/n,
+			float64(bytes)/n,
+			float64(size)/n,
+		)
+	}
+}
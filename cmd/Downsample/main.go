@@ -0,0 +1,61 @@
+// This application downsamples old logs in the Query API store, keeping
+// severe entries and only counts of the others
+package main
+
+import (
+	"context"
+	"flag"
+	"kafka-logging-system/internal/buildinfo"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/selflog"
+	"kafka-logging-system/internal/store"
+	"log/slog"
+	"time"
+)
+
+func main() {
+	dbPath := flag.String("db", "logs.db", "SQLite database of the Query API")
+	olderThan := flag.Duration("older-than", 7*24*time.Hour, "age past which entries are downsampled")
+	keepName := flag.String("keep", string(models.WARN), "least severe level kept in full, less severe entries are replaced by counts")
+	bucket := flag.Duration("bucket", time.Hour, "time bucket the counts of removed entries are kept in, a divisor of a day")
+	vacuum := flag.Bool("vacuum", false, "compact the database file afterwards, which locks it while running")
+	buildinfo.RegisterFlag(flag.CommandLine, "log-downsample")
+	flag.Parse()
+
+	keep, err := models.ParseLevel(*keepName)
+	if err != nil {
+		selflog.Fatal(err.Error())
+	}
+	if *olderThan <= 0 {
+		selflog.Fatal("-older-than must be positive")
+	}
+	var levels []models.LogLevel
+	for _, level := range models.Levels {
+		if level.Severity() < keep.Severity() {
+			levels = append(levels, level)
+		}
+	}
+
+	db, err := store.OpenSQLite(*dbPath)
+	if err != nil {
+		selflog.Fatal("Error opening store", "err", err)
+	}
+	defer db.Close()
+
+	//the Query API can keep ingesting, each day is rolled up in its own transaction
+	ctx := context.Background()
+	before := time.Now().Add(-*olderThan)
+	start := time.Now()
+	removed, err := db.Downsample(ctx, before, levels, *bucket)
+	if err != nil {
+		selflog.Fatal("Error downsampling logs", "removed", removed, "err", err)
+	}
+	slog.Info("Downsampled logs", "before", before.Format(time.RFC3339), "levels", levels, "removed", removed, "took", time.Since(start))
+
+	if *vacuum {
+		if err := db.Vacuum(ctx); err != nil {
+			selflog.Fatal("Error compacting the database", "err", err)
+		}
+		slog.Info("Compacted the database")
+	}
+}
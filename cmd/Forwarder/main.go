@@ -0,0 +1,310 @@
+// This application forwards processed logs to systems outside Kafka, such as Graylog
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"kafka-logging-system/internal/buildinfo"
+	"kafka-logging-system/internal/debugserver"
+	"kafka-logging-system/internal/envelope"
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/processor"
+	"kafka-logging-system/internal/selflog"
+	"kafka-logging-system/internal/sink"
+	"kafka-logging-system/internal/tracing"
+	"kafka-logging-system/pkg/consumer"
+	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Forwarder writes consumed logs to a sink in batches, marking offsets only
+// once the sink accepted a batch
+type Forwarder struct {
+	ready chan bool
+	sink  sink.Sink
+
+	batchSize     int
+	flushInterval time.Duration
+	//format decodes messages without a content-type header
+	format models.Format
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (f *Forwarder) Setup(sarama.ConsumerGroupSession) error {
+	close(f.ready)
+	return nil
+}
+
+// Cleanup is run at the end of the session, once all ConsumeClaim goroutines have exited
+func (f *Forwarder) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (f *Forwarder) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ticker := time.NewTicker(f.flushInterval)
+	defer ticker.Stop()
+
+	var batch []*models.LogEntry
+	var links []trace.Link
+	var last *sarama.ConsumerMessage
+	//flush returns false when the session ended before the batch was forwarded
+	flush := func() bool {
+		if last == nil {
+			return true
+		}
+		if len(batch) > 0 && !f.write(session.Context(), batch, links) {
+			return false
+		}
+		session.MarkMessage(last, "")
+		batch, links, last = batch[:0], links[:0], nil
+		return true
+	}
+
+	//messages join the batch through the middleware registered with consumer.Use
+	add := consumer.Wrap(consumer.HandlerFunc(func(_ context.Context, message *sarama.ConsumerMessage) error {
+		entries, err := envelope.DecodeAll(message, f.format)
+		if err != nil {
+			slog.Error("Error parsing the log message", "err", err)
+		}
+		if len(entries) > 0 {
+			batch = append(batch, entries...)
+			if link, ok := tracing.MessageLink(message); ok {
+				links = append(links, link)
+			}
+		}
+		return nil
+	}), consumer.Recover())
+
+	for {
+		select {
+		case message := <-claim.Messages():
+			if message == nil {
+				flush()
+				return nil
+			}
+
+			if err := add.Handle(session.Context(), message); err != nil {
+				if session.Context().Err() != nil {
+					return nil
+				}
+				return err
+			}
+			last = message
+
+			if len(batch) >= f.batchSize && !flush() {
+				return nil
+			}
+
+		case <-ticker.C:
+			if !flush() {
+				return nil
+			}
+
+		case <-session.Context().Done():
+			//unforwarded entries are read again by the next owner of the partition
+			return nil
+		}
+	}
+}
+
+// Retries of a failed batch wait retryBackoff, doubling up to maxRetryBackoff
+const (
+	retryBackoff    = time.Second
+	maxRetryBackoff = 30 * time.Second
+)
+
+// write delivers a batch, retrying until it succeeds. It returns false when
+// the session ended first, the batch is then read again by the next session.
+func (f *Forwarder) write(ctx context.Context, batch []*models.LogEntry, links []trace.Link) bool {
+	ctx, span := tracing.StartBatch(ctx, "forward", links, len(batch))
+	defer span.End()
+
+	backoff := retryBackoff
+	for {
+		err := f.sink.Write(ctx, batch)
+		if err == nil {
+			return true
+		}
+		span.RecordError(err)
+		slog.Error("Error forwarding entries, retrying", "entries", len(batch), "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+			backoff = min(backoff*2, maxRetryBackoff)
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// newSink builds the sink called name from the flags and the sink config
+func newSink(name, gelfAddr string, cfg sink.Config) (sink.Sink, error) {
+	switch name {
+	case "gelf":
+		return sink.NewGELF(gelfAddr)
+	case "splunk":
+		if cfg.Splunk == nil {
+			return nil, errors.New("the splunk sink needs a splunk section in -sinks")
+		}
+		return sink.NewSplunk(*cfg.Splunk)
+	case "datadog":
+		if cfg.Datadog == nil {
+			return nil, errors.New("the datadog sink needs a datadog section in -sinks")
+		}
+		return sink.NewDatadog(*cfg.Datadog)
+	case "cloudwatch":
+		if cfg.CloudWatch == nil {
+			return nil, errors.New("the cloudwatch sink needs a cloudwatch section in -sinks")
+		}
+		return sink.NewCloudWatch(context.Background(), *cfg.CloudWatch)
+	case "gcp":
+		if cfg.GCP == nil {
+			return nil, errors.New("the gcp sink needs a gcp section in -sinks")
+		}
+		return sink.NewGCP(context.Background(), *cfg.GCP)
+	case "azure":
+		if cfg.Azure == nil {
+			return nil, errors.New("the azure sink needs an azure section in -sinks")
+		}
+		return sink.NewAzure(context.Background(), *cfg.Azure)
+	case "sentry":
+		if cfg.Sentry == nil {
+			return nil, errors.New("the sentry sink needs a sentry section in -sinks")
+		}
+		return sink.NewSentry(*cfg.Sentry)
+	}
+	return nil, fmt.Errorf("unknown sink %q, expected gelf, splunk, datadog, cloudwatch, gcp, azure or sentry", name)
+}
+
+func main() {
+	group := flag.String("group", "log-forwarder-group", "consumer group id")
+	input := flag.String("input", processor.DefaultOutputTopic, "topic to forward logs from")
+	sinkName := flag.String("sink", "", "where logs are forwarded: gelf, splunk, datadog, cloudwatch, gcp, azure or sentry (default the sink of -sinks, or else gelf)")
+	sinksPath := flag.String("sinks", "", "YAML file choosing the sink and holding its settings, needed by every sink but gelf")
+	gelfAddr := flag.String("gelf-addr", "udp://localhost:12201", "gelf: Graylog input, udp://host:port or tcp://host:port")
+	batchSize := flag.Int("batch", 500, "entries written to the sink at once")
+	flushInterval := flag.Duration("flush-interval", time.Second, "maximum time entries wait before being forwarded")
+	dedupPath := flag.String("dedup-store", "", "file remembering the IDs of forwarded entries so redelivered ones are skipped, empty to disable")
+	dedupSize := flag.Int("dedup-size", 100000, "how many of the latest forwarded IDs -dedup-store remembers")
+	formatName := flag.String("format", string(models.FormatJSON), "wire format of messages without a content-type header: json, protobuf, logfmt, msgpack or cbor")
+	kafka := kafkaconfig.Default()
+	kafka.ClientID = "log-forwarder"
+	kafka.RegisterFlags(flag.CommandLine, "")
+	membership := kafkaconfig.DefaultGroup()
+	membership.RegisterFlags(flag.CommandLine, "")
+	traces := tracing.Default()
+	traces.RegisterFlags(flag.CommandLine)
+	logs := selflog.Default()
+	logs.RegisterFlags(flag.CommandLine)
+	var debug debugserver.Config
+	debug.RegisterFlags(flag.CommandLine)
+	buildinfo.RegisterFlag(flag.CommandLine, "log-forwarder")
+	flag.Parse()
+
+	closeLogs, err := selflog.Setup(logs, "log-forwarder", kafka, *input)
+	if err != nil {
+		selflog.Fatal("Error setting up logging", "err", err)
+	}
+	defer closeLogs()
+	slog.Info("Starting", buildinfo.Get().Attrs()...)
+
+	closeDebug, err := debugserver.Start(debug, "log-forwarder")
+	if err != nil {
+		selflog.Fatal("Error starting debug server", "err", err)
+	}
+	defer closeDebug()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), traces, "log-forwarder")
+	if err != nil {
+		selflog.Fatal("Error setting up tracing", "err", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	format, err := models.ParseFormat(*formatName)
+	if err != nil {
+		selflog.Fatal(err.Error())
+	}
+
+	var sinkConfig sink.Config
+	if *sinksPath != "" {
+		if sinkConfig, err = sink.LoadConfig(*sinksPath); err != nil {
+			selflog.Fatal(err.Error())
+		}
+	}
+	if *sinkName == "" {
+		*sinkName = sinkConfig.Sink
+	}
+	if *sinkName == "" {
+		*sinkName = "gelf"
+	}
+	out, err := newSink(*sinkName, *gelfAddr, sinkConfig)
+	if err != nil {
+		selflog.Fatal(err.Error())
+	}
+	if *dedupPath != "" {
+		if out, err = sink.NewDedup(out, *dedupPath, *dedupSize); err != nil {
+			selflog.Fatal(err.Error())
+		}
+	}
+	defer out.Close()
+
+	config := kafka.Sarama()
+	if err := membership.Apply(config); err != nil {
+		selflog.Fatal(err.Error())
+	}
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest //start from the beginning if no offset
+
+	brokers, err := kafka.Addrs(context.Background())
+	if err != nil {
+		selflog.Fatal(err.Error())
+	}
+	client, err := sarama.NewConsumerGroup(brokers, *group, config)
+	if err != nil {
+		selflog.Fatal("Error creating consumerGroup client", "err", err)
+	}
+	defer client.Close()
+
+	handler := &Forwarder{
+		ready:         make(chan bool),
+		sink:          out,
+		batchSize:     *batchSize,
+		flushInterval: *flushInterval,
+		format:        format,
+	}
+
+	//Cancel consumption on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			if err := client.Consume(ctx, []string{*input}, handler); err != nil {
+				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+					return
+				}
+				slog.Error("Error from forwarding session, retrying", "err", err)
+				time.Sleep(time.Second)
+			}
+			handler.ready = make(chan bool)
+		}
+	}()
+
+	select {
+	case <-handler.ready:
+		slog.Info("Forwarder started", "group", *group, "input", *input, "sink", *sinkName)
+	case <-ctx.Done():
+	}
+
+	<-ctx.Done()
+	slog.Info("Terminating Forwarder...")
+	<-done
+}
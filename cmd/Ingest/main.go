@@ -0,0 +1,172 @@
+// This application accepts logs over HTTP and gRPC and produces them to Kafka
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"kafka-logging-system/internal/buildinfo"
+	"kafka-logging-system/internal/debugserver"
+	"kafka-logging-system/internal/ingest"
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/models/logpb"
+	"kafka-logging-system/internal/selflog"
+	"kafka-logging-system/internal/tracing"
+	"kafka-logging-system/pkg/producer"
+	"log/slog"
+	"net"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func main() {
+	listen := flag.String("listen", ":8090", "address the ingestion endpoint listens on")
+	sourcesPath := flag.String("sources", "", "YAML file of sources and their API tokens (empty accepts unauthenticated requests)")
+	topic := flag.String("topic", producer.DefaultTopic, "topic ingested logs are published to")
+	formatName := flag.String("format", string(models.FormatJSON), "wire format logs are published in: json, protobuf, logfmt, msgpack or cbor")
+	maxBody := flag.Int64("max-body", 1<<20, "largest request body or gRPC message accepted, in bytes")
+	maxBatch := flag.Int("max-batch", 1000, "most entries accepted in one request")
+	grpcListen := flag.String("grpc-listen", ":8091", "address the gRPC service listens on (empty disables it)")
+	batchSize := flag.Int("batch", 500, "gRPC entries merged into one Kafka produce request")
+	linger := flag.Duration("linger", 20*time.Millisecond, "longest gRPC entries wait for their batch to fill")
+	maxInFlight := flag.Int("max-in-flight", 16, "requests of one gRPC stream waiting for Kafka before the stream is paused")
+	limits := models.DefaultLimits()
+	flag.IntVar(&limits.MaxMessageBytes, "max-message-bytes", limits.MaxMessageBytes, "longest message accepted, in bytes (0 for no limit)")
+	flag.IntVar(&limits.MaxMetadataKeys, "max-metadata-keys", limits.MaxMetadataKeys, "most metadata fields accepted on one entry (0 for no limit)")
+	flag.IntVar(&limits.MaxMetadataValueBytes, "max-metadata-value-bytes", limits.MaxMetadataValueBytes, "largest metadata value accepted, in bytes of JSON (0 for no limit)")
+	kafka := kafkaconfig.Default()
+	kafka.ClientID = "log-ingest"
+	kafka.RegisterFlags(flag.CommandLine, "")
+	traces := tracing.Default()
+	traces.RegisterFlags(flag.CommandLine)
+	logs := selflog.Default()
+	logs.RegisterFlags(flag.CommandLine)
+	var debug debugserver.Config
+	debug.RegisterFlags(flag.CommandLine)
+	buildinfo.RegisterFlag(flag.CommandLine, "log-ingest")
+	flag.Parse()
+
+	closeLogs, err := selflog.Setup(logs, "log-ingest", kafka)
+	if err != nil {
+		selflog.Fatal("Error setting up logging", "err", err)
+	}
+	defer closeLogs()
+	slog.Info("Starting", buildinfo.Get().Attrs()...)
+
+	closeDebug, err := debugserver.Start(debug, "log-ingest")
+	if err != nil {
+		selflog.Fatal("Error starting debug server", "err", err)
+	}
+	defer closeDebug()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), traces, "log-ingest")
+	if err != nil {
+		selflog.Fatal("Error setting up tracing", "err", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	format, err := models.ParseFormat(*formatName)
+	if err != nil {
+		selflog.Fatal(err.Error())
+	}
+
+	var sources []ingest.Source
+	if *sourcesPath != "" {
+		if sources, err = ingest.LoadSources(*sourcesPath); err != nil {
+			selflog.Fatal(err.Error())
+		}
+	}
+	if len(sources) == 0 {
+		slog.Warn("No sources configured, accepting logs without a token")
+	}
+
+	producerConfig := producer.DefaultConfig()
+	producerConfig.Kafka = kafka
+	producerConfig.Topic = *topic
+	producerConfig.Format = format
+	producerConfig.Limits = limits
+	p, err := producer.New(producerConfig)
+	if err != nil {
+		selflog.Fatal("Error creating producer", "err", err)
+	}
+	defer p.Close()
+
+	handler := ingest.NewHandler(p, sources)
+	handler.MaxBodySize = *maxBody
+	handler.MaxBatch = *maxBatch
+	handler.Limits = limits
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /logs", handler)
+	mux.HandleFunc("POST /v1/logs", handler.ServeOTLP)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"status": "ok", "build": buildinfo.Get()})
+	})
+
+	//Stop accepting logs on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var grpcServer *grpc.Server
+	var batcher *ingest.Batcher
+	if *grpcListen != "" {
+		lis, err := net.Listen("tcp", *grpcListen)
+		if err != nil {
+			selflog.Fatal("Error listening for gRPC", "err", err)
+		}
+		batcher = ingest.NewBatcher(p, *batchSize, *linger)
+		service := ingest.NewGRPCService(batcher, sources)
+		service.MaxInFlight = *maxInFlight
+		service.Limits = limits
+
+		grpcServer = grpc.NewServer(grpc.MaxRecvMsgSize(int(*maxBody)))
+		logpb.RegisterIngestServer(grpcServer, service)
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				slog.Error("Error from gRPC server", "err", err)
+				stop()
+			}
+		}()
+		slog.Info("gRPC ingestion listening", "addr", *grpcListen)
+	}
+
+	server := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error from ingestion server", "err", err)
+			stop()
+		}
+	}()
+	slog.Info("Ingesting logs", "addr", *listen, "topic", *topic)
+
+	<-ctx.Done()
+	slog.Info("Terminating Ingest...")
+
+	//in-flight requests finish before the producer is closed
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error shutting down ingestion server", "err", err)
+	}
+	if grpcServer != nil {
+		//streams still open when the timeout ends are cut off
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+		}
+		batcher.Close()
+	}
+}
@@ -0,0 +1,283 @@
+// This application mirrors log topics from one Kafka cluster to another, such as from an edge site to the central cluster
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"kafka-logging-system/internal/buildinfo"
+	"kafka-logging-system/internal/debugserver"
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/internal/selflog"
+	"kafka-logging-system/pkg/consumer"
+
+	"github.com/IBM/sarama"
+)
+
+// Mirror copies consumed messages to the target cluster as they are, marking
+// offsets on the source cluster only once the target acknowledged them
+type Mirror struct {
+	ready    chan bool
+	producer sarama.SyncProducer
+	//rename maps source topics to their target topic, topics not in it keep their name
+	rename map[string]string
+
+	batchSize     int
+	flushInterval time.Duration
+
+	mirrored atomic.Int64
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (m *Mirror) Setup(sarama.ConsumerGroupSession) error {
+	close(m.ready)
+	return nil
+}
+
+// Cleanup is run at the end of the session, once all ConsumeClaim goroutines have exited
+func (m *Mirror) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (m *Mirror) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ticker := time.NewTicker(m.flushInterval)
+	defer ticker.Stop()
+
+	var batch []*sarama.ProducerMessage
+	var last *sarama.ConsumerMessage
+	//flush returns false when the session ended before the batch was mirrored
+	flush := func() bool {
+		if last == nil {
+			return true
+		}
+		if !m.send(session.Context(), batch) {
+			return false
+		}
+		session.MarkMessage(last, "")
+		m.mirrored.Add(int64(len(batch)))
+		batch, last = batch[:0], nil
+		return true
+	}
+
+	//messages join the batch through the middleware registered with consumer.Use
+	add := consumer.Wrap(consumer.HandlerFunc(func(_ context.Context, message *sarama.ConsumerMessage) error {
+		batch = append(batch, m.message(message))
+		return nil
+	}), consumer.Recover())
+
+	for {
+		select {
+		case message := <-claim.Messages():
+			if message == nil {
+				flush()
+				return nil
+			}
+			if err := add.Handle(session.Context(), message); err != nil {
+				if session.Context().Err() != nil {
+					return nil
+				}
+				return err
+			}
+			last = message
+
+			if len(batch) >= m.batchSize && !flush() {
+				return nil
+			}
+
+		case <-ticker.C:
+			if !flush() {
+				return nil
+			}
+
+		case <-session.Context().Done():
+			//unmirrored messages are read again by the next owner of the partition
+			return nil
+		}
+	}
+}
+
+// message copies a consumed message, keeping its key, headers and timestamp.
+// Messages with the same key land in the same target partition, so their
+// order is kept even when the clusters' partition counts differ.
+func (m *Mirror) message(msg *sarama.ConsumerMessage) *sarama.ProducerMessage {
+	topic := msg.Topic
+	if renamed, ok := m.rename[topic]; ok {
+		topic = renamed
+	}
+	out := &sarama.ProducerMessage{
+		Topic:     topic,
+		Value:     sarama.ByteEncoder(msg.Value),
+		Timestamp: msg.Timestamp,
+		Headers:   make([]sarama.RecordHeader, 0, len(msg.Headers)),
+	}
+	if msg.Key != nil {
+		out.Key = sarama.ByteEncoder(msg.Key)
+	}
+	for _, header := range msg.Headers {
+		out.Headers = append(out.Headers, *header)
+	}
+	return out
+}
+
+// Retries of a failed batch wait retryBackoff, doubling up to maxRetryBackoff
+const (
+	retryBackoff    = time.Second
+	maxRetryBackoff = 30 * time.Second
+)
+
+// send produces a batch to the target, retrying until it succeeds. It returns
+// false when the session ended first, the batch is then read again by the
+// next session.
+func (m *Mirror) send(ctx context.Context, batch []*sarama.ProducerMessage) bool {
+	backoff := retryBackoff
+	for {
+		err := m.producer.SendMessages(batch)
+		if err == nil {
+			return true
+		}
+		slog.Error("Error mirroring messages, retrying", "messages", len(batch), "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+			backoff = min(backoff*2, maxRetryBackoff)
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// renames collects repeated -rename SOURCE=TARGET flags
+type renames map[string]string
+
+func (r renames) String() string { return "" }
+
+func (r renames) Set(value string) error {
+	source, target, ok := strings.Cut(value, "=")
+	if !ok || source == "" || target == "" {
+		return fmt.Errorf("expected source=target, got %q", value)
+	}
+	r[source] = target
+	return nil
+}
+
+func main() {
+	//-source-brokers, -target-brokers and the other connection settings of both clusters
+	source := kafkaconfig.Default()
+	source.ClientID = "log-mirror"
+	source.RegisterFlags(flag.CommandLine, "source-")
+	target := kafkaconfig.Default()
+	target.Brokers = nil
+	target.ClientID = "log-mirror"
+	target.RegisterFlags(flag.CommandLine, "target-")
+	//the mirror's consumer group lives on the source cluster
+	membership := kafkaconfig.DefaultGroup()
+	membership.RegisterFlags(flag.CommandLine, "")
+	topics := flag.String("topics", "raw-logs", "comma separated topics to mirror")
+	group := flag.String("group", "log-mirror-group", "consumer group on the source cluster keeping the mirror's offsets")
+	rename := renames{}
+	flag.Var(rename, "rename", "source=target mirrors a topic under another name, may be repeated")
+	batchSize := flag.Int("batch", 500, "messages produced to the target at once")
+	flushInterval := flag.Duration("flush-interval", time.Second, "maximum time messages wait before being mirrored")
+	logs := selflog.Default()
+	logs.RegisterFlags(flag.CommandLine)
+	var debug debugserver.Config
+	debug.RegisterFlags(flag.CommandLine)
+	buildinfo.RegisterFlag(flag.CommandLine, "log-mirror")
+	flag.Parse()
+
+	closeLogs, err := selflog.Setup(logs, "log-mirror", target)
+	if err != nil {
+		selflog.Fatal("Error setting up logging", "err", err)
+	}
+	defer closeLogs()
+	slog.Info("Starting", buildinfo.Get().Attrs()...)
+
+	closeDebug, err := debugserver.Start(debug, "log-mirror")
+	if err != nil {
+		selflog.Fatal("Error starting debug server", "err", err)
+	}
+	defer closeDebug()
+
+	sourceBrokers, err := source.Addrs(context.Background())
+	if err != nil {
+		selflog.Fatal("Invalid source cluster", "err", err)
+	}
+	targetBrokers, err := target.Addrs(context.Background())
+	if err != nil {
+		selflog.Fatal("Invalid target cluster, -target-brokers or -target-discover is required", "err", err)
+	}
+	topicList := kafkaconfig.SplitList(*topics)
+	if len(topicList) == 0 {
+		selflog.Fatal("-topics is required")
+	}
+
+	//Target producer, idempotent so retried batches aren't written twice
+	producerConfig := target.Sarama()
+	producerConfig.Producer.Return.Successes = true
+	producerConfig.Producer.RequiredAcks = sarama.WaitForAll
+	producerConfig.Producer.Idempotent = true
+	producerConfig.Producer.Retry.Max = 5
+	producerConfig.Net.MaxOpenRequests = 1
+	out, err := sarama.NewSyncProducer(targetBrokers, producerConfig)
+	if err != nil {
+		selflog.Fatal("Error creating target producer", "err", err)
+	}
+	defer out.Close()
+
+	config := source.Sarama()
+	if err := membership.Apply(config); err != nil {
+		selflog.Fatal(err.Error())
+	}
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest //start from the beginning if no offset
+
+	client, err := sarama.NewConsumerGroup(sourceBrokers, *group, config)
+	if err != nil {
+		selflog.Fatal("Error creating consumerGroup client", "err", err)
+	}
+	defer client.Close()
+
+	handler := &Mirror{
+		ready:         make(chan bool),
+		producer:      out,
+		rename:        rename,
+		batchSize:     *batchSize,
+		flushInterval: *flushInterval,
+	}
+
+	//Cancel consumption on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			if err := client.Consume(ctx, topicList, handler); err != nil {
+				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+					return
+				}
+				slog.Error("Error from mirror session, retrying", "err", err)
+				time.Sleep(time.Second)
+			}
+			handler.ready = make(chan bool)
+		}
+	}()
+
+	select {
+	case <-handler.ready:
+		slog.Info("Mirror started", "group", *group, "topics", topicList, "source", sourceBrokers, "target", targetBrokers)
+	case <-ctx.Done():
+	}
+
+	<-ctx.Done()
+	slog.Info("Terminating Mirror...")
+	<-done
+	slog.Info("Mirror stopped", "mirrored", handler.mirrored.Load())
+}
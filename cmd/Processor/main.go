@@ -0,0 +1,445 @@
+// This application processes raw logs and republishes them to processed-logs
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"kafka-logging-system/internal/buildinfo"
+	"kafka-logging-system/internal/debugserver"
+	"kafka-logging-system/internal/envelope"
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/processor"
+	"kafka-logging-system/internal/selflog"
+	"kafka-logging-system/internal/tracing"
+	"kafka-logging-system/pkg/consumer"
+	"kafka-logging-system/pkg/producer"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+type Processor struct {
+	ready    chan bool
+	handler  consumer.Handler
+	chain    processor.Chain
+	producer *producer.Producer
+	metrics  *processor.Metrics
+	//txns is set when processing in transactions
+	txns *transactions
+
+	outputTopic string
+	dlqTopic    string
+	//format decodes messages without a content-type header
+	format models.Format
+	//salvage publishes what can be read of malformed JSON messages instead
+	//of dead lettering them
+	salvage bool
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (p *Processor) Setup(sarama.ConsumerGroupSession) error {
+	//Mark the processor as ready
+	close(p.ready)
+	return nil
+}
+
+// Cleanup is run at the end of the session, once all ConsumeClaim goroutines have exited
+func (p *Processor) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim processes messages until the session ends. A message is only
+// marked once it has been published, if publishing fails the session is ended
+// so the message is consumed again.
+func (p *Processor) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	if p.txns != nil {
+		return p.consumeTransactional(session, claim)
+	}
+	return consumer.ConsumeClaim(session, claim, p.handler)
+}
+
+// handle runs one message through the chain and publishes the result
+func (p *Processor) handle(ctx context.Context, message *sarama.ConsumerMessage) error {
+	if err := p.process(ctx, message); err != nil {
+		p.metrics.Failed.Add(1)
+		return err
+	}
+	return nil
+}
+
+// process handles every entry of a message, a batch message is only done
+// once all of its entries are
+func (p *Processor) process(ctx context.Context, message *sarama.ConsumerMessage) error {
+	out := p.output(message)
+	messages, err := envelope.Unpack(message)
+	if err != nil {
+		p.metrics.Consumed.Add(1)
+		return p.deadLetter(ctx, out, message, "decode", err)
+	}
+	for _, message := range messages {
+		if err := p.processEntry(ctx, out, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Processor) processEntry(ctx context.Context, out *producer.Producer, message *sarama.ConsumerMessage) error {
+	p.metrics.Consumed.Add(1)
+
+	//Entries are encoded when published and not kept, so they are recycled
+	entry := models.AcquireEntry()
+	defer entry.Release()
+	if err := envelope.DecodeInto(message, p.format, entry); err != nil {
+		if !p.salvage {
+			return p.deadLetter(ctx, out, message, "decode", err)
+		}
+		salvaged, ok := envelope.Salvage(message, p.format, err)
+		if !ok {
+			return p.deadLetter(ctx, out, message, "decode", err)
+		}
+		slog.Warn("Salvaged malformed message", "topic", message.Topic, "partition", message.Partition, "offset", message.Offset, "err", err)
+		p.metrics.Salvaged.Add(1)
+		*entry = *salvaged
+	}
+
+	record := &processor.Record{Entry: entry}
+	if err := p.chain.Process(record); err != nil {
+		if errors.Is(err, processor.ErrDrop) {
+			p.metrics.Dropped.Add(1)
+			return nil
+		}
+
+		stage := "chain"
+		var perr *processor.Error
+		if errors.As(err, &perr) {
+			stage = perr.Processor
+		}
+		return p.deadLetter(ctx, out, message, stage, err)
+	}
+
+	return p.publish(ctx, out, record)
+}
+
+// output returns the producer publishing what message turns into, the
+// producer of its claim's transactions in transactional mode
+func (p *Processor) output(message *sarama.ConsumerMessage) *producer.Producer {
+	if p.txns != nil {
+		if out, ok := p.txns.output(message); ok {
+			return out
+		}
+	}
+	return p.producer
+}
+
+// publish sends a processed record to its topics
+func (p *Processor) publish(ctx context.Context, out *producer.Producer, record *processor.Record) error {
+	topics := record.Topics
+	if len(topics) == 0 {
+		topics = []string{p.outputTopic}
+	}
+	for _, topic := range topics {
+		if _, _, err := out.SendToContext(ctx, topic, record.Entry); err != nil {
+			return fmt.Errorf("failed to publish to %s %w", topic, err)
+		}
+	}
+
+	p.metrics.Published.Add(1)
+	return nil
+}
+
+// emit publishes a record created by a processor rather than consumed
+func (p *Processor) emit(record *processor.Record) {
+	if err := p.publish(context.Background(), p.producer, record); err != nil {
+		p.metrics.Failed.Add(1)
+		slog.Error("Error publishing emitted entry", "err", err)
+	}
+}
+
+// deadLetter forwards the original message untouched, with headers explaining the failure
+func (p *Processor) deadLetter(ctx context.Context, out *producer.Producer, message *sarama.ConsumerMessage, stage string, cause error) error {
+	headers := make([]sarama.RecordHeader, 0, len(message.Headers)+3)
+	for _, h := range message.Headers {
+		if h != nil {
+			headers = append(headers, *h)
+		}
+	}
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(models.HeaderDLQError), Value: []byte(cause.Error())},
+		sarama.RecordHeader{Key: []byte(models.HeaderDLQStage), Value: []byte(stage)},
+		sarama.RecordHeader{Key: []byte(models.HeaderDLQSource), Value: []byte(fmt.Sprintf("%s/%d/%d", message.Topic, message.Partition, message.Offset))},
+	)
+
+	msg := &sarama.ProducerMessage{
+		Topic:     p.dlqTopic,
+		Value:     sarama.ByteEncoder(message.Value),
+		Headers:   headers,
+		Timestamp: message.Timestamp,
+	}
+	if message.Key != nil {
+		msg.Key = sarama.ByteEncoder(message.Key)
+	}
+
+	if _, _, err := out.SendMessageContext(ctx, msg); err != nil {
+		return fmt.Errorf("failed to dead letter message %w", err)
+	}
+
+	p.metrics.DeadLettered.Add(1)
+	slog.Warn("Dead lettered message", "topic", message.Topic, "partition", message.Partition, "offset", message.Offset, "stage", stage, "err", cause)
+	return nil
+}
+
+// publishMetrics sends every series of the log metrics to topic as JSON
+// each interval, keyed by metric name
+func publishMetrics(ctx context.Context, out *producer.Producer, metrics *processor.LogMetrics, topic string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, sample := range metrics.Snapshot(now.UTC()) {
+				data, err := json.Marshal(sample)
+				if err != nil {
+					slog.Error("Error encoding log metric", "metric", sample.Name, "err", err)
+					continue
+				}
+				msg := &sarama.ProducerMessage{Topic: topic, Key: sarama.StringEncoder(sample.Name), Value: sarama.ByteEncoder(data)}
+				if _, _, err := out.SendMessageContext(ctx, msg); err != nil {
+					slog.Error("Error publishing log metrics", "topic", topic, "err", err)
+					break
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func main() {
+	group := flag.String("group", "log-processor-group", "consumer group id")
+	input := flag.String("input", producer.DefaultTopic, "topic to consume raw logs from")
+	output := flag.String("output", processor.DefaultOutputTopic, "topic processed logs are published to")
+	dlq := flag.String("dlq", processor.DefaultDLQTopic, "topic for messages that fail processing")
+	processors := flag.String("processors", "validate,redact,enrich", "comma separated processors, applied in order")
+	formatName := flag.String("format", string(models.FormatJSON), "wire format of messages without a content-type header: json, protobuf, logfmt, msgpack or cbor")
+	routes := flag.String("routes", "", "YAML routing rules used by the route processor, reloaded on change")
+	enrichFile := flag.String("enrich-file", "", "YAML lookup of fields per application for the enrich processor")
+	enrichURL := flag.String("enrich-url", "", "lookup service URL for the enrich processor, {app} is replaced by the application")
+	enrichTTL := flag.Duration("enrich-ttl", 5*time.Minute, "how long lookup service responses are cached")
+	redact := flag.String("redact", "", "YAML config for the redact processor (default masks all built-in patterns)")
+	dedupWindow := flag.Duration("dedup-window", 30*time.Second, "how long the dedup processor suppresses repeats of an entry")
+	sampleRate := flag.Int("sample-rate", 10, "the sample processor keeps 1 in this many DEBUG and INFO logs of each kind")
+	patternSimilarity := flag.Float64("pattern-similarity", 0.5, "share of words a message must have in common with a pattern to join it, for the pattern processor")
+	metricRules := flag.String("metric-rules", "", "YAML rules turning logs into metrics, for the logmetrics processor")
+	metricsAddr := flag.String("metrics-addr", "", "address serving the logmetrics metrics to Prometheus on /metrics, such as :9102")
+	metricsTopic := flag.String("metrics-topic", "", "topic the logmetrics metrics are published to as JSON, empty to disable")
+	metricsInterval := flag.Duration("metrics-interval", time.Minute, "how often the logmetrics metrics are published to -metrics-topic")
+	salvage := flag.Bool("salvage", false, "publish the readable fields of malformed JSON messages as degraded entries instead of dead lettering them")
+	rateLimit := flag.Float64("rate-limit", 0, "most messages processed per second, 0 for no limit")
+	transactionalID := flag.String("transactional-id", "", "prefix of the transactional IDs of the claimed partitions, enables exactly once processing with Kafka transactions")
+	txnSize := flag.Int("txn-size", 500, "messages per transaction with -transactional-id")
+	txnInterval := flag.Duration("txn-interval", 100*time.Millisecond, "longest a transaction stays open with -transactional-id")
+	statsInterval := flag.Duration("stats-interval", 30*time.Second, "how often processing counts are logged (0 disables)")
+	kafka := kafkaconfig.Default()
+	kafka.ClientID = "log-processor"
+	kafka.RegisterFlags(flag.CommandLine, "")
+	membership := kafkaconfig.DefaultGroup()
+	membership.RegisterFlags(flag.CommandLine, "")
+	traces := tracing.Default()
+	traces.RegisterFlags(flag.CommandLine)
+	logs := selflog.Default()
+	logs.RegisterFlags(flag.CommandLine)
+	var debug debugserver.Config
+	debug.RegisterFlags(flag.CommandLine)
+	buildinfo.RegisterFlag(flag.CommandLine, "log-processor")
+	flag.Parse()
+
+	closeLogs, err := selflog.Setup(logs, "log-processor", kafka, *input)
+	if err != nil {
+		selflog.Fatal("Error setting up logging", "err", err)
+	}
+	defer closeLogs()
+	slog.Info("Starting", buildinfo.Get().Attrs()...)
+
+	closeDebug, err := debugserver.Start(debug, "log-processor")
+	if err != nil {
+		selflog.Fatal("Error starting debug server", "err", err)
+	}
+	defer closeDebug()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), traces, "log-processor")
+	if err != nil {
+		selflog.Fatal("Error setting up tracing", "err", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	format, err := models.ParseFormat(*formatName)
+	if err != nil {
+		selflog.Fatal(err.Error())
+	}
+
+	//Cancel consumption on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var logMetrics *processor.LogMetrics
+	if *metricRules != "" {
+		rules, err := processor.LoadMetricRules(*metricRules)
+		if err != nil {
+			selflog.Fatal("Error loading metric rules", "err", err)
+		}
+		logMetrics = processor.NewLogMetrics(rules)
+	}
+
+	metrics := &processor.Metrics{}
+	//set once consuming starts, before the first window closes
+	var handler *Processor
+	chain, err := processor.Build(strings.Split(*processors, ","), processor.Options{
+		Context:           ctx,
+		RoutesFile:        *routes,
+		EnrichFile:        *enrichFile,
+		EnrichURL:         *enrichURL,
+		EnrichTTL:         *enrichTTL,
+		RedactFile:        *redact,
+		SampleRate:        *sampleRate,
+		DedupWindow:       *dedupWindow,
+		PatternSimilarity: *patternSimilarity,
+		LogMetrics:        logMetrics,
+		Emit: func(record *processor.Record) {
+			handler.emit(record)
+		},
+		Metrics: metrics,
+	})
+	if err != nil {
+		selflog.Fatal("Error building processor chain", "err", err)
+	}
+
+	//Output producer, re-encoding in the same format it reads by default
+	producerConfig := producer.DefaultConfig()
+	producerConfig.Kafka = kafka
+	producerConfig.Topic = *output
+	producerConfig.Format = format
+	out, err := producer.New(producerConfig)
+	if err != nil {
+		selflog.Fatal("Error creating producer", "err", err)
+	}
+	defer out.Close()
+
+	//Kafka Consumer Configuration
+	config := kafka.Sarama()
+	if err := membership.Apply(config); err != nil {
+		selflog.Fatal(err.Error())
+	}
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest //start from the beginning if no offset
+
+	var txns *transactions
+	if *transactionalID != "" {
+		txnConfig := producerConfig
+		txnConfig.Idempotent = true
+		txnConfig.TransactionalID = *transactionalID
+		if err := txnConfig.Validate(); err != nil {
+			selflog.Fatal("Invalid transactional producer config", "err", err)
+		}
+		if *txnSize < 1 || *txnInterval <= 0 {
+			selflog.Fatal("-txn-size and -txn-interval must be positive")
+		}
+		txns = &transactions{
+			config:   txnConfig,
+			group:    *group,
+			size:     *txnSize,
+			interval: *txnInterval,
+			outputs:  make(map[string]*producer.Producer),
+		}
+		//offsets are committed by the transactions
+		config.Consumer.Offsets.AutoCommit.Enable = false
+	}
+
+	brokers, err := kafka.Addrs(ctx)
+	if err != nil {
+		selflog.Fatal(err.Error())
+	}
+	client, err := sarama.NewConsumerGroup(brokers, *group, config)
+	if err != nil {
+		selflog.Fatal("Error creating consumerGroup client", "err", err)
+	}
+	defer client.Close()
+
+	handler = &Processor{
+		ready:       make(chan bool),
+		chain:       chain,
+		producer:    out,
+		metrics:     metrics,
+		txns:        txns,
+		outputTopic: *output,
+		dlqTopic:    *dlq,
+		format:      format,
+		salvage:     *salvage,
+	}
+	handler.handler = consumer.Wrap(consumer.HandlerFunc(handler.handle), consumer.Recover(), consumer.RateLimit(*rateLimit), tracing.Middleware(*group))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			if err := client.Consume(ctx, []string{*input}, handler); err != nil {
+				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+					return
+				}
+				slog.Error("Error from processor session, retrying", "err", err)
+				time.Sleep(time.Second)
+			}
+			handler.ready = make(chan bool)
+		}
+	}()
+
+	if *statsInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(*statsInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					slog.Info("Processor stats", "stats", handler.metrics.String())
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	if logMetrics != nil && *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", logMetrics)
+		server := &http.Server{Addr: *metricsAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Error from metrics server", "err", err)
+			}
+		}()
+		defer server.Close()
+		slog.Info("Serving log metrics", "addr", *metricsAddr)
+	}
+	if logMetrics != nil && *metricsTopic != "" && *metricsInterval > 0 {
+		go publishMetrics(ctx, out, logMetrics, *metricsTopic, *metricsInterval)
+	}
+
+	select {
+	case <-handler.ready:
+		slog.Info("Processor started", "group", *group, "input", *input, "output", *output, "chain", *processors, "transactional", txns != nil)
+	case <-ctx.Done():
+	}
+
+	<-ctx.Done()
+	slog.Info("Terminating Processor...")
+	<-done
+	slog.Info("Processor stats", "stats", handler.metrics.String())
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"kafka-logging-system/pkg/producer"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// transactions hands every claim its own transactional producer, named
+// after the claimed partition so a new owner of the partition fences off
+// the previous one
+type transactions struct {
+	config producer.Config //TransactionalID is the prefix of the claims' IDs
+	group  string
+	//a transaction is committed once it holds size messages or is interval old
+	size     int
+	interval time.Duration
+
+	mu      sync.Mutex
+	outputs map[string]*producer.Producer //by claimed topic and partition
+}
+
+func claimKey(topic string, partition int32) string {
+	return fmt.Sprintf("%s/%d", topic, partition)
+}
+
+// open creates the producer of a claim
+func (t *transactions) open(topic string, partition int32) (*producer.Producer, error) {
+	cfg := t.config
+	cfg.TransactionalID = fmt.Sprintf("%s-%s-%d", t.config.TransactionalID, topic, partition)
+	out, err := producer.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	t.outputs[claimKey(topic, partition)] = out
+	t.mu.Unlock()
+	return out, nil
+}
+
+// output returns the producer of the claim a message was read from
+func (t *transactions) output(message *sarama.ConsumerMessage) (*producer.Producer, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out, ok := t.outputs[claimKey(message.Topic, message.Partition)]
+	return out, ok
+}
+
+// close releases the producer of a claim
+func (t *transactions) close(topic string, partition int32) {
+	t.mu.Lock()
+	out := t.outputs[claimKey(topic, partition)]
+	delete(t.outputs, claimKey(topic, partition))
+	t.mu.Unlock()
+
+	if err := out.Close(); err != nil {
+		slog.Error("Error closing transactional producer", "topic", topic, "partition", partition, "err", err)
+	}
+}
+
+// consumeTransactional processes the messages of a claim in transactions,
+// each committing the consumed offsets together with what was published
+// for them. A failed transaction is aborted and the session ended, so its
+// messages are consumed again from the last committed offset.
+func (p *Processor) consumeTransactional(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	out, err := p.txns.open(claim.Topic(), claim.Partition())
+	if err != nil {
+		return err
+	}
+	defer p.txns.close(claim.Topic(), claim.Partition())
+
+	ticker := time.NewTicker(p.txns.interval)
+	defer ticker.Stop()
+
+	pending := 0 //messages in the open transaction
+	abort := func(cause error) error {
+		p.metrics.Aborted.Add(1)
+		if err := out.AbortTxn(); err != nil {
+			slog.Error("Error aborting transaction", "topic", claim.Topic(), "partition", claim.Partition(), "err", err)
+		}
+		pending = 0
+		return cause
+	}
+	commit := func() error {
+		if pending == 0 {
+			return nil
+		}
+		if err := out.CommitTxn(); err != nil {
+			return abort(err)
+		}
+		p.metrics.Committed.Add(1)
+		pending = 0
+		return nil
+	}
+
+	for {
+		select {
+		case message := <-claim.Messages():
+			if message == nil {
+				return commit()
+			}
+
+			if pending == 0 {
+				if err := out.BeginTxn(); err != nil {
+					return err
+				}
+			}
+			pending++
+			if err := p.handler.Handle(session.Context(), message); err != nil {
+				if session.Context().Err() != nil {
+					return abort(nil)
+				}
+				return abort(err)
+			}
+			if err := out.AddMessageToTxn(message, p.txns.group); err != nil {
+				return abort(err)
+			}
+
+			if pending >= p.txns.size {
+				if err := commit(); err != nil {
+					return err
+				}
+			}
+
+		case <-ticker.C:
+			if err := commit(); err != nil {
+				return err
+			}
+
+		case <-session.Context().Done():
+			//the partition is still owned until the claim returns
+			return commit()
+		}
+	}
+}
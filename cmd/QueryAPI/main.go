@@ -0,0 +1,491 @@
+// This application stores logs and serves them through a search API
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"kafka-logging-system/internal/buildinfo"
+	"kafka-logging-system/internal/dashboard"
+	"kafka-logging-system/internal/debugserver"
+	"kafka-logging-system/internal/envelope"
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/internal/livetail"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/processor"
+	"kafka-logging-system/internal/selflog"
+	"kafka-logging-system/internal/store"
+	"kafka-logging-system/internal/topk"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Ingester writes consumed logs to the store in batches, marking offsets
+// only once a batch is saved
+type Ingester struct {
+	ready chan bool
+	store store.Store
+	//hub streams saved entries to the dashboard and other WebSocket clients
+	hub *livetail.Hub
+	//noisy tracks the loudest applications and messages among saved entries
+	noisy *topk.Sources
+
+	batchSize     int
+	flushInterval time.Duration
+	//format decodes messages without a content-type header
+	format models.Format
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (in *Ingester) Setup(sarama.ConsumerGroupSession) error {
+	close(in.ready)
+	return nil
+}
+
+// Cleanup is run at the end of the session, once all ConsumeClaim goroutines have exited
+func (in *Ingester) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (in *Ingester) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ticker := time.NewTicker(in.flushInterval)
+	defer ticker.Stop()
+
+	var batch []*models.LogEntry
+	var last *sarama.ConsumerMessage
+	flush := func() error {
+		if last == nil {
+			return nil
+		}
+		if len(batch) > 0 {
+			if err := in.store.Insert(session.Context(), batch); err != nil {
+				return fmt.Errorf("failed to store %d entries %w", len(batch), err)
+			}
+			now := time.Now()
+			for _, entry := range batch {
+				in.hub.Publish(entry)
+				in.noisy.Observe(entry, now)
+			}
+		}
+		session.MarkMessage(last, "")
+		batch, last = batch[:0], nil
+		return nil
+	}
+
+	for {
+		select {
+		case message := <-claim.Messages():
+			if message == nil {
+				return flush()
+			}
+
+			entries, err := envelope.DecodeAll(message, in.format)
+			if err != nil {
+				slog.Error("Error parsing the log message", "err", err)
+			}
+			batch = append(batch, entries...)
+			last = message
+
+			if len(batch) >= in.batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+
+		case <-session.Context().Done():
+			//unsaved entries are read again by the next owner of the partition
+			return nil
+		}
+	}
+}
+
+// API serves stored logs over HTTP
+type API struct {
+	store store.Store
+	hub   *livetail.Hub
+	noisy *topk.Sources
+}
+
+func (api *API) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("GET /", dashboard.Handler())
+	mux.Handle("GET /ws", api.hub)
+	mux.HandleFunc("GET /logs", api.handleLogs)
+	mux.HandleFunc("GET /stats", api.handleStats)
+	mux.HandleFunc("GET /patterns", api.handlePatterns)
+	mux.HandleFunc("GET /latency", api.handleLatency)
+	mux.HandleFunc("GET /timeline", api.handleTimeline)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "build": buildinfo.Get()})
+	})
+	return mux
+}
+
+// handleLogs serves GET /logs?app=AuthService&level=ERROR&from=...&to=...&q=timeout
+func (api *API) handleLogs(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	page, err := api.store.Query(r.Context(), q)
+	switch {
+	case errors.Is(err, store.ErrInvalidCursor):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	case err != nil:
+		slog.Error("Error querying logs", "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if page.Entries == nil {
+		page.Entries = []*models.LogEntry{}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// handleStats serves GET /stats?from=1h&bucket=1m, entry counts per bucket, application and level,
+// with the loudest applications and messages ingested recently
+func (api *API) handleStats(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	from, err := parseTime(params.Get("from"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from " + err.Error()})
+		return
+	}
+	if from.IsZero() {
+		from = time.Now().Add(-time.Hour)
+	}
+
+	bucket := time.Minute
+	if b := params.Get("bucket"); b != "" {
+		if bucket, err = time.ParseDuration(b); err != nil || bucket < time.Second {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "bucket must be a duration of at least 1s"})
+			return
+		}
+	}
+
+	counts, err := api.store.Counts(r.Context(), from, time.Time{}, bucket)
+	if err != nil {
+		slog.Error("Error counting logs", "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if counts == nil {
+		counts = []store.Count{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"counts": counts, "noisy": api.noisy.Top(time.Now())})
+}
+
+// handlePatterns serves GET /patterns?app=AuthService&from=1h&limit=10, the most frequent patterns per application
+func (api *API) handlePatterns(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	from, err := parseTime(params.Get("from"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from " + err.Error()})
+		return
+	}
+	if from.IsZero() {
+		from = time.Now().Add(-time.Hour)
+	}
+
+	limit := 10
+	if l := params.Get("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit <= 0 || limit > store.MaxLimit {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", store.MaxLimit)})
+			return
+		}
+	}
+
+	patterns, err := api.store.Patterns(r.Context(), from, params.Get("app"), limit)
+	if err != nil {
+		slog.Error("Error counting patterns", "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if patterns == nil {
+		patterns = []store.PatternCount{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"patterns": patterns})
+}
+
+// handleLatency serves GET /latency?app=AuthService&from=1h&to=..., duration percentiles per application
+func (api *API) handleLatency(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	from, err := parseTime(params.Get("from"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid from " + err.Error()})
+		return
+	}
+	if from.IsZero() {
+		from = time.Now().Add(-time.Hour)
+	}
+	to, err := parseTime(params.Get("to"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid to " + err.Error()})
+		return
+	}
+
+	latencies, err := api.store.Latencies(r.Context(), from, to, params.Get("app"))
+	if err != nil {
+		slog.Error("Error computing latencies", "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if latencies == nil {
+		latencies = []store.Latency{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"latencies": latencies})
+}
+
+// Timeline is every entry of one trace or request across applications, oldest first
+type Timeline struct {
+	TraceID   string    `json:"trace_id,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	//Applications are in the order they first appear
+	Applications []string           `json:"applications"`
+	Entries      []*models.LogEntry `json:"entries"`
+	//Truncated is set when the trace has more entries than were returned
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// handleTimeline serves GET /timeline?trace_id=...&request_id=..., the correlated entries of a trace or request
+func (api *API) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	timeline := Timeline{TraceID: params.Get("trace_id"), RequestID: params.Get("request_id")}
+	if timeline.TraceID == "" && timeline.RequestID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "trace_id or request_id is required"})
+		return
+	}
+
+	limit := store.MaxCorrelated
+	if l := params.Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit <= 0 || limit > store.MaxCorrelated {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", store.MaxCorrelated)})
+			return
+		}
+	}
+
+	entries, truncated, err := api.store.Correlated(r.Context(), timeline.TraceID, timeline.RequestID, limit)
+	if err != nil {
+		slog.Error("Error querying correlated logs", "err", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "query failed"})
+		return
+	}
+	if len(entries) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no entries found"})
+		return
+	}
+
+	timeline.Entries, timeline.Truncated = entries, truncated
+	timeline.Start, timeline.End = entries[0].Timestamp, entries[len(entries)-1].Timestamp
+	for _, entry := range entries {
+		if !slices.Contains(timeline.Applications, entry.Application) {
+			timeline.Applications = append(timeline.Applications, entry.Application)
+		}
+	}
+	writeJSON(w, http.StatusOK, timeline)
+}
+
+func parseQuery(r *http.Request) (store.Query, error) {
+	params := r.URL.Query()
+	q := store.Query{
+		Application: params.Get("app"),
+		Text:        params.Get("q"),
+		TraceID:     params.Get("trace_id"),
+		RequestID:   params.Get("request_id"),
+		ErrorType:   params.Get("error_type"),
+		Cursor:      params.Get("cursor"),
+	}
+
+	if levels := params.Get("level"); levels != "" {
+		for _, name := range strings.Split(levels, ",") {
+			level, err := models.ParseLevel(strings.TrimSpace(name))
+			if err != nil {
+				return store.Query{}, err
+			}
+			q.Levels = append(q.Levels, level)
+		}
+	}
+
+	var err error
+	if q.From, err = parseTime(params.Get("from")); err != nil {
+		return store.Query{}, fmt.Errorf("invalid from %w", err)
+	}
+	if q.To, err = parseTime(params.Get("to")); err != nil {
+		return store.Query{}, fmt.Errorf("invalid to %w", err)
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit <= 0 {
+			return store.Query{}, fmt.Errorf("invalid limit %q", limit)
+		}
+	}
+	return q, nil
+}
+
+// parseTime accepts RFC3339 or a duration before now such as 15m
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error writing response", "err", err)
+	}
+}
+
+func main() {
+	dbPath := flag.String("db", "logs.db", "SQLite database the logs are stored in")
+	listen := flag.String("listen", ":8080", "address the API listens on")
+	ingest := flag.Bool("ingest", true, "consume logs into the store, disable to serve a store filled elsewhere")
+	group := flag.String("group", "log-queryapi-group", "consumer group id")
+	input := flag.String("input", processor.DefaultOutputTopic, "topic to store logs from")
+	batchSize := flag.Int("batch", 500, "entries written per transaction")
+	flushInterval := flag.Duration("flush-interval", time.Second, "maximum time entries wait before being written")
+	formatName := flag.String("format", string(models.FormatJSON), "wire format of messages without a content-type header: json, protobuf, logfmt, msgpack or cbor")
+	noisyTop := flag.Int("noisy-top", 10, "loudest applications and messages listed by /stats")
+	noisyWindow := flag.Duration("noisy-window", 5*time.Minute, "sliding window the loudest applications and messages are counted over")
+	kafka := kafkaconfig.Default()
+	kafka.ClientID = "log-queryapi"
+	kafka.RegisterFlags(flag.CommandLine, "")
+	membership := kafkaconfig.DefaultGroup()
+	membership.RegisterFlags(flag.CommandLine, "")
+	logs := selflog.Default()
+	logs.RegisterFlags(flag.CommandLine)
+	var debug debugserver.Config
+	debug.RegisterFlags(flag.CommandLine)
+	buildinfo.RegisterFlag(flag.CommandLine, "log-queryapi")
+	flag.Parse()
+
+	closeLogs, err := selflog.Setup(logs, "log-queryapi", kafka, *input)
+	if err != nil {
+		selflog.Fatal("Error setting up logging", "err", err)
+	}
+	defer closeLogs()
+	slog.Info("Starting", buildinfo.Get().Attrs()...)
+
+	closeDebug, err := debugserver.Start(debug, "log-queryapi")
+	if err != nil {
+		selflog.Fatal("Error starting debug server", "err", err)
+	}
+	defer closeDebug()
+
+	format, err := models.ParseFormat(*formatName)
+	if err != nil {
+		selflog.Fatal(err.Error())
+	}
+
+	db, err := store.OpenSQLite(*dbPath)
+	if err != nil {
+		selflog.Fatal("Error opening store", "err", err)
+	}
+	defer db.Close()
+
+	hub := livetail.NewHub(livetail.DefaultBuffer)
+	noisy := topk.NewSources(*noisyTop, *noisyWindow)
+
+	//Cancel consumption on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	done := make(chan struct{})
+	if *ingest {
+		config := kafka.Sarama()
+		if err := membership.Apply(config); err != nil {
+			selflog.Fatal(err.Error())
+		}
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest //start from the beginning if no offset
+
+		brokers, err := kafka.Addrs(ctx)
+		if err != nil {
+			selflog.Fatal(err.Error())
+		}
+		client, err := sarama.NewConsumerGroup(brokers, *group, config)
+		if err != nil {
+			selflog.Fatal("Error creating consumerGroup client", "err", err)
+		}
+		defer client.Close()
+
+		handler := &Ingester{
+			ready:         make(chan bool),
+			store:         db,
+			hub:           hub,
+			noisy:         noisy,
+			batchSize:     *batchSize,
+			flushInterval: *flushInterval,
+			format:        format,
+		}
+
+		go func() {
+			defer close(done)
+			for ctx.Err() == nil {
+				if err := client.Consume(ctx, []string{*input}, handler); err != nil {
+					if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+						return
+					}
+					slog.Error("Error from ingest session, retrying", "err", err)
+					time.Sleep(time.Second)
+				}
+				handler.ready = make(chan bool)
+			}
+		}()
+
+		go func() {
+			select {
+			case <-handler.ready:
+				slog.Info("Ingest started", "group", *group, "input", *input, "db", *dbPath)
+			case <-ctx.Done():
+			}
+		}()
+	} else {
+		close(done)
+	}
+
+	api := &API{store: db, hub: hub, noisy: noisy}
+	server := &http.Server{Addr: *listen, Handler: api.routes(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error from API server", "err", err)
+			stop()
+		}
+	}()
+	slog.Info("Query API and dashboard listening", "addr", *listen)
+
+	<-ctx.Done()
+	slog.Info("Terminating Query API...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error shutting down API server", "err", err)
+	}
+	<-done
+}
@@ -0,0 +1,79 @@
+// This application writes a daily report of the stored logs per application
+package main
+
+import (
+	"context"
+	"flag"
+	"kafka-logging-system/internal/buildinfo"
+	"kafka-logging-system/internal/report"
+	"kafka-logging-system/internal/selflog"
+	"kafka-logging-system/internal/store"
+	"log/slog"
+	"os"
+	"time"
+)
+
+func main() {
+	dbPath := flag.String("db", "logs.db", "SQLite database of the Query API the logs are read from")
+	date := flag.String("date", "", "day reported as YYYY-MM-DD (default yesterday)")
+	zone := flag.String("tz", "Local", "time zone the day starts in, such as UTC or Europe/Berlin")
+	format := flag.String("format", report.FormatMarkdown, "report format: json, markdown or html")
+	output := flag.String("output", "", "file the report is written to (default stdout)")
+	top := flag.Int("top", 5, "top error messages listed per application")
+	slack := flag.String("slack-webhook", os.Getenv("SLACK_WEBHOOK_URL"), "Slack incoming webhook the overview is posted to (or SLACK_WEBHOOK_URL)")
+	timeout := flag.Duration("timeout", 5*time.Minute, "how long the report may take")
+	buildinfo.RegisterFlag(flag.CommandLine, "log-report")
+	flag.Parse()
+
+	switch *format {
+	case report.FormatJSON, report.FormatMarkdown, report.FormatHTML:
+	default:
+		selflog.Fatal("Unknown report format, expected json, markdown or html", "format", *format)
+	}
+	loc, err := time.LoadLocation(*zone)
+	if err != nil {
+		selflog.Fatal("Unknown time zone", "tz", *zone, "err", err)
+	}
+	day := time.Now().In(loc).AddDate(0, 0, -1)
+	if *date != "" {
+		if day, err = time.ParseInLocation(time.DateOnly, *date, loc); err != nil {
+			selflog.Fatal("Invalid date, expected YYYY-MM-DD", "date", *date)
+		}
+	}
+
+	db, err := store.OpenSQLite(*dbPath)
+	if err != nil {
+		selflog.Fatal("Error opening store", "err", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	r, err := report.Build(ctx, db, day, loc, *top)
+	if err != nil {
+		selflog.Fatal("Error building report", "err", err)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			selflog.Fatal("Error creating report file", "err", err)
+		}
+	}
+	if err := r.Write(out, *format); err != nil {
+		selflog.Fatal("Error writing report", "err", err)
+	}
+	if out != os.Stdout {
+		if err := out.Close(); err != nil {
+			selflog.Fatal("Error writing report", "err", err)
+		}
+		slog.Info("Report written", "day", r.Day, "file", *output)
+	}
+
+	if *slack != "" {
+		if err := r.PostSlack(ctx, *slack); err != nil {
+			selflog.Fatal("Error posting report to Slack", "err", err)
+		}
+		slog.Info("Report posted to Slack", "day", r.Day)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kafka-logging-system/internal/aggregator"
+	"kafka-logging-system/internal/processor"
+	"kafka-logging-system/pkg/producer"
+
+	"github.com/IBM/sarama"
+)
+
+var adminCmd = &command{
+	name:  "admin",
+	usage: "<subcommand>",
+	short: "Manage the pipeline's topics and inspect consumer groups",
+	run:   runAdmin,
+}
+
+// adminCommands are named "admin <subcommand>" so their usage reads as typed
+var adminCommands = []*command{
+	{name: "admin bootstrap", usage: "[topic...]", short: "Create the pipeline topics, skipping ones that exist", run: runBootstrap},
+	{name: "admin topics", usage: "[topic...]", short: "Describe topics, all of them when none are given", run: runDescribeTopics},
+	{name: "admin groups", usage: "[group...]", short: "Describe consumer groups with their members and lag", run: runDescribeGroups},
+	{name: "admin retention", usage: "topic...", short: "Change the retention of existing topics", run: runRetention},
+	{name: "admin reset-offsets", short: "Move a stopped consumer group's offsets to replay or skip logs", run: runResetOffsets},
+}
+
+// pipelineTopics are created by bootstrap when no topics are given
+var pipelineTopics = []string{
+	producer.DefaultTopic,
+	processor.DefaultOutputTopic,
+	processor.DefaultDLQTopic,
+	aggregator.DefaultTopic,
+}
+
+func runAdmin(cmd *command, args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		var b strings.Builder
+		fmt.Fprintf(&b, "Usage: klog admin <subcommand> [flags]\n\n%s\n\nSubcommands:\n", cmd.short)
+		for _, sub := range adminCommands {
+			fmt.Fprintf(&b, "  %-14s %s\n", strings.TrimPrefix(sub.name, "admin "), sub.short)
+		}
+		fmt.Fprint(os.Stderr, b.String())
+		return flag.ErrHelp
+	}
+
+	for _, sub := range adminCommands {
+		if sub.name == "admin "+args[0] {
+			return sub.run(sub, args[1:])
+		}
+	}
+	return fmt.Errorf("unknown subcommand %q", args[0])
+}
+
+// newAdmin connects a cluster admin, closing it also closes the client
+func newAdmin(globals *globalOptions) (sarama.Client, sarama.ClusterAdmin, error) {
+	config := globals.kafka.Sarama()
+	//incremental config changes need 2.3
+	if !config.Version.IsAtLeast(sarama.V2_3_0_0) {
+		config.Version = sarama.V2_3_0_0
+	}
+	//offset resets commit explicitly and need to see commit errors
+	config.Consumer.Offsets.AutoCommit.Enable = false
+	config.Consumer.Return.Errors = true
+
+	client, err := globals.newClient(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to kafka %w", err)
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("failed to create cluster admin %w", err)
+	}
+	return client, admin, nil
+}
+
+// retentionMs converts a duration such as 168h, or forever, to a retention.ms value
+func retentionMs(retention string) (string, error) {
+	if retention == "forever" {
+		return "-1", nil
+	}
+	d, err := time.ParseDuration(retention)
+	if err != nil || d <= 0 {
+		return "", fmt.Errorf("invalid retention %q, expected a positive duration or forever", retention)
+	}
+	return strconv.FormatInt(d.Milliseconds(), 10), nil
+}
+
+func runBootstrap(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	partitions := fs.Int("partitions", 3, "partitions per topic")
+	replication := fs.Int("replication", 1, "replication factor")
+	retention := fs.String("retention", "", "retention such as 168h, or forever (default broker setting)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs()
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+
+	topics := fs.Args()
+	if len(topics) == 0 {
+		topics = pipelineTopics
+	}
+
+	detail := &sarama.TopicDetail{
+		NumPartitions:     int32(*partitions),
+		ReplicationFactor: int16(*replication),
+	}
+	if *retention != "" {
+		ms, err := retentionMs(*retention)
+		if err != nil {
+			return err
+		}
+		detail.ConfigEntries = map[string]*string{"retention.ms": &ms}
+	}
+
+	_, admin, err := newAdmin(globals)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	var errs []error
+	for _, topic := range topics {
+		err := admin.CreateTopic(topic, detail, false)
+		switch {
+		case errors.Is(err, sarama.ErrTopicAlreadyExists):
+			fmt.Printf("%s already exists\n", topic)
+		case err != nil:
+			errs = append(errs, fmt.Errorf("failed to create %s %w", topic, err))
+		default:
+			fmt.Printf("created %s with %d partitions, replication %d\n", topic, *partitions, *replication)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func runDescribeTopics(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs()
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+
+	_, admin, err := newAdmin(globals)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	topics := fs.Args()
+	if len(topics) == 0 {
+		all, err := admin.ListTopics()
+		if err != nil {
+			return fmt.Errorf("failed to list topics %w", err)
+		}
+		for name := range all {
+			topics = append(topics, name)
+		}
+		sort.Strings(topics)
+	}
+
+	metadata, err := admin.DescribeTopics(topics)
+	if err != nil {
+		return fmt.Errorf("failed to describe topics %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tPARTITIONS\tREPLICATION\tRETENTION\tUNDER-REPLICATED")
+	for _, topic := range metadata {
+		if topic.Err != sarama.ErrNoError {
+			fmt.Fprintf(w, "%s\t%v\t\t\t\n", topic.Name, topic.Err)
+			continue
+		}
+
+		replication, underReplicated := 0, 0
+		for _, p := range topic.Partitions {
+			replication = max(replication, len(p.Replicas))
+			if len(p.Isr) < len(p.Replicas) {
+				underReplicated++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\n", topic.Name, len(topic.Partitions), replication, topicRetention(admin, topic.Name), underReplicated)
+	}
+	return w.Flush()
+}
+
+// topicRetention reads retention.ms for display
+func topicRetention(admin sarama.ClusterAdmin, topic string) string {
+	entries, err := admin.DescribeConfig(sarama.ConfigResource{
+		Type:        sarama.TopicResource,
+		Name:        topic,
+		ConfigNames: []string{"retention.ms"},
+	})
+	if err != nil || len(entries) == 0 {
+		return "?"
+	}
+
+	ms, err := strconv.ParseInt(entries[0].Value, 10, 64)
+	switch {
+	case err != nil:
+		return entries[0].Value
+	case ms < 0:
+		return "forever"
+	default:
+		return (time.Duration(ms) * time.Millisecond).String()
+	}
+}
+
+func runDescribeGroups(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs()
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+
+	client, admin, err := newAdmin(globals)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	groups := fs.Args()
+	if len(groups) == 0 {
+		all, err := admin.ListConsumerGroups()
+		if err != nil {
+			return fmt.Errorf("failed to list consumer groups %w", err)
+		}
+		for name := range all {
+			groups = append(groups, name)
+		}
+		sort.Strings(groups)
+	}
+
+	descriptions, err := admin.DescribeConsumerGroups(groups)
+	if err != nil {
+		return fmt.Errorf("failed to describe consumer groups %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, group := range descriptions {
+		fmt.Fprintf(w, "GROUP %s\tstate %s\tmembers %d\n", group.GroupId, group.State, len(group.Members))
+
+		members := make([]string, 0, len(group.Members))
+		for _, m := range group.Members {
+			members = append(members, fmt.Sprintf("  member %s\t%s\t%s", m.MemberId, m.ClientId, m.ClientHost))
+		}
+		slices.Sort(members)
+		for _, m := range members {
+			fmt.Fprintln(w, m)
+		}
+
+		offsets, err := admin.ListConsumerGroupOffsets(group.GroupId, nil)
+		if err != nil {
+			fmt.Fprintf(w, "  offsets unavailable: %v\n", err)
+			continue
+		}
+
+		fmt.Fprintln(w, "  TOPIC\tPARTITION\tCOMMITTED\tEND\tLAG")
+		for _, topic := range sortedKeys(offsets.Blocks) {
+			for _, partition := range sortedKeys(offsets.Blocks[topic]) {
+				committed := offsets.Blocks[topic][partition].Offset
+				end, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+				if err != nil {
+					fmt.Fprintf(w, "  %s\t%d\t%d\t?\t?\n", topic, partition, committed)
+					continue
+				}
+				lag := "-"
+				if committed >= 0 {
+					lag = strconv.FormatInt(end-committed, 10)
+				}
+				fmt.Fprintf(w, "  %s\t%d\t%d\t%d\t%s\n", topic, partition, committed, end, lag)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+func sortedKeys[K string | int32, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func runRetention(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	retention := fs.String("retention", "", "new retention such as 72h, or forever")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs()
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+	if fs.NArg() == 0 || *retention == "" {
+		fs.Usage()
+		return errors.New("a -retention and at least one topic are required")
+	}
+	ms, err := retentionMs(*retention)
+	if err != nil {
+		return err
+	}
+
+	_, admin, err := newAdmin(globals)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	var errs []error
+	for _, topic := range fs.Args() {
+		//incremental so other topic overrides are kept
+		err := admin.IncrementalAlterConfig(sarama.TopicResource, topic, map[string]sarama.IncrementalAlterConfigsEntry{
+			"retention.ms": {Operation: sarama.IncrementalAlterConfigsOperationSet, Value: &ms},
+		}, false)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to set retention of %s %w", topic, err))
+			continue
+		}
+		fmt.Printf("%s retention set to %s\n", topic, *retention)
+	}
+	return errors.Join(errs...)
+}
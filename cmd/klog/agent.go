@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/ingest"
+	"kafka-logging-system/internal/kube"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/tailer"
+	"kafka-logging-system/pkg/producer"
+)
+
+var agentCmd = &command{
+	name:  "agent",
+	usage: "pattern...",
+	short: "Follow log files matching glob patterns and ship their lines",
+	run:   runAgent,
+}
+
+// ingestOptions choose how input lines become entries
+type ingestOptions struct {
+	parser     *string
+	pattern    *string
+	timeLayout *string
+	app        *string
+	level      *string
+	metadata   metadataFlag
+}
+
+func registerIngestFlags(fs *flag.FlagSet, defaultApp string) *ingestOptions {
+	o := &ingestOptions{
+		parser:     fs.String("parser", "auto", "how lines are parsed: auto (JSON objects, logfmt or plain text), json, logfmt or regex"),
+		pattern:    fs.String("pattern", "", "regex parser: named groups timestamp, level, application, message and ids set those fields, others become metadata"),
+		timeLayout: fs.String("time-layout", time.RFC3339Nano, "regex parser: Go layout of the timestamp group"),
+		app:        fs.String("app", defaultApp, "application of entries that don't name one"),
+		level:      fs.String("level", string(models.INFO), "level of entries that don't have one"),
+		metadata:   metadataFlag{},
+	}
+	fs.Var(o.metadata, "meta", "metadata key=value added to every entry, may be repeated")
+	return o
+}
+
+// build returns the parser and the defaults once flags have been parsed
+func (o *ingestOptions) build() (ingest.Parser, *ingest.Defaults, error) {
+	parser, err := ingest.NewParser(*o.parser, *o.pattern, *o.timeLayout)
+	if err != nil {
+		return nil, nil, err
+	}
+	level, err := models.ParseLevel(*o.level)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parser, &ingest.Defaults{Application: *o.app, Level: level, Metadata: o.metadata}, nil
+}
+
+// ingestStats count what became of the lines read by an input
+type ingestStats struct {
+	sent, skipped, failed int64
+}
+
+func (s *ingestStats) String() string {
+	return fmt.Sprintf("sent %d logs, skipped %d invalid lines, %d failed", s.sent, s.skipped, s.failed)
+}
+
+func runAgent(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	opts := registerProducerFlags(fs)
+	daemon := registerDaemonFlags(fs)
+	in := registerIngestFlags(fs, "")
+	positions := fs.String("positions", "klog-positions.json", "file keeping how far every log file was read, empty to always start over")
+	poll := fs.Duration("poll-interval", time.Second, "how often files are checked for new lines, rotation and new matches")
+	fromStart := fs.Bool("from-start", false, "read files found at startup from the beginning instead of only new lines")
+	kubeOpts := registerKubeFlags(fs)
+	drainTimeout := registerDrainFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs()
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+	patterns := fs.Args()
+	if len(patterns) == 0 && *kubeOpts.enabled {
+		patterns = []string{kube.LogDir + "/*.log"}
+	}
+	if len(patterns) == 0 {
+		fs.Usage()
+		return errors.New("at least one file pattern is required")
+	}
+
+	parser, defaults, err := in.build()
+	if err != nil {
+		return err
+	}
+	k8s, err := kubeOpts.build()
+	if err != nil {
+		return err
+	}
+	t, err := tailer.New(tailer.Config{
+		Patterns:      patterns,
+		PositionsFile: *positions,
+		PollInterval:  *poll,
+		FromStart:     *fromStart,
+		MaxLineSize:   maxLineSize,
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg := opts.config(globals)
+	p, err := producer.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create producer %w", err)
+	}
+
+	//Handle graceful shutdown
+	ctx, stop := signalContext()
+	defer stop()
+	if err := daemon.startProducer(ctx, globals, p, cfg); err != nil {
+		return err
+	}
+
+	//Every file gets its own defaults, naming the app after the file unless
+	//-app is set, or after the pod in Kubernetes mode. Nil skips the file.
+	perFile := make(map[string]*ingest.Defaults)
+	fileDefaults := func(path string) *ingest.Defaults {
+		d, ok := perFile[path]
+		if ok {
+			return d
+		}
+		if k8s != nil {
+			if d, ok = k8s.defaults(ctx, path, defaults); !ok {
+				d = nil
+			}
+		} else {
+			d = &ingest.Defaults{Application: defaults.Application, Level: defaults.Level, Metadata: maps.Clone(defaults.Metadata)}
+			if d.Application == "" {
+				d.Application, _, _ = strings.Cut(filepath.Base(path), ".")
+			}
+			if d.Metadata == nil {
+				d.Metadata = make(map[string]any)
+			}
+		}
+		if d != nil {
+			d.Metadata["file"] = path
+		}
+		perFile[path] = d
+		return d
+	}
+
+	slog.Info("Following files", "patterns", patterns)
+	fmt.Println("Ctrl-C to stop...")
+
+	stats := &ingestStats{}
+	err = t.Run(ctx, func(line tailer.Line) error {
+		if len(strings.TrimSpace(string(line.Data))) == 0 {
+			return nil
+		}
+		d := fileDefaults(line.Path)
+		if d == nil {
+			return nil
+		}
+
+		data, now, stream := line.Data, time.Now(), ""
+		if k8s != nil {
+			rec, complete, err := k8s.record(line.Path, line.Data)
+			if err != nil {
+				slog.Warn("Skipping line", "path", line.Path, "err", err)
+				stats.skipped++
+				return nil
+			}
+			if !complete {
+				return nil
+			}
+			data, stream = rec.Message, rec.Stream
+			if len(bytes.TrimSpace(data)) == 0 {
+				return nil
+			}
+			if !rec.Time.IsZero() {
+				now = rec.Time
+			}
+		}
+
+		entry, err := parser.Parse(data, d, now)
+		if err != nil {
+			slog.Warn("Skipping line", "path", line.Path, "err", err)
+			stats.skipped++
+			return nil
+		}
+		if k8s == nil {
+			_, _, err = p.Send(entry)
+		} else {
+			if stream != "" && entry.Metadata != nil {
+				entry.Metadata["stream"] = stream
+			}
+			if topic := k8s.topic(d); topic != "" {
+				_, _, err = p.SendTo(topic, entry)
+			} else {
+				_, _, err = p.Send(entry)
+			}
+		}
+		if err != nil {
+			slog.Error("Error sending log", "err", err)
+			stats.failed++
+			return nil
+		}
+		stats.sent++
+		return nil
+	})
+
+	slog.Info("Agent stopped", "stats", stats.String())
+	if derr := drain(*drainTimeout, "buffered messages", p.Close); err == nil {
+		err = derr
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+
+	"kafka-logging-system/internal/models"
+)
+
+// appColors are 256-color codes distinct enough to tell services apart
+var appColors = []int{33, 39, 45, 70, 76, 99, 135, 141, 166, 172, 178, 205, 208, 214}
+
+// palette decides how entries are colored
+type palette struct {
+	enabled bool
+	//byApp colors lines by a hash of the application, keeping the level colored
+	byApp bool
+}
+
+// newPalette enables colors unless NO_COLOR is set, -no-color was given or
+// stdout isn't a terminal
+func newPalette(noColor bool, colorBy string) (palette, error) {
+	if colorBy != "level" && colorBy != "app" {
+		return palette{}, fmt.Errorf("unknown -color-by %q, expected level or app", colorBy)
+	}
+	_, noColorEnv := os.LookupEnv("NO_COLOR")
+	return palette{
+		enabled: !noColor && !noColorEnv && isTerminal(os.Stdout),
+		byApp:   colorBy == "app",
+	}, nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// level returns the escape code of a level
+func (p palette) level(level models.LogLevel) string {
+	if !p.enabled {
+		return ""
+	}
+	return levelColors[level]
+}
+
+// line returns the escape code a whole entry is printed in
+func (p palette) line(entry *models.LogEntry) string {
+	switch {
+	case !p.enabled:
+		return ""
+	case p.byApp:
+		return p.app(entry.Application)
+	}
+	color, ok := levelColors[entry.Level]
+	if !ok {
+		return colorReset
+	}
+	return color
+}
+
+// dim returns the escape code of secondary text such as stack traces
+func (p palette) dim() string {
+	if !p.enabled {
+		return ""
+	}
+	return colorDim
+}
+
+func (p palette) reset() string {
+	if !p.enabled {
+		return ""
+	}
+	return colorReset
+}
+
+// app returns the escape code of an application, picked by hashing its name
+func (p palette) app(application string) string {
+	if !p.enabled {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(application))
+	return fmt.Sprintf("\033[38;5;%dm", appColors[h.Sum32()%uint32(len(appColors))])
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Offset commit strategies of consume
+const (
+	//commitAuto marks processed messages and lets sarama commit them every interval
+	commitAuto = "auto"
+	//commitBatch commits after a number of messages or a duration, whichever comes first
+	commitBatch = "batch"
+	//commitAck only marks a message once its sink acknowledged it and commits right away
+	commitAck = "ack"
+)
+
+type commitOptions struct {
+	mode     *string
+	interval *time.Duration
+	messages *int
+}
+
+func registerCommitFlags(fs *flag.FlagSet) *commitOptions {
+	return &commitOptions{
+		mode:     fs.String("commit", commitAuto, "offset commit strategy: auto, batch or ack"),
+		interval: fs.Duration("commit-interval", time.Second, "auto and batch: how often marked offsets are committed (0 disables the timer in batch)"),
+		messages: fs.Int("commit-messages", 1000, "batch: commit after this many messages (0 disables the count)"),
+	}
+}
+
+// committer marks and commits offsets of processed messages following the commit strategy
+type committer struct {
+	mode     string
+	interval time.Duration
+	every    int
+
+	//mu guards the batch count shared by every claim of a session
+	mu     sync.Mutex
+	marked int
+}
+
+// committer validates the flags and configures sarama's auto commit for the strategy
+func (o *commitOptions) committer(config *sarama.Config) (*committer, error) {
+	c := &committer{mode: *o.mode, interval: *o.interval, every: *o.messages}
+
+	switch c.mode {
+	case commitAuto:
+		if c.interval <= 0 {
+			return nil, fmt.Errorf("-commit-interval must be positive with -commit auto")
+		}
+		config.Consumer.Offsets.AutoCommit.Interval = c.interval
+	case commitBatch:
+		if c.interval <= 0 && c.every <= 0 {
+			return nil, fmt.Errorf("-commit batch needs -commit-interval or -commit-messages")
+		}
+		config.Consumer.Offsets.AutoCommit.Enable = false
+	case commitAck:
+		config.Consumer.Offsets.AutoCommit.Enable = false
+	default:
+		return nil, fmt.Errorf("unknown commit strategy %q, expected auto, batch or ack", c.mode)
+	}
+	return c, nil
+}
+
+// start begins the batch timer of a session, it stops with the session
+func (c *committer) start(session sarama.ConsumerGroupSession) {
+	c.mu.Lock()
+	c.marked = 0
+	c.mu.Unlock()
+
+	if c.mode != commitBatch || c.interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.commit(session)
+			case <-session.Context().Done():
+				return
+			}
+		}
+	}()
+}
+
+// processed records the outcome of a message. In ack mode a failed message
+// is returned as an error, ending the session so it is consumed again from
+// the last committed offset.
+func (c *committer) processed(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage, err error) error {
+	if err != nil && c.mode == commitAck {
+		return fmt.Errorf("sink did not acknowledge %s/%d at offset %d %w", message.Topic, message.Partition, message.Offset, err)
+	}
+	session.MarkMessage(message, "")
+
+	switch c.mode {
+	case commitAck:
+		session.Commit()
+	case commitBatch:
+		c.mu.Lock()
+		c.marked++
+		full := c.every > 0 && c.marked >= c.every
+		c.mu.Unlock()
+		if full {
+			c.commit(session)
+		}
+	}
+	return nil
+}
+
+// commit flushes the marked offsets of a batch
+func (c *committer) commit(session sarama.ConsumerGroupSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.marked == 0 {
+		return
+	}
+	session.Commit()
+	c.marked = 0
+}
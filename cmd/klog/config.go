@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/buildinfo"
+	"kafka-logging-system/internal/debugserver"
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/reload"
+	"kafka-logging-system/internal/selflog"
+	"kafka-logging-system/pkg/producer"
+
+	"github.com/IBM/sarama"
+)
+
+// globalOptions are accepted by every command
+type globalOptions struct {
+	kafka kafkaconfig.Config
+	logs  selflog.Config
+}
+
+func registerGlobals(fs *flag.FlagSet) *globalOptions {
+	g := &globalOptions{kafka: kafkaconfig.Default()}
+	g.kafka.ClientID = "klog"
+	//KLOG_BROKERS overrides the default
+	if brokers := kafkaconfig.SplitList(os.Getenv("KLOG_BROKERS")); len(brokers) > 0 {
+		g.kafka.Brokers = brokers
+	}
+	g.kafka.RegisterFlags(fs, "")
+	g.logs = selflog.Default()
+	g.logs.RegisterFlags(fs)
+	return g
+}
+
+// setupLogs installs the logger of the command once flags have been parsed,
+// consumed are the topics it reads
+func (g *globalOptions) setupLogs(consumed ...string) (func(), error) {
+	return selflog.Setup(g.logs, "klog", g.kafka, consumed...)
+}
+
+// newClient connects to the cluster with config, which should come from
+// g.kafka.Sarama so the connection settings apply
+func (g *globalOptions) newClient(config *sarama.Config) (sarama.Client, error) {
+	brokers, err := g.kafka.Addrs(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return sarama.NewClient(brokers, config)
+}
+
+// producerOptions registers the producer library settings shared by produce and loadgen
+type producerOptions struct {
+	cfg         producer.Config
+	format      *string
+	env         *string
+	acks        *int
+	minLevel    *string
+	overflow    *string
+	pack        *string
+	partitioner *string
+	partition   *int
+}
+
+func registerProducerFlags(fs *flag.FlagSet) *producerOptions {
+	o := &producerOptions{cfg: producer.DefaultConfig()}
+	cfg := &o.cfg
+	fs.StringVar(&cfg.Topic, "topic", cfg.Topic, "topic to produce to")
+	fs.StringVar(&cfg.ProducerID, "producer-id", cfg.ProducerID, "id sent in the producer-id header (default hostname-pid)")
+	o.format = fs.String("format", string(cfg.Format), "wire format: json, protobuf, logfmt, msgpack or cbor")
+	o.env = fs.String("env", string(cfg.Environment), "environment stamped on logs: dev, stage or prod")
+	o.minLevel = fs.String("min-level", "", "drop logs less severe than this level instead of publishing them")
+	fs.BoolVar(&cfg.Idempotent, "idempotent", cfg.Idempotent, "prevent duplicate writes when retrying")
+	o.acks = fs.Int("acks", int(cfg.RequiredAcks), "required acks: -1 all replicas, 1 leader only, 0 none")
+	fs.IntVar(&cfg.RetryMax, "retries", cfg.RetryMax, "retries per message before giving up")
+	fs.DurationVar(&cfg.RetryBackoff, "retry-backoff", cfg.RetryBackoff, "initial wait between retries, doubled on every attempt")
+	fs.DurationVar(&cfg.RetryMaxBackoff, "retry-max-backoff", cfg.RetryMaxBackoff, "upper bound for the wait between retries")
+	fs.IntVar(&cfg.BreakerThreshold, "breaker-threshold", cfg.BreakerThreshold, "consecutive failures before sends are stopped (0 disables)")
+	fs.DurationVar(&cfg.BreakerProbeInterval, "breaker-probe-interval", cfg.BreakerProbeInterval, "how often the broker is probed while sends are stopped")
+	fs.IntVar(&cfg.MaxOpenRequests, "max-open-requests", cfg.MaxOpenRequests, "in-flight requests per broker (0 uses the client default)")
+	fs.BoolVar(&cfg.Async, "async", cfg.Async, "batch messages with an async producer")
+	fs.IntVar(&cfg.FlushMessages, "flush-messages", cfg.FlushMessages, "async: messages per batch")
+	fs.IntVar(&cfg.FlushBytes, "flush-bytes", cfg.FlushBytes, "async: bytes per batch")
+	fs.DurationVar(&cfg.FlushFrequency, "flush-frequency", cfg.FlushFrequency, "async: maximum time between flushes")
+	fs.IntVar(&cfg.MaxInFlight, "max-in-flight", cfg.MaxInFlight, "async: unacknowledged messages before sends block")
+	fs.TextVar(&cfg.Compression, "compression", cfg.Compression, "compression codec: none, gzip, snappy, lz4 or zstd")
+	fs.IntVar(&cfg.CompressionLevel, "compression-level", cfg.CompressionLevel, "codec specific compression level (gzip, zstd)")
+	fs.IntVar(&cfg.PackEntries, "pack", cfg.PackEntries, "logs of one application packed into each message (0 sends one message per log)")
+	fs.DurationVar(&cfg.PackLinger, "pack-linger", cfg.PackLinger, "with -pack, longest a log waits for its message to fill")
+	o.pack = fs.String("pack-compression", string(models.CompressionNone), "with -pack, compression of the logs in a message: none, gzip or zstd")
+	fs.Float64Var(&cfg.RateLimit, "rate-limit", cfg.RateLimit, "logs published per second, 0 for no limit")
+	fs.IntVar(&cfg.RateBurst, "rate-burst", cfg.RateBurst, "logs published at once within the rate limit (default a second's worth)")
+	fs.Func("level-rate-limit", "per level limits on top of -rate-limit, such as DEBUG=100,INFO=1000", func(s string) error {
+		rates, err := producer.ParseLevelRates(s)
+		cfg.LevelRateLimits = rates
+		return err
+	})
+	o.partitioner = fs.String("partitioner", string(cfg.Partitioner), "how logs are spread over partitions: application, field (hash of -partition-field), round-robin or manual (all to -partition)")
+	fs.StringVar(&cfg.PartitionField, "partition-field", cfg.PartitionField, "with -partitioner field, entry field or metadata key hashed, such as trace_id or tenant")
+	o.partition = fs.Int("partition", 0, "with -partitioner manual, partition every log is sent to")
+	fs.Func("level-topic", "per level topics instead of -topic, such as ERROR=raw-logs-errors,FATAL=raw-logs-errors", func(s string) error {
+		topics, err := producer.ParseLevelTopics(s)
+		cfg.LevelTopics = topics
+		return err
+	})
+	o.overflow = fs.String("rate-overflow", string(cfg.Overflow), "logs over a rate limit: block, drop (least severe first) or sample")
+	fs.IntVar(&cfg.SampleEvery, "rate-sample", cfg.SampleEvery, "with -rate-overflow sample, keep 1 in this many logs over the limit")
+	fs.StringVar(&cfg.SpoolDir, "spool-dir", cfg.SpoolDir, "keep logs in this directory while Kafka is unreachable")
+	fs.DurationVar(&cfg.SpoolReplayInterval, "spool-replay-interval", cfg.SpoolReplayInterval, "how often spooled logs are retried")
+	return o
+}
+
+// config returns the producer config once flags have been parsed
+func (o *producerOptions) config(g *globalOptions) producer.Config {
+	cfg := o.cfg
+	cfg.Kafka = g.kafka
+	cfg.RequiredAcks = sarama.RequiredAcks(*o.acks)
+	cfg.Environment = models.Environment(*o.env)
+	cfg.Format = models.Format(*o.format)
+	cfg.MinLevel = models.LogLevel(strings.ToUpper(*o.minLevel))
+	cfg.Overflow = producer.OverflowPolicy(*o.overflow)
+	cfg.PackCompression = models.Compression(*o.pack)
+	cfg.Partitioner = producer.Partitioner(*o.partitioner)
+	if cfg.Partitioner == producer.PartitionManual {
+		partition := int32(*o.partition)
+		cfg.PartitionFunc = func(*models.LogEntry) int32 { return partition }
+	}
+	return cfg
+}
+
+// daemonOptions are accepted by long running commands, to change their
+// settings while they run and profile them
+type daemonOptions struct {
+	reload reload.Config
+	debug  debugserver.Config
+}
+
+func registerDaemonFlags(fs *flag.FlagSet) *daemonOptions {
+	o := &daemonOptions{}
+	o.reload.RegisterFlags(fs)
+	o.debug.RegisterFlags(fs)
+	return o
+}
+
+// start serves the debug endpoints and applies settings changed by SIGHUP
+// or POST /admin/config until ctx is done. The log level always applies,
+// apply handles the rest.
+func (o *daemonOptions) start(ctx context.Context, g *globalOptions, initial reload.Settings, apply func(reload.Settings)) error {
+	closeDebug, err := debugserver.Start(o.debug, "klog")
+	if err != nil {
+		return err
+	}
+	context.AfterFunc(ctx, closeDebug)
+	slog.Info("Starting", buildinfo.Get().Attrs()...)
+
+	initial.LogLevel = g.logs.Level
+	_, err = reload.Start(ctx, o.reload, initial, func(s reload.Settings) {
+		selflog.SetLevel(s.LogLevel)
+		apply(s)
+	})
+	return err
+}
+
+// startProducer lets the settings change the least severe level p publishes,
+// starting from the one given by flags
+func (o *daemonOptions) startProducer(ctx context.Context, g *globalOptions, p *producer.Producer, cfg producer.Config) error {
+	return o.start(ctx, g, reload.Settings{MinLevel: cfg.MinLevel}, func(s reload.Settings) {
+		p.SetMinLevel(s.MinLevel)
+	})
+}
+
+// startPrinter lets the settings change the filters of printer, starting
+// from the ones given by flags
+func (o *daemonOptions) startPrinter(ctx context.Context, g *globalOptions, printer *printer, filters *filterOptions) error {
+	return o.start(ctx, g, reload.Settings{Filters: filters.filters()}, func(s reload.Settings) {
+		printer.setFilters(s.Filters)
+	})
+}
+
+// filterOptions are the display filters shared by consume and tail
+type filterOptions struct {
+	traceID     *string
+	hostname    *string
+	environment *string
+	format      *string
+	tui         *bool
+	output      *string
+	template    *string
+	noColor     *bool
+	colorBy     *string
+	msgWidth    *int
+	wide        *bool
+	flushEvery  *time.Duration
+	bufferSize  *int
+	collapse    *bool
+}
+
+func registerFilterFlags(fs *flag.FlagSet) *filterOptions {
+	return &filterOptions{
+		traceID:     fs.String("trace-id", "", "only show logs belonging to this trace"),
+		hostname:    fs.String("host", "", "only show logs produced on this host"),
+		environment: fs.String("env", "", "only show logs from this environment: dev, stage or prod"),
+		format:      fs.String("format", string(models.FormatJSON), "wire format of messages without a content-type header: json, protobuf, logfmt, msgpack or cbor"),
+		tui:         fs.Bool("tui", false, "browse logs in an interactive terminal UI with scrollback and filters"),
+		output:      fs.String("output", outputPretty, "how entries are printed: pretty, columns, json, logfmt, ecs or template"),
+		template:    fs.String("template", "", "Go text/template for each line with the entry fields plus .Topic, .Partition and .Offset, implies -output template"),
+		noColor:     fs.Bool("no-color", false, "disable colors, also disabled by NO_COLOR or when stdout isn't a terminal"),
+		colorBy:     fs.String("color-by", "level", "color lines by level or app, app keeps the level colored"),
+		msgWidth:    fs.Int("message-width", 0, "columns output: truncate messages to this width (default fits the terminal)"),
+		wide:        fs.Bool("wide", false, "columns output: show metadata after the message"),
+		flushEvery:  fs.Duration("flush-interval", 100*time.Millisecond, "how often printed lines are flushed to stdout"),
+		bufferSize:  fs.Int("buffer-size", 64*1024, "bytes of printed lines buffered before they are flushed"),
+		collapse:    fs.Bool("collapse", false, "print repeats of the same message once with an xN suffix"),
+	}
+}
+
+// filters returns the filters given by flags
+func (o *filterOptions) filters() reload.Filters {
+	return reload.Filters{
+		TraceID:     *o.traceID,
+		Host:        *o.hostname,
+		Environment: models.Environment(*o.environment),
+	}
+}
+
+// printer builds the log printer once flags have been parsed
+func (o *filterOptions) printer() (*printer, error) {
+	format, err := models.ParseFormat(*o.format)
+	if err != nil {
+		return nil, err
+	}
+	if *o.environment != "" && !models.Environment(*o.environment).Valid() {
+		return nil, fmt.Errorf("unknown environment %q, expected dev, stage or prod", *o.environment)
+	}
+	pal, err := newPalette(*o.noColor, *o.colorBy)
+	if err != nil {
+		return nil, err
+	}
+	render, err := parseOutput(outputOptions{
+		format:       *o.output,
+		template:     *o.template,
+		palette:      pal,
+		messageWidth: *o.msgWidth,
+		wide:         *o.wide,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if *o.flushEvery <= 0 || *o.bufferSize <= 0 {
+		return nil, fmt.Errorf("-flush-interval and -buffer-size must be positive")
+	}
+	if *o.collapse && *o.output == outputJSON {
+		return nil, fmt.Errorf("-collapse can't be combined with -output json")
+	}
+
+	p := &printer{
+		palette:  pal,
+		render:   render,
+		format:   format,
+		out:      bufio.NewWriterSize(os.Stdout, *o.bufferSize),
+		collapse: *o.collapse,
+	}
+	if *o.tui {
+		if render != nil {
+			return nil, fmt.Errorf("-tui can't be combined with -output %s", *o.output)
+		}
+		p.view = newTUIView(*o.noColor, *o.colorBy)
+	}
+	p.setFilters(o.filters())
+	p.startFlushing(*o.flushEvery)
+	return p, nil
+}
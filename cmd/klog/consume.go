@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/pkg/producer"
+
+	"github.com/IBM/sarama"
+)
+
+var consumeCmd = &command{
+	name:  "consume",
+	short: "Consume logs in a consumer group and display them",
+	run:   runConsume,
+}
+
+type Consumer struct {
+	ready    chan bool
+	printer  *printer
+	commits  *committer
+	pipeline *pipeline
+	pauser   *pauser
+
+	//start overrides the group offsets the first time a partition is claimed
+	client  sarama.Client
+	start   offsetTarget
+	started map[string]map[int32]bool
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim
+func (consumer *Consumer) Setup(session sarama.ConsumerGroupSession) error {
+	if consumer.start != nil {
+		if err := consumer.seek(session); err != nil {
+			return err
+		}
+	}
+	consumer.commits.start(session)
+
+	//Mark the consumer as ready
+	close(consumer.ready)
+	return nil
+}
+
+// seek moves newly claimed partitions to the requested start position.
+// Partitions seen in an earlier session continue from the group offsets.
+func (consumer *Consumer) seek(session sarama.ConsumerGroupSession) error {
+	for topic, partitions := range session.Claims() {
+		if consumer.started[topic] == nil {
+			consumer.started[topic] = make(map[int32]bool)
+		}
+		for _, partition := range partitions {
+			if consumer.started[topic][partition] {
+				continue
+			}
+			offset, ok, err := consumer.start(consumer.client, topic, partition)
+			if err != nil {
+				return fmt.Errorf("failed to find start offset of %s/%d %w", topic, partition, err)
+			}
+			if ok {
+				session.ResetOffset(topic, partition, offset, "")
+			}
+			consumer.started[topic][partition] = true
+		}
+	}
+	return nil
+}
+
+// Cleanup is run at the end of the session, once all ConsumeClaim goroutines have exited.
+// Every processed message has been marked by then, commit them before the partitions move.
+func (consumer *Consumer) Cleanup(session sarama.ConsumerGroupSession) error {
+	session.Commit()
+	return nil
+}
+
+// ConsumeClaim must start a consumer loop of ConsumerGroupSession's messages()
+func (consumer *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	//This function is called within a goroutine
+	consumer.pauser.claimed(claim.Topic(), claim.Partition())
+	return consumer.pipeline.consume(session, claim)
+}
+
+func runConsume(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	//Consumer group ID - multiple consumers with the same group id will share the same load
+	consumerGroup := fs.String("group", "log-consumer-group", "consumer group id")
+	topic := fs.String("topic", producer.DefaultTopic, "topics to consume, comma separated")
+	topicsPath := fs.String("topics", "", "YAML file of the topics to consume and how each is decoded, filtered and printed, instead of -topic")
+	filters := registerFilterFlags(fs)
+	daemon := registerDaemonFlags(fs)
+	startFlags := registerStartFlags(fs)
+	live := registerLiveFlags(fs)
+	latencyFlags := registerLatencyFlags(fs)
+	commitFlags := registerCommitFlags(fs)
+	membership := kafkaconfig.DefaultGroup()
+	membership.RegisterFlags(fs, "")
+	pipelineFlags := registerPipelineFlags(fs)
+	drainTimeout := registerDrainFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	topics := kafkaconfig.SplitList(*topic)
+	var topicConfigs []topicConfig
+	if *topicsPath != "" {
+		configs, err := loadTopics(*topicsPath)
+		if err != nil {
+			return err
+		}
+		topicConfigs, topics = configs, nil
+		for _, cfg := range configs {
+			topics = append(topics, cfg.Name)
+		}
+	}
+	if len(topics) == 0 {
+		return fmt.Errorf("-topic or -topics is required")
+	}
+	closeLogs, err := globals.setupLogs(topics...)
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+
+	printer, err := filters.printer()
+	if err != nil {
+		return err
+	}
+	//Buffered lines are printed before exiting
+	defer printer.close()
+	if printer.topics, err = filters.topicViews(printer, topics, topicConfigs); err != nil {
+		return err
+	}
+	start, err := startFlags.target()
+	if err != nil {
+		return err
+	}
+	defer latencyFlags.start(printer)()
+	defer live.start(printer)()
+
+	//Kafka Consumer Configuration
+	config := globals.kafka.Sarama()
+	if err := membership.Apply(config); err != nil {
+		return err
+	}
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest //start from the beginning if no offset
+	commits, err := commitFlags.committer(config)
+	if err != nil {
+		return err
+	}
+	if commits.mode == commitAck {
+		if printer.collapse {
+			return fmt.Errorf("-collapse can't be combined with -commit ack, held lines would be acknowledged before printing")
+		}
+		printer.syncWrites = true
+	}
+	pipeline, err := pipelineFlags.pipeline(printer, commits)
+	if err != nil {
+		return err
+	}
+
+	//The client is shared with the start position lookups
+	kafkaClient, err := globals.newClient(config)
+	if err != nil {
+		return fmt.Errorf("error creating kafka client %w", err)
+	}
+
+	//Create consumer group client
+	client, err := sarama.NewConsumerGroupFromClient(*consumerGroup, kafkaClient)
+	if err != nil {
+		kafkaClient.Close()
+		return fmt.Errorf("error creating consumerGroup client %w", err)
+	}
+
+	//Cancelled on SIGINT/SIGTERM, or when the TUI is closed
+	ctx, stop := signalContext()
+	defer stop()
+
+	//Fetching is paused and resumed by SIGUSR1, the admin server and the TUI
+	pauses := newPauser(client)
+	togglePauseOnSignal(ctx, pauses)
+	daemon.reload.Register = pauses.register
+	if printer.view != nil {
+		printer.view.pauser = pauses
+	}
+	if err := daemon.startPrinter(ctx, globals, printer, filters); err != nil {
+		return err
+	}
+	pipeline.run(ctx, *pipelineFlags.statsInterval)
+
+	consumer := Consumer{
+		ready:    make(chan bool),
+		printer:  printer,
+		commits:  commits,
+		pipeline: pipeline,
+		pauser:   pauses,
+		client:   kafkaClient,
+		start:    start,
+		started:  make(map[string]map[int32]bool),
+	}
+
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		for {
+			// "Consumer" should be called inside an infinite loop
+			if err := client.Consume(ctx, topics, &consumer); err != nil {
+				if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+					return
+				}
+				slog.Error("Error from Consumer, retrying", "err", err)
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+				}
+			}
+
+			//Check if context was cancelled, signalling that the consumer should stop
+			if ctx.Err() != nil {
+				return
+			}
+
+			consumer.ready = make(chan bool)
+		}
+	}()
+
+	// await till the consumer has been Setup
+	select {
+	case <-consumer.ready:
+	case <-ctx.Done():
+	}
+
+	if printer.view != nil {
+		if err := printer.view.run(fmt.Sprintf("klog consume %s (%s)", strings.Join(topics, ","), *consumerGroup)); err != nil {
+			slog.Error("Error from terminal UI", "err", err)
+		}
+		stop()
+	} else {
+		slog.Info("Consumer group started", "group", *consumerGroup, "topics", topics)
+		fmt.Println("Ctrl-C to stop...")
+		<-ctx.Done()
+	}
+	slog.Info("Terminating Consumer...")
+
+	//Consume returns once the claims finished their current message and the
+	//session committed the marked offsets, only then are the clients closed
+	return drain(*drainTimeout, "in-flight messages", func() error {
+		<-consumed
+		if err := client.Close(); err != nil {
+			return fmt.Errorf("error closing client %w", err)
+		}
+		return kafkaClient.Close()
+	})
+}
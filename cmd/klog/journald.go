@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/journald"
+	"kafka-logging-system/pkg/producer"
+)
+
+var journaldCmd = &command{
+	name:  "journald",
+	short: "Follow the systemd journal and ship its entries",
+	run:   runJournald,
+}
+
+// unitList collects repeated -unit flags
+type unitList []string
+
+func (u *unitList) String() string { return strings.Join(*u, ",") }
+
+func (u *unitList) Set(value string) error {
+	*u = append(*u, value)
+	return nil
+}
+
+func runJournald(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	opts := registerProducerFlags(fs)
+	daemon := registerDaemonFlags(fs)
+	var units unitList
+	fs.Var(&units, "unit", "only follow this systemd unit, may be repeated")
+	cursorFile := fs.String("cursor", "klog-journald.cursor", "file keeping the cursor of the last shipped entry, empty to always start over")
+	directory := fs.String("directory", "", "read the journal files in this directory, such as the host's /var/log/journal")
+	fromStart := fs.Bool("from-start", false, "without a saved cursor, ship the whole journal instead of only new entries")
+	app := fs.String("app", "journald", "application of entries outside a unit without a syslog identifier")
+	journalctl := fs.String("journalctl", "journalctl", "journalctl binary")
+	drainTimeout := registerDrainFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs()
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+
+	journal, err := journald.New(journald.Config{
+		Journalctl: *journalctl,
+		Directory:  *directory,
+		Units:      units,
+		CursorFile: *cursorFile,
+		FromStart:  *fromStart,
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg := opts.config(globals)
+	p, err := producer.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create producer %w", err)
+	}
+
+	//Handle graceful shutdown
+	ctx, stop := signalContext()
+	defer stop()
+	if err := daemon.startProducer(ctx, globals, p, cfg); err != nil {
+		return err
+	}
+
+	if cursor := journal.Cursor(); cursor != "" {
+		slog.Info("Following the journal", "after", cursor)
+	} else {
+		slog.Info("Following the journal")
+	}
+	fmt.Println("Ctrl-C to stop...")
+
+	stats := &ingestStats{}
+	err = journal.Run(ctx, func(fields journald.Fields) error {
+		entry, err := fields.Entry(*app, time.Now())
+		if err != nil {
+			stats.skipped++
+			return nil
+		}
+		if _, _, err := p.Send(entry); err != nil {
+			slog.Error("Error sending log", "err", err)
+			stats.failed++
+			return nil
+		}
+		stats.sent++
+		return nil
+	})
+
+	slog.Info("Journal stopped", "stats", stats.String())
+	if derr := drain(*drainTimeout, "buffered messages", p.Close); err == nil {
+		err = derr
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"strings"
+
+	"kafka-logging-system/internal/ingest"
+	"kafka-logging-system/internal/kube"
+)
+
+// Pod labels naming the application, in order of preference. Pods without
+// them are named after their container.
+var kubeAppLabels = []string{"app.kubernetes.io/name", "app"}
+
+// topicMap collects repeated -namespace-topic NAMESPACE=TOPIC flags
+type topicMap map[string]string
+
+func (m topicMap) String() string { return "" }
+
+func (m topicMap) Set(value string) error {
+	namespace, topic, ok := strings.Cut(value, "=")
+	if !ok || namespace == "" || topic == "" {
+		return fmt.Errorf("expected namespace=topic, got %q", value)
+	}
+	m[namespace] = topic
+	return nil
+}
+
+// kubeOptions configure the agent's Kubernetes mode
+type kubeOptions struct {
+	enabled     *bool
+	metadata    *string
+	node        *string
+	kubeletURL  *string
+	insecure    *bool
+	excluded    *string
+	namespaceTo topicMap
+}
+
+func registerKubeFlags(fs *flag.FlagSet) *kubeOptions {
+	kubeletURL := "https://localhost:10250"
+	if ip := os.Getenv("NODE_IP"); ip != "" {
+		kubeletURL = "https://" + ip + ":10250"
+	}
+	o := &kubeOptions{
+		enabled:     fs.Bool("kubernetes", false, "read container logs of a Kubernetes node, following "+kube.LogDir+" when no pattern is given"),
+		metadata:    fs.String("kube-metadata", "api", "kubernetes: where pod labels are read from: api, kubelet or none"),
+		node:        fs.String("node", os.Getenv("NODE_NAME"), "kubernetes: name of the node, for -kube-metadata api (default $NODE_NAME)"),
+		kubeletURL:  fs.String("kubelet-url", kubeletURL, "kubernetes: kubelet address for -kube-metadata kubelet (default uses $NODE_IP)"),
+		insecure:    fs.Bool("kubelet-insecure", false, "kubernetes: don't verify the kubelet's certificate"),
+		excluded:    fs.String("exclude-namespaces", "", "kubernetes: comma separated namespaces whose logs are not shipped"),
+		namespaceTo: topicMap{},
+	}
+	fs.Var(o.namespaceTo, "namespace-topic", "kubernetes: namespace=topic sends a namespace's logs to its own topic, may be repeated")
+	return o
+}
+
+// kubeAgent turns container log lines into entries of their pod
+type kubeAgent struct {
+	pods     *kube.Pods
+	excluded map[string]bool
+	topics   topicMap
+
+	//partial holds the start of lines the runtime split, per file
+	partial map[string][]byte
+}
+
+// build returns the Kubernetes mode once flags have been parsed, nil when disabled
+func (o *kubeOptions) build() (*kubeAgent, error) {
+	if !*o.enabled {
+		return nil, nil
+	}
+	k := &kubeAgent{
+		excluded: make(map[string]bool),
+		topics:   o.namespaceTo,
+		partial:  make(map[string][]byte),
+	}
+	for _, ns := range strings.Split(*o.excluded, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			k.excluded[ns] = true
+		}
+	}
+
+	var err error
+	switch *o.metadata {
+	case "api":
+		k.pods, err = kube.NewAPIPods(*o.node)
+	case "kubelet":
+		k.pods, err = kube.NewKubeletPods(*o.kubeletURL, *o.insecure)
+	case "none":
+	default:
+		return nil, fmt.Errorf("unknown -kube-metadata %q, expected api, kubelet or none", *o.metadata)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// defaults returns the defaults for a container log file, false for files
+// that aren't container logs or belong to an excluded namespace
+func (k *kubeAgent) defaults(ctx context.Context, path string, base *ingest.Defaults) (*ingest.Defaults, bool) {
+	c, ok := kube.ParsePath(path)
+	if !ok || k.excluded[c.Namespace] {
+		return nil, false
+	}
+
+	d := &ingest.Defaults{Application: base.Application, Level: base.Level, Metadata: maps.Clone(base.Metadata)}
+	if d.Metadata == nil {
+		d.Metadata = make(map[string]any)
+	}
+	d.Metadata["k8s.namespace"] = c.Namespace
+	d.Metadata["k8s.pod"] = c.Pod
+	d.Metadata["k8s.container"] = c.Name
+	d.Metadata["k8s.container_id"] = c.ID
+
+	var labels map[string]string
+	if k.pods != nil {
+		pod, err := k.pods.Lookup(ctx, c.Namespace, c.Pod)
+		if err != nil {
+			slog.Error("Error looking up pod", "namespace", c.Namespace, "pod", c.Pod, "err", err)
+		}
+		if pod != nil {
+			labels = pod.Labels
+			d.Metadata["k8s.node"] = pod.Node
+			d.Metadata["k8s.pod_uid"] = pod.UID
+			if len(labels) > 0 {
+				values := make(map[string]any, len(labels))
+				for key, value := range labels {
+					values[key] = value
+				}
+				d.Metadata["k8s.labels"] = values
+			}
+		}
+	}
+
+	if d.Application == "" {
+		d.Application = c.Name
+		for _, label := range kubeAppLabels {
+			if app := labels[label]; app != "" {
+				d.Application = app
+				break
+			}
+		}
+	}
+	return d, true
+}
+
+// record decodes a runtime line. It returns false while the line is the
+// start of one the runtime split, until its last piece arrives.
+func (k *kubeAgent) record(path string, line []byte) (kube.Record, bool, error) {
+	rec, err := kube.ParseRecord(line)
+	if err != nil {
+		return rec, false, err
+	}
+	if rec.Partial {
+		//lines can't grow without bound when a final piece never arrives
+		if len(k.partial[path])+len(rec.Message) <= maxLineSize {
+			k.partial[path] = append(k.partial[path], rec.Message...)
+		}
+		return rec, false, nil
+	}
+	if start := k.partial[path]; start != nil {
+		rec.Message = append(start, rec.Message...)
+		delete(k.partial, path)
+	}
+	return rec, true, nil
+}
+
+// topic returns the topic of a namespace, empty for the default one
+func (k *kubeAgent) topic(d *ingest.Defaults) string {
+	namespace, _ := d.Metadata["k8s.namespace"].(string)
+	return k.topics[namespace]
+}
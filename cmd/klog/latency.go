@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"kafka-logging-system/internal/latency"
+)
+
+// latencyOptions measure how long messages took from the producer
+type latencyOptions struct {
+	enabled  *bool
+	interval *time.Duration
+}
+
+func registerLatencyFlags(fs *flag.FlagSet) *latencyOptions {
+	return &latencyOptions{
+		enabled:  fs.Bool("latency", false, "measure produce to consume latency from the producer's sent-at header"),
+		interval: fs.Duration("latency-interval", 10*time.Second, "how often a latency summary is logged to stderr (0 only logs it on exit)"),
+	}
+}
+
+// start attaches a latency recorder to the printer and logs summaries. The
+// returned func stops them and logs the totals.
+func (o *latencyOptions) start(p *printer) func() {
+	if !*o.enabled {
+		return func() {}
+	}
+	p.latency = &latency.Recorder{}
+
+	stop := make(chan struct{})
+	//Summaries would draw over the TUI, it only gets the totals
+	if *o.interval > 0 && p.view == nil {
+		go func() {
+			ticker := time.NewTicker(*o.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					slog.Info("Latency", "interval", p.latency.Interval().String())
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	return func() {
+		close(stop)
+		total, missing := p.latency.Total()
+		slog.Info("Latency since start", "total", total.String())
+		if missing > 0 {
+			slog.Warn("Messages had no sent-at header", "messages", missing)
+		}
+	}
+}
+
+// serveLatency returns the totals since the start as JSON
+func serveLatency(recorder *latency.Recorder) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		total, missing := recorder.Total()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			latency.Summary
+			Missing uint64 `json:"missing"`
+		}{total, missing})
+	}
+}
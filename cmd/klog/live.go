@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+
+	"kafka-logging-system/internal/livetail"
+)
+
+// liveOptions serve decoded entries to WebSocket clients
+type liveOptions struct {
+	listen *string
+	buffer *int
+	quiet  *bool
+}
+
+func registerLiveFlags(fs *flag.FlagSet) *liveOptions {
+	return &liveOptions{
+		listen: fs.String("listen", "", "serve matching logs over WebSocket at ws://<addr>/ws, e.g. :8081"),
+		buffer: fs.Int("ws-buffer", livetail.DefaultBuffer, "entries a WebSocket client can fall behind before entries are dropped for it"),
+		quiet:  fs.Bool("quiet", false, "don't print logs, useful when only serving them"),
+	}
+}
+
+// start runs the WebSocket server when -listen is set and attaches it to the printer
+func (o *liveOptions) start(p *printer) func() {
+	p.quiet = *o.quiet
+	if *o.listen == "" {
+		return func() {}
+	}
+
+	hub := livetail.NewHub(*o.buffer)
+	p.hub = hub
+
+	mux := http.NewServeMux()
+	mux.Handle("/ws", hub)
+	if p.latency != nil {
+		mux.Handle("/latency", serveLatency(p.latency))
+	}
+	server := &http.Server{Addr: *o.listen, Handler: mux}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Live tail server stopped", "err", err)
+		}
+	}()
+	slog.Info("Serving live logs", "url", "ws://"+*o.listen+"/ws")
+
+	return func() { server.Close() }
+}
@@ -0,0 +1,625 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kafka-logging-system/internal/generator"
+	"kafka-logging-system/internal/latency"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/pkg/producer"
+)
+
+var loadgenCmd = &command{
+	name:  "loadgen",
+	short: "Generate log traffic at a target rate and report throughput and latency",
+	run:   runLoadgen,
+}
+
+// printEachBelow is the highest rate at which every sent log is printed,
+// faster runs print a progress line every second instead
+const printEachBelow = 10
+
+// Arrival distributions of the time between two logs of an app
+const (
+	arrivalFixed   = "fixed"
+	arrivalJitter  = "jitter"
+	arrivalPoisson = "poisson"
+)
+
+// sizeRange is the encoded size of generated entries, picked uniformly
+// between min and max. Zero leaves entries at their natural size.
+type sizeRange struct {
+	min, max int
+}
+
+func (s *sizeRange) String() string {
+	if s.min == s.max {
+		return strconv.Itoa(s.min)
+	}
+	return fmt.Sprintf("%d-%d", s.min, s.max)
+}
+
+// Set parses a fixed size such as 512 or a range such as 100-2000
+func (s *sizeRange) Set(value string) error {
+	low, high, isRange := strings.Cut(value, "-")
+	min, err := strconv.Atoi(low)
+	if err != nil {
+		return fmt.Errorf("invalid payload size %q, expected BYTES or MIN-MAX", value)
+	}
+	max := min
+	if isRange {
+		if max, err = strconv.Atoi(high); err != nil {
+			return fmt.Errorf("invalid payload size %q, expected BYTES or MIN-MAX", value)
+		}
+	}
+	if min < 0 || max < min {
+		return fmt.Errorf("invalid payload size %q, sizes must be positive and MIN at most MAX", value)
+	}
+	s.min, s.max = min, max
+	return nil
+}
+
+// pick returns a size from the range, 0 when entries keep their natural size
+func (s *sizeRange) pick(rnd *rand.Rand) int {
+	if s.max == 0 {
+		return 0
+	}
+	return s.min + rnd.Intn(s.max-s.min+1)
+}
+
+// seededEpoch is when the first log of a seeded run is timestamped, so
+// repeated runs produce identical entries
+var seededEpoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// appRates are the rates of single applications, given as APP=RATE
+type appRates map[string]float64
+
+func (r appRates) String() string {
+	pairs := make([]string, 0, len(r))
+	for app, rate := range r {
+		pairs = append(pairs, fmt.Sprintf("%s=%g", app, rate))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set parses APP=RATE pairs separated by commas
+func (r appRates) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		app, rate, ok := strings.Cut(pair, "=")
+		perSecond, err := strconv.ParseFloat(rate, 64)
+		if !ok || app == "" || err != nil || perSecond <= 0 {
+			return fmt.Errorf("invalid app rate %q, expected APP=RATE with a positive rate", pair)
+		}
+		r[strings.TrimSpace(app)] = perSecond
+	}
+	return nil
+}
+
+type loadgenOptions struct {
+	rate        *float64
+	appRates    appRates
+	apps        *int
+	size        sizeRange
+	duration    *time.Duration
+	rampUp      *time.Duration
+	concurrency *int
+	seed        *int64
+	scenario    *string
+	arrival     *string
+	jitter      *float64
+	burstSize   *int
+	burstEvery  *time.Duration
+	backfill    *time.Duration
+}
+
+func registerLoadgenFlags(fs *flag.FlagSet) *loadgenOptions {
+	o := &loadgenOptions{
+		rate:        fs.Float64("rate", 1, "target messages per second, shared by the apps without their own rate (0 sends as fast as possible)"),
+		appRates:    appRates{},
+		apps:        fs.Int("apps", 0, "simulated applications, picked at random for each message (default one, or every app of a scenario file)"),
+		duration:    fs.Duration("duration", 0, "stop after this long (0 runs until Ctrl-C)"),
+		rampUp:      fs.Duration("ramp-up", 0, "raise the rate linearly from zero over this long"),
+		concurrency: fs.Int("concurrency", 1, "messages sent in parallel"),
+		seed:        fs.Int64("seed", 0, "seed for reproducible runs, the same seed generates the same logs (default random)"),
+		scenario:    fs.String("scenario", generator.Default.Name, "traffic to simulate: default, incident, verbose or a .yaml scenario file"),
+		arrival:     fs.String("arrival", arrivalFixed, "time between logs: fixed, jitter or poisson"),
+		jitter:      fs.Float64("jitter", 0.5, "jitter arrival: how far gaps vary around the average, as a fraction of it"),
+		burstSize:   fs.Int("burst-size", 0, "logs every app sends at once in a burst (0 disables bursts)"),
+		burstEvery:  fs.Duration("burst-every", 30*time.Second, "time between bursts"),
+		backfill:    fs.Duration("backfill", 0, "send the logs of this long ago up to now as fast as possible, e.g. 24h at -rate 10"),
+	}
+	fs.Var(o.appRates, "app-rate", "messages per second of one app as APP=RATE, repeat or separate with commas")
+	fs.Var(&o.size, "payload-size", "encoded size of each log in bytes, BYTES or MIN-MAX picked uniformly (default natural size)")
+	return o
+}
+
+// rates returns the rate of every app. Apps with a rate from -app-rate or the
+// scenario keep it, the others share -rate evenly. Zero is unlimited.
+func (o *loadgenOptions) rates(apps []string, scenario *generator.Scenario) ([]float64, error) {
+	for app := range o.appRates {
+		if !slices.Contains(apps, app) {
+			return nil, fmt.Errorf("-app-rate names %s, which isn't simulated", app)
+		}
+	}
+	rates := make([]float64, len(apps))
+	shared := 0
+	for i, app := range apps {
+		if rates[i] = o.appRates[app]; rates[i] == 0 {
+			rates[i] = scenario.AppRate(app)
+		}
+		if rates[i] == 0 {
+			shared++
+		}
+	}
+	for i := range rates {
+		if rates[i] == 0 {
+			rates[i] = *o.rate / float64(shared)
+		}
+	}
+	return rates, nil
+}
+
+// validateArrival checks the arrival and burst flags
+func (o *loadgenOptions) validateArrival() error {
+	switch *o.arrival {
+	case arrivalFixed, arrivalPoisson:
+	case arrivalJitter:
+		if *o.jitter < 0 || *o.jitter > 1 {
+			return fmt.Errorf("-jitter must be between 0 and 1")
+		}
+	default:
+		return fmt.Errorf("unknown arrival %q, expected fixed, jitter or poisson", *o.arrival)
+	}
+	if *o.burstSize < 0 || (*o.burstSize > 0 && *o.burstEvery <= 0) {
+		return fmt.Errorf("-burst-size can't be negative and -burst-every must be positive")
+	}
+	return nil
+}
+
+// schedule returns when each message is due at rate, following the ramp up,
+// the scenario's bursts and the arrival distribution drawn from rnd
+func (o *loadgenOptions) schedule(rate float64, scenario *generator.Scenario, rnd *rand.Rand) *schedule {
+	s := &schedule{
+		rate: func(elapsed time.Duration) float64 {
+			rate := scenario.RateAt(rate, elapsed)
+			if elapsed < *o.rampUp {
+				rate *= float64(elapsed) / float64(*o.rampUp)
+			}
+			return rate
+		},
+		burstSize:  *o.burstSize,
+		burstEvery: *o.burstEvery,
+		nextBurst:  *o.burstEvery,
+	}
+	if rate <= 0 {
+		//without a target rate seeded runs space logs a millisecond apart
+		s.rate = func(time.Duration) float64 { return 1000 }
+	}
+
+	//gap is how much of the integrated rate passes between two logs, on
+	//average one. Exponential gaps make the arrivals a Poisson process.
+	switch *o.arrival {
+	case arrivalJitter:
+		jitter := *o.jitter
+		s.gap = func() float64 { return 1 + jitter*(2*rnd.Float64()-1) }
+	case arrivalPoisson:
+		s.gap = rnd.ExpFloat64
+	default:
+		s.gap = func() float64 { return 1 }
+	}
+	return s
+}
+
+// scheduleStep is how finely the rate is integrated
+const scheduleStep = time.Millisecond
+
+// schedule spaces messages by integrating the rate over fixed steps, so send
+// times don't depend on when the pacer wakes up and seeded runs repeat exactly
+type schedule struct {
+	rate func(elapsed time.Duration) float64
+	gap  func() float64
+	at   time.Duration
+	//left is the integrated rate until the next message, negative when
+	//several are due in one step
+	left float64
+
+	burstSize  int
+	burstEvery time.Duration
+	nextBurst  time.Duration
+	burstSent  int
+
+	pending    time.Duration
+	hasPending bool
+}
+
+// next returns when the next message is due since the start of the run
+func (s *schedule) next() time.Duration {
+	if !s.hasPending {
+		s.pending, s.hasPending = s.arrival(), true
+	}
+	//A burst sends all of its messages before the next regular one
+	if s.burstSize > 0 && s.nextBurst <= s.pending {
+		at := s.nextBurst
+		if s.burstSent++; s.burstSent == s.burstSize {
+			s.burstSent = 0
+			s.nextBurst += s.burstEvery
+		}
+		return at
+	}
+	s.hasPending = false
+	return s.pending
+}
+
+// arrival returns when the next regular message is due
+func (s *schedule) arrival() time.Duration {
+	s.left += s.gap()
+	for s.left > 0 {
+		s.left -= s.rate(s.at) * scheduleStep.Seconds()
+		s.at += scheduleStep
+	}
+	return s.at
+}
+
+// simulation is one simulated application, paced on its own
+type simulation struct {
+	rate  float64
+	gen   *generator.Generator
+	rnd   *rand.Rand
+	sched *schedule
+}
+
+// pace generates the app's logs on its schedule until ctx is done, or the
+// backfill is complete. Logs are stamped by clock, or by the schedule from
+// start in seeded runs and backfills.
+func (o *loadgenOptions) pace(ctx context.Context, sim *simulation, start time.Time, clock func() time.Time, format models.Format, jobs chan<- *models.LogEntry) error {
+	unlimited := sim.rate <= 0
+	//Backfills don't wait for the schedule, only for the senders
+	fast := unlimited || *o.backfill > 0
+
+	//Wake often enough to keep the rate smooth without spinning at low rates
+	tick := 100 * time.Millisecond
+	if !unlimited {
+		tick = max(min(time.Duration(float64(time.Second)/sim.rate), tick), time.Millisecond)
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	began := time.Now()
+	var generated int64
+	next := sim.sched.next()
+	for {
+		for fast || next <= time.Since(began) {
+			if *o.backfill > 0 && next > *o.backfill {
+				return nil
+			}
+			at := start.Add(next)
+			if clock != nil {
+				at = clock()
+			}
+			entry := sim.gen.NextAt(at)
+			if err := pad(entry, format, o.size.pick(sim.rnd), sim.rnd); err != nil {
+				return fmt.Errorf("failed to encode log %w", err)
+			}
+			select {
+			case jobs <- entry:
+				generated++
+				next = sim.sched.next()
+			case <-ctx.Done():
+				return nil
+			}
+			//Only the senders slow the pacer down, check for shutdown now and then
+			if fast && generated%1000 == 0 {
+				break
+			}
+		}
+
+		if fast {
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// loadStats are updated by every sender
+type loadStats struct {
+	sent   atomic.Int64
+	failed atomic.Int64
+	bytes  atomic.Int64
+
+	mu      sync.Mutex
+	latency latency.Histogram
+	errors  map[string]int64
+}
+
+func (s *loadStats) record(took time.Duration, size int, err error) {
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	s.sent.Add(1)
+	s.bytes.Add(int64(size))
+	s.mu.Lock()
+	s.latency.Record(took)
+	s.mu.Unlock()
+}
+
+func (s *loadStats) fail(err error) {
+	s.failed.Add(1)
+	s.mu.Lock()
+	s.errors[err.Error()]++
+	s.mu.Unlock()
+}
+
+// report prints the achieved throughput, send latency and errors of the run
+func (s *loadStats) report(elapsed time.Duration, async bool) {
+	sent := s.sent.Load()
+	fmt.Printf("\nSent %d messages in %s (%.1f msgs/s, %.2f MB/s), %d failed\n",
+		sent,
+		elapsed.Round(time.Millisecond),
+		float64(sent)/elapsed.Seconds(),
+		float64(s.bytes.Load())/(1<<20)/elapsed.Seconds(),
+		s.failed.Load(),
+	)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	what := "Send latency"
+	if async {
+		what = "Queueing latency (async, acks are not timed)"
+	}
+	fmt.Printf("%s: %s\n", what, s.latency.Summary())
+
+	errs := make([]string, 0, len(s.errors))
+	for err := range s.errors {
+		errs = append(errs, err)
+	}
+	sort.Slice(errs, func(i, j int) bool { return s.errors[errs[i]] > s.errors[errs[j]] })
+	for _, err := range errs {
+		fmt.Printf("  %6d x %s\n", s.errors[err], err)
+	}
+}
+
+// pad grows the encoded entry to about size bytes with a filler metadata field
+func pad(entry *models.LogEntry, format models.Format, size int, rnd *rand.Rand) error {
+	if size == 0 {
+		return nil
+	}
+	data, err := entry.Encode(format)
+	if err != nil {
+		return err
+	}
+	//the filler field name, quotes and separators take about 14 bytes
+	if missing := size - len(data) - 14; missing > 0 {
+		filler := make([]byte, missing)
+		for i := range filler {
+			filler[i] = 'a' + byte(rnd.Intn(26))
+		}
+		entry.WithField("filler", string(filler))
+	}
+	return nil
+}
+
+// simulatedApps names n applications, the scenario's first
+func simulatedApps(n int, scenario *generator.Scenario, rnd *rand.Rand) []string {
+	names := scenario.AppNames()
+	if n == 0 && len(scenario.Apps) > 0 {
+		return names
+	}
+	if n <= 1 {
+		return []string{names[rnd.Intn(len(names))]}
+	}
+	apps := make([]string, n)
+	for i := range apps {
+		if i < len(names) {
+			apps[i] = names[i]
+		} else {
+			apps[i] = fmt.Sprintf("Service%02d", i+1)
+		}
+	}
+	return apps
+}
+
+func runLoadgen(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	opts := registerProducerFlags(fs)
+	daemon := registerDaemonFlags(fs)
+	load := registerLoadgenFlags(fs)
+	drainTimeout := registerDrainFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs()
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+	if *load.rate < 0 || *load.apps < 0 || *load.concurrency < 1 {
+		return fmt.Errorf("-rate and -apps can't be negative, -concurrency must be at least 1")
+	}
+	if err := load.validateArrival(); err != nil {
+		return err
+	}
+
+	scenario, err := generator.LookupScenario(*load.scenario)
+	if err != nil {
+		return err
+	}
+
+	stats := &loadStats{errors: make(map[string]int64)}
+	cfg := opts.config(globals)
+	//async failures arrive after Send returned
+	cfg.OnError = stats.fail
+
+	p, err := producer.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create producer %w", err)
+	}
+
+	//Everything generated is drawn from the seed, so a seed reproduces the run
+	seed := *load.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	//Seeded runs and backfills are stamped with the schedule instead of the clock
+	start, clock := time.Now(), time.Now
+	switch {
+	case *load.seed != 0:
+		start, clock = seededEpoch, nil
+	case *load.backfill > 0:
+		start, clock = start.Add(-*load.backfill), nil
+	}
+	apps := simulatedApps(*load.apps, scenario, rnd)
+	rates, err := load.rates(apps, scenario)
+	if err != nil {
+		return err
+	}
+
+	//Every app has its own source, so its logs don't depend on the others' timing
+	sims := make([]*simulation, len(apps))
+	described := make([]string, len(apps))
+	total := 0.0
+	for i, app := range apps {
+		appRnd := rand.New(rand.NewSource(rnd.Int63()))
+		sims[i] = &simulation{
+			rate:  rates[i],
+			gen:   generator.NewScenario(scenario, app, start, appRnd),
+			rnd:   appRnd,
+			sched: load.schedule(rates[i], scenario, appRnd),
+		}
+		described[i] = fmt.Sprintf("%s %g/s", app, rates[i])
+		if rates[i] <= 0 {
+			described[i] = app + " unlimited"
+			total = math.Inf(1)
+		}
+		total += rates[i]
+	}
+
+	//Handle graceful shutdown
+	ctx, stop := signalContext()
+	defer stop()
+	if err := daemon.startProducer(ctx, globals, p, cfg); err != nil {
+		return err
+	}
+	if *load.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *load.duration)
+		defer cancel()
+	}
+
+	printEach := total <= printEachBelow && *load.backfill == 0
+	fmt.Printf("Generating %s logs for %s (seed %d)\n", scenario.Name, strings.Join(described, ", "), seed)
+	if *load.backfill > 0 {
+		fmt.Printf("Backfilling logs from %s to %s\n", start.Format(time.RFC3339), start.Add(*load.backfill).Format(time.RFC3339))
+	}
+	fmt.Println("Press Ctrl + c to stop...")
+
+	//Senders take generated entries from the pacers
+	jobs := make(chan *models.LogEntry, *load.concurrency*2)
+	var wg sync.WaitGroup
+	for range *load.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				start := time.Now()
+				partition, offset, err := p.Send(entry)
+				took := time.Since(start)
+				//Send fills in the host fields, so the size is measured afterwards
+				data, _ := entry.Encode(cfg.Format)
+				stats.record(took, len(data), err)
+
+				if printEach {
+					switch {
+					case err != nil:
+						fmt.Println("Error sending log ", err)
+					case partition < 0:
+						fmt.Printf("[%s] Queued log: %s - %s\n", entry.Application, entry.Level, entry.Message)
+					default:
+						fmt.Printf("[%s] Sent log to partition %d, offset %d: %s - %s\n", entry.Application, partition, offset, entry.Level, entry.Message)
+					}
+				}
+			}
+		}()
+	}
+
+	progress := time.NewTicker(time.Second)
+	defer progress.Stop()
+
+	var lastSent int64
+	printProgress := func() {
+		if !printEach {
+			sent := stats.sent.Load()
+			fmt.Printf("sent=%d rate=%d/s failed=%d\n", sent, sent-lastSent, stats.failed.Load())
+			lastSent = sent
+		}
+	}
+
+	//Every app is paced by its own goroutine, the first failure stops them all
+	paceCtx, stopPacing := context.WithCancel(ctx)
+	defer stopPacing()
+	began := time.Now()
+	var pacers sync.WaitGroup
+	paced := make(chan struct{})
+	errs := make(chan error, len(sims))
+	for _, sim := range sims {
+		pacers.Add(1)
+		go func() {
+			defer pacers.Done()
+			if err := load.pace(paceCtx, sim, start, clock, cfg.Format, jobs); err != nil {
+				errs <- err
+				stopPacing()
+			}
+		}()
+	}
+
+	go func() {
+		pacers.Wait()
+		close(paced)
+	}()
+
+running:
+	for {
+		select {
+		case <-progress.C:
+			printProgress()
+		case <-paced:
+			break running
+		case <-paceCtx.Done():
+			break running
+		}
+	}
+
+	<-paced
+	fmt.Println("Shutting down Producer...")
+	close(jobs)
+	wg.Wait()
+	//Close flushes batched async messages and waits for their acks
+	err = drain(*drainTimeout, "buffered messages", p.Close)
+	stats.report(time.Since(began), cfg.Async)
+	select {
+	case paceErr := <-errs:
+		return paceErr
+	default:
+		return err
+	}
+}
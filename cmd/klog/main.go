@@ -0,0 +1,119 @@
+// klog is the command line tool for the logging pipeline, producing,
+// consuming and generating logs through one binary
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"kafka-logging-system/internal/buildinfo"
+	"kafka-logging-system/internal/selflog"
+)
+
+// command is one klog subcommand. run receives the arguments after the
+// command name and parses them with its own flag set.
+type command struct {
+	name  string
+	usage string //arguments shown after the command name
+	short string
+	run   func(cmd *command, args []string) error
+}
+
+var commands []*command
+
+func init() {
+	//assigned here because help refers back to commands
+	commands = []*command{
+		produceCmd,
+		loadgenCmd,
+		agentCmd,
+		syslogCmd,
+		gelfCmd,
+		journaldCmd,
+		consumeCmd,
+		tailCmd,
+		traceCmd,
+		queryCmd,
+		adminCmd,
+		{name: "version", short: "Print the version of klog", run: runVersion},
+		{name: "help", usage: "[command]", short: "Show help for a command", run: runHelp},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "-version" || name == "--version" {
+		name = "version"
+	}
+	cmd := lookup(name)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "klog: unknown command %q\n\n", os.Args[1])
+		printUsage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(cmd, os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		selflog.Fatal("klog "+cmd.name+" failed", "err", err)
+	}
+}
+
+func lookup(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// flagSet returns a flag set for the command with the global flags registered
+func (cmd *command) flagSet() (*flag.FlagSet, *globalOptions) {
+	fs := flag.NewFlagSet("klog "+cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: %s\n\n%s\n\nFlags:\n", strings.TrimSpace("klog "+cmd.name+" [flags] "+cmd.usage), cmd.short)
+		fs.PrintDefaults()
+	}
+	buildinfo.RegisterFlag(fs, "klog")
+	return fs, registerGlobals(fs)
+}
+
+func printUsage() {
+	var b strings.Builder
+	b.WriteString("Usage: klog <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "  %-10s %s\n", cmd.name, cmd.short)
+	}
+	b.WriteString("\nRun 'klog help <command>' for the flags of a command.\n")
+	fmt.Fprint(os.Stderr, b.String())
+}
+
+func runVersion(_ *command, _ []string) error {
+	fmt.Println("klog", buildinfo.Get())
+	return nil
+}
+
+func runHelp(_ *command, args []string) error {
+	if len(args) == 0 {
+		printUsage()
+		return nil
+	}
+
+	cmd := lookup(args[0])
+	if cmd == nil || cmd.name == "help" {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	//commands register their flags when run, -h prints them and returns flag.ErrHelp
+	return cmd.run(cmd, []string{"-h"})
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kafka-logging-system/pkg/producer"
+
+	"github.com/IBM/sarama"
+)
+
+// offsetTarget resolves the offset a partition is reset to
+type offsetTarget func(client sarama.Client, topic string, partition int32) (int64, bool, error)
+
+// parseOffsetTarget accepts earliest, latest, a duration ago such as 2h, an
+// RFC3339 time, or partition:offset pairs such as 0:120,1:95. Partitions
+// missing from an explicit list are left alone.
+func parseOffsetTarget(to string) (offsetTarget, error) {
+	switch to {
+	case "earliest":
+		return fixedOffset(sarama.OffsetOldest), nil
+	case "latest":
+		return fixedOffset(sarama.OffsetNewest), nil
+	}
+
+	if d, err := time.ParseDuration(to); err == nil {
+		return timeOffset(time.Now().Add(-d)), nil
+	}
+	if t, err := time.Parse(time.RFC3339, to); err == nil {
+		return timeOffset(t), nil
+	}
+
+	explicit := make(map[int32]int64)
+	for _, pair := range strings.Split(to, ",") {
+		p, o, ok := strings.Cut(pair, ":")
+		partition, perr := strconv.ParseInt(p, 10, 32)
+		offset, oerr := strconv.ParseInt(o, 10, 64)
+		if !ok || perr != nil || oerr != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid -to %q, expected earliest, latest, a duration, an RFC3339 time or partition:offset pairs", to)
+		}
+		explicit[int32(partition)] = offset
+	}
+	return func(client sarama.Client, topic string, partition int32) (int64, bool, error) {
+		offset, ok := explicit[partition]
+		return offset, ok, nil
+	}, nil
+}
+
+func fixedOffset(which int64) offsetTarget {
+	return func(client sarama.Client, topic string, partition int32) (int64, bool, error) {
+		offset, err := client.GetOffset(topic, partition, which)
+		return offset, true, err
+	}
+}
+
+// timeOffset resolves to the first message at or after t, or the end of
+// partitions with nothing that recent
+func timeOffset(t time.Time) offsetTarget {
+	return func(client sarama.Client, topic string, partition int32) (int64, bool, error) {
+		offset, err := client.GetOffset(topic, partition, t.UnixMilli())
+		if err == nil && offset == -1 {
+			offset, err = client.GetOffset(topic, partition, sarama.OffsetNewest)
+		}
+		return offset, true, err
+	}
+}
+
+// startOptions choose where consume and tail begin reading instead of the group offsets
+type startOptions struct {
+	fromBeginning *bool
+	fromLatest    *bool
+	since         *time.Duration
+	sinceTime     *string
+	offsets       *string
+}
+
+func registerStartFlags(fs *flag.FlagSet) *startOptions {
+	return &startOptions{
+		fromBeginning: fs.Bool("from-beginning", false, "start at the oldest retained message"),
+		fromLatest:    fs.Bool("from-latest", false, "start at the end, showing only new messages"),
+		since:         fs.Duration("since", 0, "start at messages from this long ago, e.g. 2h"),
+		sinceTime:     fs.String("since-time", "", "start at messages from this RFC3339 time"),
+		offsets:       fs.String("offsets", "", "start at these partition:offset pairs, e.g. 0:120,1:95"),
+	}
+}
+
+// target returns the chosen start position, nil when none was given
+func (o *startOptions) target() (offsetTarget, error) {
+	var chosen []string
+	if *o.fromBeginning {
+		chosen = append(chosen, "earliest")
+	}
+	if *o.fromLatest {
+		chosen = append(chosen, "latest")
+	}
+	if *o.since != 0 {
+		chosen = append(chosen, o.since.String())
+	}
+	if *o.sinceTime != "" {
+		if _, err := time.Parse(time.RFC3339, *o.sinceTime); err != nil {
+			return nil, fmt.Errorf("invalid -since-time %w", err)
+		}
+		chosen = append(chosen, *o.sinceTime)
+	}
+	if *o.offsets != "" {
+		chosen = append(chosen, *o.offsets)
+	}
+
+	switch len(chosen) {
+	case 0:
+		return nil, nil
+	case 1:
+		return parseOffsetTarget(chosen[0])
+	default:
+		return nil, errors.New("only one of -from-beginning, -from-latest, -since, -since-time and -offsets can be used")
+	}
+}
+
+func runResetOffsets(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	group := fs.String("group", "", "consumer group to reset")
+	topic := fs.String("topic", producer.DefaultTopic, "topic whose offsets are reset")
+	to := fs.String("to", "", "earliest, latest, a duration ago (2h), an RFC3339 time, or partition:offset pairs (0:120,1:95)")
+	execute := fs.Bool("execute", false, "commit the new offsets, otherwise only the planned changes are shown")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs()
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+	if *group == "" || *to == "" {
+		fs.Usage()
+		return errors.New("-group and -to are required")
+	}
+	target, err := parseOffsetTarget(*to)
+	if err != nil {
+		return err
+	}
+
+	client, admin, err := newAdmin(globals)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	//the coordinator rejects commits from outside an active group, say why up front
+	if *execute {
+		descriptions, err := admin.DescribeConsumerGroups([]string{*group})
+		if err != nil {
+			return fmt.Errorf("failed to describe %s %w", *group, err)
+		}
+		if state := descriptions[0].State; state != "Empty" && state != "Dead" {
+			return fmt.Errorf("group %s is %s, stop its consumers before resetting offsets", *group, state)
+		}
+	}
+
+	partitions, err := client.Partitions(*topic)
+	if err != nil {
+		return fmt.Errorf("failed to list partitions of %s %w", *topic, err)
+	}
+	current, err := admin.ListConsumerGroupOffsets(*group, map[string][]int32{*topic: partitions})
+	if err != nil {
+		return fmt.Errorf("failed to read offsets of %s %w", *group, err)
+	}
+
+	type reset struct {
+		partition int32
+		offset    int64
+	}
+	var resets []reset
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PARTITION\tCURRENT\tNEW\tDELTA")
+	for _, partition := range partitions {
+		offset, ok, err := target(client, *topic, partition)
+		if err != nil {
+			return fmt.Errorf("failed to resolve offset of partition %d %w", partition, err)
+		}
+		if !ok {
+			continue
+		}
+
+		committed := int64(-1)
+		if block := current.GetBlock(*topic, partition); block != nil {
+			committed = block.Offset
+		}
+		delta := "-"
+		if committed >= 0 {
+			delta = fmt.Sprintf("%+d", offset-committed)
+		}
+		fmt.Fprintf(w, "%d\t%d\t%d\t%s\n", partition, committed, offset, delta)
+		resets = append(resets, reset{partition, offset})
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !*execute {
+		fmt.Println("Dry run, add -execute to commit these offsets")
+		return nil
+	}
+
+	om, err := sarama.NewOffsetManagerFromClient(*group, client)
+	if err != nil {
+		return fmt.Errorf("failed to create offset manager %w", err)
+	}
+	defer om.Close()
+
+	poms := make([]sarama.PartitionOffsetManager, 0, len(resets))
+	for _, r := range resets {
+		pom, err := om.ManagePartition(*topic, r.partition)
+		if err != nil {
+			return fmt.Errorf("failed to manage partition %d %w", r.partition, err)
+		}
+		pom.ResetOffset(r.offset, "")
+		poms = append(poms, pom)
+	}
+	om.Commit()
+
+	var errs []error
+	for _, pom := range poms {
+		if err := pom.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to commit offsets %w", err)
+	}
+	fmt.Printf("Committed %d offsets for %s\n", len(resets), *group)
+	return nil
+}
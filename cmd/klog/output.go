@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"kafka-logging-system/internal/ecs"
+	"kafka-logging-system/internal/models"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/term"
+)
+
+// Output formats for printed entries
+const (
+	outputPretty   = "pretty"
+	outputJSON     = "json"
+	outputLogfmt   = "logfmt"
+	outputECS      = "ecs"
+	outputTemplate = "template"
+	outputColumns  = "columns"
+)
+
+// outputOptions configure the printed format
+type outputOptions struct {
+	format   string
+	template string
+	palette  palette
+	//columns: message column width, 0 fits the terminal
+	messageWidth int
+	//columns: show metadata after the message
+	wide bool
+}
+
+// outputRecord is what templates see: the entry's fields plus where it was read from
+type outputRecord struct {
+	*models.LogEntry
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+func templateFuncs(pal palette) template.FuncMap {
+	return template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"color":    pal.level,
+		"appcolor": pal.app,
+		"reset":    pal.reset,
+	}
+}
+
+// parseOutput returns the renderer for an output format, nil for pretty
+func parseOutput(opts outputOptions) (func(io.Writer, outputRecord) error, error) {
+	format, text, pal := opts.format, opts.template, opts.palette
+	if text != "" && format == outputPretty {
+		format = outputTemplate
+	}
+
+	switch format {
+	case outputColumns:
+		return columnWriter(opts), nil
+	case outputPretty:
+		return nil, nil
+	case outputJSON:
+		return writeJSONLine, nil
+	case outputLogfmt:
+		return writeLogfmt, nil
+	case outputECS:
+		return writeECSLine, nil
+	case outputTemplate:
+		if text == "" {
+			return nil, fmt.Errorf("-output template needs a -template")
+		}
+		tmpl, err := template.New("output").Funcs(templateFuncs(pal)).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -template %w", err)
+		}
+		return func(w io.Writer, rec outputRecord) error {
+			if err := tmpl.Execute(w, rec); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, "\n")
+			return err
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown output %q, expected pretty, columns, json, logfmt, ecs or template", format)
+}
+
+func writeJSONLine(w io.Writer, rec outputRecord) error {
+	data, err := rec.ToJson()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// writeECSLine writes the entry as one Elastic Common Schema document
+func writeECSLine(w io.Writer, rec outputRecord) error {
+	data, err := ecs.Marshal(rec.LogEntry)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// writeLogfmt writes the entry as one logfmt line, see models.ToLogfmt,
+// followed by where it was read from
+func writeLogfmt(w io.Writer, rec outputRecord) error {
+	line, err := rec.ToLogfmt()
+	if err != nil {
+		return err
+	}
+	line = fmt.Appendf(line, " partition=%d offset=%d\n", rec.Partition, rec.Offset)
+	_, err = w.Write(line)
+	return err
+}
+
+// Fixed column widths of the columns output, the message takes the rest
+const (
+	appColumn   = 18
+	levelColumn = 5
+	//time, app and level columns with the spaces between them
+	messageColumnStart = 8 + 2 + appColumn + 2 + levelColumn + 2
+)
+
+// columnWriter prints aligned time, app, level and message columns,
+// truncating with an ellipsis so every entry stays on one line
+func columnWriter(opts outputOptions) func(io.Writer, outputRecord) error {
+	width := opts.messageWidth
+	if width == 0 && isTerminal(os.Stdout) {
+		if cols, _, err := term.GetSize(os.Stdout.Fd()); err == nil {
+			width = max(cols-messageColumnStart, 10)
+		}
+	}
+	pal := opts.palette
+
+	return func(w io.Writer, rec outputRecord) error {
+		e := rec.LogEntry
+		color := pal.line(e)
+		level := fmt.Sprintf("%-*s", levelColumn, e.Level)
+		if pal.byApp {
+			level = pal.level(e.Level) + level + color
+		}
+
+		message := strings.ReplaceAll(e.Message, "\n", " ")
+		if width > 0 {
+			message = ansi.Truncate(message, width, "…")
+		}
+
+		line := fmt.Sprintf("%s  %-*s  %s  %s",
+			e.Timestamp.Format("15:04:05"), appColumn, ansi.Truncate(e.Application, appColumn, "…"), level, message)
+
+		if opts.wide && len(e.Metadata) > 0 {
+			if width > 0 {
+				line += strings.Repeat(" ", max(width-ansi.StringWidth(message), 0))
+			}
+			keys := make([]string, 0, len(e.Metadata))
+			for key := range e.Metadata {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				line += fmt.Sprintf("  %s=%v", key, e.Metadata[key])
+			}
+		}
+
+		_, err := fmt.Fprintf(w, "%s%s%s\n", color, line, pal.reset())
+		return err
+	}
+}
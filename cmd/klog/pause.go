@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// maxPauseBody bounds the partitions accepted by POST /admin/pause and /admin/resume
+const maxPauseBody = 64 * 1024
+
+// pauser pauses and resumes fetching for a consumer group, so operators can
+// freeze the stream while investigating. Messages already fetched are still
+// printed. It is safe for concurrent use.
+type pauser struct {
+	group sarama.ConsumerGroup
+
+	mu  sync.Mutex
+	all bool
+	//partitions are paused one by one, by topic
+	partitions map[string]map[int32]bool
+}
+
+// pauseState is what GET /admin/pause returns
+type pauseState struct {
+	All        bool               `json:"all"`
+	Partitions map[string][]int32 `json:"partitions,omitempty"`
+}
+
+func newPauser(group sarama.ConsumerGroup) *pauser {
+	return &pauser{group: group, partitions: make(map[string]map[int32]bool)}
+}
+
+// pause stops fetching from partitions, or from every partition when nil
+func (p *pauser) pause(partitions map[string][]int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if partitions == nil {
+		p.all = true
+		clear(p.partitions)
+		p.group.PauseAll()
+		slog.Info("Paused consumption of all partitions")
+		return
+	}
+	for topic, ids := range partitions {
+		if p.partitions[topic] == nil {
+			p.partitions[topic] = make(map[int32]bool)
+		}
+		for _, id := range ids {
+			p.partitions[topic][id] = true
+		}
+	}
+	p.group.Pause(partitions)
+	slog.Info("Paused consumption", "partitions", partitions)
+}
+
+var errAllPaused = errors.New("all partitions are paused, resume them all first")
+
+// resume fetches from partitions again, or from every partition when nil.
+// Single partitions can't be resumed while all of them are paused.
+func (p *pauser) resume(partitions map[string][]int32) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if partitions == nil {
+		p.all = false
+		clear(p.partitions)
+		p.group.ResumeAll()
+		slog.Info("Resumed consumption of all partitions")
+		return nil
+	}
+	if p.all {
+		return errAllPaused
+	}
+	for topic, ids := range partitions {
+		for _, id := range ids {
+			delete(p.partitions[topic], id)
+		}
+		if len(p.partitions[topic]) == 0 {
+			delete(p.partitions, topic)
+		}
+	}
+	p.group.Resume(partitions)
+	slog.Info("Resumed consumption", "partitions", partitions)
+	return nil
+}
+
+// toggle resumes every partition when any is paused, else pauses them all,
+// and reports whether consumption is paused now
+func (p *pauser) toggle() bool {
+	if p.paused() {
+		p.resume(nil)
+		return false
+	}
+	p.pause(nil)
+	return true
+}
+
+// paused reports whether any partition is paused
+func (p *pauser) paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.all || len(p.partitions) > 0
+}
+
+// claimed pauses a partition the group was just given if it was paused
+// before. Sarama only pauses the partitions claimed at the time, so pauses
+// are applied again after every rebalance.
+func (p *pauser) claimed(topic string, partition int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.all || p.partitions[topic][partition] {
+		p.group.Pause(map[string][]int32{topic: {partition}})
+	}
+}
+
+func (p *pauser) state() pauseState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state := pauseState{All: p.all}
+	if len(p.partitions) > 0 {
+		state.Partitions = make(map[string][]int32, len(p.partitions))
+		for topic, ids := range p.partitions {
+			for id := range ids {
+				state.Partitions[topic] = append(state.Partitions[topic], id)
+			}
+			slices.Sort(state.Partitions[topic])
+		}
+	}
+	return state
+}
+
+// register serves GET /admin/pause, and POST /admin/pause and /admin/resume
+// taking partitions by topic such as {"raw-logs": [0, 2]}, or an empty body
+// for every partition
+func (p *pauser) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/pause", func(w http.ResponseWriter, _ *http.Request) {
+		writePauseJSON(w, http.StatusOK, p.state())
+	})
+	mux.HandleFunc("POST /admin/pause", func(w http.ResponseWriter, r *http.Request) {
+		partitions, err := readPartitions(w, r)
+		if err != nil {
+			writePauseJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		p.pause(partitions)
+		writePauseJSON(w, http.StatusOK, p.state())
+	})
+	mux.HandleFunc("POST /admin/resume", func(w http.ResponseWriter, r *http.Request) {
+		partitions, err := readPartitions(w, r)
+		if err != nil {
+			writePauseJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := p.resume(partitions); err != nil {
+			writePauseJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		writePauseJSON(w, http.StatusOK, p.state())
+	})
+}
+
+// readPartitions decodes the partitions of a request, nil for an empty body
+func readPartitions(w http.ResponseWriter, r *http.Request) (map[string][]int32, error) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPauseBody))
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	var partitions map[string][]int32
+	if err := json.Unmarshal(data, &partitions); err != nil {
+		return nil, err
+	}
+	if len(partitions) == 0 {
+		return nil, errors.New("no partitions given, send an empty body for all of them")
+	}
+	return partitions, nil
+}
+
+func writePauseJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error writing response", "err", err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "context"
+
+// togglePauseOnSignal does nothing, there is no SIGUSR1 on this platform
+func togglePauseOnSignal(ctx context.Context, p *pauser) {}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// togglePauseOnSignal pauses or resumes every partition on SIGUSR1 until ctx is done
+func togglePauseOnSignal(ctx context.Context, p *pauser) {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	go func() {
+		defer signal.Stop(usr1)
+		for {
+			select {
+			case <-usr1:
+				p.toggle()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/spool"
+	"kafka-logging-system/pkg/consumer"
+
+	"github.com/IBM/sarama"
+)
+
+// Policies applied when a sink queue is full
+const (
+	//policyBlock waits for the sink, which pauses consumption
+	policyBlock = "block"
+	//policyDropDebug drops TRACE and DEBUG entries and waits for the rest
+	policyDropDebug = "drop-debug"
+	//policySpill writes entries to disk and prints them once the sink catches up
+	policySpill = "spill"
+)
+
+type pipelineOptions struct {
+	workers       *int
+	decodeQueue   *int
+	processQueue  *int
+	sinkQueue     *int
+	policy        *string
+	spillDir      *string
+	statsInterval *time.Duration
+}
+
+func registerPipelineFlags(fs *flag.FlagSet) *pipelineOptions {
+	return &pipelineOptions{
+		workers:       fs.Int("workers", 1, "messages of a partition printed in parallel, messages with the same key stay in order"),
+		decodeQueue:   fs.Int("decode-queue", 100, "messages per partition waiting to be decoded before consumption pauses"),
+		processQueue:  fs.Int("process-queue", 100, "decoded entries per partition waiting to be filtered"),
+		sinkQueue:     fs.Int("worker-queue", 100, "entries waiting per worker to be printed before -queue-policy applies"),
+		policy:        fs.String("queue-policy", policyBlock, "when a worker queue is full: block, drop-debug or spill"),
+		spillDir:      fs.String("spill-dir", "klog-spill", "spill: directory entries are written to while the output is behind"),
+		statsInterval: fs.Duration("stats-interval", 0, "how often queue depths are logged to stderr (0 disables)"),
+	}
+}
+
+// pipeline runs each claim through decode, process and sink stages connected
+// by bounded queues, so a slow sink degrades by the queue policy instead of
+// holding unbounded entries in memory
+type pipeline struct {
+	printer *printer
+	commits *committer
+
+	workers      int
+	decodeQueue  int
+	processQueue int
+	sinkQueue    int
+	policy       string
+	spool        *spool.Spool
+
+	stats pipelineStats
+}
+
+// pipelineStats are summed over every claim
+type pipelineStats struct {
+	//Queue depths of each stage
+	decoding   atomic.Int64
+	processing atomic.Int64
+	sinking    atomic.Int64
+
+	dropped  atomic.Int64
+	spilled  atomic.Int64
+	replayed atomic.Int64
+}
+
+func (s *pipelineStats) String() string {
+	return fmt.Sprintf("decode-queue=%d process-queue=%d worker-queues=%d dropped=%d spilled=%d replayed=%d",
+		s.decoding.Load(),
+		s.processing.Load(),
+		s.sinking.Load(),
+		s.dropped.Load(),
+		s.spilled.Load(),
+		s.replayed.Load(),
+	)
+}
+
+// job is a decoded message travelling to the sink
+type job struct {
+	message *sarama.ConsumerMessage
+	entry   *models.LogEntry
+}
+
+// spilledEntry is how a job is kept on disk
+type spilledEntry struct {
+	Entry     *models.LogEntry `json:"entry"`
+	Topic     string           `json:"topic"`
+	Partition int32            `json:"partition"`
+	Offset    int64            `json:"offset"`
+}
+
+func (o *pipelineOptions) pipeline(p *printer, commits *committer) (*pipeline, error) {
+	pl := &pipeline{
+		printer:      p,
+		commits:      commits,
+		workers:      *o.workers,
+		decodeQueue:  *o.decodeQueue,
+		processQueue: *o.processQueue,
+		sinkQueue:    *o.sinkQueue,
+		policy:       *o.policy,
+	}
+	if pl.workers < 1 {
+		return nil, fmt.Errorf("-workers must be at least 1")
+	}
+	if pl.decodeQueue < 0 || pl.processQueue < 0 || pl.sinkQueue < 0 {
+		return nil, fmt.Errorf("queue sizes can't be negative")
+	}
+
+	switch pl.policy {
+	case policyBlock, policyDropDebug:
+	case policySpill:
+		s, err := spool.Open(*o.spillDir)
+		if err != nil {
+			return nil, err
+		}
+		pl.spool = s
+	default:
+		return nil, fmt.Errorf("unknown queue policy %q, expected block, drop-debug or spill", pl.policy)
+	}
+	return pl, nil
+}
+
+// run logs the stats and prints spilled entries once the sinks are idle, until ctx is done
+func (pl *pipeline) run(ctx context.Context, statsInterval time.Duration) {
+	if statsInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(statsInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					slog.Info("Pipeline stats", "stats", pl.stats.String())
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	if pl.spool == nil {
+		return
+	}
+	//Entries left by an earlier run are printed first
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			if pl.stats.sinking.Load() == 0 {
+				if err := pl.spool.Replay(pl.replay); err != nil {
+					slog.Error("Error printing spilled entries, retrying", "err", err)
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// consume runs a claim through the stages. Offsets are marked in partition
+// order once every earlier message was printed, filtered out, dropped or
+// spilled. When the session ends the stages finish what they hold first.
+func (pl *pipeline) consume(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx, cancel := context.WithCancel(session.Context())
+	defer cancel()
+	marks := &offsetTracker{session: session, commits: pl.commits, cancel: cancel, results: make(map[int64]error)}
+
+	decodeQueue := make(chan *sarama.ConsumerMessage, pl.decodeQueue)
+	processQueue := make(chan job, pl.processQueue)
+	sinkQueues := make([]chan job, pl.workers)
+
+	var wg sync.WaitGroup
+
+	//Sink stage, one worker per queue
+	for i := range sinkQueues {
+		sinkQueues[i] = make(chan job, pl.sinkQueue)
+		wg.Add(1)
+		go func(queue chan job) {
+			defer wg.Done()
+			for j := range queue {
+				pl.stats.sinking.Add(-1)
+				marks.finish(j.message, pl.printer.output(j.entry, j.message))
+			}
+		}(sinkQueues[i])
+	}
+
+	//Process stage, filters and routes entries to the worker of their key
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			for _, queue := range sinkQueues {
+				close(queue)
+			}
+		}()
+		for j := range processQueue {
+			pl.stats.processing.Add(-1)
+			if !pl.printer.keep(j.entry, j.message.Topic) {
+				marks.finish(j.message, nil)
+				continue
+			}
+			pl.enqueue(sinkQueues[worker(j.message, len(sinkQueues))], j, marks)
+		}
+	}()
+
+	//Decode stage
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(processQueue)
+		for message := range decodeQueue {
+			pl.stats.decoding.Add(-1)
+			entry, ok := pl.printer.decode(message)
+			if !ok {
+				marks.finish(message, nil)
+				continue
+			}
+			pl.stats.processing.Add(1)
+			processQueue <- job{message: message, entry: entry}
+		}
+	}()
+
+	//Messages enter the stages through the middleware registered with consumer.Use
+	dispatch := consumer.Wrap(consumer.HandlerFunc(func(ctx context.Context, message *sarama.ConsumerMessage) error {
+		pl.printer.consumed(message, claim.HighWaterMarkOffset())
+		marks.add(message)
+
+		//A full queue blocks the claim, which pauses fetching.
+		//A message left undispatched is never marked, so it is read again.
+		pl.stats.decoding.Add(1)
+		select {
+		case decodeQueue <- message:
+			return nil
+		case <-ctx.Done():
+			pl.stats.decoding.Add(-1)
+			return ctx.Err()
+		}
+	}), consumer.Recover())
+
+	var err error
+consume:
+	for {
+		select {
+		case message := <-claim.Messages():
+			if message == nil {
+				break consume
+			}
+			if err = dispatch.Handle(ctx, message); err != nil {
+				if ctx.Err() != nil {
+					err = nil
+				}
+				break consume
+			}
+
+		case <-ctx.Done():
+			break consume
+		}
+	}
+
+	//Let the stages finish what they were given, so it is marked before the session ends
+	close(decodeQueue)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return marks.err()
+}
+
+// enqueue hands a job to a sink worker, applying the queue policy when it is full
+func (pl *pipeline) enqueue(queue chan job, j job, marks *offsetTracker) {
+	pl.stats.sinking.Add(1)
+	select {
+	case queue <- j:
+		return
+	default:
+	}
+
+	switch pl.policy {
+	case policyDropDebug:
+		if j.entry.Level == models.TRACE || j.entry.Level == models.DEBUG {
+			pl.stats.sinking.Add(-1)
+			pl.stats.dropped.Add(1)
+			marks.finish(j.message, nil)
+			return
+		}
+	case policySpill:
+		if err := pl.spill(j); err != nil {
+			slog.Error("Error spilling entry, waiting for the output", "err", err)
+			break
+		}
+		pl.stats.sinking.Add(-1)
+		pl.stats.spilled.Add(1)
+		marks.finish(j.message, nil)
+		return
+	}
+	queue <- j
+}
+
+func (pl *pipeline) spill(j job) error {
+	data, err := json.Marshal(spilledEntry{Entry: j.entry, Topic: j.message.Topic, Partition: j.message.Partition, Offset: j.message.Offset})
+	if err != nil {
+		return fmt.Errorf("failed to marshal spilled entry %w", err)
+	}
+	return pl.spool.Append(data)
+}
+
+// replay prints one spilled entry
+func (pl *pipeline) replay(record []byte) error {
+	var spilled spilledEntry
+	if err := json.Unmarshal(record, &spilled); err != nil || spilled.Entry == nil {
+		slog.Warn("Skipping unreadable spilled entry", "err", err)
+		return nil
+	}
+	message := &sarama.ConsumerMessage{Topic: spilled.Topic, Partition: spilled.Partition, Offset: spilled.Offset}
+	if err := pl.printer.output(spilled.Entry, message); err != nil {
+		return err
+	}
+	pl.stats.replayed.Add(1)
+	return nil
+}
+
+// worker picks the worker of a message by hashing its key, unkeyed
+// messages share the first worker to keep partition order
+func worker(message *sarama.ConsumerMessage, workers int) int {
+	if len(message.Key) == 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write(message.Key)
+	return int(h.Sum32() % uint32(workers))
+}
+
+// offsetTracker marks the messages of a claim in offset order, once every
+// earlier message is done
+type offsetTracker struct {
+	session sarama.ConsumerGroupSession
+	commits *committer
+	//cancel ends the claim when the commit strategy rejects a result
+	cancel func()
+
+	mu sync.Mutex
+	//inflight holds dispatched messages in offset order until they are marked
+	inflight []*sarama.ConsumerMessage
+	results  map[int64]error
+	failed   error
+}
+
+func (t *offsetTracker) add(message *sarama.ConsumerMessage) {
+	t.mu.Lock()
+	t.inflight = append(t.inflight, message)
+	t.mu.Unlock()
+}
+
+// finish records the result of a message and marks every leading message that is done
+func (t *offsetTracker) finish(message *sarama.ConsumerMessage, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.results[message.Offset] = err
+	for len(t.inflight) > 0 && t.failed == nil {
+		next := t.inflight[0]
+		err, ok := t.results[next.Offset]
+		if !ok {
+			return
+		}
+		delete(t.results, next.Offset)
+		t.inflight = t.inflight[1:]
+
+		if err := t.commits.processed(t.session, next, err); err != nil {
+			slog.Error("Error processing message, restarting from the last commit", "err", err)
+			t.failed = err
+			t.cancel()
+		}
+	}
+}
+
+func (t *offsetTracker) err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.failed
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kafka-logging-system/internal/envelope"
+	"kafka-logging-system/internal/latency"
+	"kafka-logging-system/internal/livetail"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/reload"
+
+	"github.com/IBM/sarama"
+)
+
+// printer decodes, filters and displays log messages
+type printer struct {
+	palette palette
+	//render prints entries in a machine readable or templated format, nil for pretty
+	render func(io.Writer, outputRecord) error
+	//format decodes messages without a content-type header
+	format models.Format
+	//filters can change while consuming, see setFilters
+	filters atomic.Pointer[reload.Filters]
+	//topics override the format, render and filters of their messages when
+	//consuming several topics or a topic file
+	topics map[string]*topicView
+
+	//hub receives matching entries for WebSocket clients when serving
+	hub   *livetail.Hub
+	quiet bool
+	//view shows entries in the TUI instead of printing them
+	view *tuiView
+	//latency records how long messages took from the producer when measuring
+	latency *latency.Recorder
+
+	//mu keeps lines printed by parallel claims and workers whole
+	mu sync.Mutex
+	//out buffers printed lines, it is flushed when full and every flush interval
+	out          *bufio.Writer
+	line         bytes.Buffer
+	stopFlushing chan struct{}
+	//syncWrites flushes every line, so write errors reach the commit strategy
+	syncWrites bool
+
+	//collapse holds a line back while the same message repeats, then
+	//prints it once with an xN suffix
+	collapse bool
+	held     *models.LogEntry
+	heldLine []byte
+	repeats  int
+}
+
+// Color codes for different log levels
+var levelColors = map[models.LogLevel]string{
+	models.TRACE: "\033[90m", // Gray
+	models.DEBUG: "\033[36m", // Cyan
+	models.INFO:  "\033[32m", // Green
+	models.WARN:  "\033[33m", // Yellow
+	models.ERROR: "\033[31m", // Red
+	models.FATAL: "\033[35m", // Magenta
+}
+
+const (
+	colorReset = "\033[0m"
+	colorDim   = "\033[2m"
+)
+
+// consumed records a message read from a partition whose end is highWater
+func (p *printer) consumed(message *sarama.ConsumerMessage, highWater int64) {
+	if p.latency != nil {
+		p.latency.Observe(message, time.Now())
+	}
+	if p.view != nil {
+		p.view.consumedMessage(message.Partition, highWater-message.Offset-1)
+	}
+}
+
+// Process the log message. The error reports output that could not be
+// written, messages that fail to decode or are filtered out are done.
+func (p *printer) proccessLogMessage(message *sarama.ConsumerMessage) error {
+	messages, err := envelope.Unpack(message)
+	if err != nil {
+		p.decodeFailed(err)
+		return nil
+	}
+	for _, message := range messages {
+		logEntry, ok := p.decode(message)
+		if !ok || !p.keep(logEntry, message.Topic) {
+			continue
+		}
+		if err := p.output(logEntry, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decode returns the entry of a message, false when it failed to decode or
+// belongs to another trace
+func (p *printer) decode(message *sarama.ConsumerMessage) (*models.LogEntry, bool) {
+	//Skip other traces before paying for decoding when the producer set the header
+	if want := p.filters.Load().TraceID; want != "" {
+		if traceID, ok := envelope.Header(message, models.HeaderTraceID); ok && traceID != want {
+			return nil, false
+		}
+	}
+
+	//Decode with the encoding advertised by the producer
+	format := p.format
+	if view := p.topics[message.Topic]; view != nil {
+		format = view.format
+	}
+	logEntry, err := envelope.Decode(message, format)
+	if err != nil {
+		p.decodeFailed(err)
+		return nil, false
+	}
+	return logEntry, true
+}
+
+// decodeFailed reports a message that failed to decode
+func (p *printer) decodeFailed(err error) {
+	if p.view != nil {
+		p.view.decodeError()
+		return
+	}
+	//stderr keeps machine readable output parseable
+	fmt.Fprintln(os.Stderr, "Error parsing the log message ", err)
+}
+
+// keep applies the filters, and the least severe level of the topic, and
+// hands matching entries to WebSocket clients
+func (p *printer) keep(entry *models.LogEntry, topic string) bool {
+	if !p.matches(entry) {
+		return false
+	}
+	if view := p.topics[topic]; view != nil && entry.Level.Severity() < view.minSeverity {
+		return false
+	}
+	if p.hub != nil {
+		p.hub.Publish(entry)
+	}
+	return true
+}
+
+// output shows an entry in the TUI or prints it in the configured format
+func (p *printer) output(entry *models.LogEntry, message *sarama.ConsumerMessage) error {
+	if p.view != nil {
+		p.view.add(entry, message.Partition, message.Offset)
+		return nil
+	}
+	if p.quiet {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.collapse && p.held != nil && sameMessage(p.held, entry) {
+		p.repeats++
+		return nil
+	}
+
+	render, label := p.render, ""
+	if view := p.topics[message.Topic]; view != nil {
+		render, label = view.render, view.label
+	}
+
+	p.line.Reset()
+	switch {
+	case render != nil:
+		rec := outputRecord{LogEntry: entry, Topic: message.Topic, Partition: message.Partition, Offset: message.Offset}
+		if err := render(&p.line, rec); err != nil {
+			fmt.Fprintln(os.Stderr, "Error printing the log message ", err)
+			return err
+		}
+	default:
+		if label != "" {
+			fmt.Fprintf(&p.line, "%s[%s]%s ", p.palette.dim(), label, p.palette.reset())
+		}
+		p.displayLog(&p.line, entry, message.Partition, message.Offset)
+	}
+
+	if p.collapse {
+		//The line is printed once the run of identical messages ends
+		if err := p.release(); err != nil {
+			return err
+		}
+		p.held = entry
+		p.heldLine = append(p.heldLine[:0], p.line.Bytes()...)
+		p.repeats = 1
+		return nil
+	}
+
+	if _, err := p.out.Write(p.line.Bytes()); err != nil {
+		return err
+	}
+	if p.syncWrites {
+		return p.out.Flush()
+	}
+	return nil
+}
+
+// sameMessage reports whether two entries collapse into one line
+func sameMessage(a, b *models.LogEntry) bool {
+	return a.Application == b.Application && a.Level == b.Level && a.Message == b.Message
+}
+
+// release writes the held line, with an xN suffix when its message repeated
+func (p *printer) release() error {
+	if p.held == nil {
+		return nil
+	}
+	line := p.heldLine
+	if p.repeats > 1 {
+		line = fmt.Appendf(bytes.TrimSuffix(line, []byte("\n")), " x%d\n", p.repeats)
+	}
+	p.held = nil
+	_, err := p.out.Write(line)
+	return err
+}
+
+// flush writes the held and buffered lines to stdout
+func (p *printer) flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.release(); err != nil {
+		return err
+	}
+	return p.out.Flush()
+}
+
+// startFlushing flushes buffered lines every interval until close
+func (p *printer) startFlushing(interval time.Duration) {
+	p.stopFlushing = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.flush(); err != nil {
+					fmt.Fprintln(os.Stderr, "Error printing the log message ", err)
+				}
+			case <-p.stopFlushing:
+				return
+			}
+		}
+	}()
+}
+
+// close stops the flush timer and prints what is still buffered
+func (p *printer) close() error {
+	if p.stopFlushing != nil {
+		close(p.stopFlushing)
+		p.stopFlushing = nil
+	}
+	return p.flush()
+}
+
+// setFilters replaces the filters of entries printed from now on
+func (p *printer) setFilters(filters reload.Filters) {
+	p.filters.Store(&filters)
+}
+
+// matches applies the configured filters to a decoded entry
+func (p *printer) matches(entry *models.LogEntry) bool {
+	f := p.filters.Load()
+	switch {
+	case f.TraceID != "" && entry.TraceID != f.TraceID:
+		return false
+	case f.Host != "" && entry.Hostname != f.Host:
+		return false
+	case f.Environment != "" && entry.Environment != f.Environment:
+		return false
+	}
+	return true
+}
+
+func (p *printer) displayLog(w io.Writer, entry *models.LogEntry, partition int32, offset int64) {
+	p.displayLine(w, entry)
+
+	//Add partition and offset info
+	fmt.Fprintf(w, " (p:%d, o:%d)\n", partition, offset)
+
+	p.displayError(w, entry)
+}
+
+// displayLine writes the pretty line of an entry without where it was read
+// from or a newline
+func (p *printer) displayLine(w io.Writer, entry *models.LogEntry) {
+	color, reset := p.palette.line(entry), p.palette.reset()
+
+	//When coloring by application the level keeps its own color
+	level := string(entry.Level)
+	if p.palette.byApp {
+		level = p.palette.level(entry.Level) + level + color
+	}
+
+	// Format: [TIMESTAMP] [ENV HOST:PID] [APP] [LEVEL] MESSAGE [metadata]
+	fmt.Fprintf(w, "%s[%s] %s[%s] [%s] %s%s",
+		color,
+		entry.Timestamp.Format("15:04:05"),
+		origin(entry),
+		entry.Application,
+		level,
+		entry.Message,
+		reset,
+	)
+
+	//Add metadata as sorted key=value pairs
+	if len(entry.Metadata) > 0 {
+		keys := make([]string, 0, len(entry.Metadata))
+		for key := range entry.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		pairs := make([]string, 0, len(keys))
+		for _, key := range keys {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", key, entry.Metadata[key]))
+		}
+		fmt.Fprintf(w, " [%s]", strings.Join(pairs, " "))
+	}
+
+	if entry.TraceID != "" {
+		fmt.Fprintf(w, " trace:%s", entry.TraceID)
+	}
+}
+
+// displayError prints the error of an entry below its line, with the stack
+// trace indented and dimmed so the entries around it stay readable
+func (p *printer) displayError(w io.Writer, entry *models.LogEntry) {
+	if entry.ErrorType == "" && entry.ErrorMessage == "" && entry.StackTrace == "" {
+		return
+	}
+	dim, reset := p.palette.dim(), p.palette.reset()
+	if entry.ErrorType != "" || entry.ErrorMessage != "" {
+		fmt.Fprintf(w, "    %s%s: %s%s\n", p.palette.level(entry.Level), cmp.Or(entry.ErrorType, "error"), entry.ErrorMessage, reset)
+	}
+	for line := range strings.Lines(strings.TrimRight(entry.StackTrace, "\n")) {
+		fmt.Fprintf(w, "    %s%s%s\n", dim, strings.TrimRight(line, "\n"), reset)
+	}
+}
+
+// origin formats the environment, host and pid column, empty for entries without them
+func origin(entry *models.LogEntry) string {
+	var parts []string
+	if entry.Environment != "" {
+		parts = append(parts, string(entry.Environment))
+	}
+	if entry.Hostname != "" {
+		host := entry.Hostname
+		if entry.PID != 0 {
+			host = fmt.Sprintf("%s:%d", host, entry.PID)
+		}
+		parts = append(parts, host)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(parts, " ") + "] "
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/ingest"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/pkg/producer"
+)
+
+var produceCmd = &command{
+	name:  "produce",
+	usage: "message...",
+	short: "Send one log entry built from flags and arguments, or every line of stdin with -stdin",
+	run:   runProduce,
+}
+
+// metadataFlag collects repeated -meta key=value flags
+type metadataFlag map[string]any
+
+func (m metadataFlag) String() string { return "" }
+
+func (m metadataFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	m[key] = val
+	return nil
+}
+
+func runProduce(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	opts := registerProducerFlags(fs)
+	daemon := registerDaemonFlags(fs)
+	in := registerIngestFlags(fs, "klog")
+	traceID := fs.String("trace-id", "", "trace id of the entry")
+	requestID := fs.String("request-id", "", "request id of the entry")
+	stdin := fs.Bool("stdin", false, "send every line of stdin, parsed with -parser and completed from -app, -level and -meta")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs()
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+
+	switch {
+	case *stdin && fs.NArg() > 0:
+		return errors.New("-stdin reads messages from stdin, not from arguments")
+	case !*stdin && fs.NArg() == 0:
+		fs.Usage()
+		return errors.New("a message is required")
+	}
+	parser, defaults, err := in.build()
+	if err != nil {
+		return err
+	}
+
+	cfg := opts.config(globals)
+	p, err := producer.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create producer %w", err)
+	}
+	defer p.Close()
+
+	if *stdin {
+		//Handle graceful shutdown
+		ctx, stop := signalContext()
+		defer stop()
+		if err := daemon.startProducer(ctx, globals, p, cfg); err != nil {
+			return err
+		}
+		return produceLines(ctx, p, os.Stdin, parser, defaults)
+	}
+
+	entry := models.NewEntry(defaults.Application, defaults.Level, strings.Join(fs.Args(), " "),
+		models.WithTrace(*traceID, ""),
+		models.WithRequestID(*requestID),
+	)
+	if len(defaults.Metadata) > 0 {
+		entry.Metadata = defaults.Metadata
+	}
+
+	partition, offset, err := p.Send(entry)
+	if err != nil {
+		return err
+	}
+	if partition >= 0 {
+		fmt.Printf("Sent log to partition %d, offset %d\n", partition, offset)
+	}
+	return nil
+}
+
+// maxLineSize is the longest line -stdin accepts
+const maxLineSize = 1 << 20
+
+// produceLines sends every line of r until it ends or ctx is done
+func produceLines(ctx context.Context, p *producer.Producer, r io.Reader, parser ingest.Parser, defaults *ingest.Defaults) error {
+	//Reading blocks, so it runs apart from the loop watching for a signal
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+		for scanner.Scan() {
+			select {
+			case lines <- bytes.Clone(scanner.Bytes()):
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	var read int
+	stats := &ingestStats{}
+read:
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				break read
+			}
+			read++
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			entry, err := parser.Parse(line, defaults, time.Now())
+			if err != nil {
+				slog.Warn("Skipping line", "line", read, "err", err)
+				stats.skipped++
+				continue
+			}
+			if _, _, err := p.Send(entry); err != nil {
+				slog.Error("Error sending log", "err", err)
+				stats.failed++
+				continue
+			}
+			stats.sent++
+		case <-ctx.Done():
+			break read
+		}
+	}
+
+	slog.Info("Stopped reading stdin", "stats", stats.String())
+	select {
+	case err := <-readErr:
+		if err != nil {
+			return fmt.Errorf("failed to read stdin %w", err)
+		}
+	default:
+	}
+	return nil
+}
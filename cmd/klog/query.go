@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+var queryCmd = &command{
+	name:  "query",
+	usage: "[text]",
+	short: "Search the logs stored by the Query API",
+	run:   runQuery,
+}
+
+// logPage is the response of the Query API's /logs endpoint
+type logPage struct {
+	Entries []*models.LogEntry `json:"entries"`
+	Next    string             `json:"next_cursor"`
+}
+
+func runQuery(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	api := apiFlag(fs)
+	app := fs.String("app", "", "only show logs from this application")
+	levels := fs.String("level", "", "only show these comma separated levels, such as ERROR,FATAL")
+	from := fs.String("from", "", "oldest logs shown, RFC3339 or a duration before now such as 1h")
+	to := fs.String("to", "", "newest logs shown (exclusive), RFC3339 or a duration before now")
+	traceID := fs.String("trace", "", "only show logs of this trace id")
+	requestID := fs.String("request", "", "only show logs of this request id")
+	errorType := fs.String("error-type", "", "only show logs with this error type, such as *net.OpError")
+	limit := fs.Int("limit", 0, "entries per page, 100 by default and at most 1000")
+	cursor := fs.String("cursor", "", "continue from the page that printed this cursor")
+	all := fs.Bool("all", false, "fetch every page rather than the first")
+	output := fs.String("output", outputPretty, "how entries are printed: pretty, columns, json, logfmt, ecs or template")
+	tmpl := fs.String("template", "", "Go text/template for each line with the entry fields, implies -output template")
+	noColor := fs.Bool("no-color", false, "disable colors, also disabled by NO_COLOR or when stdout isn't a terminal")
+	colorBy := fs.String("color-by", "level", "color lines by level or app, app keeps the level colored")
+	timeout := fs.Duration("timeout", 30*time.Second, "how long to wait for each page")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs()
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+
+	if *limit < 0 {
+		return errors.New("-limit must not be negative")
+	}
+	palette, err := newPalette(*noColor, *colorBy)
+	if err != nil {
+		return err
+	}
+	render, err := parseOutput(outputOptions{format: *output, template: *tmpl, palette: palette})
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	for name, value := range map[string]string{
+		"app":        *app,
+		"level":      *levels,
+		"from":       *from,
+		"to":         *to,
+		"q":          strings.Join(fs.Args(), " "),
+		"trace_id":   *traceID,
+		"request_id": *requestID,
+		"error_type": *errorType,
+		"cursor":     *cursor,
+	} {
+		if value != "" {
+			params.Set(name, value)
+		}
+	}
+	if *limit > 0 {
+		params.Set("limit", strconv.Itoa(*limit))
+	}
+
+	p := &printer{palette: palette}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	endpoint := strings.TrimSuffix(*api, "/") + "/logs?"
+	for {
+		var page logPage
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		err := getJSON(ctx, endpoint+params.Encode(), &page)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range page.Entries {
+			if render != nil {
+				if err := render(out, outputRecord{LogEntry: entry}); err != nil {
+					return err
+				}
+				continue
+			}
+			p.displayLine(out, entry)
+			fmt.Fprintln(out)
+			p.displayError(out, entry)
+		}
+
+		if page.Next == "" {
+			return nil
+		}
+		if !*all {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "More entries, continue with -cursor %s or fetch them all with -all\n", page.Next)
+			return nil
+		}
+		params.Set("cursor", page.Next)
+	}
+}
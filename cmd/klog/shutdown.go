@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// signalContext is cancelled on the first SIGINT/SIGTERM. Once it is, the
+// default handlers are restored so a second signal kills a stuck shutdown.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+func registerDrainFlag(fs *flag.FlagSet) *time.Duration {
+	return fs.Duration("drain-timeout", 10*time.Second, "how long shutdown waits for in-flight messages (0 waits forever)")
+}
+
+// drain runs fn and waits for it at most timeout, so an unreachable broker
+// can't hold the process open forever
+func drain(timeout time.Duration, what string, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	if timeout <= 0 {
+		return <-done
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("gave up waiting for %s after %s", what, timeout)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/syslog"
+	"kafka-logging-system/pkg/producer"
+)
+
+var syslogCmd = &command{
+	name:  "syslog",
+	short: "Receive syslog messages over UDP and TCP and ship them",
+	run:   runSyslog,
+}
+
+func runSyslog(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	opts := registerProducerFlags(fs)
+	daemon := registerDaemonFlags(fs)
+	udp := fs.String("udp", ":514", "UDP address to receive syslog on, empty to disable")
+	tcp := fs.String("tcp", ":514", "TCP address to receive syslog on, empty to disable")
+	app := fs.String("app", "syslog", "application of messages that don't name one")
+	drainTimeout := registerDrainFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs()
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+	if *udp == "" && *tcp == "" {
+		return errors.New("-udp and -tcp can't both be disabled")
+	}
+
+	cfg := opts.config(globals)
+	p, err := producer.New(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create producer %w", err)
+	}
+
+	var sent, skipped, failed atomic.Int64
+	server := &syslog.Server{
+		DefaultApp: *app,
+		Handler: func(entry *models.LogEntry) {
+			if _, _, err := p.Send(entry); err != nil {
+				slog.Error("Error sending log", "err", err)
+				failed.Add(1)
+				return
+			}
+			sent.Add(1)
+		},
+		Invalid: func(remote string, err error) {
+			slog.Warn("Skipping syslog message", "remote", remote, "err", err)
+			skipped.Add(1)
+		},
+	}
+
+	//Handle graceful shutdown
+	ctx, stop := signalContext()
+	defer stop()
+	if err := daemon.startProducer(ctx, globals, p, cfg); err != nil {
+		return err
+	}
+
+	if *udp != "" {
+		if err := server.ListenUDP(ctx, *udp); err != nil {
+			stop()
+			p.Close()
+			return err
+		}
+		slog.Info("Receiving syslog", "udp", *udp)
+	}
+	if *tcp != "" {
+		if err := server.ListenTCP(ctx, *tcp); err != nil {
+			stop()
+			server.Wait()
+			p.Close()
+			return err
+		}
+		slog.Info("Receiving syslog", "tcp", *tcp)
+	}
+	fmt.Println("Ctrl-C to stop...")
+
+	<-ctx.Done()
+	server.Wait()
+	stats := &ingestStats{sent: sent.Load(), skipped: skipped.Load(), failed: failed.Load()}
+	slog.Info("Syslog stopped", "stats", stats.String())
+	return drain(*drainTimeout, "buffered messages", p.Close)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/pkg/producer"
+
+	"github.com/IBM/sarama"
+)
+
+var tailCmd = &command{
+	name:  "tail",
+	short: "Follow new logs on every partition, or chosen ones, without joining a consumer group",
+	run:   runTail,
+}
+
+// backlogIdle bounds the wait for a partition's last message, which may never
+// arrive when the end offset belongs to a transaction marker
+const backlogIdle = 2 * time.Second
+
+// runTail reads each partition, or those of -partition, directly from its
+// newest offset unless a start position is given, so it never commits
+// offsets or triggers a rebalance of the consumer groups
+func runTail(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	topic := fs.String("topic", producer.DefaultTopic, "topic to follow")
+	lines := fs.Int("n", 0, "print the last n messages across partitions by timestamp, then exit unless -f is set")
+	follow := fs.Bool("f", false, "with -n, keep following new messages")
+	only := fs.String("partition", "", "only read these partitions, comma separated (default all)")
+	atOffset := fs.Int64("offset", -1, "start every partition read at this offset, e.g. with -partition to inspect a skewed partition")
+	filters := registerFilterFlags(fs)
+	daemon := registerDaemonFlags(fs)
+	startFlags := registerStartFlags(fs)
+	live := registerLiveFlags(fs)
+	latencyFlags := registerLatencyFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs(*topic)
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+
+	printer, err := filters.printer()
+	if err != nil {
+		return err
+	}
+	//Buffered lines are printed before exiting
+	defer printer.close()
+	start, err := startFlags.target()
+	if err != nil {
+		return err
+	}
+	defer latencyFlags.start(printer)()
+	defer live.start(printer)()
+	if *atOffset >= 0 {
+		if start != nil {
+			return errors.New("-offset can't be combined with another start position")
+		}
+		start = func(sarama.Client, string, int32) (int64, bool, error) {
+			return *atOffset, true, nil
+		}
+	}
+	if *lines > 0 && start != nil {
+		return errors.New("-n can't be combined with a start position")
+	}
+	//without -n tail always follows
+	following := *lines <= 0 || *follow
+
+	client, err := globals.newClient(globals.kafka.Sarama())
+	if err != nil {
+		return fmt.Errorf("error creating kafka client %w", err)
+	}
+	defer client.Close()
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return fmt.Errorf("error creating consumer %w", err)
+	}
+	defer consumer.Close()
+
+	partitions, err := consumer.Partitions(*topic)
+	if err != nil {
+		return fmt.Errorf("error listing partitions of %s %w", *topic, err)
+	}
+	if *only != "" {
+		if partitions, err = choosePartitions(partitions, *only); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := daemon.startPrinter(ctx, globals, printer, filters); err != nil {
+		return err
+	}
+
+	//each partition sends its last messages, then waits for printed before following
+	backlogs := make(chan []*sarama.ConsumerMessage, len(partitions))
+	printed := make(chan struct{})
+
+	//one printer is shared by every partition, so lines are written one at a time
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, partition := range partitions {
+		offset, end := sarama.OffsetNewest, int64(0)
+		switch {
+		case *lines > 0:
+			if offset, end, err = lastOffsets(client, *topic, partition, int64(*lines)); err != nil {
+				return err
+			}
+		case start != nil:
+			o, ok, err := start(client, *topic, partition)
+			if err != nil {
+				return fmt.Errorf("failed to find start offset of partition %d %w", partition, err)
+			}
+			if ok {
+				offset = o
+			}
+		}
+
+		pc, err := consumer.ConsumePartition(*topic, partition, offset)
+		if err != nil {
+			return fmt.Errorf("error consuming partition %d %w", partition, err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer pc.Close()
+
+			if *lines > 0 {
+				backlogs <- readBacklog(ctx, pc, offset, end)
+				if !following {
+					return
+				}
+				select {
+				case <-printed:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			for {
+				select {
+				case message := <-pc.Messages():
+					mu.Lock()
+					printer.consumed(message, pc.HighWaterMarkOffset())
+					printer.proccessLogMessage(message)
+					mu.Unlock()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	if *lines > 0 {
+		var recent []*sarama.ConsumerMessage
+		for range partitions {
+			recent = append(recent, <-backlogs...)
+		}
+		sort.SliceStable(recent, func(i, j int) bool {
+			return recent[i].Timestamp.Before(recent[j].Timestamp)
+		})
+		if len(recent) > *lines {
+			recent = recent[len(recent)-*lines:]
+		}
+
+		mu.Lock()
+		for _, message := range recent {
+			printer.proccessLogMessage(message)
+		}
+		mu.Unlock()
+		close(printed)
+
+		if !following {
+			wg.Wait()
+			if printer.view != nil {
+				return printer.view.run(fmt.Sprintf("klog tail -n %d %s", *lines, *topic))
+			}
+			return nil
+		}
+	}
+
+	if printer.view != nil {
+		err := printer.view.run("klog tail " + *topic)
+		stop()
+		wg.Wait()
+		return err
+	}
+
+	slog.Info("Following partitions", "partitions", len(partitions), "topic", *topic)
+	fmt.Fprintln(os.Stderr, "Ctrl-C to stop...")
+
+	wg.Wait()
+	return nil
+}
+
+// choosePartitions returns the partitions of a comma separated list, which
+// must all exist
+func choosePartitions(existing []int32, list string) ([]int32, error) {
+	var chosen []int32
+	for _, s := range kafkaconfig.SplitList(list) {
+		partition, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid partition %q", s)
+		}
+		if !slices.Contains(existing, int32(partition)) {
+			return nil, fmt.Errorf("partition %d doesn't exist, the topic has %d", partition, len(existing))
+		}
+		if !slices.Contains(chosen, int32(partition)) {
+			chosen = append(chosen, int32(partition))
+		}
+	}
+	return chosen, nil
+}
+
+// lastOffsets returns where the last n messages of a partition start and the offset after them
+func lastOffsets(client sarama.Client, topic string, partition int32, n int64) (int64, int64, error) {
+	oldest, err := client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read offsets of partition %d %w", partition, err)
+	}
+	newest, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read offsets of partition %d %w", partition, err)
+	}
+	return max(oldest, newest-n), newest, nil
+}
+
+// readBacklog reads a partition from offset until end
+func readBacklog(ctx context.Context, pc sarama.PartitionConsumer, offset, end int64) []*sarama.ConsumerMessage {
+	var messages []*sarama.ConsumerMessage
+	for offset < end {
+		select {
+		case message := <-pc.Messages():
+			messages = append(messages, message)
+			offset = message.Offset + 1
+		case <-time.After(backlogIdle):
+			return messages
+		case <-ctx.Done():
+			return messages
+		}
+	}
+	return messages
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"kafka-logging-system/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// topicConfig declares how consume treats the messages of one topic, unset
+// fields fall back to the display flags
+type topicConfig struct {
+	Name string `yaml:"name"`
+	//Format decodes messages without a content-type header
+	Format string `yaml:"format"`
+	//Output and Template print the topic's entries like -output and -template
+	Output   string `yaml:"output"`
+	Template string `yaml:"template"`
+	//MinLevel hides entries less severe than it
+	MinLevel models.LogLevel `yaml:"min_level"`
+	//Label starts its pretty lines, defaulting to the topic when several are consumed
+	Label string `yaml:"label"`
+}
+
+type topicFile struct {
+	Topics []topicConfig `yaml:"topics"`
+}
+
+// loadTopics reads the topics to consume and their treatment from a YAML file
+func loadTopics(path string) ([]topicConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topics %w", err)
+	}
+
+	var file topicFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse topics %w", err)
+	}
+	if len(file.Topics) == 0 {
+		return nil, fmt.Errorf("no topics in %s", path)
+	}
+
+	names := make(map[string]bool, len(file.Topics))
+	for i, topic := range file.Topics {
+		if topic.Name == "" {
+			return nil, fmt.Errorf("topic %d has no name", i+1)
+		}
+		if names[topic.Name] {
+			return nil, fmt.Errorf("duplicate topic %s", topic.Name)
+		}
+		names[topic.Name] = true
+	}
+	return file.Topics, nil
+}
+
+// topicView is how the printer treats the messages of a topic
+type topicView struct {
+	format models.Format
+	//render prints entries, nil for pretty
+	render      func(io.Writer, outputRecord) error
+	minSeverity int
+	label       string
+}
+
+// topicViews builds the view of every consumed topic from its config, if
+// any, on top of the display flags. Lines are labelled with their topic when
+// several are consumed.
+func (o *filterOptions) topicViews(p *printer, topics []string, configs []topicConfig) (map[string]*topicView, error) {
+	byName := make(map[string]topicConfig, len(configs))
+	for _, cfg := range configs {
+		byName[cfg.Name] = cfg
+	}
+
+	views := make(map[string]*topicView, len(topics))
+	for _, topic := range topics {
+		cfg := byName[topic]
+		view := &topicView{format: p.format, render: p.render, minSeverity: cfg.MinLevel.Severity(), label: cfg.Label}
+		if view.label == "" && len(topics) > 1 {
+			view.label = topic
+		}
+		if cfg.Format != "" {
+			format, err := models.ParseFormat(cfg.Format)
+			if err != nil {
+				return nil, fmt.Errorf("topic %s %w", topic, err)
+			}
+			view.format = format
+		}
+		if cfg.Output != "" || cfg.Template != "" {
+			if p.view != nil {
+				return nil, fmt.Errorf("topic %s sets an output, which can't be combined with -tui", topic)
+			}
+			output := cfg.Output
+			if output == "" {
+				output = outputPretty
+			}
+			render, err := parseOutput(outputOptions{
+				format:       output,
+				template:     cfg.Template,
+				palette:      p.palette,
+				messageWidth: *o.msgWidth,
+				wide:         *o.wide,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("topic %s %w", topic, err)
+			}
+			view.render = render
+		}
+		views[topic] = view
+	}
+	return views, nil
+}
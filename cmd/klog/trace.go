@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+var traceCmd = &command{
+	name:  "trace",
+	usage: "id",
+	short: "Show every stored entry of a trace or request across applications as one timeline",
+	run:   runTrace,
+}
+
+// timeline is the response of the Query API's /timeline endpoint
+type timeline struct {
+	TraceID      string             `json:"trace_id"`
+	RequestID    string             `json:"request_id"`
+	Start        time.Time          `json:"start"`
+	End          time.Time          `json:"end"`
+	Applications []string           `json:"applications"`
+	Entries      []*models.LogEntry `json:"entries"`
+	Truncated    bool               `json:"truncated"`
+}
+
+func runTrace(cmd *command, args []string) error {
+	fs, globals := cmd.flagSet()
+	api := apiFlag(fs)
+	request := fs.Bool("request", false, "the id is a request id rather than a trace id")
+	noColor := fs.Bool("no-color", false, "disable colored output")
+	timeout := fs.Duration("timeout", 30*time.Second, "how long to wait for the Query API")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	closeLogs, err := globals.setupLogs()
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one trace or request id is required")
+	}
+	palette, err := newPalette(*noColor, "app")
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	if *request {
+		params.Set("request_id", fs.Arg(0))
+	} else {
+		params.Set("trace_id", fs.Arg(0))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	var t timeline
+	if err := getJSON(ctx, strings.TrimSuffix(*api, "/")+"/timeline?"+params.Encode(), &t); err != nil {
+		return err
+	}
+	printTimeline(os.Stdout, &t, palette)
+	return nil
+}
+
+// apiFlag registers -api, the address of the Query API
+func apiFlag(fs *flag.FlagSet) *string {
+	defaultAPI := "http://localhost:8080"
+	if api := os.Getenv("KLOG_API"); api != "" {
+		defaultAPI = api
+	}
+	return fs.String("api", defaultAPI, "Query API the logs are stored in (or KLOG_API)")
+}
+
+// getJSON decodes the response of a Query API endpoint into v
+func getJSON(ctx context.Context, endpoint string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query %s %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &failure) != nil || failure.Error == "" {
+			failure.Error = strings.TrimSpace(string(body))
+		}
+		return fmt.Errorf("query API returned %s: %s", resp.Status, failure.Error)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response %w", err)
+	}
+	return nil
+}
+
+// printTimeline writes one line per entry with its offset from the first
+// one, applications colored apart and indented in order of appearance
+func printTimeline(w io.Writer, t *timeline, p palette) {
+	id := "trace " + t.TraceID
+	if t.TraceID == "" {
+		id = "request " + t.RequestID
+	}
+	fmt.Fprintf(w, "%s: %d entries across %d applications over %s, from %s\n",
+		id, len(t.Entries), len(t.Applications), t.End.Sub(t.Start), t.Start.Format(time.RFC3339Nano))
+
+	width := 0
+	indent := make(map[string]int, len(t.Applications))
+	for i, app := range t.Applications {
+		indent[app] = i
+		width = max(width, len(app))
+	}
+	for _, entry := range t.Entries {
+		offset := entry.Timestamp.Sub(t.Start)
+		level := p.level(entry.Level) + fmt.Sprintf("%-5s", entry.Level) + p.reset()
+		fmt.Fprintf(w, "%10s  %s%s%-*s%s  %s %s",
+			"+"+formatOffset(offset),
+			strings.Repeat("  ", indent[entry.Application]),
+			p.app(entry.Application), width, entry.Application, p.reset(),
+			level, entry.Message)
+		if entry.SpanID != "" {
+			fmt.Fprintf(w, " span:%s", entry.SpanID)
+		}
+		fmt.Fprintln(w)
+	}
+	if t.Truncated {
+		fmt.Fprintln(w, "... more entries were not returned")
+	}
+}
+
+// formatOffset rounds an offset to a precision readable at a glance
+func formatOffset(d time.Duration) string {
+	switch {
+	case d < time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	case d < time.Second:
+		return d.Round(10 * time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
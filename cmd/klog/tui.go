@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/topk"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// tuiScrollback is how many entries the TUI keeps
+const tuiScrollback = 10000
+
+// tuiLoudest is how many of the loudest applications the header shows
+const tuiLoudest = 3
+
+// tuiRefresh is how often the screen is redrawn, consumers never wait on it
+const tuiRefresh = 200 * time.Millisecond
+
+type tuiEntry struct {
+	entry     *models.LogEntry
+	partition int32
+	offset    int64
+}
+
+// tuiView collects entries and counters from the consumers for the TUI
+type tuiView struct {
+	mu           sync.Mutex
+	entries      []tuiEntry
+	dropped      int //oldest entries removed from entries
+	consumed     int64
+	decodeErrors int64
+	lag          map[int32]int64
+	palette      palette
+	//loudest tracks the applications with the most entries for the header
+	loudest *topk.Tracker
+	//pauser pauses fetching in a consumer group, nil when tailing
+	pauser *pauser
+}
+
+// newTUIView colors like the printer, except that stdout is always the terminal
+func newTUIView(noColor bool, colorBy string) *tuiView {
+	_, noColorEnv := os.LookupEnv("NO_COLOR")
+	return &tuiView{
+		lag:     make(map[int32]int64),
+		palette: palette{enabled: !noColor && !noColorEnv, byApp: colorBy == "app"},
+		loudest: topk.New(tuiLoudest, time.Minute, 6),
+	}
+}
+
+func (v *tuiView) add(entry *models.LogEntry, partition int32, offset int64) {
+	v.loudest.Add(entry.Application, 1, time.Now())
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.entries = append(v.entries, tuiEntry{entry, partition, offset})
+	if len(v.entries) > tuiScrollback {
+		//drop a chunk at a time so the slice isn't shifted on every entry
+		n := tuiScrollback / 10
+		v.entries = slices.Delete(v.entries, 0, n)
+		v.dropped += n
+	}
+}
+
+// consumedMessage counts a message read from a partition along with how far behind the partition end it was
+func (v *tuiView) consumedMessage(partition int32, lag int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.consumed++
+	v.lag[partition] = max(lag, 0)
+}
+
+func (v *tuiView) decodeError() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.decodeErrors++
+}
+
+// run shows the TUI until the user quits
+func (v *tuiView) run(title string) error {
+	_, err := tea.NewProgram(&tuiModel{view: v, title: title, levels: make(map[models.LogLevel]bool)}, tea.WithAltScreen()).Run()
+	return err
+}
+
+type tickMsg time.Time
+
+func tick() tea.Cmd {
+	return tea.Tick(tuiRefresh, func(t time.Time) tea.Msg { return tickMsg(t) })
+}
+
+// tuiModel is the bubbletea model, it only runs on the program goroutine
+type tuiModel struct {
+	view   *tuiView
+	title  string
+	width  int
+	height int
+
+	//filters, empty matches everything
+	levels map[models.LogLevel]bool
+	app    string
+	text   string
+
+	//editing is the filter being typed after / or a
+	editing string
+	input   string
+
+	paused   bool
+	pausedAt int //entries seen when paused, later ones are hidden
+	scroll   int //matching lines hidden below the screen
+
+	rate      float64
+	lastCount int64
+	lastTime  time.Time
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	m.lastTime = time.Now()
+	return tick()
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+
+	case tickMsg:
+		now := time.Time(msg)
+		if elapsed := now.Sub(m.lastTime); elapsed >= time.Second {
+			m.view.mu.Lock()
+			consumed := m.view.consumed
+			m.view.mu.Unlock()
+			m.rate = float64(consumed-m.lastCount) / elapsed.Seconds()
+			m.lastCount, m.lastTime = consumed, now
+		}
+		return m, tick()
+
+	case tea.KeyMsg:
+		if m.editing != "" {
+			return m, m.edit(msg)
+		}
+		return m, m.key(msg)
+	}
+	return m, nil
+}
+
+func (m *tuiModel) edit(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEnter:
+		if m.editing == "app" {
+			m.app = m.input
+		} else {
+			m.text = m.input
+		}
+		m.editing, m.scroll = "", 0
+	case tea.KeyEsc:
+		m.editing = ""
+	case tea.KeyBackspace:
+		if r := []rune(m.input); len(r) > 0 {
+			m.input = string(r[:len(r)-1])
+		}
+	case tea.KeyCtrlC:
+		return tea.Quit
+	case tea.KeyRunes, tea.KeySpace:
+		m.input += string(msg.Runes)
+	}
+	return nil
+}
+
+func (m *tuiModel) key(msg tea.KeyMsg) tea.Cmd {
+	page := max(m.height-4, 1)
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return tea.Quit
+	case "P":
+		if m.view.pauser != nil {
+			m.view.pauser.toggle()
+		}
+	case " ", "p":
+		m.paused = !m.paused
+		if m.paused {
+			m.view.mu.Lock()
+			m.pausedAt = m.view.dropped + len(m.view.entries)
+			m.view.mu.Unlock()
+		}
+	case "up", "k":
+		m.scroll++
+	case "down", "j":
+		m.scroll = max(m.scroll-1, 0)
+	case "pgup", "b":
+		m.scroll += page
+	case "pgdown", "f":
+		m.scroll = max(m.scroll-page, 0)
+	case "end", "G":
+		m.scroll = 0
+	case "/":
+		m.editing, m.input = "text", m.text
+	case "a":
+		m.editing, m.input = "app", m.app
+	case "c":
+		m.app, m.text, m.scroll = "", "", 0
+		clear(m.levels)
+	case "1", "2", "3", "4", "5", "6":
+		level := models.Levels[msg.String()[0]-'1']
+		m.levels[level] = !m.levels[level]
+		if !m.levels[level] {
+			delete(m.levels, level)
+		}
+		m.scroll = 0
+	}
+	return nil
+}
+
+func (m *tuiModel) matches(entry *models.LogEntry) bool {
+	switch {
+	case len(m.levels) > 0 && !m.levels[entry.Level]:
+		return false
+	case m.app != "" && !strings.Contains(strings.ToLower(entry.Application), strings.ToLower(m.app)):
+		return false
+	case m.text != "" && !strings.Contains(strings.ToLower(entry.Message), strings.ToLower(m.text)):
+		return false
+	}
+	return true
+}
+
+func (m *tuiModel) View() string {
+	if m.height == 0 {
+		return ""
+	}
+	rows := max(m.height-3, 1)
+
+	m.view.mu.Lock()
+	entries := m.view.entries
+	if m.paused {
+		entries = entries[:max(min(m.pausedAt-m.view.dropped, len(entries)), 0)]
+	}
+	//newest first, stopping once the oldest match is on screen
+	var matching []int
+	for i := len(entries) - 1; i >= 0; i-- {
+		if m.matches(entries[i].entry) {
+			matching = append(matching, i)
+		}
+	}
+	m.scroll = min(m.scroll, max(len(matching)-rows, 0))
+	var lines []string
+	for _, i := range matching[m.scroll:min(m.scroll+rows, len(matching))] {
+		lines = append(lines, m.line(entries[i]))
+	}
+	var lag int64
+	for _, l := range m.view.lag {
+		lag += l
+	}
+	consumed, decodeErrors, held := m.view.consumed, m.view.decodeErrors, len(entries)
+	m.view.mu.Unlock()
+
+	var b strings.Builder
+	header := fmt.Sprintf(" %s │ %.0f msg/s │ lag %d │ consumed %d │ kept %d", m.title, m.rate, lag, consumed, held)
+	if decodeErrors > 0 {
+		header += fmt.Sprintf(" │ %d undecodable", decodeErrors)
+	}
+	if m.paused {
+		header += " │ PAUSED"
+	}
+	if m.view.pauser != nil && m.view.pauser.paused() {
+		header += " │ FETCHING PAUSED"
+	}
+	if m.scroll > 0 {
+		header += fmt.Sprintf(" │ scrolled %d", m.scroll)
+	}
+	if loudest := m.loudest(); loudest != "" {
+		header += " │ loudest " + loudest
+	}
+	b.WriteString("\033[7m" + padRight(ansi.Truncate(header, m.width, "…"), m.width) + "\033[0m\n")
+	b.WriteString(ansi.Truncate(m.filterLine(), m.width, "…") + "\n")
+
+	for i := len(lines) - 1; i >= 0; i-- {
+		b.WriteString(lines[i] + "\n")
+	}
+	for range rows - len(lines) {
+		b.WriteString("\n")
+	}
+
+	footer := " q quit  space pause  ↑↓ pgup pgdn end scroll  1-6 levels  a app  / text  c clear"
+	if m.view.pauser != nil {
+		footer += "  P pause fetching"
+	}
+	if m.editing != "" {
+		footer = fmt.Sprintf(" %s filter: %s█  (enter apply, esc cancel)", m.editing, m.input)
+	}
+	b.WriteString("\033[2m" + ansi.Truncate(footer, m.width, "…") + "\033[0m")
+	return b.String()
+}
+
+// loudest lists the applications with the most entries in the last minute
+// and their share of them
+func (m *tuiModel) loudest() string {
+	apps, total := m.view.loudest.Top(time.Now())
+	if total == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(apps))
+	for _, app := range apps {
+		parts = append(parts, fmt.Sprintf("%s %.0f%%", app.Key, 100*float64(app.Count)/float64(total)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (m *tuiModel) filterLine() string {
+	var parts []string
+	for i, level := range models.Levels {
+		mark := " "
+		if m.levels[level] {
+			mark = "x"
+		}
+		parts = append(parts, fmt.Sprintf("%d[%s]%s", i+1, mark, level))
+	}
+	line := " " + strings.Join(parts, " ")
+	if m.app != "" {
+		line += "  app~" + m.app
+	}
+	if m.text != "" {
+		line += "  text~" + m.text
+	}
+	return line
+}
+
+func (m *tuiModel) line(e tuiEntry) string {
+	entry := e.entry
+	pal := m.view.palette
+	color := pal.line(entry)
+	level := fmt.Sprintf("%-5s", entry.Level)
+	if pal.byApp {
+		level = pal.level(entry.Level) + level + color
+	}
+	text := fmt.Sprintf("%s %-16s %s %s", entry.Timestamp.Format("15:04:05"), entry.Application, level, entry.Message)
+	return color + ansi.Truncate(text, m.width, "…") + pal.reset()
+}
+
+func padRight(s string, width int) string {
+	if n := width - ansi.StringWidth(s); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
@@ -0,0 +1,266 @@
+// Package aggregator counts log entries in tumbling time windows and
+// summarises each closed window per application.
+package aggregator
+
+import (
+	"encoding/json"
+	"fmt"
+	"kafka-logging-system/internal/latency"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/processor"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultTopic is where window summaries are published
+const DefaultTopic = "log-metrics"
+
+// Summary is the statistics of one application in one window
+type Summary struct {
+	WindowStart time.Time                 `json:"window_start"`
+	WindowEnd   time.Time                 `json:"window_end"`
+	Application string                    `json:"application"`
+	Total       int64                     `json:"total"`
+	Counts      map[models.LogLevel]int64 `json:"counts"`
+	//ErrorRate is the share of ERROR and FATAL entries
+	ErrorRate   float64        `json:"error_rate"`
+	TopMessages []MessageCount `json:"top_messages"`
+	//TopPatterns groups messages differing only in their variable words
+	TopPatterns []PatternCount `json:"top_patterns,omitempty"`
+	//Latency is the distribution of the durations of entries that have one
+	Latency *latency.Summary `json:"latency,omitempty"`
+}
+
+type MessageCount struct {
+	Message string `json:"message"`
+	Count   int64  `json:"count"`
+}
+
+type PatternCount struct {
+	ID      string `json:"id"`
+	Pattern string `json:"pattern"`
+	Count   int64  `json:"count"`
+}
+
+// appStats are the running counts of one application in a window
+type appStats struct {
+	Counts   map[models.LogLevel]int64 `json:"counts"`
+	Messages map[string]int64          `json:"messages"`
+	Patterns map[string]int64          `json:"patterns,omitempty"`
+	Latency  *latency.Histogram        `json:"latency,omitempty"`
+}
+
+type window struct {
+	Start time.Time            `json:"start"`
+	Apps  map[string]*appStats `json:"apps"`
+}
+
+// Aggregator keeps open windows keyed by start time. It is safe for concurrent use.
+type Aggregator struct {
+	size  time.Duration
+	grace time.Duration
+	topN  int
+
+	mu      sync.Mutex
+	windows map[int64]*window
+	late    int64
+}
+
+// New returns an aggregator with windows of size that stay open for grace
+// after they end to collect late entries, keeping topN messages per summary
+func New(size, grace time.Duration, topN int) *Aggregator {
+	return &Aggregator{
+		size:    size,
+		grace:   grace,
+		topN:    topN,
+		windows: make(map[int64]*window),
+	}
+}
+
+// Add counts an entry in the window containing its timestamp. It reports
+// false when that window has already been flushed.
+func (a *Aggregator) Add(entry *models.LogEntry, now time.Time) bool {
+	start := entry.Timestamp.Truncate(a.size)
+	if !start.Add(a.size + a.grace).After(now) {
+		a.mu.Lock()
+		a.late++
+		a.mu.Unlock()
+		return false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	w, ok := a.windows[start.UnixNano()]
+	if !ok {
+		w = &window{Start: start, Apps: make(map[string]*appStats)}
+		a.windows[start.UnixNano()] = w
+	}
+	stats, ok := w.Apps[entry.Application]
+	if !ok {
+		stats = &appStats{Counts: make(map[models.LogLevel]int64), Messages: make(map[string]int64)}
+		w.Apps[entry.Application] = stats
+	}
+	//checkpoints written before patterns were counted have none
+	if stats.Patterns == nil {
+		stats.Patterns = make(map[string]int64)
+	}
+	stats.Counts[entry.Level]++
+	stats.Messages[entry.Message]++
+	stats.Patterns[entryPattern(entry)]++
+	if entry.DurationMs > 0 {
+		if stats.Latency == nil {
+			stats.Latency = &latency.Histogram{}
+		}
+		stats.Latency.Record(time.Duration(entry.DurationMs * float64(time.Millisecond)))
+	}
+	return true
+}
+
+// entryPattern is the pattern the processor found for the entry, or the
+// template of its message when it went through no pattern processor
+func entryPattern(entry *models.LogEntry) string {
+	if pattern, ok := entry.GetString(processor.MetadataPattern); ok && pattern != "" {
+		return pattern
+	}
+	return processor.MessageTemplate(entry.Message)
+}
+
+// Late returns how many entries arrived after their window was flushed
+func (a *Aggregator) Late() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.late
+}
+
+// Closed returns summaries of windows whose grace period has passed, oldest
+// first. They stay open until Remove is called, so a failed publish can be retried.
+func (a *Aggregator) Closed(now time.Time) ([]Summary, []int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var keys []int64
+	for key, w := range a.windows {
+		if !w.Start.Add(a.size + a.grace).After(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	var summaries []Summary
+	for _, key := range keys {
+		summaries = append(summaries, a.summarise(a.windows[key])...)
+	}
+	return summaries, keys
+}
+
+// Remove forgets windows once their summaries are published
+func (a *Aggregator) Remove(keys []int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, key := range keys {
+		delete(a.windows, key)
+	}
+}
+
+func (a *Aggregator) summarise(w *window) []Summary {
+	apps := make([]string, 0, len(w.Apps))
+	for app := range w.Apps {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	summaries := make([]Summary, 0, len(apps))
+	for _, app := range apps {
+		stats := w.Apps[app]
+		summary := Summary{
+			WindowStart: w.Start,
+			WindowEnd:   w.Start.Add(a.size),
+			Application: app,
+			Counts:      make(map[models.LogLevel]int64, len(stats.Counts)),
+		}
+		for level, count := range stats.Counts {
+			summary.Counts[level] = count
+			summary.Total += count
+		}
+		if summary.Total > 0 {
+			summary.ErrorRate = float64(stats.Counts[models.ERROR]+stats.Counts[models.FATAL]) / float64(summary.Total)
+		}
+		summary.TopMessages = topMessages(stats.Messages, a.topN)
+		summary.TopPatterns = topPatterns(stats.Patterns, a.topN)
+		if stats.Latency != nil {
+			latencies := stats.Latency.Summary()
+			summary.Latency = &latencies
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+func topMessages(messages map[string]int64, n int) []MessageCount {
+	top := make([]MessageCount, 0, len(messages))
+	for message, count := range messages {
+		top = append(top, MessageCount{Message: message, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Message < top[j].Message
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+func topPatterns(patterns map[string]int64, n int) []PatternCount {
+	if len(patterns) == 0 {
+		return nil
+	}
+	top := make([]PatternCount, 0, len(patterns))
+	for _, message := range topMessages(patterns, n) {
+		top = append(top, PatternCount{ID: processor.PatternID(message.Message), Pattern: message.Message, Count: message.Count})
+	}
+	return top
+}
+
+// Save writes the open windows to path atomically
+func (a *Aggregator) Save(path string) error {
+	a.mu.Lock()
+	data, err := json.Marshal(a.windows)
+	a.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write checkpoint %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load restores windows saved by Save, a missing file is not an error
+func (a *Aggregator) Load(path string) error {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint %w", err)
+	}
+
+	windows := make(map[int64]*window)
+	if err := json.Unmarshal(data, &windows); err != nil {
+		return fmt.Errorf("failed to decode checkpoint %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.windows = windows
+	return nil
+}
@@ -0,0 +1,87 @@
+package aggregator
+
+import (
+	"fmt"
+	"io"
+	"kafka-logging-system/internal/latency"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyQuantiles are the quantiles of each application served to Prometheus
+var latencyQuantiles = []struct {
+	label string
+	value func(latency.Summary) time.Duration
+}{
+	{"0.5", func(s latency.Summary) time.Duration { return s.P50 }},
+	{"0.95", func(s latency.Summary) time.Duration { return s.P95 }},
+	{"0.99", func(s latency.Summary) time.Duration { return s.P99 }},
+}
+
+// LatencyMetrics serves the entry durations of the last published window
+// of each application to Prometheus. It is safe for concurrent use.
+type LatencyMetrics struct {
+	mu     sync.Mutex
+	latest map[string]latency.Summary
+}
+
+func NewLatencyMetrics() *LatencyMetrics {
+	return &LatencyMetrics{latest: make(map[string]latency.Summary)}
+}
+
+// Update keeps the latency of summaries, which replaces that of earlier
+// windows of their applications. Summaries are expected oldest first.
+func (m *LatencyMetrics) Update(summaries []Summary) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, summary := range summaries {
+		if summary.Latency != nil {
+			m.latest[summary.Application] = *summary.Latency
+		}
+	}
+}
+
+// WritePrometheus writes the quantiles and count of every application as gauges
+func (m *LatencyMetrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	apps := make([]string, 0, len(m.latest))
+	for app := range m.latest {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	var b strings.Builder
+	b.WriteString("# HELP log_window_duration_ms Entry durations in the last window of the application, by quantile\n")
+	b.WriteString("# TYPE log_window_duration_ms gauge\n")
+	for _, app := range apps {
+		for _, q := range latencyQuantiles {
+			fmt.Fprintf(&b, "log_window_duration_ms{application=\"%s\",quantile=\"%s\"} %s\n",
+				labelEscaper.Replace(app), q.label, milliseconds(q.value(m.latest[app])))
+		}
+	}
+	b.WriteString("# HELP log_window_duration_count Entries with a duration in the last window of the application\n")
+	b.WriteString("# TYPE log_window_duration_count gauge\n")
+	for _, app := range apps {
+		fmt.Fprintf(&b, "log_window_duration_count{application=\"%s\"} %d\n", labelEscaper.Replace(app), m.latest[app].Count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP serves the metrics for Prometheus to scrape
+func (m *LatencyMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WritePrometheus(w)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func milliseconds(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'g', -1, 64)
+}
@@ -0,0 +1,255 @@
+package alerting
+
+import (
+	"fmt"
+	"kafka-logging-system/internal/aggregator"
+	"kafka-logging-system/internal/models"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxMissedWindows bounds the empty windows counted for an application
+// whose summaries stopped, so a long outage doesn't replay every one
+const maxMissedWindows = 60
+
+// AnomalyRule fires when the volume of one application in a window strays
+// more than Sigma standard deviations from the baseline learned from its
+// previous windows. The baseline is an exponentially weighted moving
+// average, so it follows slow changes such as daily traffic.
+type AnomalyRule struct {
+	Name string `yaml:"name"`
+	//Levels are counted together, every level when empty
+	Levels       []models.LogLevel `yaml:"levels"`
+	Applications []string          `yaml:"applications"`
+	Sigma        float64           `yaml:"sigma"`
+	//Alpha is the weight of the latest window in the baseline, between 0 and 1
+	Alpha float64 `yaml:"alpha"`
+	//Warmup is how many windows are learned before the rule can fire
+	Warmup int `yaml:"warmup"`
+	//MinDelta ignores deviations of fewer entries, so a quiet application
+	//with a tiny variance doesn't fire on a handful of logs
+	MinDelta float64       `yaml:"min_delta"`
+	Cooldown time.Duration `yaml:"cooldown"`
+	Notify   []string      `yaml:"notify"`
+}
+
+func (r *AnomalyRule) setDefaults(i int) error {
+	if r.Name == "" {
+		r.Name = fmt.Sprintf("anomaly-%d", i+1)
+	}
+	if r.Sigma <= 0 {
+		r.Sigma = 3
+	}
+	switch {
+	case r.Alpha == 0:
+		r.Alpha = 0.1
+	case r.Alpha < 0 || r.Alpha > 1:
+		return fmt.Errorf("anomaly rule %s has alpha %v, expected a weight between 0 and 1", r.Name, r.Alpha)
+	}
+	if r.Warmup <= 0 {
+		r.Warmup = 10
+	}
+	if r.MinDelta <= 0 {
+		r.MinDelta = 5
+	}
+	return nil
+}
+
+// count sums the levels of the summary the rule watches
+func (r *AnomalyRule) count(counts map[models.LogLevel]int64) int64 {
+	var total int64
+	for level, count := range counts {
+		if len(r.Levels) == 0 || slices.Contains(r.Levels, level) {
+			total += count
+		}
+	}
+	return total
+}
+
+// baseline is the learned volume of one rule for one application
+type baseline struct {
+	mean     float64
+	variance float64
+	windows  int
+	//anomalous counts the consecutive windows left out of the baseline
+	anomalous int
+	//last is the end of the latest window counted
+	last       time.Time
+	firing     bool
+	firedAt    time.Time
+	resolvedAt time.Time
+}
+
+// observe scores count against the baseline, then learns it. The score is
+// 0 until the warmup is over. Anomalous windows are left out of the
+// baseline so an outage doesn't become the norm, unless they last a whole
+// warmup, then the baseline is learned again from the new volume.
+func (b *baseline) observe(count float64, rule *AnomalyRule) (expected, score float64) {
+	expected = b.mean
+	if b.windows >= rule.Warmup && math.Abs(count-b.mean) >= rule.MinDelta {
+		//a flat baseline has no variance, an entry is the smallest deviation
+		score = (count - b.mean) / math.Max(math.Sqrt(b.variance), 1)
+	}
+	if math.Abs(score) > rule.Sigma {
+		if b.anomalous++; b.anomalous < rule.Warmup {
+			return expected, score
+		}
+		b.mean, b.variance, b.windows = 0, 0, 0
+	}
+	b.anomalous = 0
+
+	if b.windows == 0 {
+		b.mean = count
+	} else {
+		diff := count - b.mean
+		incr := rule.Alpha * diff
+		b.mean += incr
+		b.variance = (1 - rule.Alpha) * (b.variance + diff*incr)
+	}
+	b.windows++
+	return expected, score
+}
+
+// AnomalyDetector evaluates anomaly rules against the aggregator's window
+// summaries. Applications missing from a window that others were summarised
+// in count as zero, so logs stopping altogether are caught. It is safe for
+// concurrent use.
+type AnomalyDetector struct {
+	rules []*AnomalyRule
+
+	mu        sync.Mutex
+	baselines map[seriesKey]*baseline
+	//latest is the end of the newest window summarised for any application
+	latest time.Time
+	size   time.Duration
+}
+
+func NewAnomalyDetector(rules []*AnomalyRule) *AnomalyDetector {
+	return &AnomalyDetector{rules: rules, baselines: make(map[seriesKey]*baseline)}
+}
+
+// Observe learns one window summary and returns alerts that start firing
+// or resolve for its application. Summaries must arrive oldest first for
+// each application, older ones are ignored.
+func (d *AnomalyDetector) Observe(summary aggregator.Summary, now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if summary.WindowEnd.After(d.latest) {
+		d.latest = summary.WindowEnd
+		d.size = summary.WindowEnd.Sub(summary.WindowStart)
+	}
+
+	var alerts []Alert
+	for _, rule := range d.rules {
+		if len(rule.Applications) > 0 && !slices.Contains(rule.Applications, summary.Application) {
+			continue
+		}
+		key := seriesKey{rule: rule.Name, application: summary.Application}
+		b, ok := d.baselines[key]
+		if !ok {
+			b = &baseline{}
+			d.baselines[key] = b
+		}
+		if !summary.WindowEnd.After(b.last) {
+			continue
+		}
+		alerts = append(alerts, d.missed(rule, key, b, summary.WindowStart, now)...)
+		if alert, ok := d.score(rule, key, b, float64(rule.count(summary.Counts)), summary.WindowEnd, now); ok {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
+
+// Tick counts the windows that closed without a summary for an application
+// as empty and returns the alerts they cause
+func (d *AnomalyDetector) Tick(now time.Time) []Alert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	rules := make(map[string]*AnomalyRule, len(d.rules))
+	for _, rule := range d.rules {
+		rules[rule.Name] = rule
+	}
+
+	//summaries of the newest window may still be arriving, an application
+	//is only missing from it once a later window was summarised
+	until := d.latest.Add(-d.size)
+	var alerts []Alert
+	for key, b := range d.baselines {
+		alerts = append(alerts, d.missed(rules[key.rule], key, b, until, now)...)
+	}
+	return alerts
+}
+
+// missed scores the empty windows between the last one counted for the
+// baseline and until
+func (d *AnomalyDetector) missed(rule *AnomalyRule, key seriesKey, b *baseline, until, now time.Time) []Alert {
+	if d.size <= 0 || b.last.IsZero() {
+		return nil
+	}
+	missing := int(until.Sub(b.last) / d.size)
+	if missing <= 0 {
+		return nil
+	}
+	if missing > maxMissedWindows {
+		b.last = until.Add(-maxMissedWindows * d.size)
+		missing = maxMissedWindows
+	}
+
+	var alerts []Alert
+	for range missing {
+		if alert, ok := d.score(rule, key, b, 0, b.last.Add(d.size), now); ok {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
+
+// score learns the count of the window ending at end and reports an alert
+// when the baseline starts or stops being exceeded
+func (d *AnomalyDetector) score(rule *AnomalyRule, key seriesKey, b *baseline, count float64, end, now time.Time) (Alert, bool) {
+	b.last = end
+	expected, score := b.observe(count, rule)
+	anomalous := math.Abs(score) > rule.Sigma && b.windows >= rule.Warmup
+
+	switch {
+	case anomalous && !b.firing:
+		//Hold back a new incident until the cool-down after the last one has passed
+		if !b.resolvedAt.IsZero() && now.Sub(b.resolvedAt) < rule.Cooldown {
+			return Alert{}, false
+		}
+		b.firing = true
+		b.firedAt = now
+		return b.alert(rule, key.application, Firing, count, expected, score, d.size), true
+	case !anomalous && b.firing:
+		b.firing = false
+		b.resolvedAt = now
+		return b.alert(rule, key.application, Resolved, count, expected, score, d.size), true
+	}
+	return Alert{}, false
+}
+
+func (b *baseline) alert(rule *AnomalyRule, application string, state State, count, expected, score float64, window time.Duration) Alert {
+	alert := Alert{
+		Rule:        rule.Name,
+		Application: application,
+		State:       state,
+		Count:       int64(count),
+		Expected:    expected,
+		Sigma:       score,
+		Window:      window,
+		FiredAt:     b.firedAt,
+		Notify:      rule.Notify,
+	}
+	if len(rule.Levels) == 1 {
+		alert.Level = rule.Levels[0]
+	}
+	if state == Resolved {
+		alert.ResolvedAt = b.resolvedAt
+	}
+	return alert
+}
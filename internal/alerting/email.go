@@ -0,0 +1,87 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type EmailConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"` //defaults to 587
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// Email sends alerts over SMTP, authenticating when a username is set
+type Email struct {
+	cfg  EmailConfig
+	addr string
+	auth smtp.Auth
+}
+
+func NewEmail(cfg EmailConfig) (*Email, error) {
+	if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+		return nil, errors.New("email notifier needs a host, from and to")
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+	}
+
+	e := &Email{cfg: cfg, addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))}
+	if cfg.Username != "" {
+		e.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return e, nil
+}
+
+func (*Email) Name() string { return "email" }
+
+// Notify sends the message, smtp.SendMail can't be cancelled so ctx is only checked up front
+func (e *Email) Notify(ctx context.Context, alert Alert) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := smtp.SendMail(e.addr, e.auth, e.cfg.From, e.cfg.To, e.message(alert)); err != nil {
+		return fmt.Errorf("failed to send email %w", err)
+	}
+	return nil
+}
+
+func (e *Email) message(alert Alert) []byte {
+	subject := fmt.Sprintf("[%s] %s for %s", strings.ToUpper(string(alert.State)), alert.Rule, alert.Application)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+
+	fmt.Fprintf(&b, "Rule: %s\r\n", alert.Rule)
+	fmt.Fprintf(&b, "Application: %s\r\n", alert.Application)
+	fmt.Fprintf(&b, "State: %s\r\n", alert.State)
+	if alert.Level != "" {
+		fmt.Fprintf(&b, "Level: %s\r\n", alert.Level)
+	}
+	fmt.Fprintf(&b, "Count: %s\r\n", CountText(alert))
+	fmt.Fprintf(&b, "Fired at: %s\r\n", alert.FiredAt.Format(time.RFC3339))
+	if alert.State == Resolved {
+		fmt.Fprintf(&b, "Resolved at: %s\r\n", alert.ResolvedAt.Format(time.RFC3339))
+	}
+	if len(alert.Samples) > 0 {
+		b.WriteString("\r\nSample messages:\r\n")
+		for _, s := range alert.Samples {
+			fmt.Fprintf(&b, "  %s\r\n", s)
+		}
+	}
+	return []byte(b.String())
+}
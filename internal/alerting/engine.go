@@ -0,0 +1,205 @@
+package alerting
+
+import (
+	"kafka-logging-system/internal/models"
+	"slices"
+	"sync"
+	"time"
+)
+
+type State string
+
+const (
+	Firing   State = "firing"
+	Resolved State = "resolved"
+)
+
+// maxSamples is how many distinct example messages an alert carries
+const maxSamples = 5
+
+// Alert is a notification about one rule and application
+type Alert struct {
+	Rule        string          `json:"rule"`
+	Application string          `json:"application"`
+	State       State           `json:"state"`
+	Level       models.LogLevel `json:"level"` //most severe level seen
+	Count       int64           `json:"count"` //matches within the window
+	Threshold   int64           `json:"threshold"`
+	Window      time.Duration   `json:"window"`
+	FiredAt     time.Time       `json:"fired_at"`
+	ResolvedAt  time.Time       `json:"resolved_at,omitempty"`
+	Samples     []string        `json:"samples,omitempty"`
+	//Expected and Sigma are set by anomaly rules: the baseline count of the
+	//window and how many standard deviations Count is away from it
+	Expected float64 `json:"expected,omitempty"`
+	Sigma    float64 `json:"sigma,omitempty"`
+	//Notify names the notifiers for this alert, all of them when empty
+	Notify []string `json:"-"`
+}
+
+// anomaly reports whether the alert comes from an anomaly rule, threshold
+// rules always have a threshold
+func (a Alert) anomaly() bool {
+	return a.Threshold == 0
+}
+
+// Key identifies the incident an alert belongs to, stable from firing to resolved
+func (a Alert) Key() string {
+	return a.Rule + "/" + a.Application
+}
+
+type event struct {
+	at    time.Time
+	count int64
+}
+
+// series tracks one rule for one application
+type series struct {
+	events     []event
+	level      models.LogLevel
+	samples    []string
+	firing     bool
+	firedAt    time.Time
+	resolvedAt time.Time
+	suppressed int64 //alerts held back by the cool-down
+}
+
+type seriesKey struct {
+	rule        string
+	application string
+}
+
+// Engine evaluates rules against observed log volume. It is safe for concurrent use.
+type Engine struct {
+	rules []*Rule
+
+	mu     sync.Mutex
+	series map[seriesKey]*series
+}
+
+func NewEngine(rules []*Rule) *Engine {
+	return &Engine{
+		rules:  rules,
+		series: make(map[seriesKey]*series),
+	}
+}
+
+// Observe records one log entry and returns any alerts that start firing
+func (e *Engine) Observe(entry *models.LogEntry, now time.Time) []Alert {
+	return e.ObserveCount(entry.Application, entry.Level, entry.Message, 1, entry.Timestamp, now)
+}
+
+// ObserveCount records count entries at once, as reported by the aggregator.
+// An empty message never matches rules with a message pattern.
+func (e *Engine) ObserveCount(application string, level models.LogLevel, message string, count int64, at, now time.Time) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var alerts []Alert
+	for _, rule := range e.rules {
+		if count <= 0 || !rule.matches(application, level, message) {
+			continue
+		}
+		if rule.message != nil && message == "" {
+			continue
+		}
+
+		key := seriesKey{rule: rule.Name, application: application}
+		s, ok := e.series[key]
+		if !ok {
+			s = &series{}
+			e.series[key] = s
+		}
+
+		s.events = append(s.events, event{at: at, count: count})
+		if level.Severity() > s.level.Severity() {
+			s.level = level
+		}
+		if message != "" && len(s.samples) < maxSamples && !slices.Contains(s.samples, message) {
+			s.samples = append(s.samples, message)
+		}
+
+		total := s.prune(now, rule.Window)
+		if s.firing || total < rule.Threshold {
+			continue
+		}
+
+		//Hold back a new incident until the cool-down after the last one has passed
+		if !s.resolvedAt.IsZero() && now.Sub(s.resolvedAt) < rule.Cooldown {
+			s.suppressed++
+			continue
+		}
+
+		s.firing = true
+		s.firedAt = now
+		alerts = append(alerts, s.alert(rule, application, Firing, total))
+	}
+	return alerts
+}
+
+// Tick expires old events and returns resolved alerts for incidents whose
+// count dropped below the threshold
+func (e *Engine) Tick(now time.Time) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules := make(map[string]*Rule, len(e.rules))
+	for _, rule := range e.rules {
+		rules[rule.Name] = rule
+	}
+
+	var alerts []Alert
+	for key, s := range e.series {
+		rule := rules[key.rule]
+		total := s.prune(now, rule.Window)
+		if s.firing && total < rule.Threshold {
+			s.firing = false
+			s.resolvedAt = now
+			alerts = append(alerts, s.alert(rule, key.application, Resolved, total))
+			s.samples = nil
+			s.level = ""
+		}
+		if !s.firing && len(s.events) == 0 {
+			s.samples = nil
+			s.level = ""
+			if now.Sub(s.resolvedAt) >= rule.Cooldown {
+				delete(e.series, key)
+			}
+		}
+	}
+	return alerts
+}
+
+// prune drops events older than window and returns the remaining count
+func (s *series) prune(now time.Time, window time.Duration) int64 {
+	cutoff := now.Add(-window)
+	kept := s.events[:0]
+	var total int64
+	for _, ev := range s.events {
+		if ev.at.After(cutoff) {
+			kept = append(kept, ev)
+			total += ev.count
+		}
+	}
+	s.events = kept
+	return total
+}
+
+func (s *series) alert(rule *Rule, application string, state State, count int64) Alert {
+	alert := Alert{
+		Rule:        rule.Name,
+		Application: application,
+		State:       state,
+		Level:       s.level,
+		Count:       count,
+		Threshold:   rule.Threshold,
+		Window:      rule.Window,
+		FiredAt:     s.firedAt,
+		Samples:     append([]string{}, s.samples...),
+		Notify:      rule.Notify,
+	}
+	if state == Resolved {
+		alert.ResolvedAt = s.resolvedAt
+	}
+	return alert
+}
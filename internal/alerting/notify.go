@@ -0,0 +1,147 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// Notifier delivers alerts to one channel
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// Dispatcher sends each alert to the notifiers its rule selects
+type Dispatcher struct {
+	notifiers []Notifier
+}
+
+func NewDispatcher(notifiers ...Notifier) *Dispatcher {
+	return &Dispatcher{notifiers: notifiers}
+}
+
+// Dispatch notifies every selected notifier, returning their combined errors
+func (d *Dispatcher) Dispatch(ctx context.Context, alert Alert) error {
+	var errs []error
+	for _, n := range d.notifiers {
+		if len(alert.Notify) > 0 && !slices.Contains(alert.Notify, n.Name()) {
+			continue
+		}
+		if err := n.Notify(ctx, alert); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NotifiersConfig enables notification channels, console is always enabled
+type NotifiersConfig struct {
+	Slack     *SlackConfig     `yaml:"slack"`
+	PagerDuty *PagerDutyConfig `yaml:"pagerduty"`
+	Email     *EmailConfig     `yaml:"email"`
+	Webhooks  []WebhookConfig  `yaml:"webhooks"`
+}
+
+// Build returns the notifiers enabled in the config
+func (c NotifiersConfig) Build() ([]Notifier, error) {
+	notifiers := []Notifier{Console{}}
+	if c.Slack != nil {
+		slack, err := NewSlack(*c.Slack)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, slack)
+	}
+	if c.PagerDuty != nil {
+		pd, err := NewPagerDuty(*c.PagerDuty)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, pd)
+	}
+	if c.Email != nil {
+		email, err := NewEmail(*c.Email)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, email)
+	}
+	for _, wc := range c.Webhooks {
+		webhook, err := NewWebhook(wc)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, webhook)
+	}
+
+	seen := make(map[string]bool)
+	for _, n := range notifiers {
+		if seen[n.Name()] {
+			return nil, fmt.Errorf("duplicate notifier name %s", n.Name())
+		}
+		seen[n.Name()] = true
+	}
+	return notifiers, nil
+}
+
+// CheckNotify reports rules that select a notifier which isn't configured
+func (c *Config) CheckNotify(notifiers []Notifier) error {
+	notify := make(map[string][]string, len(c.Rules)+len(c.Anomalies))
+	for _, rule := range c.Rules {
+		notify[rule.Name] = rule.Notify
+	}
+	for _, rule := range c.Anomalies {
+		notify[rule.Name] = rule.Notify
+	}
+
+	var errs []error
+	for rule, names := range notify {
+		for _, name := range names {
+			if !slices.ContainsFunc(notifiers, func(n Notifier) bool { return n.Name() == name }) {
+				errs = append(errs, fmt.Errorf("alert rule %s notifies unknown channel %s", rule, name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Console logs alerts, it is always available
+type Console struct{}
+
+func (Console) Name() string { return "console" }
+
+func (Console) Notify(_ context.Context, alert Alert) error {
+	slog.Warn(Summary(alert))
+	return nil
+}
+
+// Summary is a one line description of an alert shared by text notifiers
+func Summary(alert Alert) string {
+	if alert.State == Resolved {
+		return fmt.Sprintf("RESOLVED %s for %s: %s", alert.Rule, alert.Application, CountText(alert))
+	}
+
+	summary := fmt.Sprintf("FIRING %s for %s: %d %s matches in the last %s (threshold %d)",
+		alert.Rule, alert.Application, alert.Count, alert.Level, alert.Window, alert.Threshold)
+	if alert.anomaly() {
+		summary = fmt.Sprintf("FIRING %s for %s: %s", alert.Rule, alert.Application, CountText(alert))
+	}
+	if len(alert.Samples) > 0 {
+		summary += ", e.g. " + strings.Join(alert.Samples, " | ")
+	}
+	return summary
+}
+
+// CountText describes the count of an alert against its threshold, or
+// against the expected count for anomaly rules
+func CountText(alert Alert) string {
+	if alert.anomaly() {
+		return fmt.Sprintf("%d entries in the last %s (expected %.1f, %+.1f sigma)",
+			alert.Count, alert.Window, alert.Expected, alert.Sigma)
+	}
+	return fmt.Sprintf("%d matches in the last %s (threshold %d)", alert.Count, alert.Window, alert.Threshold)
+}
@@ -0,0 +1,161 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+type PagerDutyConfig struct {
+	RoutingKey string `yaml:"routing_key"`
+	//URL overrides the Events API v2 endpoint
+	URL string `yaml:"url"`
+	//Retries on transient API errors, defaults to 3
+	Retries int `yaml:"retries"`
+}
+
+// PagerDuty opens and closes incidents through the Events API v2. The dedup
+// key is the alert key, so the resolve for an incident closes the one its
+// trigger opened.
+type PagerDuty struct {
+	cfg    PagerDutyConfig
+	client *http.Client
+	source string
+}
+
+func NewPagerDuty(cfg PagerDutyConfig) (*PagerDuty, error) {
+	if cfg.RoutingKey == "" {
+		return nil, errors.New("pagerduty notifier needs a routing_key")
+	}
+	if cfg.URL == "" {
+		cfg.URL = pagerDutyEventsURL
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = 3
+	}
+	source, _ := os.Hostname()
+	return &PagerDuty{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		source: source,
+	}, nil
+}
+
+func (*PagerDuty) Name() string { return "pagerduty" }
+
+// Notify triggers an incident for a firing alert and resolves it once the alert resolves
+func (p *PagerDuty) Notify(ctx context.Context, alert Alert) error {
+	action := "trigger"
+	if alert.State == Resolved {
+		action = "resolve"
+	}
+	return p.send(ctx, action, alert)
+}
+
+// Acknowledge marks the incident for an alert as being worked on
+func (p *PagerDuty) Acknowledge(ctx context.Context, alert Alert) error {
+	return p.send(ctx, "acknowledge", alert)
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string `json:"summary"`
+	Source        string `json:"source"`
+	Severity      string `json:"severity"`
+	Timestamp     string `json:"timestamp,omitempty"`
+	Component     string `json:"component,omitempty"`
+	Class         string `json:"class,omitempty"`
+	CustomDetails Alert  `json:"custom_details"`
+}
+
+func (p *PagerDuty) send(ctx context.Context, action string, alert Alert) error {
+	event := pagerDutyEvent{
+		RoutingKey:  p.cfg.RoutingKey,
+		EventAction: action,
+		DedupKey:    alert.Key(),
+	}
+	//only triggers carry a payload
+	if action == "trigger" {
+		event.Payload = &pagerDutyPayload{
+			Summary:       Summary(alert),
+			Source:        p.source,
+			Severity:      pagerDutySeverity(alert.Level),
+			Timestamp:     alert.FiredAt.Format(time.RFC3339),
+			Component:     alert.Application,
+			Class:         alert.Rule,
+			CustomDetails: alert,
+		}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode pagerduty event %w", err)
+	}
+
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		retry, err := p.post(ctx, body)
+		if err == nil || !retry || attempt >= p.cfg.Retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends one event, reporting whether a failure is worth retrying
+func (p *PagerDuty) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("failed to post to pagerduty %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusAccepted || resp.StatusCode == http.StatusOK {
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	transient := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return transient, fmt.Errorf("pagerduty returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+// pagerDutySeverity maps the most severe level seen to a PagerDuty severity
+func pagerDutySeverity(level models.LogLevel) string {
+	switch level {
+	case models.FATAL:
+		return "critical"
+	case models.ERROR:
+		return "error"
+	case models.WARN:
+		return "warning"
+	default:
+		return "info"
+	}
+}
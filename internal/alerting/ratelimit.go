@@ -0,0 +1,51 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket allowing burst notifications, refilled at one
+// token per interval. It counts what it rejects so the next allowed
+// notification can mention them.
+type limiter struct {
+	interval time.Duration
+	burst    int
+
+	mu         sync.Mutex
+	tokens     float64
+	last       time.Time
+	suppressed int
+}
+
+// newLimiter allows perMinute notifications per minute, in bursts of up to perMinute
+func newLimiter(perMinute int) *limiter {
+	return &limiter{
+		interval: time.Minute / time.Duration(perMinute),
+		burst:    perMinute,
+		tokens:   float64(perMinute),
+		last:     time.Now(),
+	}
+}
+
+// allow takes a token if one is available. When it does, it also returns how
+// many notifications were rejected since the last allowed one.
+func (l *limiter) allow(now time.Time) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		l.suppressed++
+		return false, 0
+	}
+	l.tokens--
+	suppressed := l.suppressed
+	l.suppressed = 0
+	return true, suppressed
+}
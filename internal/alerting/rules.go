@@ -0,0 +1,100 @@
+// Package alerting fires alerts when log volume matching a rule crosses a
+// threshold, with deduplication, cool-down and resolved notifications.
+package alerting
+
+import (
+	"fmt"
+	"kafka-logging-system/internal/models"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule fires when at least Threshold matching entries from one application
+// arrive within Window. Every condition that is set must match.
+type Rule struct {
+	Name         string            `yaml:"name"`
+	Levels       []models.LogLevel `yaml:"levels"`
+	Applications []string          `yaml:"applications"`
+	//Message is a regular expression, rules using it only match raw logs
+	Message   string        `yaml:"message"`
+	Threshold int64         `yaml:"threshold"`
+	Window    time.Duration `yaml:"window"`
+	//Cooldown suppresses a new alert for the same rule and application after one resolves
+	Cooldown time.Duration `yaml:"cooldown"`
+	//Notify names the notifiers used for this rule, every configured notifier when empty
+	Notify []string `yaml:"notify"`
+
+	message *regexp.Regexp
+}
+
+func (r *Rule) matches(application string, level models.LogLevel, message string) bool {
+	if len(r.Levels) > 0 && !slices.Contains(r.Levels, level) {
+		return false
+	}
+	if len(r.Applications) > 0 && !slices.Contains(r.Applications, application) {
+		return false
+	}
+	if r.message != nil && !r.message.MatchString(message) {
+		return false
+	}
+	return true
+}
+
+// Config is the alerter configuration file
+type Config struct {
+	Rules []*Rule `yaml:"rules"`
+	//Anomalies are evaluated against window summaries only
+	Anomalies []*AnomalyRule  `yaml:"anomalies"`
+	Notifiers NotifiersConfig `yaml:"notifiers"`
+}
+
+// LoadConfig reads alert rules and notifier settings from a YAML file.
+// ${VAR} references are expanded from the environment so secrets such as
+// webhook URLs can stay out of the file.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert rules %w", err)
+	}
+
+	var file Config
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), &file); err != nil {
+		return nil, fmt.Errorf("failed to parse alert rules %w", err)
+	}
+
+	names := make(map[string]bool, len(file.Rules))
+	for i, rule := range file.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate alert rule %s", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Threshold <= 0 {
+			rule.Threshold = 1
+		}
+		if rule.Window <= 0 {
+			rule.Window = 5 * time.Minute
+		}
+		if rule.Message != "" {
+			if rule.message, err = regexp.Compile(rule.Message); err != nil {
+				return nil, fmt.Errorf("alert rule %s has invalid message pattern %w", rule.Name, err)
+			}
+		}
+	}
+	for i, rule := range file.Anomalies {
+		if err := rule.setDefaults(i); err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate alert rule %s", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return &file, nil
+}
@@ -0,0 +1,128 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type SlackConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+	//MaxPerMinute caps posts so an error storm doesn't flood the channel, defaults to 10
+	MaxPerMinute int `yaml:"max_per_minute"`
+	//Link is added to every message, {app} and {rule} are replaced
+	Link string `yaml:"link"`
+}
+
+// Slack posts alerts to an incoming webhook
+type Slack struct {
+	cfg     SlackConfig
+	client  *http.Client
+	limiter *limiter
+}
+
+func NewSlack(cfg SlackConfig) (*Slack, error) {
+	if cfg.WebhookURL == "" {
+		return nil, errors.New("slack notifier needs a webhook_url")
+	}
+	if cfg.MaxPerMinute <= 0 {
+		cfg.MaxPerMinute = 10
+	}
+	return &Slack{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		limiter: newLimiter(cfg.MaxPerMinute),
+	}, nil
+}
+
+func (*Slack) Name() string { return "slack" }
+
+func (s *Slack) Notify(ctx context.Context, alert Alert) error {
+	allowed, suppressed := s.limiter.allow(time.Now())
+	if !allowed {
+		return nil
+	}
+
+	body, err := json.Marshal(s.payload(alert, suppressed))
+	if err != nil {
+		return fmt.Errorf("failed to encode slack message %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to slack %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack returned %s", resp.Status)
+	}
+	return nil
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Title  string       `json:"title"`
+	Text   string       `json:"text,omitempty"`
+	Fields []slackField `json:"fields"`
+	Footer string       `json:"footer,omitempty"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func (s *Slack) payload(alert Alert, suppressed int) slackMessage {
+	color := "danger"
+	title := fmt.Sprintf(":rotating_light: %s firing for %s", alert.Rule, alert.Application)
+	if alert.State == Resolved {
+		color = "good"
+		title = fmt.Sprintf(":white_check_mark: %s resolved for %s", alert.Rule, alert.Application)
+	}
+
+	attachment := slackAttachment{
+		Color: color,
+		Title: title,
+		Fields: []slackField{
+			{Title: "Application", Value: alert.Application, Short: true},
+			{Title: "Count", Value: CountText(alert), Short: true},
+		},
+	}
+	if alert.Level != "" {
+		attachment.Fields = append(attachment.Fields, slackField{Title: "Level", Value: string(alert.Level), Short: true})
+	}
+	if len(alert.Samples) > 0 {
+		attachment.Text = "```" + strings.Join(alert.Samples, "\n") + "```"
+	}
+	if s.cfg.Link != "" {
+		link := strings.NewReplacer("{app}", url.QueryEscape(alert.Application), "{rule}", url.QueryEscape(alert.Rule)).Replace(s.cfg.Link)
+		attachment.Fields = append(attachment.Fields, slackField{Title: "Link", Value: link})
+	}
+	if suppressed > 0 {
+		attachment.Footer = fmt.Sprintf("%d notifications were rate limited since the last message", suppressed)
+	}
+
+	return slackMessage{
+		Text:        Summary(alert),
+		Attachments: []slackAttachment{attachment},
+	}
+}
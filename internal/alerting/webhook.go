@@ -0,0 +1,91 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+type WebhookConfig struct {
+	//Name selects the webhook from a rule's notify list
+	Name    string            `yaml:"name"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	//Template renders the request body from the alert, the alert as JSON when empty.
+	//The json function quotes a value, e.g. {"text": {{json .Rule}}}
+	Template string `yaml:"template"`
+}
+
+// Webhook posts alerts to an arbitrary HTTP endpoint
+type Webhook struct {
+	cfg    WebhookConfig
+	tmpl   *template.Template
+	client *http.Client
+}
+
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	if cfg.Name == "" || cfg.URL == "" {
+		return nil, errors.New("webhook notifier needs a name and url")
+	}
+
+	w := &Webhook{cfg: cfg, client: &http.Client{Timeout: 10 * time.Second}}
+	if cfg.Template != "" {
+		tmpl, err := template.New(cfg.Name).Funcs(template.FuncMap{"json": toJSON, "summary": Summary}).Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %s has an invalid template %w", cfg.Name, err)
+		}
+		w.tmpl = tmpl
+	}
+	return w, nil
+}
+
+func (w *Webhook) Name() string { return w.cfg.Name }
+
+func (w *Webhook) Notify(ctx context.Context, alert Alert) error {
+	body, err := w.render(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post webhook %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (w *Webhook) render(alert Alert) ([]byte, error) {
+	if w.tmpl == nil {
+		return json.Marshal(alert)
+	}
+
+	var buf bytes.Buffer
+	if err := w.tmpl.Execute(&buf, alert); err != nil {
+		return nil, fmt.Errorf("failed to render webhook %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
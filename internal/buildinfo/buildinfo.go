@@ -0,0 +1,125 @@
+// Package buildinfo reports which build of the logging system is running,
+// so the versions producing each schema can be audited across a fleet. The
+// values are set at build time:
+//
+//	go build -ldflags "-X kafka-logging-system/internal/buildinfo.Version=v1.4.0
+//	  -X kafka-logging-system/internal/buildinfo.Commit=$(git rev-parse HEAD)
+//	  -X kafka-logging-system/internal/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/...
+package buildinfo
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Set with -ldflags -X, builds without them report a dev version and the
+// commit recorded by the go command, if any
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// Info describes a build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+	//Tags are the build tags enabling optional features
+	Tags []string `json:"tags,omitempty"`
+	//Modified is set when the commit had uncommitted changes
+	Modified bool `json:"modified,omitempty"`
+}
+
+var get = sync.OnceValue(func() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, s := range build.Settings {
+		switch s.Key {
+		case "-tags":
+			info.Tags = strings.Split(s.Value, ",")
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.Date == "" {
+				info.Date = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+})
+
+// Get returns the running build
+func Get() Info {
+	return get()
+}
+
+// String formats the build as one line, such as
+// "v1.4.0 (commit 3f2a9c1, built 2026-03-02T10:00:00Z, go1.24.4)"
+func (i Info) String() string {
+	var details []string
+	if i.Commit != "" {
+		commit := i.Commit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		if i.Modified {
+			commit += "+dirty"
+		}
+		details = append(details, "commit "+commit)
+	}
+	if i.Date != "" {
+		details = append(details, "built "+i.Date)
+	}
+	details = append(details, i.GoVersion)
+	if len(i.Tags) > 0 {
+		details = append(details, "tags "+strings.Join(i.Tags, ","))
+	}
+	return fmt.Sprintf("%s (%s)", i.Version, strings.Join(details, ", "))
+}
+
+// Attrs returns the build as key value pairs for slog
+func (i Info) Attrs() []any {
+	attrs := []any{"version", i.Version}
+	if i.Commit != "" {
+		attrs = append(attrs, "commit", i.Commit)
+	}
+	if i.Date != "" {
+		attrs = append(attrs, "built", i.Date)
+	}
+	return append(attrs, "go", i.GoVersion)
+}
+
+// versionFlag prints the build and exits as soon as it is parsed
+type versionFlag string
+
+func (versionFlag) IsBoolFlag() bool { return true }
+func (versionFlag) String() string   { return "false" }
+
+func (f versionFlag) Set(value string) error {
+	if value != "true" {
+		return nil
+	}
+	fmt.Println(string(f), Get())
+	os.Exit(0)
+	return nil
+}
+
+// RegisterFlag adds -version to fs, printing the build of program and
+// exiting when given
+func RegisterFlag(fs *flag.FlagSet, program string) {
+	fs.Var(versionFlag(program), "version", "print the version and exit")
+}
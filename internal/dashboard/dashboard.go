@@ -0,0 +1,22 @@
+// Package dashboard serves the embedded web UI for live logs and statistics.
+// The page reads the live tail from /ws, counts from /stats and search
+// results from /logs on the same server.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the dashboard files
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) //the directory is embedded above
+	}
+	return http.FileServerFS(files)
+}
@@ -0,0 +1,148 @@
+"use strict";
+
+const LEVELS = ["TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL"];
+const MAX_ROWS = 500;
+const STATS_WINDOW = "1h";
+const STATS_BUCKET = "1m";
+const STATS_REFRESH_MS = 10000;
+
+const feed = document.querySelector("#feed tbody");
+const status = document.getElementById("status");
+const dropped = document.getElementById("dropped");
+let socket = null;
+let paused = false;
+let droppedTotal = 0;
+
+for (const level of LEVELS) {
+  const label = document.createElement("label");
+  label.className = level;
+  label.innerHTML = `<input type="checkbox" value="${level}"> ${level}`;
+  document.getElementById("levels").append(label);
+}
+
+// filterParams returns the query string shared by /ws and /logs
+function filterParams() {
+  const params = new URLSearchParams();
+  const app = document.getElementById("app").value;
+  const levels = [...document.querySelectorAll("#levels input:checked")].map((el) => el.value);
+  const q = document.getElementById("q").value.trim();
+  if (app) params.set("app", app);
+  if (levels.length) params.set("level", levels.join(","));
+  if (q) params.set("q", q);
+  return params;
+}
+
+function row(entry) {
+  const tr = document.createElement("tr");
+  const time = new Date(entry.timestamp).toLocaleTimeString();
+  const cells = [time, entry.application, entry.level, entry.message];
+  cells.forEach((text, i) => {
+    const td = document.createElement("td");
+    td.textContent = text;
+    if (i === 2) td.className = entry.level;
+    if (i === 3) td.className = "msg";
+    tr.append(td);
+  });
+  return tr;
+}
+
+function connect() {
+  if (socket) socket.close();
+  const scheme = location.protocol === "https:" ? "wss" : "ws";
+  socket = new WebSocket(`${scheme}://${location.host}/ws?${filterParams()}`);
+  document.getElementById("feed-title").textContent = "Live tail";
+
+  socket.onopen = () => { status.textContent = "live"; status.className = "status live"; };
+  socket.onclose = (event) => {
+    if (event.target !== socket) return;
+    status.textContent = "disconnected, retrying…";
+    status.className = "status";
+    setTimeout(connect, 3000);
+  };
+  socket.onmessage = (event) => {
+    const data = JSON.parse(event.data);
+    if (data.dropped !== undefined) {
+      droppedTotal += data.dropped;
+      dropped.textContent = `${droppedTotal} entries skipped because the page fell behind`;
+      dropped.hidden = false;
+      return;
+    }
+    if (paused) return;
+    feed.prepend(row(data));
+    while (feed.rows.length > MAX_ROWS) feed.deleteRow(-1);
+  };
+}
+
+async function search() {
+  const params = filterParams();
+  params.set("limit", "200");
+  const resp = await fetch(`/logs?${params}`);
+  const body = await resp.json();
+  if (!resp.ok) {
+    status.textContent = body.error;
+    return;
+  }
+  paused = true;
+  document.getElementById("pause").textContent = "Resume";
+  document.getElementById("feed-title").textContent = "Stored logs (live tail paused)";
+  feed.replaceChildren(...body.entries.map(row));
+}
+
+function sparkline(points) {
+  const width = 240, height = 28;
+  const max = Math.max(...points, 0.01);
+  const step = points.length > 1 ? width / (points.length - 1) : 0;
+  const coords = points.map((p, i) => `${(i * step).toFixed(1)},${(height - (p / max) * height).toFixed(1)}`);
+  return `<svg width="${width}" height="${height}"><polyline fill="none" stroke="#f85149" stroke-width="1.5" points="${coords.join(" ")}"/></svg>`;
+}
+
+async function refreshStats() {
+  const resp = await fetch(`/stats?from=${STATS_WINDOW}&bucket=${STATS_BUCKET}`);
+  if (!resp.ok) return;
+  const counts = (await resp.json()).counts;
+
+  const totals = Object.fromEntries(LEVELS.map((l) => [l, 0]));
+  const buckets = [...new Set(counts.map((c) => c.bucket))].sort();
+  const apps = {};
+  for (const c of counts) {
+    totals[c.level] = (totals[c.level] || 0) + c.count;
+    const series = (apps[c.application] ||= Object.fromEntries(buckets.map((b) => [b, { total: 0, errors: 0 }])));
+    series[c.bucket].total += c.count;
+    if (c.level === "ERROR" || c.level === "FATAL") series[c.bucket].errors += c.count;
+  }
+
+  document.getElementById("counts").innerHTML = LEVELS.map(
+    (l) => `<div class="count ${l}">${l}<b>${totals[l]}</b></div>`).join("");
+  document.getElementById("window").textContent = `(last ${STATS_WINDOW}, ${STATS_BUCKET} buckets)`;
+
+  const select = document.getElementById("app");
+  const tbody = document.querySelector("#sparklines tbody");
+  tbody.replaceChildren();
+  for (const app of Object.keys(apps).sort()) {
+    if (![...select.options].some((o) => o.value === app)) select.add(new Option(app, app));
+    const points = buckets.map((b) => apps[app][b].total ? apps[app][b].errors / apps[app][b].total : 0);
+    const latest = points.length ? (points[points.length - 1] * 100).toFixed(1) : "0.0";
+    const tr = document.createElement("tr");
+    tr.innerHTML = `<td></td><td>${sparkline(points)}</td><td>${latest}%</td>`;
+    tr.firstChild.textContent = app;
+    tbody.append(tr);
+  }
+}
+
+document.getElementById("filters").addEventListener("submit", (event) => {
+  event.preventDefault();
+  feed.replaceChildren();
+  paused = false;
+  document.getElementById("pause").textContent = "Pause";
+  connect();
+});
+document.getElementById("pause").addEventListener("click", (event) => {
+  paused = !paused;
+  event.target.textContent = paused ? "Resume" : "Pause";
+  if (!paused) document.getElementById("feed-title").textContent = "Live tail";
+});
+document.getElementById("search").addEventListener("click", search);
+
+connect();
+refreshStats();
+setInterval(refreshStats, STATS_REFRESH_MS);
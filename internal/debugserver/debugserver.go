@@ -0,0 +1,71 @@
+// Package debugserver serves pprof profiles and expvar variables, so CPU and
+// heap profiles can be captured while the pipeline is under load. It is off
+// unless an address is given, profiles shouldn't be reachable by everyone.
+package debugserver
+
+import (
+	"errors"
+	"expvar"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Config says where the debug endpoints listen
+type Config struct {
+	//Addr serves /debug/pprof/ and /debug/vars, empty disables them
+	Addr string
+}
+
+// RegisterFlags binds the settings to flags
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "debug-addr", c.Addr, "address serving pprof profiles and expvar variables, such as localhost:6060, empty to disable")
+}
+
+// publishOnce guards the process wide expvar names, which can only be
+// published once
+var publishOnce sync.Once
+
+// Start serves the debug endpoints of service on cfg.Addr. The returned
+// function stops serving.
+func Start(cfg Config, service string) (func(), error) {
+	if cfg.Addr == "" {
+		return func() {}, nil
+	}
+	publishOnce.Do(func() {
+		expvar.NewString("service").Set(service)
+		expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	})
+
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for debug requests %w", err)
+	}
+	server := &http.Server{Handler: Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error from debug server", "err", err)
+		}
+	}()
+	slog.Info("Serving debug endpoints", "url", "http://"+listener.Addr().String()+"/debug/pprof/")
+	return func() { server.Close() }, nil
+}
+
+// Handler serves the pprof index and profiles under /debug/pprof/ and the
+// expvar variables on /debug/vars
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	return mux
+}
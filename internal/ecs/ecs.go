@@ -0,0 +1,145 @@
+// Package ecs maps log entries to Elastic Common Schema documents, so
+// Kibana dashboards and other ECS tooling work on them unchanged.
+package ecs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+// Version is the ECS version documents follow
+const Version = "8.11.0"
+
+// Document is one entry in ECS. Only the fields an entry has are set.
+type Document struct {
+	Timestamp time.Time `json:"@timestamp"`
+	Message   string    `json:"message"`
+	//Labels hold the metadata, ECS labels are keywords without dots in their keys
+	Labels  map[string]string `json:"labels,omitempty"`
+	ECS     ecsField          `json:"ecs"`
+	Log     logField          `json:"log"`
+	Service serviceField      `json:"service"`
+	Event   eventField        `json:"event"`
+	Host    *hostField        `json:"host,omitempty"`
+	Process *processField     `json:"process,omitempty"`
+	Trace   *idField          `json:"trace,omitempty"`
+	Span    *idField          `json:"span,omitempty"`
+	HTTP    *httpField        `json:"http,omitempty"`
+	Error   *errorField       `json:"error,omitempty"`
+}
+
+type ecsField struct {
+	Version string `json:"version"`
+}
+
+type logField struct {
+	//Level is the entry's level in lower case, as ECS loggers write it
+	Level string `json:"level"`
+}
+
+type serviceField struct {
+	Name        string `json:"name,omitempty"`
+	Environment string `json:"environment,omitempty"`
+}
+
+type eventField struct {
+	ID string `json:"id,omitempty"`
+	//Severity orders levels from TRACE (1) to FATAL (6)
+	Severity int `json:"severity,omitempty"`
+	//Duration is in nanoseconds
+	Duration int64 `json:"duration,omitempty"`
+}
+
+type hostField struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+}
+
+type processField struct {
+	PID int `json:"pid"`
+}
+
+type idField struct {
+	ID string `json:"id"`
+}
+
+type httpField struct {
+	Request idField `json:"request"`
+}
+
+type errorField struct {
+	Type       string `json:"type,omitempty"`
+	Message    string `json:"message,omitempty"`
+	StackTrace string `json:"stack_trace,omitempty"`
+}
+
+// FromEntry maps an entry to its ECS document: the application is the
+// service, the request id http.request.id and the duration event.duration
+func FromEntry(entry *models.LogEntry) Document {
+	doc := Document{
+		Timestamp: entry.Timestamp.UTC(),
+		Message:   entry.Message,
+		ECS:       ecsField{Version: Version},
+		Log:       logField{Level: strings.ToLower(string(entry.Level))},
+		Service:   serviceField{Name: entry.Application, Environment: string(entry.Environment)},
+		Event: eventField{
+			ID:       entry.ID,
+			Severity: entry.Level.Severity(),
+			Duration: int64(entry.DurationMs * float64(time.Millisecond)),
+		},
+	}
+	if entry.Hostname != "" {
+		doc.Host = &hostField{Name: entry.Hostname, Hostname: entry.Hostname}
+	}
+	if entry.PID != 0 {
+		doc.Process = &processField{PID: entry.PID}
+	}
+	if entry.TraceID != "" {
+		doc.Trace = &idField{ID: entry.TraceID}
+	}
+	if entry.SpanID != "" {
+		doc.Span = &idField{ID: entry.SpanID}
+	}
+	if entry.RequestID != "" {
+		doc.HTTP = &httpField{Request: idField{ID: entry.RequestID}}
+	}
+	if entry.ErrorType != "" || entry.ErrorMessage != "" || entry.StackTrace != "" {
+		doc.Error = &errorField{Type: entry.ErrorType, Message: entry.ErrorMessage, StackTrace: entry.StackTrace}
+	}
+	if len(entry.Metadata) > 0 {
+		doc.Labels = make(map[string]string, len(entry.Metadata))
+		for key, value := range entry.Metadata {
+			doc.Labels[labelKey(key)] = labelValue(value)
+		}
+	}
+	return doc
+}
+
+// Marshal encodes the ECS document of an entry
+func Marshal(entry *models.LogEntry) ([]byte, error) {
+	return json.Marshal(FromEntry(entry))
+}
+
+var labelKeyReplacer = strings.NewReplacer(".", "_", " ", "_", "*", "_", "\\", "_", `"`, "_")
+
+// labelKey replaces the characters Elasticsearch doesn't allow in label keys
+func labelKey(key string) string {
+	return labelKeyReplacer.Replace(key)
+}
+
+// labelValue formats a metadata value as a keyword, objects and arrays as JSON
+func labelValue(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case map[string]any, []any:
+		if data, err := json.Marshal(value); err == nil {
+			return string(data)
+		}
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,165 @@
+// Package envelope decodes log entries from Kafka messages using the headers
+// set by the producer, so new encodings can roll out without breaking older consumers.
+package envelope
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"kafka-logging-system/internal/models"
+	"strconv"
+
+	"github.com/IBM/sarama"
+)
+
+// Header returns the value of a message header
+func Header(message *sarama.ConsumerMessage, key string) (string, bool) {
+	for _, h := range message.Headers {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
+
+// Decode parses the message payload with the decoder named by its
+// content-type header. Messages from producers that predate headers are
+// decoded with fallback.
+func Decode(message *sarama.ConsumerMessage, fallback models.Format) (*models.LogEntry, error) {
+	entry := &models.LogEntry{}
+	if err := DecodeInto(message, fallback, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// DecodeAll returns the entries of a message, all of a batch message. The
+// entries that decoded are returned along with the first error.
+func DecodeAll(message *sarama.ConsumerMessage, fallback models.Format) ([]*models.LogEntry, error) {
+	messages, err := Unpack(message)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*models.LogEntry, 0, len(messages))
+	var firstErr error
+	for _, message := range messages {
+		entry, err := Decode(message, fallback)
+		if err != nil {
+			firstErr = cmp.Or(firstErr, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, firstErr
+}
+
+// DecodeInto is Decode for an existing entry, such as one from models.AcquireEntry
+func DecodeInto(message *sarama.ConsumerMessage, fallback models.Format, entry *models.LogEntry) error {
+	version := 0
+	if header, ok := Header(message, models.HeaderSchemaVersion); ok {
+		v, err := strconv.Atoi(header)
+		if err != nil || v < 1 {
+			return fmt.Errorf("invalid schema version %q", header)
+		}
+		version = v
+	}
+
+	format := fallback
+	if contentType, ok := Header(message, models.HeaderContentType); ok {
+		if contentType == models.ContentTypeBatch {
+			return errors.New("message is a batch, unpack it before decoding")
+		}
+		advertised, err := models.FormatForContentType(contentType)
+		if err != nil {
+			return err
+		}
+		format = advertised
+	}
+
+	if err := models.DecodeVersion(message.Value, format, version, entry); err != nil {
+		return err
+	}
+	//entries of producers that predate IDs are identified by where they
+	//were read, which stays the same when the message is read again
+	if entry.ID == "" {
+		entry.ID = sourceID(message)
+	}
+	return nil
+}
+
+// sourceID identifies a message by where it was read, and its entry by its
+// position in the batch it was unpacked from
+func sourceID(message *sarama.ConsumerMessage) string {
+	if index, ok := Header(message, models.HeaderBatchIndex); ok {
+		return fmt.Sprintf("%s/%d/%d/%s", message.Topic, message.Partition, message.Offset, index)
+	}
+	return fmt.Sprintf("%s/%d/%d", message.Topic, message.Partition, message.Offset)
+}
+
+// Unpack splits a batch message into a message per entry, with the key,
+// timestamp and headers of the batch, the content type of its entries and
+// the index of the entry in the batch-index header. Other messages are
+// returned as they are.
+func Unpack(message *sarama.ConsumerMessage) ([]*sarama.ConsumerMessage, error) {
+	if contentType, _ := Header(message, models.HeaderContentType); contentType != models.ContentTypeBatch {
+		return []*sarama.ConsumerMessage{message}, nil
+	}
+	batch, err := models.DecodeBatch(message.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := []byte(batch.Format.ContentType())
+	messages := make([]*sarama.ConsumerMessage, len(batch.Entries))
+	for i, value := range batch.Entries {
+		unpacked := *message
+		unpacked.Value = value
+		unpacked.Headers = make([]*sarama.RecordHeader, 0, len(message.Headers)+1)
+		for _, h := range message.Headers {
+			if h != nil && string(h.Key) == models.HeaderContentType {
+				h = &sarama.RecordHeader{Key: h.Key, Value: contentType}
+			}
+			unpacked.Headers = append(unpacked.Headers, h)
+		}
+		unpacked.Headers = append(unpacked.Headers, &sarama.RecordHeader{
+			Key:   []byte(models.HeaderBatchIndex),
+			Value: []byte(strconv.Itoa(i)),
+		})
+		messages[i] = &unpacked
+	}
+	return messages, nil
+}
+
+// Salvage recovers what it can of a JSON message that failed to decode with
+// cause, see models.Salvage. A missing timestamp or application is taken
+// from the message, which producers key by application, and a missing or
+// unknown level becomes WARN so the entry isn't overlooked. It reports
+// false for messages in other formats.
+func Salvage(message *sarama.ConsumerMessage, fallback models.Format, cause error) (*models.LogEntry, bool) {
+	format := fallback
+	if contentType, ok := Header(message, models.HeaderContentType); ok {
+		advertised, err := models.FormatForContentType(contentType)
+		if err != nil {
+			return nil, false
+		}
+		format = advertised
+	}
+	if format != models.FormatJSON {
+		return nil, false
+	}
+
+	entry := models.Salvage(message.Value, cause)
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = message.Timestamp
+	}
+	if entry.Application == "" && len(message.Key) > 0 {
+		entry.Application = string(message.Key)
+	}
+	if entry.Level.Severity() == 0 {
+		entry.Level = models.WARN
+	}
+	if entry.ID == "" {
+		entry.ID = sourceID(message)
+	}
+	return entry, true
+}
@@ -0,0 +1,133 @@
+package gelf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Chunked messages start with the magic bytes, an 8 byte message id, the
+// chunk's sequence number and the number of chunks
+var chunkMagic = []byte{0x1e, 0x0f}
+
+const (
+	chunkHeaderSize = 12
+	maxChunks       = 128
+	//chunkTimeout is how long the chunks of a message are kept waiting for
+	//the rest, as the GELF spec says
+	chunkTimeout = 5 * time.Second
+	//maxPending bounds the messages being assembled at once
+	maxPending = 4096
+)
+
+// Chunk splits a message into UDP datagrams of at most size bytes. A
+// message that fits is returned as it is.
+func Chunk(data []byte, size int) ([][]byte, error) {
+	if len(data) <= size {
+		return [][]byte{data}, nil
+	}
+	payload := size - chunkHeaderSize
+	count := (len(data) + payload - 1) / payload
+	if count > maxChunks {
+		return nil, fmt.Errorf("message of %d bytes needs more than %d chunks", len(data), maxChunks)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate message id %w", err)
+	}
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		part := data[i*payload : min((i+1)*payload, len(data))]
+		chunk := make([]byte, 0, chunkHeaderSize+len(part))
+		chunk = append(chunk, chunkMagic...)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunks = append(chunks, append(chunk, part...))
+	}
+	return chunks, nil
+}
+
+// pendingMessage collects the chunks of one message
+type pendingMessage struct {
+	chunks  [][]byte
+	missing int
+	size    int
+	started time.Time
+}
+
+// assembler joins chunked datagrams back into messages
+type assembler struct {
+	mu      sync.Mutex
+	pending map[[8]byte]*pendingMessage
+	swept   time.Time
+}
+
+func newAssembler() *assembler {
+	return &assembler{pending: make(map[[8]byte]*pendingMessage)}
+}
+
+// add returns the message a datagram completes. Datagrams that aren't
+// chunks are returned as they are, and nil is returned while chunks of the
+// message are still missing.
+func (a *assembler) add(datagram []byte, now time.Time) ([]byte, error) {
+	if !bytes.HasPrefix(datagram, chunkMagic) {
+		return datagram, nil
+	}
+	if len(datagram) < chunkHeaderSize {
+		return nil, errors.New("truncated chunk header")
+	}
+	var id [8]byte
+	copy(id[:], datagram[2:10])
+	seq, count := int(datagram[10]), int(datagram[11])
+	if count == 0 || count > maxChunks || seq >= count {
+		return nil, fmt.Errorf("invalid chunk %d of %d", seq, count)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if now.Sub(a.swept) >= time.Second {
+		a.expire(now)
+		a.swept = now
+	}
+
+	msg := a.pending[id]
+	if msg == nil {
+		if len(a.pending) >= maxPending {
+			return nil, errors.New("too many incomplete chunked messages")
+		}
+		msg = &pendingMessage{chunks: make([][]byte, count), missing: count, started: now}
+		a.pending[id] = msg
+	}
+	if len(msg.chunks) != count {
+		delete(a.pending, id)
+		return nil, errors.New("chunks of one message disagree on their count")
+	}
+	if msg.chunks[seq] != nil {
+		return nil, nil
+	}
+	part := datagram[chunkHeaderSize:]
+	if msg.size += len(part); msg.size > MaxMessageSize {
+		delete(a.pending, id)
+		return nil, fmt.Errorf("chunked message is larger than %d bytes", MaxMessageSize)
+	}
+	msg.chunks[seq] = bytes.Clone(part)
+	if msg.missing--; msg.missing > 0 {
+		return nil, nil
+	}
+
+	delete(a.pending, id)
+	return bytes.Join(msg.chunks, nil), nil
+}
+
+// expire drops messages whose chunks didn't all arrive in time
+func (a *assembler) expire(now time.Time) {
+	for id, msg := range a.pending {
+		if now.Sub(msg.started) > chunkTimeout {
+			delete(a.pending, id)
+		}
+	}
+}
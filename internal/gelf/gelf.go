@@ -0,0 +1,240 @@
+// Package gelf reads and writes the Graylog Extended Log Format, so logs can
+// be received from GELF senders and forwarded to Graylog.
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/syslog"
+)
+
+// Version is the GELF version of encoded messages
+const Version = "1.1"
+
+// MaxMessageSize bounds a message once decompressed
+const MaxMessageSize = 1 << 20
+
+// appFields name the application of a message, in order of preference.
+// Docker's GELF log driver sets _container_name.
+var appFields = []string{"_application", "_app", "_service", "_container_name", "facility"}
+
+// Decode parses one GELF message, plain JSON or compressed with gzip or
+// zlib. Messages without an application are logged as defaultApp.
+func Decode(data []byte, defaultApp string, now time.Time) (*models.LogEntry, error) {
+	data, err := decompress(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("invalid GELF message %w", err)
+	}
+
+	entry := &models.LogEntry{Timestamp: now, Level: syslog.Level(1)}
+	if short, _ := fields["short_message"].(string); strings.TrimSpace(short) != "" {
+		entry.Message = short
+	} else if full, _ := fields["full_message"].(string); strings.TrimSpace(full) != "" {
+		entry.Message = full
+		delete(fields, "full_message")
+	} else {
+		return nil, errors.New("GELF message has no short_message")
+	}
+	delete(fields, "short_message")
+	delete(fields, "version")
+
+	entry.Hostname, _ = fields["host"].(string)
+	delete(fields, "host")
+	if ts, ok := fields["timestamp"].(json.Number); ok {
+		seconds, err := ts.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", ts)
+		}
+		whole, frac := math.Modf(seconds)
+		entry.Timestamp = time.Unix(int64(whole), int64(math.Round(frac*1e6))*1e3)
+		delete(fields, "timestamp")
+	}
+	//a missing level is ALERT, as the GELF spec says
+	if level, ok := fields["level"].(json.Number); ok {
+		severity, err := level.Int64()
+		if err != nil || severity < 0 || severity > 7 {
+			return nil, fmt.Errorf("invalid level %q", level)
+		}
+		entry.Level = syslog.Level(int(severity))
+		delete(fields, "level")
+	}
+	//messages written by Encode carry the exact level, such as TRACE
+	if name, ok := fields["_log_level"].(string); ok {
+		if level, err := models.ParseLevel(name); err == nil {
+			entry.Level = level
+			delete(fields, "_log_level")
+		}
+	}
+
+	for _, field := range appFields {
+		if app, ok := fields[field].(string); ok && app != "" {
+			entry.Application = strings.TrimPrefix(app, "/")
+			delete(fields, field)
+			break
+		}
+	}
+	if entry.Application == "" {
+		entry.Application = defaultApp
+	}
+
+	for field, target := range map[string]*string{
+		"_trace_id":   &entry.TraceID,
+		"_span_id":    &entry.SpanID,
+		"_request_id": &entry.RequestID,
+	} {
+		if value, ok := fields[field].(string); ok {
+			*target = value
+			delete(fields, field)
+		}
+	}
+	if env, ok := fields["_environment"].(string); ok {
+		entry.Environment = models.Environment(env)
+		delete(fields, "_environment")
+	}
+	if pid, err := strconv.Atoi(fmt.Sprint(fields["_pid"])); err == nil {
+		entry.PID = pid
+		delete(fields, "_pid")
+	}
+
+	//additional fields lose their underscore, the deprecated file, line and
+	//facility fields are kept as they are
+	for key, value := range fields {
+		if entry.Metadata == nil {
+			entry.Metadata = make(map[string]any, len(fields))
+		}
+		if number, ok := value.(json.Number); ok {
+			value = jsonNumber(number)
+		}
+		entry.Metadata[strings.TrimPrefix(key, "_")] = value
+	}
+	return entry, nil
+}
+
+// jsonNumber returns an integer when the number has no fraction
+func jsonNumber(n json.Number) any {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
+
+// decompress inflates gzip and zlib compressed messages
+func decompress(data []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch {
+	case len(data) > 1 && data[0] == 0x1f && data[1] == 0x8b:
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	case len(data) > 1 && data[0]&0x0f == 8 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0:
+		r, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed message %w", err)
+	}
+	defer r.Close()
+
+	inflated, err := io.ReadAll(io.LimitReader(r, MaxMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed message %w", err)
+	}
+	if len(inflated) > MaxMessageSize {
+		return nil, fmt.Errorf("message is larger than %d bytes", MaxMessageSize)
+	}
+	return inflated, nil
+}
+
+// invalidFieldChars are replaced in additional field names
+var invalidFieldChars = regexp.MustCompile(`[^\w.\-]`)
+
+// Encode returns the entry as a GELF 1.1 message. A multi-line message is
+// sent in full_message with its first line as short_message, followed by
+// the stack trace of an error, and metadata becomes additional fields.
+func Encode(entry *models.LogEntry) ([]byte, error) {
+	host := entry.Hostname
+	if host == "" {
+		host = "unknown"
+	}
+	msg := map[string]any{
+		"version":       Version,
+		"host":          host,
+		"short_message": entry.Message,
+		"timestamp":     float64(entry.Timestamp.UnixMilli()) / 1e3,
+		"level":         syslog.Severity(entry.Level),
+		"_application":  entry.Application,
+		"_log_level":    string(entry.Level),
+	}
+	if first, _, multiline := strings.Cut(entry.Message, "\n"); multiline {
+		msg["short_message"] = first
+		msg["full_message"] = entry.Message
+	}
+	if entry.StackTrace != "" {
+		msg["full_message"] = entry.Message + "\n" + entry.StackTrace
+	}
+	for field, value := range map[string]string{
+		"_trace_id":      entry.TraceID,
+		"_span_id":       entry.SpanID,
+		"_request_id":    entry.RequestID,
+		"_environment":   string(entry.Environment),
+		"_error_type":    entry.ErrorType,
+		"_error_message": entry.ErrorMessage,
+	} {
+		if value != "" {
+			msg[field] = value
+		}
+	}
+	if entry.PID != 0 {
+		msg["_pid"] = entry.PID
+	}
+
+	for key, value := range entry.Metadata {
+		field := "_" + invalidFieldChars.ReplaceAllString(key, "_")
+		if field == "_id" {
+			//_id is reserved by Graylog
+			field = "_id_"
+		}
+		if _, taken := msg[field]; taken {
+			continue
+		}
+		msg[field] = fieldValue(value)
+	}
+	return json.Marshal(msg)
+}
+
+// fieldValue keeps strings and numbers, GELF has no other field types
+func fieldValue(value any) any {
+	switch v := value.(type) {
+	case string, float64, float32, int, int64, int32, uint, uint64, uint32, json.Number:
+		return v
+	case nil:
+		return ""
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
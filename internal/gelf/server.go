@@ -0,0 +1,171 @@
+package gelf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+// maxDatagramSize is the largest UDP datagram read, a chunk or a whole message
+const maxDatagramSize = 64 * 1024
+
+// Server decodes the messages it receives and hands them to Handler, which
+// may be called from several goroutines at once
+type Server struct {
+	//DefaultApp names messages that don't carry an application
+	DefaultApp string
+	Handler    func(entry *models.LogEntry)
+	//Invalid is called for messages that can't be decoded, when set
+	Invalid func(remote string, err error)
+
+	wg sync.WaitGroup
+}
+
+func (s *Server) handle(data []byte, remote net.Addr) {
+	entry, err := Decode(data, s.DefaultApp, time.Now())
+	if err != nil {
+		s.invalid(remote, err)
+		return
+	}
+	if host, _, err := net.SplitHostPort(remote.String()); err == nil {
+		if entry.Metadata == nil {
+			entry.Metadata = make(map[string]any, 1)
+		}
+		entry.Metadata["source_ip"] = host
+	}
+	s.Handler(entry)
+}
+
+func (s *Server) invalid(remote net.Addr, err error) {
+	if s.Invalid != nil {
+		s.Invalid(remote.String(), err)
+	}
+}
+
+// ListenUDP receives messages on addr until ctx is done. Messages may be
+// chunked and compressed with gzip or zlib.
+func (s *Server) ListenUDP(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on udp %s %w", addr, err)
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		chunks := newAssembler()
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, remote, err := conn.ReadFrom(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("GELF UDP listener stopped", "err", err)
+				}
+				return
+			}
+			msg, err := chunks.add(buf[:n], time.Now())
+			if err != nil {
+				s.invalid(remote, err)
+				continue
+			}
+			if msg != nil {
+				s.handle(msg, remote)
+			}
+		}
+	}()
+	return nil
+}
+
+// ListenTCP accepts connections on addr until ctx is done. Messages are
+// uncompressed JSON, each ended by a null byte.
+func (s *Server) ListenTCP(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on tcp %s %w", addr, err)
+	}
+
+	var mu sync.Mutex
+	conns := make(map[net.Conn]bool)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		<-ctx.Done()
+		listener.Close()
+		mu.Lock()
+		for conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+	}()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("GELF TCP listener stopped", "err", err)
+				}
+				return
+			}
+			mu.Lock()
+			conns[conn] = true
+			mu.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serveConn(conn)
+				mu.Lock()
+				delete(conns, conn)
+				mu.Unlock()
+				conn.Close()
+			}()
+		}
+	}()
+	return nil
+}
+
+// serveConn reads null terminated messages from one TCP connection
+func (s *Server) serveConn(conn net.Conn) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), MaxMessageSize)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, 0); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	for scanner.Scan() {
+		//some senders end messages with a newline as well
+		if msg := bytes.TrimSpace(scanner.Bytes()); len(msg) > 0 {
+			s.handle(msg, conn.RemoteAddr())
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Warn("Closing GELF connection", "remote", conn.RemoteAddr().String(), "err", err)
+	}
+}
+
+// Wait blocks until the listeners and connections have stopped
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
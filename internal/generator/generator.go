@@ -0,0 +1,91 @@
+// Package generator produces realistic random log entries for simulated applications.
+package generator
+
+import (
+	"encoding/hex"
+	"kafka-logging-system/internal/models"
+	"math/rand"
+	"time"
+)
+
+// AppNames are the applications simulated by default
+var AppNames = []string{
+	"userService",
+	"DatabaseService",
+	"AuthService",
+	"PaymentService",
+}
+
+var infoMessages = []string{
+	"User logged in successfully",
+	"data Retrieved successfully",
+	"Service Started",
+	"Request completed",
+}
+
+var warnMessages = []string{
+	"Slow Database query",
+	"High Memory usage",
+	"Connection Pool almost full",
+	"Password failed for user",
+	"Unauthenticated user trying to access data",
+}
+
+var errorMessages = []string{
+	"Database Connection Failed",
+	"Invalid user credentials",
+	"Backup Database not responding",
+	"Service Unavailable",
+	"Request Timeout",
+}
+
+type Generator struct {
+	appName  string
+	scenario *Scenario
+	start    time.Time
+	rnd      *rand.Rand
+}
+
+// New returns a generator for appName drawing from rnd
+func New(appName string, rnd *rand.Rand) *Generator {
+	return NewScenario(Default, appName, time.Now(), rnd)
+}
+
+// NewScenario returns a generator for appName that follows scenario, with
+// its spikes scheduled from start. Generators sharing a seeded rnd produce
+// the same entries on every run.
+func NewScenario(scenario *Scenario, appName string, start time.Time, rnd *rand.Rand) *Generator {
+	return &Generator{
+		appName:  appName,
+		scenario: scenario,
+		start:    start,
+		rnd:      rnd,
+	}
+}
+
+// Next returns a new log entry timestamped now
+func (g *Generator) Next() *models.LogEntry {
+	return g.NextAt(time.Now())
+}
+
+// NextAt returns a new log entry timestamped at, used for reproducible runs
+func (g *Generator) NextAt(at time.Time) *models.LogEntry {
+	//Randomly select log level
+	level, message := g.scenario.pick(g.appName, at.Sub(g.start), g.rnd)
+
+	entry := models.NewEntry(g.appName, level, message,
+		models.WithTime(at),
+		models.WithTrace(g.randomID(16), g.randomID(8)),
+		models.WithRequestID(g.randomID(8)),
+	)
+	return entry.
+		WithField("user_id", 1000+g.rnd.Intn(9000)).
+		WithField("latency_ms", g.rnd.Intn(500))
+}
+
+// randomID returns n random bytes hex encoded, the W3C trace context format
+func (g *Generator) randomID(n int) string {
+	id := make([]byte, n)
+	g.rnd.Read(id)
+	return hex.EncodeToString(id)
+}
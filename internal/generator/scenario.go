@@ -0,0 +1,346 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LevelWeight is the relative share of entries logged at Level
+type LevelWeight struct {
+	Level  models.LogLevel
+	Weight float64
+}
+
+// Levels are picked in proportion to their weights. In YAML they are a
+// mapping such as {INFO: 60, ERROR: 40}, kept in file order.
+type Levels []LevelWeight
+
+func (l *Levels) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: levels must map a level to its weight", node.Line)
+	}
+	weights := make(Levels, 0, len(node.Content)/2)
+	for i := 0; i < len(node.Content); i += 2 {
+		var w LevelWeight
+		if err := node.Content[i].Decode(&w.Level); err != nil {
+			return err
+		}
+		if err := node.Content[i+1].Decode(&w.Weight); err != nil {
+			return err
+		}
+		if w.Weight < 0 {
+			return fmt.Errorf("line %d: weight of %s can't be negative", node.Content[i].Line, w.Level)
+		}
+		weights = append(weights, w)
+	}
+	*l = weights
+	return nil
+}
+
+// Messages are the messages logged at each level
+type Messages map[models.LogLevel][]string
+
+// App overrides the scenario's levels and messages for one application
+type App struct {
+	Name string `yaml:"name"`
+	//Rate is the app's messages per second, zero shares the loadgen rate
+	Rate     float64  `yaml:"rate"`
+	Levels   Levels   `yaml:"levels"`
+	Messages Messages `yaml:"messages"`
+}
+
+// Burst multiplies the rate by Rate for For, every Every after Start
+type Burst struct {
+	Start time.Duration `yaml:"start"`
+	Every time.Duration `yaml:"every"`
+	For   time.Duration `yaml:"for"`
+	Rate  float64       `yaml:"rate"`
+}
+
+func (b *Burst) active(elapsed time.Duration) bool {
+	if elapsed < b.Start {
+		return false
+	}
+	since := elapsed - b.Start
+	if b.Every > 0 {
+		since %= b.Every
+	}
+	return since < b.For
+}
+
+// Spike replaces the levels and messages of Apps, every app when empty,
+// from At for For, such as an error storm during an outage
+type Spike struct {
+	At       time.Duration `yaml:"at"`
+	For      time.Duration `yaml:"for"`
+	Apps     []string      `yaml:"apps"`
+	Levels   Levels        `yaml:"levels"`
+	Messages Messages      `yaml:"messages"`
+}
+
+func (s *Spike) active(app string, elapsed time.Duration) bool {
+	if elapsed < s.At || elapsed >= s.At+s.For {
+		return false
+	}
+	if len(s.Apps) == 0 {
+		return true
+	}
+	for _, a := range s.Apps {
+		if a == app {
+			return true
+		}
+	}
+	return false
+}
+
+// Scenario describes the traffic of the simulated applications. Bursts and
+// spikes are scheduled relative to the start of the run.
+type Scenario struct {
+	Name string `yaml:"name"`
+	//Apps are the simulated applications, AppNames when empty
+	Apps     []App    `yaml:"apps"`
+	Levels   Levels   `yaml:"levels"`
+	Messages Messages `yaml:"messages"`
+	Bursts   []Burst  `yaml:"bursts"`
+	Spikes   []Spike  `yaml:"spikes"`
+
+	apps map[string]*App
+}
+
+// Default is the traffic of a healthy system with occasional errors
+var Default = &Scenario{
+	Name: "default",
+	Levels: Levels{
+		{models.INFO, 0.6},
+		{models.WARN, 0.2},
+		{models.ERROR, 0.15},
+		{models.DEBUG, 0.05},
+	},
+	Messages: Messages{
+		models.INFO:  infoMessages,
+		models.WARN:  warnMessages,
+		models.ERROR: errorMessages,
+		models.DEBUG: {"debug trace information"},
+	},
+}
+
+// Scenarios are the built in scenarios by name
+var Scenarios = map[string]*Scenario{
+	Default.Name: Default,
+	"incident": {
+		Name: "incident",
+		Levels: Levels{
+			{models.INFO, 0.2},
+			{models.WARN, 0.3},
+			{models.ERROR, 0.5},
+		},
+		Messages: Default.Messages,
+	},
+	"verbose": {
+		Name: "verbose",
+		Levels: Levels{
+			{models.INFO, 0.3},
+			{models.WARN, 0.05},
+			{models.ERROR, 0.01},
+			{models.DEBUG, 0.64},
+		},
+		Messages: Default.Messages,
+	},
+}
+
+// LookupScenario returns the built in scenario called name, or loads it
+// from a YAML file when name ends in .yaml or .yml
+func LookupScenario(name string) (*Scenario, error) {
+	if strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml") {
+		return LoadScenario(name)
+	}
+	if s, ok := Scenarios[name]; ok {
+		return s, nil
+	}
+	names := make([]string, 0, len(Scenarios))
+	for n := range Scenarios {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("unknown scenario %q, expected one of %s or a .yaml file", name, strings.Join(names, ", "))
+}
+
+// LoadScenario reads a scenario from a YAML file. Levels and messages that
+// aren't set fall back to the default scenario.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario %w", err)
+	}
+
+	var s Scenario
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %w", err)
+	}
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if len(s.Levels) == 0 {
+		s.Levels = Default.Levels
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("scenario %s %w", s.Name, err)
+	}
+	return &s, nil
+}
+
+// validate checks that every level that can be picked has messages
+func (s *Scenario) validate() error {
+	s.apps = make(map[string]*App, len(s.Apps))
+	for i := range s.Apps {
+		app := &s.Apps[i]
+		if app.Name == "" {
+			return fmt.Errorf("app %d has no name", i+1)
+		}
+		if s.apps[app.Name] != nil {
+			return fmt.Errorf("has duplicate app %s", app.Name)
+		}
+		if app.Rate < 0 {
+			return fmt.Errorf("app %s has a negative rate", app.Name)
+		}
+		s.apps[app.Name] = app
+	}
+	for i, b := range s.Bursts {
+		if b.For <= 0 || b.Rate < 0 {
+			return fmt.Errorf("burst %d needs a positive for and rate", i+1)
+		}
+	}
+
+	for _, app := range s.AppNames() {
+		if err := s.checkLevels(app, s.levels(app, nil), nil); err != nil {
+			return err
+		}
+		for i := range s.Spikes {
+			spike := &s.Spikes[i]
+			if spike.For <= 0 {
+				return fmt.Errorf("spike %d needs a positive for", i+1)
+			}
+			if spike.active(app, spike.At) {
+				if err := s.checkLevels(app, s.levels(app, spike), spike); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Scenario) checkLevels(app string, levels Levels, spike *Spike) error {
+	total := 0.0
+	for _, l := range levels {
+		total += l.Weight
+		if l.Weight > 0 && len(s.messages(app, spike, l.Level)) == 0 {
+			return fmt.Errorf("has no %s messages for %s", l.Level, app)
+		}
+	}
+	if total <= 0 {
+		return fmt.Errorf("has no level with a positive weight for %s", app)
+	}
+	return nil
+}
+
+// AppNames returns the applications simulated by the scenario
+func (s *Scenario) AppNames() []string {
+	if len(s.Apps) == 0 {
+		return AppNames
+	}
+	names := make([]string, len(s.Apps))
+	for i, app := range s.Apps {
+		names[i] = app.Name
+	}
+	return names
+}
+
+// AppRate returns the rate set for app, zero when it has none
+func (s *Scenario) AppRate(app string) float64 {
+	if a := s.apps[app]; a != nil {
+		return a.Rate
+	}
+	return 0
+}
+
+// RateAt returns the rate at elapsed, multiplied while a burst is active
+func (s *Scenario) RateAt(rate float64, elapsed time.Duration) float64 {
+	for i := range s.Bursts {
+		if s.Bursts[i].active(elapsed) {
+			rate *= s.Bursts[i].Rate
+		}
+	}
+	return rate
+}
+
+// spike returns the spike active for app at elapsed, nil when there is none
+func (s *Scenario) spike(app string, elapsed time.Duration) *Spike {
+	for i := range s.Spikes {
+		if s.Spikes[i].active(app, elapsed) {
+			return &s.Spikes[i]
+		}
+	}
+	return nil
+}
+
+// levels returns the level weights of app, a spike's take precedence
+func (s *Scenario) levels(app string, spike *Spike) Levels {
+	if spike != nil && len(spike.Levels) > 0 {
+		return spike.Levels
+	}
+	if a := s.apps[app]; a != nil && len(a.Levels) > 0 {
+		return a.Levels
+	}
+	return s.Levels
+}
+
+// messages returns the messages of app at level, from the most specific
+// catalog that has any
+func (s *Scenario) messages(app string, spike *Spike, level models.LogLevel) []string {
+	if spike != nil && len(spike.Messages[level]) > 0 {
+		return spike.Messages[level]
+	}
+	if a := s.apps[app]; a != nil && len(a.Messages[level]) > 0 {
+		return a.Messages[level]
+	}
+	if len(s.Messages[level]) > 0 {
+		return s.Messages[level]
+	}
+	return Default.Messages[level]
+}
+
+// pick draws a level by weight and one of its messages
+func (s *Scenario) pick(app string, elapsed time.Duration, rnd *rand.Rand) (models.LogLevel, string) {
+	spike := s.spike(app, elapsed)
+	levels := s.levels(app, spike)
+
+	total := 0.0
+	for _, l := range levels {
+		total += l.Weight
+	}
+	r := float64(rnd.Float32()) * total
+	var level models.LogLevel
+	for _, l := range levels {
+		if l.Weight <= 0 {
+			continue
+		}
+		//rounding can leave r just above the last weight
+		level = l.Level
+		if r < l.Weight {
+			break
+		}
+		r -= l.Weight
+	}
+	messages := s.messages(app, spike, level)
+	return level, messages[rnd.Intn(len(messages))]
+}
@@ -0,0 +1,108 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+// ErrBatcherClosed is returned for entries submitted after Close
+var ErrBatcherClosed = errors.New("batcher is closed")
+
+// chunk is a group of entries submitted together, done receives the
+// result of the batch they were sent in
+type chunk struct {
+	entries []*models.LogEntry
+	done    chan error
+}
+
+// Batcher merges entries submitted by many callers into batches of up to
+// Size entries, sent once full or Linger after their first entry arrived
+type Batcher struct {
+	sender BatchSender
+	size   int
+	linger time.Duration
+
+	chunks chan chunk
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewBatcher starts a batcher sending through sender
+func NewBatcher(sender BatchSender, size int, linger time.Duration) *Batcher {
+	b := &Batcher{
+		sender: sender,
+		size:   size,
+		linger: linger,
+		chunks: make(chan chunk),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Submit queues entries for the next batch. The returned channel receives
+// the result once the batch was sent. Submit blocks while a batch is being
+// sent, until ctx is done.
+func (b *Batcher) Submit(ctx context.Context, entries []*models.LogEntry) (<-chan error, error) {
+	c := chunk{entries: entries, done: make(chan error, 1)}
+	select {
+	case b.chunks <- c:
+		return c.done, nil
+	case <-b.stop:
+		return nil, ErrBatcherClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close sends what is pending and stops the batcher
+func (b *Batcher) Close() {
+	close(b.stop)
+	<-b.done
+}
+
+func (b *Batcher) run() {
+	defer close(b.done)
+
+	var pending []chunk
+	var entries []*models.LogEntry
+	timer := time.NewTimer(b.linger)
+	timer.Stop()
+
+	flush := func() {
+		timer.Stop()
+		if len(pending) == 0 {
+			return
+		}
+		//entries of many streams share the batch, they only join the traces
+		//they name themselves
+		err := b.sender.SendBatchContext(context.Background(), entries)
+		for _, c := range pending {
+			c.done <- err
+		}
+		pending, entries = pending[:0], nil
+	}
+
+	for {
+		select {
+		case c := <-b.chunks:
+			if len(pending) == 0 {
+				timer.Reset(b.linger)
+			}
+			pending = append(pending, c)
+			entries = append(entries, c.entries...)
+			if len(entries) >= b.size {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		case <-b.stop:
+			flush()
+			return
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/models/logpb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCService implements the Ingest gRPC service. Entries of every call are
+// merged into shared Kafka batches by a Batcher, and a call returns once its
+// entries were produced.
+type GRPCService struct {
+	logpb.UnimplementedIngestServer
+
+	batcher *Batcher
+	sources []Source
+	//MaxInFlight is how many requests of one stream wait for Kafka before
+	//the stream stops reading, pushing back on the client
+	MaxInFlight int
+	//Limits bound every entry, larger ones fail the call
+	Limits models.Limits
+}
+
+// NewGRPCService returns a service shipping through batcher. Calls must
+// carry the token of one of the sources in the authorization metadata,
+// unless there are none.
+func NewGRPCService(batcher *Batcher, sources []Source) *GRPCService {
+	return &GRPCService{
+		batcher:     batcher,
+		sources:     sources,
+		MaxInFlight: 16,
+		Limits:      models.DefaultLimits(),
+	}
+}
+
+// Ship produces the entries of one request, all or none of them
+func (s *GRPCService) Ship(ctx context.Context, req *logpb.ShipRequest) (*logpb.ShipResponse, error) {
+	source, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := protoEntries(req.Entries, source.defaults(), s.Limits, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return &logpb.ShipResponse{}, nil
+	}
+
+	done, err := s.batcher.Submit(ctx, entries)
+	if err != nil {
+		return nil, submitStatus(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "failed to ship logs %v", err)
+		}
+	case <-ctx.Done():
+		//the entries may still be produced once their batch is sent
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	return &logpb.ShipResponse{Accepted: int64(len(entries))}, nil
+}
+
+// pendingShip is a request of a stream waiting for its batch to be sent
+type pendingShip struct {
+	done    <-chan error
+	entries int
+}
+
+// ShipStream produces the entries of every request on the stream. An
+// invalid entry or a failed batch ends the stream with an error, entries of
+// earlier requests may have been produced by then.
+func (s *GRPCService) ShipStream(stream logpb.Ingest_ShipStreamServer) error {
+	ctx := stream.Context()
+	source, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	defaults := source.defaults()
+
+	pending := make([]pendingShip, 0, s.MaxInFlight)
+	var accepted int64
+	wait := func() error {
+		oldest := pending[0]
+		pending = pending[1:]
+		select {
+		case err := <-oldest.done:
+			if err != nil {
+				return status.Errorf(codes.Unavailable, "failed to ship logs after %d entries %v", accepted, err)
+			}
+			accepted += int64(oldest.entries)
+			return nil
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	received := 0
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		entries, err := protoEntries(req.Entries, defaults, s.Limits, received)
+		if err != nil {
+			return err
+		}
+		received += len(entries)
+		if len(entries) == 0 {
+			continue
+		}
+
+		//stop reading until the oldest request is sent, so a client can't
+		//queue more than MaxInFlight requests
+		if len(pending) >= s.MaxInFlight {
+			if err := wait(); err != nil {
+				return err
+			}
+		}
+		done, err := s.batcher.Submit(ctx, entries)
+		if err != nil {
+			return submitStatus(err)
+		}
+		pending = append(pending, pendingShip{done: done, entries: len(entries)})
+	}
+
+	for len(pending) > 0 {
+		if err := wait(); err != nil {
+			return err
+		}
+	}
+	return stream.SendAndClose(&logpb.ShipResponse{Accepted: accepted})
+}
+
+// authenticate returns the source whose token the call carries
+func (s *GRPCService) authenticate(ctx context.Context) (Source, error) {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+	source, ok := authenticate(s.sources, authorization)
+	if !ok {
+		return Source{}, status.Error(codes.Unauthenticated, "missing or unknown token")
+	}
+	return source, nil
+}
+
+// protoEntries converts and validates the entries of a request, first is
+// the index of the first one within its stream
+func protoEntries(msgs []*logpb.LogEntry, defaults *Defaults, limits models.Limits, first int) ([]*models.LogEntry, error) {
+	now := time.Now()
+	entries := make([]*models.LogEntry, len(msgs))
+	for i, msg := range msgs {
+		entry, err := models.FromProtoMessage(msg)
+		if err == nil {
+			defaults.fill(entry, now)
+			err = validate(entry, limits)
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "entry %d %v", first+i, err)
+		}
+		entries[i] = entry
+	}
+	return entries, nil
+}
+
+// submitStatus maps an error from Batcher.Submit to a gRPC status
+func submitStatus(err error) error {
+	if errors.Is(err, ErrBatcherClosed) {
+		return status.Error(codes.Unavailable, "server is shutting down")
+	}
+	return status.FromContextError(err).Err()
+}
@@ -0,0 +1,252 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/tracing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BatchSender ships a batch of entries, such as producer.Producer. The
+// messages continue the trace of ctx.
+type BatchSender interface {
+	SendBatchContext(ctx context.Context, entries []*models.LogEntry) error
+}
+
+// Source is a client allowed to ship logs over HTTP, identified by its token
+type Source struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	//Application names entries from this source that don't name one
+	Application string `yaml:"application"`
+}
+
+// defaults fill in the entries of the source, which are tagged with its
+// name. Their level is never filled in, an entry without one is invalid.
+func (s Source) defaults() *Defaults {
+	defaults := &Defaults{Application: s.Application}
+	if s.Name != "" {
+		defaults.Metadata = map[string]any{"source": s.Name}
+	}
+	return defaults
+}
+
+// LoadSources reads the sources from a YAML file. ${VAR} references are
+// expanded from the environment so tokens can stay out of the file.
+func LoadSources(path string) ([]Source, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sources %w", err)
+	}
+
+	var file struct {
+		Sources []Source `yaml:"sources"`
+	}
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), &file); err != nil {
+		return nil, fmt.Errorf("failed to parse sources %w", err)
+	}
+	names := make(map[string]bool, len(file.Sources))
+	for i, source := range file.Sources {
+		if source.Name == "" || source.Token == "" {
+			return nil, fmt.Errorf("source %d needs a name and a token", i+1)
+		}
+		if names[source.Name] {
+			return nil, fmt.Errorf("duplicate source %s", source.Name)
+		}
+		names[source.Name] = true
+	}
+	return file.Sources, nil
+}
+
+// Handler accepts entries POSTed as a JSON object, a JSON array or
+// newline delimited JSON. A batch is only shipped when every entry in it
+// is valid.
+type Handler struct {
+	sender  BatchSender
+	sources []Source
+	//MaxBodySize and MaxBatch bound a single request
+	MaxBodySize int64
+	MaxBatch    int
+	//Limits bound every entry, larger ones are rejected
+	Limits models.Limits
+}
+
+// NewHandler returns a handler shipping to sender. Requests must carry the
+// token of one of the sources as a bearer token, unless there are none.
+func NewHandler(sender BatchSender, sources []Source) *Handler {
+	return &Handler{
+		sender:      sender,
+		sources:     sources,
+		MaxBodySize: 1 << 20,
+		MaxBatch:    1000,
+		Limits:      models.DefaultLimits(),
+	}
+}
+
+// invalidEntry explains why one entry of a batch was rejected. Field, Code
+// and Limit are those of a models.ValidationError, entries that aren't
+// valid JSON have the malformed code and the field that failed to decode.
+type invalidEntry struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+	Field string `json:"field,omitempty"`
+	Code  string `json:"code"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+func newInvalidEntry(index int, err error) invalidEntry {
+	invalid := invalidEntry{Index: index, Error: err.Error(), Code: models.CodeMalformed}
+	var verr *models.ValidationError
+	var perr *models.ParseError
+	switch {
+	case errors.As(err, &verr):
+		invalid.Field, invalid.Code, invalid.Limit = verr.Field, verr.Code, verr.Limit
+	case errors.As(err, &perr):
+		invalid.Field = perr.Field
+	}
+	return invalid
+}
+
+// validate checks an entry has the fields every consumer relies on and fits limits
+func validate(entry *models.LogEntry, limits models.Limits) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+	return entry.CheckLimits(limits)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartRequest(r, "POST /logs")
+	defer span.End()
+
+	source, ok := h.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or unknown token"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.MaxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("body is larger than %d bytes", h.MaxBodySize)})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "failed to read body"})
+		return
+	}
+
+	raw, err := splitEntries(body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if len(raw) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no entries"})
+		return
+	}
+	if len(raw) > h.MaxBatch {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": fmt.Sprintf("more than %d entries", h.MaxBatch)})
+		return
+	}
+
+	defaults := source.defaults()
+	now := time.Now()
+	entries := make([]*models.LogEntry, 0, len(raw))
+	var invalid []invalidEntry
+	for i, data := range raw {
+		entry, err := models.FromJson(data)
+		if err == nil {
+			defaults.fill(entry, now)
+			err = validate(entry, h.Limits)
+		}
+		if err != nil {
+			invalid = append(invalid, newInvalidEntry(i, err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(invalid) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid entries, none were accepted", "invalid": invalid})
+		return
+	}
+
+	if err := h.sender.SendBatchContext(ctx, entries); err != nil {
+		span.RecordError(err)
+		slog.Error("Error shipping ingested logs", "err", err)
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "failed to ship logs, retry later"})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]int{"accepted": len(entries)})
+}
+
+// authenticate returns the source whose token the request carries. Without
+// configured sources every request is accepted as an anonymous source.
+func (h *Handler) authenticate(r *http.Request) (Source, bool) {
+	return authenticate(h.sources, r.Header.Get("Authorization"))
+}
+
+// authenticate returns the source whose token is the bearer token of an
+// authorization header, any caller is anonymous when there are no sources
+func authenticate(sources []Source, authorization string) (Source, bool) {
+	if len(sources) == 0 {
+		return Source{}, true
+	}
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return Source{}, false
+	}
+	for _, source := range sources {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(source.Token)) == 1 {
+			return source, true
+		}
+	}
+	return Source{}, false
+}
+
+// splitEntries returns the JSON values of a body holding one object, an
+// array of them or one object per line
+func splitEntries(body []byte) ([]json.RawMessage, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var raw []json.RawMessage
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, fmt.Errorf("invalid JSON array %w", err)
+		}
+		return raw, nil
+	}
+
+	var raw []json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err == io.EOF {
+			return raw, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid JSON entry %d %w", len(raw), err)
+		}
+		raw = append(raw, value)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error writing response", "err", err)
+	}
+}
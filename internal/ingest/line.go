@@ -0,0 +1,70 @@
+// Package ingest turns lines read from pipes, files and other sources into
+// log entries.
+package ingest
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+// Defaults fill in the fields a line doesn't carry
+type Defaults struct {
+	Application string
+	Level       models.LogLevel
+	Metadata    map[string]any
+}
+
+// Entry returns the entry for one line. JSON objects and logfmt lines with
+// a message and a level, see models.IsLogfmt, are decoded as a LogEntry
+// with missing fields taken from the defaults, any other line becomes the
+// message of an entry built from them.
+func (d *Defaults) Entry(line []byte, now time.Time) (*models.LogEntry, error) {
+	line = bytes.TrimSpace(line)
+	entry := &models.LogEntry{Message: string(line)}
+	var err error
+	switch {
+	case len(line) > 0 && line[0] == '{':
+		if entry, err = models.FromJson(line); err != nil {
+			return nil, fmt.Errorf("invalid JSON log %w", err)
+		}
+	case models.IsLogfmt(line):
+		if entry, err = models.FromLogfmt(line); err != nil {
+			return nil, fmt.Errorf("invalid logfmt log %w", err)
+		}
+	}
+
+	d.fill(entry, now)
+	if err := entry.Validate(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// fill sets the fields the entry is missing, metadata keys it has are kept
+func (d *Defaults) fill(entry *models.LogEntry, now time.Time) {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = now
+	}
+	if entry.Application == "" {
+		entry.Application = d.Application
+	}
+	if entry.Level == "" {
+		entry.Level = d.Level
+	}
+	if len(d.Metadata) == 0 {
+		return
+	}
+	if entry.Metadata == nil {
+		entry.Metadata = maps.Clone(d.Metadata)
+		return
+	}
+	for key, value := range d.Metadata {
+		if _, ok := entry.Metadata[key]; !ok {
+			entry.Metadata[key] = value
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package ingest
+
+import (
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/tracing"
+
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// Resource attributes that set entry fields instead of becoming metadata
+const (
+	attrServiceName    = "service.name"
+	attrHostName       = "host.name"
+	attrProcessPID     = "process.pid"
+	attrEnvironment    = "deployment.environment.name"
+	attrEnvironmentOld = "deployment.environment"
+)
+
+// ServeOTLP accepts OpenTelemetry logs sent by OTLP/HTTP exporters as
+// protobuf, optionally gzip compressed. Valid records are produced and
+// invalid ones are reported back as rejected, as the OTLP spec asks.
+func (h *Handler) ServeOTLP(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.StartRequest(r, "POST /v1/logs")
+	defer span.End()
+
+	source, ok := h.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeOTLPStatus(w, http.StatusUnauthorized, codes.Unauthenticated, "missing or unknown token")
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != models.ContentTypeProtobuf {
+		writeOTLPStatus(w, http.StatusUnsupportedMediaType, codes.InvalidArgument, fmt.Sprintf("unsupported content type %q, expected %s", contentType, models.ContentTypeProtobuf))
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, r.Body, h.MaxBodySize)
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			writeOTLPStatus(w, http.StatusBadRequest, codes.InvalidArgument, "invalid gzip body")
+			return
+		}
+		//the limit also applies once decompressed
+		body = io.LimitReader(gz, h.MaxBodySize+1)
+	default:
+		writeOTLPStatus(w, http.StatusUnsupportedMediaType, codes.InvalidArgument, "unsupported content encoding")
+		return
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeOTLPStatus(w, http.StatusRequestEntityTooLarge, codes.InvalidArgument, fmt.Sprintf("body is larger than %d bytes", h.MaxBodySize))
+			return
+		}
+		writeOTLPStatus(w, http.StatusBadRequest, codes.InvalidArgument, "failed to read body")
+		return
+	}
+	if int64(len(data)) > h.MaxBodySize {
+		writeOTLPStatus(w, http.StatusRequestEntityTooLarge, codes.InvalidArgument, fmt.Sprintf("body is larger than %d bytes", h.MaxBodySize))
+		return
+	}
+
+	var req collogspb.ExportLogsServiceRequest
+	if err := proto.Unmarshal(data, &req); err != nil {
+		writeOTLPStatus(w, http.StatusBadRequest, codes.InvalidArgument, "invalid ExportLogsServiceRequest")
+		return
+	}
+
+	entries, rejected, firstErr := otlpEntries(&req, source.defaults(), h.Limits, time.Now())
+	if len(entries) > h.MaxBatch {
+		writeOTLPStatus(w, http.StatusRequestEntityTooLarge, codes.InvalidArgument, fmt.Sprintf("more than %d log records", h.MaxBatch))
+		return
+	}
+	if len(entries) > 0 {
+		if err := h.sender.SendBatchContext(ctx, entries); err != nil {
+			span.RecordError(err)
+			slog.Error("Error shipping OTLP logs", "err", err)
+			writeOTLPStatus(w, http.StatusServiceUnavailable, codes.Unavailable, "failed to ship logs, retry later")
+			return
+		}
+	}
+
+	resp := &collogspb.ExportLogsServiceResponse{}
+	if rejected > 0 {
+		resp.PartialSuccess = &collogspb.ExportLogsPartialSuccess{
+			RejectedLogRecords: rejected,
+			ErrorMessage:       firstErr.Error(),
+		}
+	}
+	writeOTLP(w, http.StatusOK, resp)
+}
+
+// otlpEntries converts every log record of the request. It returns the
+// valid entries, how many records were rejected and why the first was.
+func otlpEntries(req *collogspb.ExportLogsServiceRequest, defaults *Defaults, limits models.Limits, now time.Time) ([]*models.LogEntry, int64, error) {
+	var entries []*models.LogEntry
+	var rejected int64
+	var firstErr error
+	for _, rl := range req.ResourceLogs {
+		resource := resourceEntry(rl.GetResource().GetAttributes())
+		for _, sl := range rl.ScopeLogs {
+			for _, record := range sl.LogRecords {
+				entry, err := otlpEntry(record, resource, sl.GetScope().GetName())
+				if err == nil {
+					defaults.fill(entry, now)
+					err = validate(entry, limits)
+				}
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("log record %d %w", len(entries)+int(rejected), err)
+					}
+					rejected++
+					continue
+				}
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries, rejected, firstErr
+}
+
+// resourceEntry maps the attributes of a resource to the fields shared by
+// its records, attributes without a field become metadata
+func resourceEntry(attrs []*commonpb.KeyValue) *models.LogEntry {
+	entry := &models.LogEntry{}
+	for _, kv := range attrs {
+		value := anyValue(kv.Value)
+		switch kv.Key {
+		case attrServiceName:
+			entry.Application = fmt.Sprint(value)
+		case attrHostName:
+			entry.Hostname = fmt.Sprint(value)
+		case attrEnvironment, attrEnvironmentOld:
+			entry.Environment = models.Environment(fmt.Sprint(value))
+		case attrProcessPID:
+			if pid, err := strconv.Atoi(fmt.Sprint(value)); err == nil {
+				entry.PID = pid
+			}
+		default:
+			if entry.Metadata == nil {
+				entry.Metadata = make(map[string]any)
+			}
+			entry.Metadata[kv.Key] = value
+		}
+	}
+	return entry
+}
+
+// otlpEntry maps one log record, starting from the fields of its resource
+func otlpEntry(record *logspb.LogRecord, resource *models.LogEntry, scope string) (*models.LogEntry, error) {
+	entry := &models.LogEntry{
+		Application: resource.Application,
+		Hostname:    resource.Hostname,
+		Environment: resource.Environment,
+		PID:         resource.PID,
+	}
+
+	switch {
+	case record.TimeUnixNano > 0:
+		entry.Timestamp = time.Unix(0, int64(record.TimeUnixNano))
+	case record.ObservedTimeUnixNano > 0:
+		entry.Timestamp = time.Unix(0, int64(record.ObservedTimeUnixNano))
+	}
+
+	level, err := otlpLevel(record.SeverityNumber, record.SeverityText)
+	if err != nil {
+		return nil, err
+	}
+	entry.Level = level
+
+	switch body := anyValue(record.Body).(type) {
+	case nil:
+		entry.Message = record.EventName
+	case string:
+		entry.Message = body
+	default:
+		message, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode body %w", err)
+		}
+		entry.Message = string(message)
+	}
+
+	if id := hex.EncodeToString(record.TraceId); !isZeroID(id) {
+		entry.TraceID = id
+	}
+	if id := hex.EncodeToString(record.SpanId); !isZeroID(id) {
+		entry.SpanID = id
+	}
+
+	metadata := make(map[string]any, len(resource.Metadata)+len(record.Attributes)+1)
+	for key, value := range resource.Metadata {
+		metadata[key] = value
+	}
+	for _, kv := range record.Attributes {
+		metadata[kv.Key] = anyValue(kv.Value)
+	}
+	if scope != "" {
+		metadata["otel.scope"] = scope
+	}
+	if record.EventName != "" && entry.Message != record.EventName {
+		metadata["event.name"] = record.EventName
+	}
+	if len(metadata) > 0 {
+		entry.Metadata = metadata
+	}
+	return entry, nil
+}
+
+// otlpLevel maps a severity number, in ranges of four per level, falling
+// back to the severity text. Records without either are INFO.
+func otlpLevel(number logspb.SeverityNumber, text string) (models.LogLevel, error) {
+	switch {
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_FATAL:
+		return models.FATAL, nil
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_ERROR:
+		return models.ERROR, nil
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_WARN:
+		return models.WARN, nil
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_INFO:
+		return models.INFO, nil
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG:
+		return models.DEBUG, nil
+	case number >= logspb.SeverityNumber_SEVERITY_NUMBER_TRACE:
+		return models.TRACE, nil
+	case text != "":
+		return models.ParseLevelAlias(text)
+	}
+	return models.INFO, nil
+}
+
+// anyValue converts an attribute or body value to the JSON types metadata holds
+func anyValue(v *commonpb.AnyValue) any {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]any, len(v.ArrayValue.GetValues()))
+		for i, value := range v.ArrayValue.GetValues() {
+			values[i] = anyValue(value)
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		values := make(map[string]any, len(v.KvlistValue.GetValues()))
+		for _, kv := range v.KvlistValue.GetValues() {
+			values[kv.Key] = anyValue(kv.Value)
+		}
+		return values
+	}
+	return nil
+}
+
+// isZeroID reports whether a hex encoded trace or span id is unset
+func isZeroID(id string) bool {
+	for _, c := range id {
+		if c != '0' {
+			return false
+		}
+	}
+	return true
+}
+
+// writeOTLPStatus answers with a google.rpc.Status, as OTLP/HTTP clients expect
+func writeOTLPStatus(w http.ResponseWriter, httpStatus int, code codes.Code, message string) {
+	writeOTLP(w, httpStatus, &status.Status{Code: int32(code), Message: message})
+}
+
+func writeOTLP(w http.ResponseWriter, httpStatus int, msg proto.Message) {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		slog.Error("Error encoding OTLP response", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", models.ContentTypeProtobuf)
+	w.WriteHeader(httpStatus)
+	if _, err := w.Write(data); err != nil {
+		slog.Error("Error writing response", "err", err)
+	}
+}
@@ -0,0 +1,135 @@
+package ingest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+// Parser turns one line into an entry, completing it from the defaults
+type Parser interface {
+	Parse(line []byte, d *Defaults, now time.Time) (*models.LogEntry, error)
+}
+
+// Auto decodes JSON objects and logfmt lines as entries and sends any other
+// line as a message
+type Auto struct{}
+
+func (Auto) Parse(line []byte, d *Defaults, now time.Time) (*models.LogEntry, error) {
+	return d.Entry(line, now)
+}
+
+// JSON only accepts lines holding a JSON encoded entry
+type JSON struct{}
+
+func (JSON) Parse(line []byte, d *Defaults, now time.Time) (*models.LogEntry, error) {
+	if line = bytes.TrimSpace(line); len(line) == 0 || line[0] != '{' {
+		return nil, errors.New("line isn't a JSON object")
+	}
+	return d.Entry(line, now)
+}
+
+// Logfmt only accepts logfmt lines, see models.FromLogfmt
+type Logfmt struct{}
+
+func (Logfmt) Parse(line []byte, d *Defaults, now time.Time) (*models.LogEntry, error) {
+	entry, err := models.FromLogfmt(bytes.TrimSpace(line))
+	if err != nil {
+		return nil, fmt.Errorf("invalid logfmt log %w", err)
+	}
+	d.fill(entry, now)
+	if err := entry.Validate(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Regex parses lines with the named groups of a regular expression.
+// timestamp, level, application, message, trace_id, span_id and request_id
+// set those fields, any other named group becomes metadata.
+type Regex struct {
+	re         *regexp.Regexp
+	timeLayout string
+}
+
+// NewRegex compiles pattern, which needs a message group. Timestamps are
+// parsed with timeLayout, RFC 3339 when empty.
+func NewRegex(pattern, timeLayout string) (*Regex, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %w", err)
+	}
+	if re.SubexpIndex("message") < 0 {
+		return nil, errors.New("pattern needs a (?P<message>...) group")
+	}
+	if timeLayout == "" {
+		timeLayout = time.RFC3339Nano
+	}
+	return &Regex{re: re, timeLayout: timeLayout}, nil
+}
+
+func (r *Regex) Parse(line []byte, d *Defaults, now time.Time) (*models.LogEntry, error) {
+	match := r.re.FindSubmatch(line)
+	if match == nil {
+		return nil, errors.New("line doesn't match the pattern")
+	}
+
+	entry := &models.LogEntry{}
+	for i, name := range r.re.SubexpNames() {
+		value := string(match[i])
+		if name == "" || value == "" {
+			continue
+		}
+		switch name {
+		case "timestamp":
+			ts, err := time.Parse(r.timeLayout, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid timestamp %w", err)
+			}
+			entry.Timestamp = ts
+		case "level":
+			level, err := models.ParseLevelAlias(value)
+			if err != nil {
+				return nil, err
+			}
+			entry.Level = level
+		case "application":
+			entry.Application = value
+		case "message":
+			entry.Message = value
+		case "trace_id":
+			entry.TraceID = value
+		case "span_id":
+			entry.SpanID = value
+		case "request_id":
+			entry.RequestID = value
+		default:
+			entry.WithField(name, value)
+		}
+	}
+
+	d.fill(entry, now)
+	if err := entry.Validate(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// NewParser returns the parser called name: auto, json, logfmt or regex
+func NewParser(name, pattern, timeLayout string) (Parser, error) {
+	switch name {
+	case "auto":
+		return Auto{}, nil
+	case "json":
+		return JSON{}, nil
+	case "logfmt":
+		return Logfmt{}, nil
+	case "regex":
+		return NewRegex(pattern, timeLayout)
+	}
+	return nil, fmt.Errorf("unknown parser %q, expected auto, json, logfmt or regex", name)
+}
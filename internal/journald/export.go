@@ -0,0 +1,147 @@
+// Package journald follows the systemd journal through journalctl's export
+// format and turns its entries into log entries.
+package journald
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/syslog"
+)
+
+// maxFieldSize bounds a binary field, larger ones are rejected
+const maxFieldSize = 1 << 20
+
+// Fields are the fields of one journal entry
+type Fields map[string]string
+
+// Reader reads entries in the journal export format, where every field is
+// a KEY=value line, or the key, a newline and the value's little endian
+// 64 bit length for binary values, and a blank line ends an entry
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Next returns the next entry, io.EOF once the input ends between entries
+func (r *Reader) Next() (Fields, error) {
+	fields := make(Fields)
+	for {
+		line, err := r.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			//a text field longer than the buffer
+			rest, rerr := r.r.ReadBytes('\n')
+			line, err = append(bytes.Clone(line), rest...), rerr
+		}
+		if err != nil {
+			if err == io.EOF && len(fields) > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = line[:len(line)-1]
+		if len(line) == 0 {
+			if len(fields) == 0 {
+				continue
+			}
+			return fields, nil
+		}
+
+		if key, value, ok := bytes.Cut(line, []byte("=")); ok {
+			fields[string(key)] = string(value)
+			continue
+		}
+		key := string(line)
+		var size uint64
+		if err := binary.Read(r.r, binary.LittleEndian, &size); err != nil {
+			return nil, fmt.Errorf("failed to read size of %s %w", key, err)
+		}
+		if size > maxFieldSize {
+			return nil, fmt.Errorf("field %s of %d bytes is too large", key, size)
+		}
+		value := make([]byte, size+1)
+		if _, err := io.ReadFull(r.r, value); err != nil {
+			return nil, fmt.Errorf("failed to read %s %w", key, err)
+		}
+		if value[size] != '\n' {
+			return nil, fmt.Errorf("field %s isn't followed by a newline", key)
+		}
+		fields[key] = string(value[:size])
+	}
+}
+
+// Cursor returns the position of the entry in the journal
+func (f Fields) Cursor() string {
+	return f["__CURSOR"]
+}
+
+// metadataFields are the journal fields kept as metadata, by the name they get
+var metadataFields = map[string]string{
+	"_SYSTEMD_UNIT":     "unit",
+	"SYSLOG_IDENTIFIER": "syslog_identifier",
+	"SYSLOG_FACILITY":   "facility",
+	"_TRANSPORT":        "transport",
+	"_COMM":             "comm",
+	"_EXE":              "exe",
+	"_UID":              "uid",
+	"_BOOT_ID":          "boot_id",
+	"CODE_FILE":         "code_file",
+	"CODE_LINE":         "code_line",
+	"CODE_FUNC":         "code_func",
+	"CONTAINER_NAME":    "container_name",
+}
+
+// Entry maps a journal entry. The application is the systemd unit without
+// its .service suffix, or the syslog identifier or command for processes
+// outside a unit, defaultApp when there is none.
+func (f Fields) Entry(defaultApp string, now time.Time) (*models.LogEntry, error) {
+	message := f["MESSAGE"]
+	if strings.TrimSpace(message) == "" {
+		return nil, errors.New("journal entry has no message")
+	}
+
+	entry := &models.LogEntry{
+		Timestamp: now,
+		Level:     models.INFO,
+		Message:   message,
+		Hostname:  f["_HOSTNAME"],
+		Metadata:  make(map[string]any),
+	}
+	if usec, err := strconv.ParseInt(f["__REALTIME_TIMESTAMP"], 10, 64); err == nil {
+		entry.Timestamp = time.UnixMicro(usec)
+	}
+	if priority, err := strconv.Atoi(f["PRIORITY"]); err == nil {
+		entry.Level = syslog.Level(priority)
+	}
+	if pid, err := strconv.Atoi(f["_PID"]); err == nil {
+		entry.PID = pid
+	}
+
+	for _, field := range []string{"_SYSTEMD_UNIT", "_SYSTEMD_USER_UNIT", "SYSLOG_IDENTIFIER", "_COMM"} {
+		if app := f[field]; app != "" {
+			entry.Application = strings.TrimSuffix(app, ".service")
+			break
+		}
+	}
+	if entry.Application == "" {
+		entry.Application = defaultApp
+	}
+
+	for field, key := range metadataFields {
+		if value := f[field]; value != "" {
+			entry.Metadata[key] = value
+		}
+	}
+	return entry, nil
+}
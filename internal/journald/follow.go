@@ -0,0 +1,185 @@
+package journald
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Config selects the journal and where reading resumes
+type Config struct {
+	//Journalctl is the journalctl binary, looked up in PATH when empty
+	Journalctl string
+	//Directory reads the journal files of another system, such as the
+	//host's /var/log/journal when running in a container
+	Directory string
+	//Units limits the journal to these systemd units, all when empty
+	Units []string
+	//CursorFile keeps the cursor of the last handled entry, empty disables resuming
+	CursorFile string
+	//FromStart reads the whole journal when there is no saved cursor,
+	//instead of only new entries
+	FromStart bool
+	//SaveInterval is how often the cursor is saved
+	SaveInterval time.Duration
+}
+
+// Journal follows the journal from its saved cursor
+type Journal struct {
+	cfg    Config
+	cursor string
+	saved  string
+}
+
+// New loads the saved cursor
+func New(cfg Config) (*Journal, error) {
+	if cfg.Journalctl == "" {
+		cfg.Journalctl = "journalctl"
+	}
+	if cfg.SaveInterval <= 0 {
+		cfg.SaveInterval = time.Second
+	}
+	j := &Journal{cfg: cfg}
+	if cfg.CursorFile != "" {
+		data, err := os.ReadFile(cfg.CursorFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read journal cursor %w", err)
+		}
+		j.cursor = strings.TrimSpace(string(data))
+		j.saved = j.cursor
+	}
+	return j, nil
+}
+
+// Cursor returns the cursor reading resumes after
+func (j *Journal) Cursor() string {
+	return j.cursor
+}
+
+// Run hands every entry to handle until ctx is done, restarting journalctl
+// from the last cursor when it exits. The cursor only moves past entries
+// handle returned nil for; an error from handle stops Run.
+func (j *Journal) Run(ctx context.Context, handle func(Fields) error) error {
+	defer j.save()
+
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := j.follow(ctx, handle)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var handleErr *handlerError
+		if errors.As(err, &handleErr) {
+			return handleErr.err
+		}
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		slog.Warn("journalctl stopped, restarting", "backoff", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+			backoff = min(backoff*2, 30*time.Second)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// handlerError tells errors of the handler apart from those of journalctl
+type handlerError struct{ err error }
+
+func (e *handlerError) Error() string { return e.err.Error() }
+
+// args are the journalctl arguments resuming after the cursor
+func (j *Journal) args() []string {
+	args := []string{"--output=export", "--follow", "--no-pager"}
+	switch {
+	case j.cursor != "":
+		args = append(args, "--after-cursor="+j.cursor)
+	case j.cfg.FromStart:
+		args = append(args, "--lines=all")
+	default:
+		args = append(args, "--lines=0")
+	}
+	if j.cfg.Directory != "" {
+		args = append(args, "--directory="+j.cfg.Directory)
+	}
+	for _, unit := range j.cfg.Units {
+		args = append(args, "--unit="+unit)
+	}
+	return args
+}
+
+// follow runs journalctl once, until it exits or ctx is done
+func (j *Journal) follow(ctx context.Context, handle func(Fields) error) error {
+	cmd := exec.CommandContext(ctx, j.cfg.Journalctl, j.args()...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start journalctl %w", err)
+	}
+
+	reader := NewReader(stdout)
+	lastSave := time.Now()
+	var readErr error
+	for {
+		fields, err := reader.Next()
+		if err != nil {
+			readErr = err
+			break
+		}
+		if err := handle(fields); err != nil {
+			readErr = &handlerError{err}
+			break
+		}
+		if cursor := fields.Cursor(); cursor != "" {
+			j.cursor = cursor
+		}
+		//an idle journal keeps the cursor of its last burst unsaved until
+		//Run returns, a crash then sends those entries again
+		if time.Since(lastSave) >= j.cfg.SaveInterval {
+			j.save()
+			lastSave = time.Now()
+		}
+	}
+
+	//unblock journalctl and wait for it before the next run
+	stdout.Close()
+	waitErr := cmd.Wait()
+	if readErr == nil || errors.Is(readErr, io.EOF) {
+		if waitErr != nil {
+			return fmt.Errorf("journalctl failed %w: %s", waitErr, strings.TrimSpace(stderr.String()))
+		}
+		return errors.New("journalctl exited")
+	}
+	return readErr
+}
+
+// save writes the cursor when it moved since it was last saved
+func (j *Journal) save() {
+	if j.cfg.CursorFile == "" || j.cursor == j.saved {
+		return
+	}
+	tmp := j.cfg.CursorFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(j.cursor+"\n"), 0o644); err != nil {
+		slog.Error("Error saving journal cursor", "err", err)
+		return
+	}
+	if err := os.Rename(tmp, j.cfg.CursorFile); err != nil {
+		slog.Error("Error saving journal cursor", "err", err)
+		return
+	}
+	j.saved = j.cursor
+}
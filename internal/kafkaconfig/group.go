@@ -0,0 +1,90 @@
+package kafkaconfig
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Rebalance strategies a group can assign partitions with
+const (
+	StrategyRange      = "range"
+	StrategyRoundRobin = "roundrobin"
+	StrategySticky     = "sticky"
+)
+
+// Group says how a consumer takes part in its consumer group
+type Group struct {
+	//Strategy assigns partitions to members: range, roundrobin or sticky.
+	//sticky keeps partitions where they were when members join or leave.
+	Strategy string
+	//InstanceID makes the member static. A static member that restarts
+	//within SessionTimeout gets its partitions back without the group
+	//rebalancing, so it must be unique in the group and stable across
+	//restarts, such as a StatefulSet pod name.
+	InstanceID string
+	//SessionTimeout is how long the group waits for a silent member before
+	//its partitions are handed to the others
+	SessionTimeout time.Duration
+	//ReadCommitted skips messages of aborted and still open transactions,
+	//for topics written by a transactional processor
+	ReadCommitted bool
+}
+
+// DefaultGroup returns the group settings used without flags
+func DefaultGroup() Group {
+	return Group{Strategy: StrategyRoundRobin, SessionTimeout: 10 * time.Second}
+}
+
+// RegisterFlags binds the settings to flags, each name starting with prefix
+func (g *Group) RegisterFlags(fs *flag.FlagSet, prefix string) {
+	fs.StringVar(&g.Strategy, prefix+"rebalance-strategy", g.Strategy, "how partitions are assigned to group members: range, roundrobin or sticky")
+	fs.StringVar(&g.InstanceID, prefix+"group-instance-id", g.InstanceID, "unique, stable id making this a static member, so restarts within the session timeout don't rebalance the group")
+	fs.DurationVar(&g.SessionTimeout, prefix+"session-timeout", g.SessionTimeout, "how long the group waits for a silent member before rebalancing")
+	fs.BoolVar(&g.ReadCommitted, prefix+"read-committed", g.ReadCommitted, "only read messages of committed transactions, for topics written by a transactional processor")
+}
+
+// Apply sets the group settings on a client config, which should already
+// carry the protocol version
+func (g Group) Apply(c *sarama.Config) error {
+	switch g.Strategy {
+	case StrategyRange:
+		c.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategyRange()
+	case StrategyRoundRobin, "":
+		c.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategyRoundRobin()
+	case StrategySticky:
+		c.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategySticky()
+	default:
+		return fmt.Errorf("unknown rebalance strategy %q, expected range, roundrobin or sticky", g.Strategy)
+	}
+
+	if g.SessionTimeout < 0 {
+		return errors.New("session timeout can't be negative")
+	}
+	if g.SessionTimeout > 0 {
+		c.Consumer.Group.Session.Timeout = g.SessionTimeout
+		//members must send heartbeats well within the session timeout
+		c.Consumer.Group.Heartbeat.Interval = min(c.Consumer.Group.Heartbeat.Interval, g.SessionTimeout/3)
+	}
+
+	if g.InstanceID != "" {
+		if !c.Version.IsAtLeast(sarama.V2_3_0_0) {
+			return fmt.Errorf("static group membership needs Kafka 2.3.0 or newer, -kafka-version is %s", c.Version)
+		}
+		if !validClientID.MatchString(g.InstanceID) {
+			return fmt.Errorf("group instance id %q may only contain letters, digits, '.', '_' and '-'", g.InstanceID)
+		}
+		c.Consumer.Group.InstanceId = g.InstanceID
+	}
+
+	if g.ReadCommitted {
+		if !c.Version.IsAtLeast(sarama.V0_11_0_0) {
+			return fmt.Errorf("reading committed messages needs Kafka 0.11.0 or newer, -kafka-version is %s", c.Version)
+		}
+		c.Consumer.IsolationLevel = sarama.ReadCommitted
+	}
+	return nil
+}
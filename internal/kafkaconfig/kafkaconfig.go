@@ -0,0 +1,281 @@
+// Package kafkaconfig holds the Kafka client settings shared by the
+// services and klog, so every client bootstraps and fails over the same way.
+package kafkaconfig
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// DefaultBroker is used when neither flags nor KAFKA_BROKERS name one
+const DefaultBroker = "localhost:9092"
+
+// Config says how clients find and stay connected to the cluster
+type Config struct {
+	//Brokers bootstrap the client. Any reachable one is enough, the rest of
+	//the cluster is learned from its metadata.
+	Brokers []string
+	//Discovery adds brokers found in DNS when the client starts, either
+	//srv:_kafka._tcp.example.com for an SRV record or
+	//dns:kafka.example.com:9092 for every address of a name, such as a
+	//Kubernetes headless service
+	Discovery string
+
+	//MetadataRefresh is how often cluster metadata is refreshed in the
+	//background, failed requests also refresh it
+	MetadataRefresh time.Duration
+	//MetadataRetries and MetadataRetryBackoff apply while a leader is being
+	//elected, so a broker restart doesn't fail requests
+	MetadataRetries      int
+	MetadataRetryBackoff time.Duration
+	//DialTimeout bounds connecting to one broker before the next is tried
+	DialTimeout time.Duration
+
+	//Version is the protocol version spoken to the brokers, the oldest the
+	//cluster runs. Newer versions enable features such as headers (0.11).
+	Version sarama.KafkaVersion
+	//ClientID identifies the program to the brokers, which apply client
+	//quotas by it. Empty keeps sarama's default.
+	ClientID string
+	//ChannelBufferSize is how many messages are buffered in each of the
+	//client's internal channels
+	ChannelBufferSize int
+
+	//Rack is where the client runs, such as its availability zone. Brokers
+	//with a rack aware replica selector then let consumers fetch from a
+	//follower in the same rack, saving cross zone traffic.
+	Rack string
+	//FetchMinBytes is how much data a fetch waits for, up to FetchMaxWait.
+	//Larger values mean fewer requests at the cost of latency.
+	FetchMinBytes int32
+	//FetchDefaultBytes is the size of a fetch per partition, grown as needed
+	//to hold messages up to FetchMaxBytes, 0 for no limit
+	FetchDefaultBytes int32
+	FetchMaxBytes     int32
+	FetchMaxWait      time.Duration
+}
+
+// Default returns the settings used without flags, brokers are read from
+// the comma separated KAFKA_BROKERS
+func Default() Config {
+	brokers := SplitList(os.Getenv("KAFKA_BROKERS"))
+	if len(brokers) == 0 {
+		brokers = []string{DefaultBroker}
+	}
+	return Config{
+		Brokers:              brokers,
+		MetadataRefresh:      5 * time.Minute,
+		MetadataRetries:      5,
+		MetadataRetryBackoff: 500 * time.Millisecond,
+		DialTimeout:          10 * time.Second,
+		Version:              sarama.DefaultVersion,
+		ChannelBufferSize:    256,
+		FetchMinBytes:        1,
+		FetchDefaultBytes:    1 << 20,
+		FetchMaxWait:         500 * time.Millisecond,
+	}
+}
+
+// RegisterFlags binds the settings to flags, each name starting with prefix
+// so one program can connect to several clusters
+func (k *Config) RegisterFlags(fs *flag.FlagSet, prefix string) {
+	fs.Var((*listFlag)(&k.Brokers), prefix+"brokers", "comma separated Kafka brokers to bootstrap from, KAFKA_BROKERS sets the default")
+	fs.StringVar(&k.Discovery, prefix+"discover", k.Discovery, "also bootstrap from brokers in DNS: srv:NAME for an SRV record or dns:HOST:PORT for every address of HOST")
+	fs.DurationVar(&k.MetadataRefresh, prefix+"metadata-refresh", k.MetadataRefresh, "how often cluster metadata is refreshed")
+	fs.IntVar(&k.MetadataRetries, prefix+"metadata-retries", k.MetadataRetries, "metadata requests retried while a leader is elected")
+	fs.DurationVar(&k.MetadataRetryBackoff, prefix+"metadata-retry-backoff", k.MetadataRetryBackoff, "wait between metadata retries")
+	fs.DurationVar(&k.DialTimeout, prefix+"dial-timeout", k.DialTimeout, "how long connecting to one broker may take")
+	fs.Var((*versionFlag)(&k.Version), prefix+"kafka-version", "protocol version spoken to the brokers, the oldest the cluster runs, such as 3.6.0")
+	fs.StringVar(&k.ClientID, prefix+"client-id", k.ClientID, "client id sent to the brokers, which apply quotas by it")
+	fs.IntVar(&k.ChannelBufferSize, prefix+"channel-buffer-size", k.ChannelBufferSize, "messages buffered in each internal channel of the client")
+	fs.StringVar(&k.Rack, prefix+"rack", k.Rack, "rack or availability zone of the client, consumers fetch from a replica in the same rack when brokers allow it")
+	fs.Var((*int32Flag)(&k.FetchMinBytes), prefix+"fetch-min-bytes", "bytes a fetch waits for before returning, up to -"+prefix+"fetch-max-wait")
+	fs.Var((*int32Flag)(&k.FetchDefaultBytes), prefix+"fetch-default-bytes", "bytes fetched per partition and request")
+	fs.Var((*int32Flag)(&k.FetchMaxBytes), prefix+"fetch-max-bytes", "largest fetch per partition and request, 0 for no limit")
+	fs.DurationVar(&k.FetchMaxWait, prefix+"fetch-max-wait", k.FetchMaxWait, "how long a fetch waits for -"+prefix+"fetch-min-bytes")
+}
+
+// Validate rejects settings clients can't connect with
+func (k Config) Validate() error {
+	if len(k.Brokers) == 0 && k.Discovery == "" {
+		return errors.New("at least one broker or a discovery name is required")
+	}
+	if k.Discovery != "" && !strings.HasPrefix(k.Discovery, "srv:") && !strings.HasPrefix(k.Discovery, "dns:") {
+		return fmt.Errorf("discovery %q must start with srv: or dns:", k.Discovery)
+	}
+	if k.ClientID != "" && !validClientID.MatchString(k.ClientID) {
+		return fmt.Errorf("client id %q may only contain letters, digits, '.', '_' and '-'", k.ClientID)
+	}
+	if k.ChannelBufferSize < 0 {
+		return errors.New("channel buffer size can't be negative")
+	}
+	if k.Rack != "" && k.Version != (sarama.KafkaVersion{}) && !k.Version.IsAtLeast(sarama.V2_4_0_0) {
+		return fmt.Errorf("fetching from the closest replica needs Kafka 2.4.0 or newer, -kafka-version is %s", k.Version)
+	}
+	if k.FetchMinBytes < 0 || k.FetchDefaultBytes < 0 || k.FetchMaxBytes < 0 {
+		return errors.New("fetch sizes can't be negative")
+	}
+	if k.FetchMaxBytes > 0 && k.FetchDefaultBytes > k.FetchMaxBytes {
+		return fmt.Errorf("fetch default bytes %d are larger than the max of %d", k.FetchDefaultBytes, k.FetchMaxBytes)
+	}
+	return nil
+}
+
+// Addrs returns the brokers to bootstrap from, with the discovered ones.
+// Discovery failing is only an error when no broker is configured.
+func (k Config) Addrs(ctx context.Context) ([]string, error) {
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+	if k.Discovery == "" {
+		return k.Brokers, nil
+	}
+	discovered, err := discover(ctx, k.Discovery)
+	if err != nil {
+		if len(k.Brokers) == 0 {
+			return nil, err
+		}
+		slog.Warn("Error discovering brokers, using the configured ones", "err", err)
+	}
+	addrs := append([]string(nil), k.Brokers...)
+	for _, addr := range discovered {
+		if !slices.Contains(addrs, addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
+
+// Sarama returns a client config with the connection settings applied
+func (k Config) Sarama() *sarama.Config {
+	c := sarama.NewConfig()
+	if k.MetadataRefresh > 0 {
+		c.Metadata.RefreshFrequency = k.MetadataRefresh
+	}
+	if k.MetadataRetries > 0 {
+		c.Metadata.Retry.Max = k.MetadataRetries
+	}
+	if k.MetadataRetryBackoff > 0 {
+		c.Metadata.Retry.Backoff = k.MetadataRetryBackoff
+	}
+	if k.DialTimeout > 0 {
+		c.Net.DialTimeout = k.DialTimeout
+	}
+	if k.Version != (sarama.KafkaVersion{}) {
+		c.Version = k.Version
+	}
+	if k.ClientID != "" {
+		c.ClientID = k.ClientID
+	}
+	if k.ChannelBufferSize > 0 {
+		c.ChannelBufferSize = k.ChannelBufferSize
+	}
+	c.RackID = k.Rack
+	if k.FetchMinBytes > 0 {
+		c.Consumer.Fetch.Min = k.FetchMinBytes
+	}
+	if k.FetchDefaultBytes > 0 {
+		c.Consumer.Fetch.Default = k.FetchDefaultBytes
+	}
+	c.Consumer.Fetch.Max = k.FetchMaxBytes
+	if k.FetchMaxWait > 0 {
+		c.Consumer.MaxWaitTime = k.FetchMaxWait
+	}
+	return c
+}
+
+// discover looks brokers up in DNS
+func discover(ctx context.Context, discovery string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if name, ok := strings.CutPrefix(discovery, "srv:"); ok {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover brokers %w", err)
+		}
+		addrs := make([]string, 0, len(records))
+		for _, record := range records {
+			addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))))
+		}
+		return addrs, nil
+	}
+
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(discovery, "dns:"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid discovery name %w", err)
+	}
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover brokers %w", err)
+	}
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip, port))
+	}
+	return addrs, nil
+}
+
+// SplitList splits a comma separated list, dropping empty items
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// validClientID is what brokers accept as a client id
+var validClientID = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// versionFlag parses Kafka versions such as 2.8.0
+type versionFlag sarama.KafkaVersion
+
+func (v *versionFlag) String() string { return sarama.KafkaVersion(*v).String() }
+
+func (v *versionFlag) Set(value string) error {
+	version, err := sarama.ParseKafkaVersion(value)
+	if err != nil {
+		return err
+	}
+	*v = versionFlag(version)
+	return nil
+}
+
+// int32Flag is an int32 flag, the type sarama keeps fetch sizes in
+type int32Flag int32
+
+func (i *int32Flag) String() string { return strconv.Itoa(int(*i)) }
+
+func (i *int32Flag) Set(value string) error {
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return err
+	}
+	*i = int32Flag(n)
+	return nil
+}
+
+// listFlag is a comma separated flag
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(value string) error {
+	*l = SplitList(value)
+	return nil
+}
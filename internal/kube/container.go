@@ -0,0 +1,93 @@
+// Package kube reads the container logs Kubernetes nodes keep in
+// /var/log/containers and looks up the pods they belong to.
+package kube
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LogDir holds a symlink per container log on every node
+const LogDir = "/var/log/containers"
+
+// Container identifies the container a log file belongs to
+type Container struct {
+	Namespace string
+	Pod       string
+	Name      string
+	ID        string
+}
+
+// ParsePath reads the container from a log file named
+// <pod>_<namespace>_<container>-<id>.log, as the kubelet names them
+func ParsePath(path string) (Container, bool) {
+	name, ok := strings.CutSuffix(filepath.Base(path), ".log")
+	if !ok {
+		return Container{}, false
+	}
+	parts := strings.Split(name, "_")
+	if len(parts) != 3 {
+		return Container{}, false
+	}
+	dash := strings.LastIndexByte(parts[2], '-')
+	if dash <= 0 {
+		return Container{}, false
+	}
+	return Container{
+		Pod:       parts[0],
+		Namespace: parts[1],
+		Name:      parts[2][:dash],
+		ID:        parts[2][dash+1:],
+	}, true
+}
+
+// Record is one line written by a container runtime
+type Record struct {
+	Time    time.Time
+	Stream  string
+	Message []byte
+	//Partial is set when the runtime split a long line, the rest follows
+	//in the next records
+	Partial bool
+}
+
+// ParseRecord decodes a line of the CRI format used by containerd and
+// CRI-O, "<time> <stream> <F|P> <message>", or of Docker's json-file driver
+func ParseRecord(line []byte) (Record, error) {
+	if len(line) > 0 && line[0] == '{' {
+		return parseDocker(line)
+	}
+
+	fields := bytes.SplitN(line, []byte(" "), 4)
+	if len(fields) < 3 {
+		return Record{}, errors.New("line isn't in the CRI log format")
+	}
+	ts, err := time.Parse(time.RFC3339Nano, string(fields[0]))
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid CRI timestamp %w", err)
+	}
+	rec := Record{Time: ts, Stream: string(fields[1]), Partial: string(fields[2]) == "P"}
+	if len(fields) == 4 {
+		rec.Message = fields[3]
+	}
+	return rec, nil
+}
+
+func parseDocker(line []byte) (Record, error) {
+	var doc struct {
+		Log    string    `json:"log"`
+		Stream string    `json:"stream"`
+		Time   time.Time `json:"time"`
+	}
+	if err := json.Unmarshal(line, &doc); err != nil {
+		return Record{}, fmt.Errorf("invalid docker log line %w", err)
+	}
+	//docker splits lines over 16KiB, only the last piece ends in a newline
+	message, complete := strings.CutSuffix(doc.Log, "\n")
+	return Record{Time: doc.Time, Stream: doc.Stream, Message: []byte(message), Partial: !complete}, nil
+}
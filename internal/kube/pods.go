@@ -0,0 +1,166 @@
+package kube
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Credentials Kubernetes mounts into every pod
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	tokenFile         = serviceAccountDir + "/token"
+	caFile            = serviceAccountDir + "/ca.crt"
+)
+
+// Pod is what entries are enriched with
+type Pod struct {
+	Namespace string
+	Name      string
+	UID       string
+	Node      string
+	Labels    map[string]string
+}
+
+// podList is the part of a v1 PodList the agent reads
+type podList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string            `json:"name"`
+			Namespace string            `json:"namespace"`
+			UID       string            `json:"uid"`
+			Labels    map[string]string `json:"labels"`
+		} `json:"metadata"`
+		Spec struct {
+			NodeName string `json:"nodeName"`
+		} `json:"spec"`
+	} `json:"items"`
+}
+
+// Pods caches the pods running on one node, listed from the API server or
+// from the node's kubelet. The list is refreshed when a pod is missing, at
+// most once every MinRefresh.
+type Pods struct {
+	client *http.Client
+	url    string
+	token  string
+	//MinRefresh spaces out lists caused by unknown pods
+	MinRefresh time.Duration
+
+	mu        sync.Mutex
+	pods      map[string]*Pod
+	refreshed time.Time
+}
+
+// NewAPIPods lists the pods of node from the API server, using the service
+// account of the pod the agent runs in
+func NewAPIPods(node string) (*Pods, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes pod, KUBERNETES_SERVICE_HOST is not set")
+	}
+	if node == "" {
+		return nil, errors.New("the node name is required, set NODE_NAME from spec.nodeName")
+	}
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("service account CA holds no certificate")
+	}
+
+	query := url.Values{"fieldSelector": {"spec.nodeName=" + node}}
+	u := "https://" + net.JoinHostPort(host, port) + "/api/v1/pods?" + query.Encode()
+	return newPods(u, &tls.Config{RootCAs: pool})
+}
+
+// NewKubeletPods lists pods from the kubelet at kubeletURL, such as
+// https://10.0.0.5:10250. Kubelets usually serve a self-signed
+// certificate, insecure skips its verification.
+func NewKubeletPods(kubeletURL string, insecure bool) (*Pods, error) {
+	return newPods(kubeletURL+"/pods", &tls.Config{InsecureSkipVerify: insecure})
+}
+
+func newPods(u string, tlsConfig *tls.Config) (*Pods, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Pods{
+		client:     &http.Client{Transport: transport, Timeout: 10 * time.Second},
+		url:        u,
+		token:      string(token),
+		MinRefresh: 10 * time.Second,
+		pods:       make(map[string]*Pod),
+	}, nil
+}
+
+// Lookup returns the pod called name in namespace, nil when it can't be found
+func (p *Pods) Lookup(ctx context.Context, namespace, name string) (*Pod, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := namespace + "/" + name
+	if pod := p.pods[key]; pod != nil || time.Since(p.refreshed) < p.MinRefresh {
+		return pod, nil
+	}
+	if err := p.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return p.pods[key], nil
+}
+
+// refresh replaces the cache with the current pods of the node
+func (p *Pods) refresh(ctx context.Context) error {
+	p.refreshed = time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return err
+	}
+	//the token is rotated by the kubelet, read it again when it changed
+	if token, err := os.ReadFile(tokenFile); err == nil {
+		p.token = string(token)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to list pods %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to list pods: %s", resp.Status)
+	}
+
+	var list podList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return fmt.Errorf("failed to decode pod list %w", err)
+	}
+	pods := make(map[string]*Pod, len(list.Items))
+	for _, item := range list.Items {
+		pods[item.Metadata.Namespace+"/"+item.Metadata.Name] = &Pod{
+			Namespace: item.Metadata.Namespace,
+			Name:      item.Metadata.Name,
+			UID:       item.Metadata.UID,
+			Node:      item.Spec.NodeName,
+			Labels:    item.Metadata.Labels,
+		}
+	}
+	p.pods = pods
+	return nil
+}
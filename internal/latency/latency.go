@@ -0,0 +1,198 @@
+// Package latency measures how long messages take from the producer to a
+// consumer, using the sent-at header stamped by the producer.
+package latency
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"kafka-logging-system/internal/envelope"
+	"kafka-logging-system/internal/models"
+
+	"github.com/IBM/sarama"
+)
+
+// Buckets grow by growth from 1µs, so reported quantiles are within 5% and
+// the last bucket starts past an hour
+const (
+	growth  = 1.05
+	buckets = 460
+)
+
+// Histogram counts latencies in exponential buckets
+type Histogram struct {
+	counts [buckets]uint64
+	count  uint64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// Record adds one latency, negative values from clock skew count as zero
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.counts[bucket(d)]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+func bucket(d time.Duration) int {
+	if d < time.Microsecond {
+		return 0
+	}
+	i := int(math.Log(float64(d)/float64(time.Microsecond))/math.Log(growth)) + 1
+	return min(i, buckets-1)
+}
+
+// upper returns the largest latency counted in bucket i
+func upper(i int) time.Duration {
+	return time.Duration(float64(time.Microsecond) * math.Pow(growth, float64(i)))
+}
+
+// Quantile returns the latency q (0-1) of the recorded values fall under
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return min(max(upper(i), h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// histogramJSON is the saved form of a histogram, keeping only the buckets
+// in use so checkpoints of many histograms stay small
+type histogramJSON struct {
+	Buckets map[int]uint64 `json:"buckets"`
+	Count   uint64         `json:"count"`
+	Sum     time.Duration  `json:"sum_ns"`
+	Min     time.Duration  `json:"min_ns"`
+	Max     time.Duration  `json:"max_ns"`
+}
+
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	saved := histogramJSON{Buckets: make(map[int]uint64), Count: h.count, Sum: h.sum, Min: h.min, Max: h.max}
+	for i, c := range h.counts {
+		if c > 0 {
+			saved.Buckets[i] = c
+		}
+	}
+	return json.Marshal(saved)
+}
+
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var saved histogramJSON
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	*h = Histogram{count: saved.Count, sum: saved.Sum, min: saved.Min, max: saved.Max}
+	for i, c := range saved.Buckets {
+		if i < 0 || i >= buckets {
+			return fmt.Errorf("histogram bucket %d out of range", i)
+		}
+		h.counts[i] = c
+	}
+	return nil
+}
+
+// Summary is a snapshot of a histogram
+type Summary struct {
+	Count uint64        `json:"count"`
+	Mean  time.Duration `json:"mean_ns"`
+	Min   time.Duration `json:"min_ns"`
+	P50   time.Duration `json:"p50_ns"`
+	P95   time.Duration `json:"p95_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+func (h *Histogram) Summary() Summary {
+	s := Summary{Count: h.count, Min: h.min, Max: h.max,
+		P50: h.Quantile(0.50),
+		P95: h.Quantile(0.95),
+		P99: h.Quantile(0.99),
+	}
+	if h.count > 0 {
+		s.Mean = h.sum / time.Duration(h.count)
+	}
+	return s
+}
+
+func (s Summary) String() string {
+	if s.Count == 0 {
+		return "no messages with a sent-at header"
+	}
+	round := func(d time.Duration) time.Duration { return d.Round(10 * time.Microsecond) }
+	return fmt.Sprintf("n=%d p50=%s p95=%s p99=%s max=%s mean=%s",
+		s.Count, round(s.P50), round(s.P95), round(s.P99), round(s.Max), round(s.Mean))
+}
+
+// Recorder keeps a histogram since the start and one since the last interval
+type Recorder struct {
+	mu       sync.Mutex
+	total    Histogram
+	interval Histogram
+	//missing counts messages without a usable sent-at header
+	missing uint64
+}
+
+// Observe records the latency of a message received at now
+func (r *Recorder) Observe(message *sarama.ConsumerMessage, now time.Time) {
+	sentAt, ok := SentAt(message)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !ok {
+		r.missing++
+		return
+	}
+	d := now.Sub(sentAt)
+	r.total.Record(d)
+	r.interval.Record(d)
+}
+
+// Interval returns the summary since the previous call and starts a new interval
+func (r *Recorder) Interval() Summary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.interval.Summary()
+	r.interval = Histogram{}
+	return s
+}
+
+// Total returns the summary since the start and how many messages had no header
+func (r *Recorder) Total() (Summary, uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total.Summary(), r.missing
+}
+
+// SentAt reads the time a message was sent from its header
+func SentAt(message *sarama.ConsumerMessage) (time.Time, bool) {
+	value, ok := envelope.Header(message, models.HeaderSentAt)
+	if !ok {
+		return time.Time{}, false
+	}
+	micros, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMicro(micros), true
+}
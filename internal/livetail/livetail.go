@@ -0,0 +1,195 @@
+// Package livetail streams log entries to WebSocket clients, each with its
+// own filter applied on the server
+package livetail
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kafka-logging-system/internal/models"
+
+	"golang.org/x/net/websocket"
+)
+
+// DefaultBuffer is how many entries a client can fall behind before entries are dropped
+const DefaultBuffer = 256
+
+// writeTimeout disconnects clients that stop reading entirely
+const writeTimeout = 10 * time.Second
+
+// Filter selects the entries sent to one client, empty fields match everything
+type Filter struct {
+	Levels       []models.LogLevel
+	Applications []string
+	Pattern      *regexp.Regexp
+}
+
+// ParseFilter reads a filter from query parameters such as
+// ?level=ERROR,WARN&app=AuthService&q=timeout, where q is a regular expression
+func ParseFilter(query url.Values) (Filter, error) {
+	var f Filter
+	for _, name := range splitList(query.Get("level")) {
+		level, err := models.ParseLevel(name)
+		if err != nil {
+			return Filter{}, err
+		}
+		f.Levels = append(f.Levels, level)
+	}
+	f.Applications = splitList(query.Get("app"))
+	if q := query.Get("q"); q != "" {
+		pattern, err := regexp.Compile(q)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid q %w", err)
+		}
+		f.Pattern = pattern
+	}
+	return f, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Matches reports whether an entry passes the filter
+func (f Filter) Matches(entry *models.LogEntry) bool {
+	switch {
+	case len(f.Levels) > 0 && !slices.Contains(f.Levels, entry.Level):
+		return false
+	case len(f.Applications) > 0 && !slices.Contains(f.Applications, entry.Application):
+		return false
+	case f.Pattern != nil && !f.Pattern.MatchString(entry.Message):
+		return false
+	}
+	return true
+}
+
+type client struct {
+	filter  Filter
+	send    chan []byte
+	dropped atomic.Int64
+}
+
+// Hub fans entries out to connected clients. Publishing never blocks: a
+// client whose buffer is full misses entries and is told how many.
+type Hub struct {
+	buffer int
+
+	mu      sync.RWMutex
+	clients map[*client]struct{}
+}
+
+func NewHub(buffer int) *Hub {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	return &Hub{buffer: buffer, clients: make(map[*client]struct{})}
+}
+
+// Clients returns the number of connected clients
+func (h *Hub) Clients() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// Publish sends an entry to every client whose filter matches it
+func (h *Hub) Publish(entry *models.LogEntry) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var data []byte
+	for c := range h.clients {
+		if !c.filter.Matches(entry) {
+			continue
+		}
+		//encoded once, and only when someone wants it
+		if data == nil {
+			var err error
+			if data, err = json.Marshal(entry); err != nil {
+				slog.Error("livetail: failed to encode entry", "err", err)
+				return
+			}
+		}
+		select {
+		case c.send <- data:
+		default:
+			c.dropped.Add(1)
+		}
+	}
+}
+
+// ServeHTTP upgrades the request to a WebSocket and streams matching entries
+// as JSON text frames. When entries were dropped, a {"dropped": n} frame
+// reports how many.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	filter, err := ParseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server := websocket.Server{
+		//accept any origin, command line clients don't send one
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   func(ws *websocket.Conn) { h.serve(ws, filter) },
+	}
+	server.ServeHTTP(w, r)
+}
+
+func (h *Hub) serve(ws *websocket.Conn, filter Filter) {
+	c := &client{filter: filter, send: make(chan []byte, h.buffer)}
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, c)
+		h.mu.Unlock()
+		ws.Close()
+	}()
+
+	//clients don't send anything, reading only notices when they go away
+	closed := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, ws)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case data := <-c.send:
+			if n := c.dropped.Swap(0); n > 0 {
+				if !write(ws, fmt.Appendf(nil, `{"dropped":%d}`, n)) {
+					return
+				}
+			}
+			if !write(ws, data) {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func write(ws *websocket.Conn, data []byte) bool {
+	_ = ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return websocket.Message.Send(ws, string(data)) == nil
+}
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"kafka-logging-system/internal/models/logpb"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/proto"
+)
+
+// ContentTypeBatch is advertised by messages packing many entries into a
+// logpb.LogBatch, the content type of the entries is in the batch
+const ContentTypeBatch = "application/x-log-batch"
+
+// Compression is the codec of a batch payload
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// ParseCompression validates a compression name, empty is none
+func ParseCompression(s string) (Compression, error) {
+	switch Compression(s) {
+	case "":
+		return CompressionNone, nil
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return Compression(s), nil
+	}
+	return "", fmt.Errorf("unknown compression %q, expected none, gzip or zstd", s)
+}
+
+// maxBatchPayload bounds the decompressed payload of a batch, so a corrupt
+// or hostile one can't exhaust memory
+const maxBatchPayload = 64 << 20
+
+// LogBatch is a batch of entries encoded in the same format
+type LogBatch struct {
+	Format  Format
+	Entries [][]byte
+}
+
+// Add encodes entry into the batch
+func (b *LogBatch) Add(entry *LogEntry) error {
+	data, err := entry.Encode(b.Format)
+	if err != nil {
+		return err
+	}
+	b.Entries = append(b.Entries, data)
+	return nil
+}
+
+// Encode packs the batch into a logpb.LogBatch with its payload compressed by c
+func (b *LogBatch) Encode(c Compression) ([]byte, error) {
+	var payload []byte
+	for _, entry := range b.Entries {
+		payload = binary.AppendUvarint(payload, uint64(len(entry)))
+		payload = append(payload, entry...)
+	}
+	compressed, err := compress(payload, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress batch %w", err)
+	}
+	return proto.Marshal(&logpb.LogBatch{
+		Count:       uint32(len(b.Entries)),
+		ContentType: b.Format.ContentType(),
+		Compression: string(c),
+		Payload:     compressed,
+	})
+}
+
+// DecodeBatch unpacks the payload of a batch message
+func DecodeBatch(data []byte) (*LogBatch, error) {
+	var msg logpb.LogBatch
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("invalid log batch %w", err)
+	}
+	format, err := FormatForContentType(msg.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ParseCompression(msg.Compression)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := decompress(msg.Payload, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress batch %w", err)
+	}
+
+	//every entry takes at least its length byte, which bounds a corrupt count
+	if int(msg.Count) > len(payload) {
+		return nil, fmt.Errorf("log batch claims %d entries in %d bytes", msg.Count, len(payload))
+	}
+	batch := &LogBatch{Format: format, Entries: make([][]byte, 0, msg.Count)}
+	for len(payload) > 0 {
+		size, n := binary.Uvarint(payload)
+		if n <= 0 || size > uint64(len(payload)-n) {
+			return nil, fmt.Errorf("truncated entry %d in log batch", len(batch.Entries))
+		}
+		payload = payload[n:]
+		batch.Entries = append(batch.Entries, payload[:size:size])
+		payload = payload[size:]
+	}
+	if len(batch.Entries) != int(msg.Count) {
+		return nil, fmt.Errorf("log batch holds %d entries, expected %d", len(batch.Entries), msg.Count)
+	}
+	return batch, nil
+}
+
+// zstd coders are safe for concurrent EncodeAll and DecodeAll calls, and
+// expensive enough to share
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil)
+	})
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxBatchPayload))
+	})
+)
+
+func compress(data []byte, c Compression) ([]byte, error) {
+	switch c {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		encoder, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(data, nil), nil
+	}
+	return data, nil
+}
+
+func decompress(data []byte, c Compression) ([]byte, error) {
+	switch c {
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		out, err := io.ReadAll(io.LimitReader(r, maxBatchPayload+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > maxBatchPayload {
+			return nil, errors.New("payload exceeds 64MiB")
+		}
+		return out, nil
+	case CompressionZstd:
+		decoder, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return decoder.DecodeAll(data, nil)
+	}
+	return data, nil
+}
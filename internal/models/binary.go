@@ -0,0 +1,129 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Compact binary encodings of the JSON fields, for producers on constrained
+// links. Field names are those of JSON, so the payloads are self-describing
+// like JSON ones, and the timestamp is a native binary time.
+
+var (
+	cborEncMode = sync.OnceValues(func() (cbor.EncMode, error) {
+		return cbor.EncOptions{Time: cbor.TimeRFC3339Nano, TimeTag: cbor.EncTagRequired}.EncMode()
+	})
+	cborDecMode = sync.OnceValues(func() (cbor.DecMode, error) {
+		return cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+	})
+)
+
+// ToMsgpack encodes the entry as MessagePack
+func (l *LogEntry) ToMsgpack() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(l); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FromMsgpack decodes a MessagePack entry. Metadata numbers become float64
+// as they would in JSON.
+func FromMsgpack(data []byte) (*LogEntry, error) {
+	entry := &LogEntry{}
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	dec.SetMapDecoder(func(d *msgpack.Decoder) (any, error) {
+		return d.DecodeUntypedMap()
+	})
+	if err := dec.Decode(entry); err != nil {
+		return &LogEntry{}, fmt.Errorf("invalid msgpack entry %w", err)
+	}
+	entry.Metadata = jsonValues(entry.Metadata)
+	return entry, nil
+}
+
+// ToCBOR encodes the entry as CBOR
+func (l *LogEntry) ToCBOR() ([]byte, error) {
+	mode, err := cborEncMode()
+	if err != nil {
+		return nil, err
+	}
+	return mode.Marshal(l)
+}
+
+// FromCBOR decodes a CBOR entry. Metadata numbers become float64 as they
+// would in JSON.
+func FromCBOR(data []byte) (*LogEntry, error) {
+	mode, err := cborDecMode()
+	if err != nil {
+		return &LogEntry{}, err
+	}
+	entry := &LogEntry{}
+	if err := mode.Unmarshal(data, entry); err != nil {
+		return &LogEntry{}, fmt.Errorf("invalid CBOR entry %w", err)
+	}
+	entry.Metadata = jsonValues(entry.Metadata)
+	return entry, nil
+}
+
+// jsonValues converts decoded metadata to the types encoding/json decodes
+// into, so processors and rules see the same values whatever the format
+func jsonValues(metadata map[string]any) map[string]any {
+	for key, value := range metadata {
+		metadata[key] = jsonValue(value)
+	}
+	return metadata
+}
+
+func jsonValue(value any) any {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case []byte:
+		//msgpack writes text marshalers such as levels as binary
+		return string(v)
+	case map[string]any:
+		return jsonValues(v)
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []any:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+		return v
+	}
+	return value
+}
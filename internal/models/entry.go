@@ -0,0 +1,178 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// maxStackFrames bounds the stack traces of WithError and CallerStack
+const maxStackFrames = 32
+
+// Option sets fields of an entry built by NewEntry
+type Option func(*LogEntry)
+
+// NewEntry returns an entry of application at level, timestamped now and
+// with a new ID, then applies opts in order
+func NewEntry(application string, level LogLevel, message string, opts ...Option) *LogEntry {
+	entry := &LogEntry{
+		Timestamp:   time.Now(),
+		Application: application,
+		Level:       level,
+		Message:     message,
+		ID:          NewID(),
+	}
+	for _, opt := range opts {
+		opt(entry)
+	}
+	return entry
+}
+
+// WithTime sets when the entry happened, for entries built after the fact
+// such as records of another logger. A zero time keeps now.
+func WithTime(t time.Time) Option {
+	return func(l *LogEntry) {
+		if !t.IsZero() {
+			l.Timestamp = t
+		}
+	}
+}
+
+// WithMetadata adds fields to the metadata. The entry keeps the map when it
+// has no metadata yet, so it mustn't be changed afterwards.
+func WithMetadata(metadata map[string]any) Option {
+	return func(l *LogEntry) {
+		if l.Metadata == nil {
+			l.Metadata = metadata
+			return
+		}
+		for key, value := range metadata {
+			l.Metadata[key] = value
+		}
+	}
+}
+
+// WithTrace sets the W3C trace and span ids of the request the entry belongs to
+func WithTrace(traceID, spanID string) Option {
+	return func(l *LogEntry) {
+		l.TraceID, l.SpanID = traceID, spanID
+	}
+}
+
+// WithRequestID sets the id of the request the entry belongs to
+func WithRequestID(requestID string) Option {
+	return func(l *LogEntry) {
+		l.RequestID = requestID
+	}
+}
+
+// WithEnvironment sets the environment instead of the producer's
+func WithEnvironment(env Environment) Option {
+	return func(l *LogEntry) {
+		l.Environment = env
+	}
+}
+
+// WithDuration sets how long the operation the entry completes took
+func WithDuration(d time.Duration) Option {
+	return func(l *LogEntry) {
+		l.DurationMs = float64(d) / float64(time.Millisecond)
+	}
+}
+
+// WithError records the message and type of err, see ErrorType, and the
+// stack of the call to WithError. A nil error records nothing.
+func WithError(err error) Option {
+	if err == nil {
+		return func(*LogEntry) {}
+	}
+	//captured here rather than in the option, so the stack is the caller's
+	stack := callerStack(2, nil)
+	return func(l *LogEntry) {
+		l.ErrorType = ErrorType(err)
+		l.ErrorMessage = err.Error()
+		l.StackTrace = stack
+	}
+}
+
+// WithStackTrace sets the stack trace, for errors whose stack was captured elsewhere
+func WithStackTrace(stack string) Option {
+	return func(l *LogEntry) {
+		l.StackTrace = stack
+	}
+}
+
+// WithErrorStack is WithError with a stack captured elsewhere, such as by
+// the logger an adapter forwards from. An empty stack records none.
+func WithErrorStack(err error, stack string) Option {
+	if err == nil {
+		return func(*LogEntry) {}
+	}
+	return func(l *LogEntry) {
+		l.ErrorType = ErrorType(err)
+		l.ErrorMessage = err.Error()
+		l.StackTrace = stack
+	}
+}
+
+// genericErrors are the types of errors that only wrap or describe another
+var genericErrors = map[string]bool{
+	"*fmt.wrapError":      true,
+	"*fmt.wrapErrors":     true,
+	"*errors.errorString": true,
+	"*errors.joinError":   true,
+}
+
+// ErrorType names the type of the first error in the chain of err that
+// isn't a plain error of errors.New or fmt.Errorf, so a wrapped
+// *fs.PathError is reported as such. Errors that are all plain report the
+// type of err.
+func ErrorType(err error) string {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if name := fmt.Sprintf("%T", e); !genericErrors[name] {
+			return name
+		}
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// CallerStack returns the stack of its caller formatted like a Go panic,
+// leaving out the innermost frames of functions whose name starts with one
+// of skip, such as the logging library that called it
+func CallerStack(skip ...string) string {
+	return callerStack(2, skip)
+}
+
+// callerStack formats the stack above depth frames like a Go panic, which
+// the Sentry sink parses into frames, dropping leading frames in skip
+func callerStack(depth int, skip []string) string {
+	//room for the skipped frames of a logging library
+	pcs := make([]uintptr, 2*maxStackFrames)
+	n := runtime.Callers(depth+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var b strings.Builder
+	written := 0
+	for written < maxStackFrames {
+		frame, more := frames.Next()
+		if written > 0 || !hasAnyPrefix(frame.Function, skip) {
+			fmt.Fprintf(&b, "%s()\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+			written++
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+package models
+
+import (
+	"fmt"
+	"kafka-logging-system/internal/models/logpb"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Format is the wire encoding of a log entry
+type Format string
+
+const (
+	FormatJSON     Format = "json"
+	FormatProtobuf Format = "protobuf"
+	FormatLogfmt   Format = "logfmt"
+	FormatMsgpack  Format = "msgpack"
+	FormatCBOR     Format = "cbor"
+)
+
+// Content types advertised in the content-type header
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeLogfmt   = "text/x-logfmt"
+	ContentTypeMsgpack  = "application/msgpack"
+	ContentTypeCBOR     = "application/cbor"
+)
+
+// ParseFormat validates a format name
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case FormatJSON, FormatProtobuf, FormatLogfmt, FormatMsgpack, FormatCBOR:
+		return Format(s), nil
+	}
+	return "", fmt.Errorf("unknown format %q, expected json, protobuf, logfmt, msgpack or cbor", s)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatProtobuf:
+		return ContentTypeProtobuf
+	case FormatLogfmt:
+		return ContentTypeLogfmt
+	case FormatMsgpack:
+		return ContentTypeMsgpack
+	case FormatCBOR:
+		return ContentTypeCBOR
+	}
+	return ContentTypeJSON
+}
+
+// FormatForContentType maps a content-type header back to a format
+func FormatForContentType(contentType string) (Format, error) {
+	switch contentType {
+	case ContentTypeJSON:
+		return FormatJSON, nil
+	case ContentTypeProtobuf:
+		return FormatProtobuf, nil
+	case ContentTypeLogfmt:
+		return FormatLogfmt, nil
+	case ContentTypeMsgpack:
+		return FormatMsgpack, nil
+	case ContentTypeCBOR:
+		return FormatCBOR, nil
+	}
+	return "", fmt.Errorf("unsupported content type %q", contentType)
+}
+
+// Encode serializes the entry in format f
+func (l *LogEntry) Encode(f Format) ([]byte, error) {
+	switch f {
+	case FormatProtobuf:
+		return l.ToProto()
+	case FormatLogfmt:
+		return l.ToLogfmt()
+	case FormatMsgpack:
+		return l.ToMsgpack()
+	case FormatCBOR:
+		return l.ToCBOR()
+	}
+	return l.ToJson()
+}
+
+// Decode parses data encoded in format f
+func Decode(data []byte, f Format) (*LogEntry, error) {
+	switch f {
+	case FormatProtobuf:
+		return FromProto(data)
+	case FormatLogfmt:
+		return FromLogfmt(data)
+	case FormatMsgpack:
+		return FromMsgpack(data)
+	case FormatCBOR:
+		return FromCBOR(data)
+	}
+	return FromJson(data)
+}
+
+// DecodeInto parses data encoded in format f into an existing entry,
+// such as one from AcquireEntry
+func DecodeInto(data []byte, f Format, entry *LogEntry) error {
+	switch f {
+	case FormatProtobuf, FormatLogfmt, FormatMsgpack, FormatCBOR:
+		decoded, err := Decode(data, f)
+		if err != nil {
+			return err
+		}
+		*entry = *decoded
+		return nil
+	}
+	return entry.UnmarshalJSON(data)
+}
+
+func (l *LogEntry) ToProto() ([]byte, error) {
+	msg, err := l.ProtoMessage()
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
+
+// ProtoMessage converts the entry to its protobuf message, as sent over gRPC
+func (l *LogEntry) ProtoMessage() (*logpb.LogEntry, error) {
+	level, err := protoLevel(l.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &logpb.LogEntry{
+		Timestamp:     timestamppb.New(l.Timestamp),
+		Application:   l.Application,
+		Level:         level,
+		Message:       l.Message,
+		TraceId:       l.TraceID,
+		SpanId:        l.SpanID,
+		RequestId:     l.RequestID,
+		Hostname:      l.Hostname,
+		Environment:   string(l.Environment),
+		Pid:           int32(l.PID),
+		Id:            l.ID,
+		SchemaVersion: int32(l.SchemaVersion),
+		ErrorType:     l.ErrorType,
+		ErrorMessage:  l.ErrorMessage,
+		StackTrace:    l.StackTrace,
+		DurationMs:    l.DurationMs,
+	}
+	if len(l.Metadata) > 0 {
+		metadata, err := structpb.NewStruct(l.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert metadata %w", err)
+		}
+		msg.Metadata = metadata
+	}
+	return msg, nil
+}
+
+func FromProto(data []byte) (*LogEntry, error) {
+	var msg logpb.LogEntry
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return &LogEntry{}, err
+	}
+	return FromProtoMessage(&msg)
+}
+
+// FromProtoMessage converts a protobuf message, such as one received over
+// gRPC, to an entry
+func FromProtoMessage(msg *logpb.LogEntry) (*LogEntry, error) {
+	level, err := modelLevel(msg.Level)
+	if err != nil {
+		return &LogEntry{}, err
+	}
+
+	entry := &LogEntry{
+		Application:   msg.Application,
+		Level:         level,
+		Message:       msg.Message,
+		TraceID:       msg.TraceId,
+		SpanID:        msg.SpanId,
+		RequestID:     msg.RequestId,
+		Hostname:      msg.Hostname,
+		Environment:   Environment(msg.Environment),
+		PID:           int(msg.Pid),
+		ID:            msg.Id,
+		SchemaVersion: int(msg.SchemaVersion),
+		ErrorType:     msg.ErrorType,
+		ErrorMessage:  msg.ErrorMessage,
+		StackTrace:    msg.StackTrace,
+		DurationMs:    msg.DurationMs,
+	}
+	if msg.Timestamp != nil {
+		entry.Timestamp = msg.Timestamp.AsTime().In(time.Local)
+	}
+	if msg.Metadata != nil {
+		entry.Metadata = msg.Metadata.AsMap()
+	}
+	return entry, nil
+}
+
+func protoLevel(level LogLevel) (logpb.Level, error) {
+	value, ok := logpb.Level_value["LEVEL_"+string(level)]
+	if !ok {
+		return logpb.Level_LEVEL_UNSPECIFIED, fmt.Errorf("unknown log level %q", level)
+	}
+	return logpb.Level(value), nil
+}
+
+func modelLevel(level logpb.Level) (LogLevel, error) {
+	name, ok := logpb.Level_name[int32(level)]
+	if !ok || level == logpb.Level_LEVEL_UNSPECIFIED {
+		return "", fmt.Errorf("unknown log level %d", level)
+	}
+	return ParseLevel(name[len("LEVEL_"):])
+}
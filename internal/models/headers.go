@@ -0,0 +1,29 @@
+package models
+
+// Kafka header keys set by the producer alongside the JSON body, so consumers
+// can filter without decoding the payload
+const (
+	HeaderTraceID   = "trace-id"
+	HeaderSpanID    = "span-id"
+	HeaderRequestID = "request-id"
+	//HeaderEntryID carries the ID of the entry
+	HeaderEntryID = "entry-id"
+
+	//HeaderContentType and HeaderSchemaVersion tell consumers how the payload is encoded
+	HeaderContentType   = "content-type"
+	HeaderSchemaVersion = "schema-version"
+	//HeaderProducerID and HeaderHost identify the sending process, and
+	//HeaderProducerVersion the build of the producer library it runs
+	HeaderProducerID      = "producer-id"
+	HeaderHost            = "host"
+	HeaderProducerVersion = "producer-version"
+	//HeaderSentAt is when the message was built for sending, in unix microseconds
+	HeaderSentAt = "sent-at"
+	//HeaderBatchIndex is the position of an entry unpacked from a batch message
+	HeaderBatchIndex = "batch-index"
+
+	//Set on dead lettered messages to explain where and why processing failed
+	HeaderDLQError  = "dlq-error"
+	HeaderDLQStage  = "dlq-stage"
+	HeaderDLQSource = "dlq-source"
+)
@@ -0,0 +1,530 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// errSlowPath sends input the fast decoder doesn't handle to encoding/json
+var errSlowPath = errors.New("decode with encoding/json")
+
+// decoderPool reuses the scratch buffer strings with escapes are unquoted into
+var decoderPool = sync.Pool{New: func() any {
+	return &jsonDecoder{scratch: make([]byte, 0, 256), interned: make(map[string]string)}
+}}
+
+// internLimit bounds the strings remembered by a decoder
+const internLimit = 1024
+
+// UnmarshalJSON decodes an entry without reflection. The fields are read
+// directly and metadata values become the types encoding/json produces.
+// Anything unusual (invalid JSON, unknown levels, keys differing only in
+// case) is handed to encoding/json, so results stay the same and errors are
+// those of encoding/json, as a *ParseError saying where decoding failed.
+func (l *LogEntry) UnmarshalJSON(data []byte) error {
+	d := decoderPool.Get().(*jsonDecoder)
+	d.data, d.pos = data, 0
+	err := d.entry(l)
+	d.data = nil
+	decoderPool.Put(d)
+	if err == nil {
+		return nil
+	}
+
+	//logEntry has the fields of LogEntry without its methods
+	type logEntry LogEntry
+	if err := json.Unmarshal(data, (*logEntry)(l)); err != nil {
+		return parseError(data, err)
+	}
+	return nil
+}
+
+type jsonDecoder struct {
+	data    []byte
+	pos     int
+	scratch []byte
+	//interned reuses the strings of low cardinality fields such as
+	//applications and metadata keys instead of allocating them per entry
+	interned map[string]string
+}
+
+func (d *jsonDecoder) intern(b []byte) string {
+	if s, ok := d.interned[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	if len(d.interned) < internLimit {
+		d.interned[s] = s
+	}
+	return s
+}
+
+func (d *jsonDecoder) entry(l *LogEntry) error {
+	if err := d.expect('{'); err != nil {
+		return err
+	}
+	if d.peek() == '}' {
+		d.pos++
+		return d.end()
+	}
+
+	for {
+		key, err := d.string()
+		if err != nil {
+			return err
+		}
+		if err := d.expect(':'); err != nil {
+			return err
+		}
+		if err := d.field(l, key); err != nil {
+			return err
+		}
+
+		switch d.next() {
+		case ',':
+			d.skipSpace()
+		case '}':
+			return d.end()
+		default:
+			return errSlowPath
+		}
+	}
+}
+
+// field decodes the value of key into l. key is only valid until the next read.
+func (d *jsonDecoder) field(l *LogEntry, key []byte) error {
+	d.skipSpace()
+	if d.null() {
+		//null leaves fields untouched, except for the metadata map
+		if string(key) == "metadata" {
+			l.Metadata = nil
+		}
+		return nil
+	}
+
+	var target *string
+	switch string(key) {
+	case "timestamp":
+		value, err := d.string()
+		if err != nil {
+			return err
+		}
+		if err := l.Timestamp.UnmarshalText(value); err != nil {
+			return errSlowPath
+		}
+		return nil
+	case "level":
+		value, err := d.string()
+		if err != nil {
+			return err
+		}
+		for _, level := range Levels {
+			if string(value) == string(level) {
+				l.Level = level
+				return nil
+			}
+		}
+		return errSlowPath
+	case "pid":
+		number, err := d.number()
+		if err != nil {
+			return err
+		}
+		pid, err := strconv.Atoi(string(number))
+		if err != nil {
+			return errSlowPath
+		}
+		l.PID = pid
+		return nil
+	case "schema_version":
+		number, err := d.number()
+		if err != nil {
+			return err
+		}
+		version, err := strconv.Atoi(string(number))
+		if err != nil {
+			return errSlowPath
+		}
+		l.SchemaVersion = version
+		return nil
+	case "duration_ms":
+		number, err := d.number()
+		if err != nil {
+			return err
+		}
+		duration, err := strconv.ParseFloat(string(number), 64)
+		if err != nil {
+			return errSlowPath
+		}
+		l.DurationMs = duration
+		return nil
+	case "metadata":
+		if d.peek() != '{' {
+			return errSlowPath
+		}
+		if l.Metadata == nil {
+			l.Metadata = make(map[string]any)
+		}
+		return d.object(l.Metadata)
+	case "environment":
+		value, err := d.string()
+		if err != nil {
+			return err
+		}
+		l.Environment = Environment(d.intern(value))
+		return nil
+	case "application":
+		value, err := d.string()
+		if err != nil {
+			return err
+		}
+		l.Application = d.intern(value)
+		return nil
+	case "hostname":
+		value, err := d.string()
+		if err != nil {
+			return err
+		}
+		l.Hostname = d.intern(value)
+		return nil
+	case "message":
+		target = &l.Message
+	case "trace_id":
+		target = &l.TraceID
+	case "span_id":
+		target = &l.SpanID
+	case "request_id":
+		target = &l.RequestID
+	case "id":
+		target = &l.ID
+	case "error_type":
+		target = &l.ErrorType
+	case "error_message":
+		target = &l.ErrorMessage
+	case "stack_trace":
+		target = &l.StackTrace
+	default:
+		//encoding/json matches field names in any case
+		for _, name := range jsonFields {
+			if bytes.EqualFold(key, []byte(name)) {
+				return errSlowPath
+			}
+		}
+		_, err := d.value()
+		return err
+	}
+
+	value, err := d.string()
+	if err != nil {
+		return err
+	}
+	*target = string(value)
+	return nil
+}
+
+var jsonFields = []string{"timestamp", "application", "level", "message", "metadata", "trace_id", "span_id", "request_id", "hostname", "environment", "pid", "id", "schema_version", "error_type", "error_message", "stack_trace", "duration_ms"}
+
+// value decodes any JSON value the way encoding/json does into an interface
+func (d *jsonDecoder) value() (any, error) {
+	switch c := d.peek(); {
+	case c == '"':
+		s, err := d.string()
+		return string(s), err
+	case c == '{':
+		m := make(map[string]any)
+		return m, d.object(m)
+	case c == '[':
+		return d.array()
+	case c == '-' || (c >= '0' && c <= '9'):
+		number, err := d.number()
+		if err != nil {
+			return nil, err
+		}
+		f, err := strconv.ParseFloat(string(number), 64)
+		if err != nil {
+			return nil, errSlowPath
+		}
+		return f, nil
+	case d.literal("true"):
+		return true, nil
+	case d.literal("false"):
+		return false, nil
+	case d.null():
+		return nil, nil
+	}
+	return nil, errSlowPath
+}
+
+func (d *jsonDecoder) object(m map[string]any) error {
+	if err := d.expect('{'); err != nil {
+		return err
+	}
+	if d.peek() == '}' {
+		d.pos++
+		return nil
+	}
+	for {
+		key, err := d.string()
+		if err != nil {
+			return err
+		}
+		name := d.intern(key)
+		if err := d.expect(':'); err != nil {
+			return err
+		}
+		d.skipSpace()
+		value, err := d.value()
+		if err != nil {
+			return err
+		}
+		m[name] = value
+
+		switch d.next() {
+		case ',':
+			d.skipSpace()
+		case '}':
+			return nil
+		default:
+			return errSlowPath
+		}
+	}
+}
+
+func (d *jsonDecoder) array() ([]any, error) {
+	if err := d.expect('['); err != nil {
+		return nil, err
+	}
+	values := []any{}
+	if d.peek() == ']' {
+		d.pos++
+		return values, nil
+	}
+	for {
+		d.skipSpace()
+		value, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		switch d.next() {
+		case ',':
+		case ']':
+			return values, nil
+		default:
+			return nil, errSlowPath
+		}
+	}
+}
+
+// string reads a quoted string. The result points into the input, or into
+// the scratch buffer when it had escapes, and is only valid until the next read.
+func (d *jsonDecoder) string() ([]byte, error) {
+	if d.pos >= len(d.data) || d.data[d.pos] != '"' {
+		return nil, errSlowPath
+	}
+	start := d.pos + 1
+	for i := start; i < len(d.data); i++ {
+		switch c := d.data[i]; {
+		case c == '"':
+			d.pos = i + 1
+			s := d.data[start:i]
+			if !utf8.Valid(s) {
+				//encoding/json replaces invalid UTF-8
+				return nil, errSlowPath
+			}
+			return s, nil
+		case c == '\\':
+			return d.unquote(start)
+		case c < 0x20:
+			return nil, errSlowPath
+		}
+	}
+	return nil, errSlowPath
+}
+
+// unquote reads a string with escapes into the scratch buffer
+func (d *jsonDecoder) unquote(start int) ([]byte, error) {
+	out := d.scratch[:0]
+	for i := start; i < len(d.data); {
+		c := d.data[i]
+		switch {
+		case c == '"':
+			d.pos = i + 1
+			d.scratch = out
+			if !utf8.Valid(out) {
+				return nil, errSlowPath
+			}
+			return out, nil
+		case c < 0x20:
+			return nil, errSlowPath
+		case c != '\\':
+			out = append(out, c)
+			i++
+			continue
+		}
+
+		if i+1 >= len(d.data) {
+			return nil, errSlowPath
+		}
+		switch d.data[i+1] {
+		case '"', '\\', '/':
+			out = append(out, d.data[i+1])
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'u':
+			r, ok := hex4(d.data[i+2:])
+			if !ok {
+				return nil, errSlowPath
+			}
+			i += 6
+			if utf16.IsSurrogate(r) {
+				low, ok := rune(-1), false
+				if i+1 < len(d.data) && d.data[i] == '\\' && d.data[i+1] == 'u' {
+					low, ok = hex4(d.data[i+2:])
+				}
+				if r = utf16.DecodeRune(r, low); !ok || r == utf8.RuneError {
+					//lone surrogates become U+FFFD in encoding/json
+					return nil, errSlowPath
+				}
+				i += 6
+			}
+			out = utf8.AppendRune(out, r)
+			continue
+		default:
+			return nil, errSlowPath
+		}
+		i += 2
+	}
+	return nil, errSlowPath
+}
+
+func hex4(b []byte) (rune, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range b[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	return r, true
+}
+
+// number reads a number token following the JSON grammar
+func (d *jsonDecoder) number() ([]byte, error) {
+	start, i := d.pos, d.pos
+	digits := func() bool {
+		from := i
+		for i < len(d.data) && d.data[i] >= '0' && d.data[i] <= '9' {
+			i++
+		}
+		return i > from
+	}
+
+	if i < len(d.data) && d.data[i] == '-' {
+		i++
+	}
+	if i < len(d.data) && d.data[i] == '0' {
+		i++
+	} else if !digits() {
+		return nil, errSlowPath
+	}
+	if i < len(d.data) && d.data[i] == '.' {
+		i++
+		if !digits() {
+			return nil, errSlowPath
+		}
+	}
+	if i < len(d.data) && (d.data[i] == 'e' || d.data[i] == 'E') {
+		i++
+		if i < len(d.data) && (d.data[i] == '+' || d.data[i] == '-') {
+			i++
+		}
+		if !digits() {
+			return nil, errSlowPath
+		}
+	}
+	d.pos = i
+	return d.data[start:i], nil
+}
+
+func (d *jsonDecoder) literal(word string) bool {
+	if bytes.HasPrefix(d.data[d.pos:], []byte(word)) {
+		d.pos += len(word)
+		return true
+	}
+	return false
+}
+
+func (d *jsonDecoder) null() bool {
+	return d.literal("null")
+}
+
+func (d *jsonDecoder) skipSpace() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\n', '\r':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next byte after whitespace without consuming it
+func (d *jsonDecoder) peek() byte {
+	d.skipSpace()
+	if d.pos >= len(d.data) {
+		return 0
+	}
+	return d.data[d.pos]
+}
+
+// next consumes the next byte after whitespace
+func (d *jsonDecoder) next() byte {
+	c := d.peek()
+	if c != 0 {
+		d.pos++
+	}
+	return c
+}
+
+func (d *jsonDecoder) expect(c byte) error {
+	if d.next() != c {
+		return errSlowPath
+	}
+	d.skipSpace()
+	return nil
+}
+
+// end checks nothing but whitespace follows the entry
+func (d *jsonDecoder) end() error {
+	d.skipSpace()
+	if d.pos != len(d.data) {
+		return errSlowPath
+	}
+	return nil
+}
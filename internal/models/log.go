@@ -1,13 +1,20 @@
 package models
 
 import (
+	"crypto/rand"
 	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 type LogLevel string
 
 const (
+	TRACE LogLevel = "TRACE"
 	DEBUG LogLevel = "DEBUG"
 	INFO  LogLevel = "INFO"
 	WARN  LogLevel = "WARN"
@@ -15,11 +22,123 @@ const (
 	FATAL LogLevel = "FATAL"
 )
 
+// Levels lists every known level from least to most severe
+var Levels = []LogLevel{TRACE, DEBUG, INFO, WARN, ERROR, FATAL}
+
+// ParseLevel converts a level name, in any case, into a LogLevel
+func ParseLevel(s string) (LogLevel, error) {
+	level := LogLevel(strings.ToUpper(strings.TrimSpace(s)))
+	for _, known := range Levels {
+		if level == known {
+			return level, nil
+		}
+	}
+	return "", fmt.Errorf("unknown log level %q", s)
+}
+
+// levelAliases are level names other loggers use
+var levelAliases = map[string]LogLevel{
+	"WARNING":  WARN,
+	"ERR":      ERROR,
+	"CRITICAL": FATAL,
+	"PANIC":    FATAL,
+}
+
+// ParseLevelAlias is ParseLevel also accepting the names other loggers
+// use, such as WARNING and CRITICAL
+func ParseLevelAlias(s string) (LogLevel, error) {
+	if level, ok := levelAliases[strings.ToUpper(strings.TrimSpace(s))]; ok {
+		return level, nil
+	}
+	return ParseLevel(s)
+}
+
+// Severity orders levels from TRACE (1) to FATAL, unknown levels are 0
+func (l LogLevel) Severity() int {
+	for i, known := range Levels {
+		if l == known {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (l LogLevel) MarshalText() ([]byte, error) {
+	if _, err := ParseLevel(string(l)); err != nil {
+		return nil, err
+	}
+	return []byte(l), nil
+}
+
+// UnmarshalText rejects unknown levels so malformed entries fail to decode
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+type Environment string
+
+const (
+	DEV   Environment = "dev"
+	STAGE Environment = "stage"
+	PROD  Environment = "prod"
+)
+
+// Valid reports whether e is one of the known environments
+func (e Environment) Valid() bool {
+	switch e {
+	case DEV, STAGE, PROD:
+		return true
+	}
+	return false
+}
+
 type LogEntry struct {
-	Timestamp   time.Time `json:"timestamp"`
-	Application string    `json:"application"`
-	Level       LogLevel  `json:"level"`
-	Message     string    `json:"message"`
+	Timestamp   time.Time      `json:"timestamp"`
+	Application string         `json:"application"`
+	Level       LogLevel       `json:"level"`
+	Message     string         `json:"message"`
+	Metadata    map[string]any `json:"metadata,omitempty"`
+
+	//Correlation IDs so one request can be followed across services
+	TraceID   string `json:"trace_id,omitempty"`
+	SpanID    string `json:"span_id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+
+	//Where the entry was produced, so environments can share a topic
+	Hostname    string      `json:"hostname,omitempty"`
+	Environment Environment `json:"environment,omitempty"`
+	PID         int         `json:"pid,omitempty"`
+
+	//ID identifies the entry across redeliveries, so stores and sinks can
+	//drop copies they already have
+	ID string `json:"id,omitempty"`
+	//SchemaVersion is the schema the entry was written with, decoded
+	//entries are upgraded to this build's
+	SchemaVersion int `json:"schema_version,omitempty"`
+
+	//The error an entry reports, kept out of the message so it can be
+	//searched and grouped on its own
+	ErrorType    string `json:"error_type,omitempty"`
+	ErrorMessage string `json:"error_message,omitempty"`
+	StackTrace   string `json:"stack_trace,omitempty"`
+
+	//DurationMs is how long the operation an entry completes took, such as
+	//a request, in milliseconds
+	DurationMs float64 `json:"duration_ms,omitempty"`
+}
+
+// NewID returns a random UUID for an entry
+func NewID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	id[6] = id[6]&0x0f | 0x40 //version 4
+	id[8] = id[8]&0x3f | 0x80 //RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
 }
 
 func (l *LogEntry) ToJson() ([]byte, error) {
@@ -28,6 +147,69 @@ func (l *LogEntry) ToJson() ([]byte, error) {
 
 func FromJson(data []byte) (*LogEntry, error) {
 	var entry LogEntry
-	err := json.Unmarshal(data, &entry)
+	err := entry.UnmarshalJSON(data)
 	return &entry, err
 }
+
+// entryPool recycles entries decoded on hot paths, see AcquireEntry
+var entryPool = sync.Pool{New: func() any { return new(LogEntry) }}
+
+// AcquireEntry returns an empty entry from a pool. Call Release once
+// nothing refers to the entry or its metadata anymore.
+func AcquireEntry() *LogEntry {
+	return entryPool.Get().(*LogEntry)
+}
+
+// Release resets the entry and returns it to the pool. The metadata map is
+// dropped rather than cleared, since processors may have shared it.
+func (l *LogEntry) Release() {
+	*l = LogEntry{}
+	entryPool.Put(l)
+}
+
+// WithField sets a metadata field and returns the entry for chaining
+func (l *LogEntry) WithField(key string, value any) *LogEntry {
+	if l.Metadata == nil {
+		l.Metadata = make(map[string]any)
+	}
+	l.Metadata[key] = value
+	return l
+}
+
+// GetString returns a metadata field as a string, formatting non-string values
+func (l *LogEntry) GetString(key string) (string, bool) {
+	value, ok := l.Metadata[key]
+	if !ok || value == nil {
+		return "", false
+	}
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+	return fmt.Sprint(value), true
+}
+
+// GetInt returns a metadata field as an int. Decoded JSON numbers arrive as
+// float64, so whole floats and numeric strings are accepted as well.
+func (l *LogEntry) GetInt(key string) (int, bool) {
+	switch value := l.Metadata[key].(type) {
+	case int:
+		return value, true
+	case int32:
+		return int(value), true
+	case int64:
+		return int(value), true
+	case float64:
+		if value != math.Trunc(value) {
+			return 0, false
+		}
+		return int(value), true
+	case json.Number:
+		n, err := value.Int64()
+		return int(n), err == nil
+	case string:
+		n, err := strconv.Atoi(value)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
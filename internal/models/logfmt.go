@@ -0,0 +1,280 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys of the fields of an entry in logfmt. Decoding also accepts the keys
+// of Go loggers, such as slog's time and logrus' msg, see logfmtAliases.
+const (
+	logfmtTime        = "ts"
+	logfmtApplication = "app"
+	logfmtLevel       = "level"
+	logfmtMessage     = "msg"
+	logfmtHostname    = "host"
+	logfmtEnvironment = "env"
+)
+
+// logfmtAliases map other keys Go services write onto the keys of fields
+var logfmtAliases = map[string]string{
+	"time":        logfmtTime,
+	"timestamp":   logfmtTime,
+	"application": logfmtApplication,
+	"service":     logfmtApplication,
+	"lvl":         logfmtLevel,
+	"message":     logfmtMessage,
+	"hostname":    logfmtHostname,
+	"environment": logfmtEnvironment,
+}
+
+// ToLogfmt encodes the entry as one logfmt line without a newline: the
+// fields that are set, then the metadata with sorted keys. Metadata values
+// that are objects or arrays are written as JSON.
+func (l *LogEntry) ToLogfmt() ([]byte, error) {
+	var b []byte
+	pair := func(key, value string) {
+		if len(b) > 0 {
+			b = append(b, ' ')
+		}
+		b = append(b, key...)
+		b = append(b, '=')
+		b = appendLogfmtValue(b, value)
+	}
+
+	pair(logfmtTime, l.Timestamp.Format(time.RFC3339Nano))
+	pair(logfmtApplication, l.Application)
+	pair(logfmtLevel, string(l.Level))
+	pair(logfmtMessage, l.Message)
+	for _, f := range [][2]string{
+		{"trace_id", l.TraceID}, {"span_id", l.SpanID}, {"request_id", l.RequestID},
+		{logfmtHostname, l.Hostname}, {logfmtEnvironment, string(l.Environment)},
+		{"id", l.ID}, {"error_type", l.ErrorType}, {"error_message", l.ErrorMessage}, {"stack_trace", l.StackTrace},
+	} {
+		if f[1] != "" {
+			pair(f[0], f[1])
+		}
+	}
+	if l.PID != 0 {
+		pair("pid", strconv.Itoa(l.PID))
+	}
+	if l.SchemaVersion != 0 {
+		pair("schema_version", strconv.Itoa(l.SchemaVersion))
+	}
+	if l.DurationMs != 0 {
+		pair("duration_ms", strconv.FormatFloat(l.DurationMs, 'f', -1, 64))
+	}
+
+	keys := make([]string, 0, len(l.Metadata))
+	for key := range l.Metadata {
+		if validLogfmtKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, err := logfmtMetadata(l.Metadata[key])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode metadata %s %w", key, err)
+		}
+		pair(key, value)
+	}
+	return b, nil
+}
+
+// logfmtMetadata formats a metadata value, objects and arrays as JSON
+func logfmtMetadata(value any) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case map[string]any, []any:
+		data, err := json.Marshal(value)
+		return string(data), err
+	}
+	return fmt.Sprint(value), nil
+}
+
+// appendLogfmtValue quotes values that are empty or contain spaces, quotes,
+// '=' or control characters
+func appendLogfmtValue(b []byte, v string) []byte {
+	if v == "" || strings.ContainsFunc(v, func(r rune) bool {
+		return r <= ' ' || r == '"' || r == '=' || r == '\\' || r == 0x7f
+	}) {
+		return strconv.AppendQuote(b, v)
+	}
+	return append(b, v...)
+}
+
+// validLogfmtKey reports whether key can be written unquoted, as logfmt keys must be
+func validLogfmtKey(key string) bool {
+	return key != "" && !strings.ContainsFunc(key, func(r rune) bool {
+		return r <= ' ' || r == '"' || r == '=' || r == 0x7f
+	})
+}
+
+// FromLogfmt decodes a logfmt line. The keys of ToLogfmt and their aliases
+// set the fields, other keys become metadata with string values. The level
+// accepts the names of ParseLevelAlias in any case.
+func FromLogfmt(data []byte) (*LogEntry, error) {
+	pairs, err := parseLogfmt(data)
+	if err != nil {
+		return &LogEntry{}, err
+	}
+
+	entry := &LogEntry{}
+	for _, p := range pairs {
+		key := p.key
+		if alias, ok := logfmtAliases[key]; ok {
+			key = alias
+		}
+		switch key {
+		case logfmtTime:
+			ts, err := time.Parse(time.RFC3339Nano, p.value)
+			if err != nil {
+				return &LogEntry{}, fmt.Errorf("invalid %s %w", p.key, err)
+			}
+			entry.Timestamp = ts
+		case logfmtApplication:
+			entry.Application = p.value
+		case logfmtLevel:
+			level, err := ParseLevelAlias(p.value)
+			if err != nil {
+				return &LogEntry{}, err
+			}
+			entry.Level = level
+		case logfmtMessage:
+			entry.Message = p.value
+		case "trace_id":
+			entry.TraceID = p.value
+		case "span_id":
+			entry.SpanID = p.value
+		case "request_id":
+			entry.RequestID = p.value
+		case logfmtHostname:
+			entry.Hostname = p.value
+		case logfmtEnvironment:
+			entry.Environment = Environment(p.value)
+		case "id":
+			entry.ID = p.value
+		case "error_type":
+			entry.ErrorType = p.value
+		case "error_message":
+			entry.ErrorMessage = p.value
+		case "stack_trace":
+			entry.StackTrace = p.value
+		case "pid", "schema_version":
+			n, err := strconv.Atoi(p.value)
+			if err != nil {
+				return &LogEntry{}, fmt.Errorf("invalid %s %q", p.key, p.value)
+			}
+			if key == "pid" {
+				entry.PID = n
+			} else {
+				entry.SchemaVersion = n
+			}
+		case "duration_ms":
+			duration, err := strconv.ParseFloat(p.value, 64)
+			if err != nil {
+				return &LogEntry{}, fmt.Errorf("invalid duration_ms %q", p.value)
+			}
+			entry.DurationMs = duration
+		default:
+			entry.WithField(p.key, p.value)
+		}
+	}
+	return entry, nil
+}
+
+// IsLogfmt reports whether line looks like a logfmt entry of a Go service:
+// key=value pairs including a message and a level, as written by slog's
+// TextHandler, logrus' TextFormatter and go-kit's logger
+func IsLogfmt(line []byte) bool {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] == '{' {
+		return false
+	}
+	pairs, err := parseLogfmt(line)
+	if err != nil {
+		return false
+	}
+	var message, level bool
+	for _, p := range pairs {
+		key := p.key
+		if alias, ok := logfmtAliases[key]; ok {
+			key = alias
+		}
+		message = message || key == logfmtMessage
+		level = level || key == logfmtLevel
+	}
+	return message && level
+}
+
+type logfmtPair struct {
+	key, value string
+}
+
+var errLogfmtQuote = errors.New("unterminated quoted value")
+
+// parseLogfmt splits a line into its pairs in order. A key without '='
+// has an empty value, and quoted values are unquoted like Go strings.
+func parseLogfmt(data []byte) ([]logfmtPair, error) {
+	var pairs []logfmtPair
+	i := 0
+	for {
+		for i < len(data) && data[i] <= ' ' {
+			i++
+		}
+		if i == len(data) {
+			return pairs, nil
+		}
+
+		start := i
+		for i < len(data) && data[i] > ' ' && data[i] != '=' && data[i] != '"' {
+			i++
+		}
+		if i == start {
+			return nil, fmt.Errorf("expected a key at offset %d", i)
+		}
+		p := logfmtPair{key: string(data[start:i])}
+		if i == len(data) || data[i] != '=' {
+			if i < len(data) && data[i] == '"' {
+				return nil, fmt.Errorf("unexpected quote in key at offset %d", i)
+			}
+			pairs = append(pairs, p)
+			continue
+		}
+		i++
+
+		if i < len(data) && data[i] == '"' {
+			end := i + 1
+			for end < len(data) && data[end] != '"' {
+				if data[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(data) {
+				return nil, errLogfmtQuote
+			}
+			value, err := strconv.Unquote(string(data[i : end+1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted value of %s %w", p.key, err)
+			}
+			p.value = value
+			i = end + 1
+		} else {
+			start = i
+			for i < len(data) && data[i] > ' ' {
+				i++
+			}
+			p.value = string(data[start:i])
+		}
+		pairs = append(pairs, p)
+	}
+}
@@ -0,0 +1,5 @@
+// Package logpb holds the protobuf schema and generated bindings for log
+// entries and the gRPC ingestion service.
+package logpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative log.proto ingest.proto
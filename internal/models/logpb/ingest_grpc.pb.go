@@ -0,0 +1,163 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: ingest.proto
+
+package logpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Ingest_Ship_FullMethodName       = "/klog.v1.Ingest/Ship"
+	Ingest_ShipStream_FullMethodName = "/klog.v1.Ingest/ShipStream"
+)
+
+// IngestClient is the client API for Ingest service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Ingest accepts log entries from other services and produces them to Kafka
+type IngestClient interface {
+	// Ship sends one batch of entries, all of them are produced or none are
+	Ship(ctx context.Context, in *ShipRequest, opts ...grpc.CallOption) (*ShipResponse, error)
+	// ShipStream sends batches until the client closes the stream, every
+	// batch is produced before the response is returned
+	ShipStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ShipRequest, ShipResponse], error)
+}
+
+type ingestClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIngestClient(cc grpc.ClientConnInterface) IngestClient {
+	return &ingestClient{cc}
+}
+
+func (c *ingestClient) Ship(ctx context.Context, in *ShipRequest, opts ...grpc.CallOption) (*ShipResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ShipResponse)
+	err := c.cc.Invoke(ctx, Ingest_Ship_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ingestClient) ShipStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ShipRequest, ShipResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ingest_ServiceDesc.Streams[0], Ingest_ShipStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ShipRequest, ShipResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ingest_ShipStreamClient = grpc.ClientStreamingClient[ShipRequest, ShipResponse]
+
+// IngestServer is the server API for Ingest service.
+// All implementations must embed UnimplementedIngestServer
+// for forward compatibility.
+//
+// Ingest accepts log entries from other services and produces them to Kafka
+type IngestServer interface {
+	// Ship sends one batch of entries, all of them are produced or none are
+	Ship(context.Context, *ShipRequest) (*ShipResponse, error)
+	// ShipStream sends batches until the client closes the stream, every
+	// batch is produced before the response is returned
+	ShipStream(grpc.ClientStreamingServer[ShipRequest, ShipResponse]) error
+	mustEmbedUnimplementedIngestServer()
+}
+
+// UnimplementedIngestServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedIngestServer struct{}
+
+func (UnimplementedIngestServer) Ship(context.Context, *ShipRequest) (*ShipResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ship not implemented")
+}
+func (UnimplementedIngestServer) ShipStream(grpc.ClientStreamingServer[ShipRequest, ShipResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ShipStream not implemented")
+}
+func (UnimplementedIngestServer) mustEmbedUnimplementedIngestServer() {}
+func (UnimplementedIngestServer) testEmbeddedByValue()                {}
+
+// UnsafeIngestServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IngestServer will
+// result in compilation errors.
+type UnsafeIngestServer interface {
+	mustEmbedUnimplementedIngestServer()
+}
+
+func RegisterIngestServer(s grpc.ServiceRegistrar, srv IngestServer) {
+	// If the following call pancis, it indicates UnimplementedIngestServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Ingest_ServiceDesc, srv)
+}
+
+func _Ingest_Ship_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ShipRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IngestServer).Ship(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ingest_Ship_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IngestServer).Ship(ctx, req.(*ShipRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ingest_ShipStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IngestServer).ShipStream(&grpc.GenericServerStream[ShipRequest, ShipResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ingest_ShipStreamServer = grpc.ClientStreamingServer[ShipRequest, ShipResponse]
+
+// Ingest_ServiceDesc is the grpc.ServiceDesc for Ingest service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ingest_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "klog.v1.Ingest",
+	HandlerType: (*IngestServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Ship",
+			Handler:    _Ingest_Ship_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ShipStream",
+			Handler:       _Ingest_ShipStream_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ingest.proto",
+}
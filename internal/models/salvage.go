@@ -0,0 +1,146 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Metadata fields set on entries salvaged from malformed payloads
+const (
+	MetadataDegraded   = "degraded"
+	MetadataParseError = "parse_error"
+)
+
+// snippetContext is how many bytes of the payload a ParseError shows on
+// each side of the offset
+const snippetContext = 24
+
+// maxRawMessage bounds the raw payload used as the message of a salvaged
+// entry that had none
+const maxRawMessage = 4096
+
+// ParseError says where a JSON payload failed to decode as a LogEntry
+type ParseError struct {
+	Offset  int64  //byte offset into the payload, -1 when unknown
+	Field   string //field being decoded, empty when unknown
+	Snippet string //payload around Offset
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	var where []string
+	if e.Field != "" {
+		where = append(where, "field "+e.Field)
+	}
+	if e.Offset >= 0 {
+		where = append(where, fmt.Sprintf("offset %d", e.Offset))
+	}
+	if len(where) == 0 {
+		return fmt.Sprintf("invalid log entry near %q: %v", e.Snippet, e.Err)
+	}
+	return fmt.Sprintf("invalid log entry at %s near %q: %v", strings.Join(where, ", "), e.Snippet, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseError describes err, returned by encoding/json for data
+func parseError(data []byte, err error) *ParseError {
+	perr := &ParseError{Offset: -1, Err: err}
+	var syntax *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax):
+		perr.Offset = syntax.Offset
+	case errors.As(err, &typeErr):
+		perr.Offset, perr.Field = typeErr.Offset, typeErr.Field
+	case strings.Contains(err.Error(), "log level"):
+		//levels are rejected by LogLevel.UnmarshalText, which knows no offset
+		perr.Field = "level"
+		if i := bytes.Index(data, []byte(`"level"`)); i >= 0 {
+			perr.Offset = int64(i)
+		}
+	}
+	perr.Snippet = snippet(data, perr.Offset)
+	return perr
+}
+
+// snippet returns the payload around offset, or its start when unknown
+func snippet(data []byte, offset int64) string {
+	start, end := 0, min(len(data), 2*snippetContext)
+	if offset >= 0 {
+		at := int(min(offset, int64(len(data))))
+		start, end = max(at-snippetContext, 0), min(at+snippetContext, len(data))
+	}
+	return strings.ToValidUTF8(string(data[start:end]), "")
+}
+
+// salvageFields are the fields Salvage decodes, by their lower case name.
+// Metadata is decoded on its own so a failure can't leave half of it.
+func salvageFields(l *LogEntry) map[string]any {
+	return map[string]any{
+		"timestamp":      &l.Timestamp,
+		"application":    &l.Application,
+		"level":          &l.Level,
+		"message":        &l.Message,
+		"trace_id":       &l.TraceID,
+		"span_id":        &l.SpanID,
+		"request_id":     &l.RequestID,
+		"hostname":       &l.Hostname,
+		"environment":    &l.Environment,
+		"pid":            &l.PID,
+		"id":             &l.ID,
+		"schema_version": &l.SchemaVersion,
+		"error_type":     &l.ErrorType,
+		"error_message":  &l.ErrorMessage,
+		"stack_trace":    &l.StackTrace,
+		"duration_ms":    &l.DurationMs,
+	}
+}
+
+// Salvage decodes what it can of a JSON payload that failed to decode with
+// cause: every field read before a syntax error, skipping fields whose
+// value is invalid. The entry is marked degraded in its metadata along with
+// the error, and when no message was read the raw payload becomes the
+// message. Fields that couldn't be read are left empty.
+func Salvage(data []byte, cause error) *LogEntry {
+	entry := &LogEntry{}
+	targets := salvageFields(entry)
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err == nil && token == json.Delim('{') {
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				break
+			}
+			key, _ := token.(string)
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				break
+			}
+			//a value that fails to decode leaves its field empty
+			if target, ok := targets[strings.ToLower(key)]; ok {
+				json.Unmarshal(raw, target)
+			} else if strings.EqualFold(key, "metadata") {
+				var metadata map[string]any
+				if json.Unmarshal(raw, &metadata) == nil {
+					entry.Metadata = metadata
+				}
+			}
+		}
+	}
+
+	if strings.TrimSpace(entry.Message) == "" {
+		entry.Message = strings.ToValidUTF8(string(data[:min(len(data), maxRawMessage)]), "\uFFFD")
+	}
+	entry.WithField(MetadataDegraded, true)
+	if cause != nil {
+		entry.WithField(MetadataParseError, cause.Error())
+	}
+	return entry
+}
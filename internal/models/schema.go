@@ -0,0 +1,175 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// SchemaVersion is the LogEntry schema written by this build. New optional
+// fields don't change it, older builds ignore them. Changes they would
+// misread, such as renaming a field, bump it and add a migration from the
+// previous version, and consumers must be upgraded before producers.
+const SchemaVersion = 1
+
+// Migration upgrades the fields of a payload from one schema version to the
+// next, such as renaming a field or filling in a new one from old ones. It
+// must leave fields already in their new form alone, protobuf payloads are
+// decoded by field number and come with this build's names.
+type Migration func(fields map[string]any) error
+
+// migrations[v] upgrades version v to v+1. Versions that only added
+// optional fields need none, their payloads decode as they are.
+var migrations = map[int]Migration{}
+
+// FieldDecoder reads a payload into the fields of its schema version, named
+// as in the JSON encoding of that version, for the migrations to upgrade
+type FieldDecoder func(data []byte) (map[string]any, error)
+
+// decoders holds the field decoders of each format by the version from
+// which on they read payloads, until a later version registers another
+var decoders = map[Format]map[int]FieldDecoder{
+	FormatJSON:     {1: decodeJSONFields},
+	FormatProtobuf: {1: decodeProtoFields},
+	FormatLogfmt:   {1: decodeLogfmtFields},
+	FormatMsgpack:  {1: decodeMsgpackFields},
+	FormatCBOR:     {1: decodeCBORFields},
+}
+
+// DecodeVersion parses data encoded in format f with a schema version, zero
+// when it isn't known, into entry. Payloads of older versions are migrated
+// to this build's schema, and newer versions are rejected rather than
+// misread.
+func DecodeVersion(data []byte, f Format, version int, entry *LogEntry) error {
+	if version > SchemaVersion {
+		return unsupportedVersion(version)
+	}
+	if version > 0 && migrated(version) {
+		return upgrade(data, f, version, entry)
+	}
+	if err := DecodeInto(data, f, entry); err != nil {
+		return err
+	}
+	if version == 0 {
+		//the payload may carry its version when the message doesn't
+		version = max(entry.SchemaVersion, 1)
+		if version > SchemaVersion {
+			return unsupportedVersion(version)
+		}
+		if migrated(version) {
+			return upgrade(data, f, version, entry)
+		}
+	}
+	entry.SchemaVersion = SchemaVersion
+	return nil
+}
+
+func unsupportedVersion(version int) error {
+	return fmt.Errorf("unsupported schema version %d, this build reads up to %d", version, SchemaVersion)
+}
+
+// migrated reports whether payloads of version need migrations to reach SchemaVersion
+func migrated(version int) bool {
+	for v := version; v < SchemaVersion; v++ {
+		if migrations[v] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// upgrade decodes the fields of a payload of version, migrates them one
+// version at a time and decodes the result
+func upgrade(data []byte, f Format, version int, entry *LogEntry) error {
+	decode := fieldDecoder(f, version)
+	if decode == nil {
+		return fmt.Errorf("no decoder for schema version %d in %s", version, f)
+	}
+	fields, err := decode(data)
+	if err != nil {
+		return err
+	}
+	for v := version; v < SchemaVersion; v++ {
+		if migrate := migrations[v]; migrate != nil {
+			if err := migrate(fields); err != nil {
+				return fmt.Errorf("failed to migrate schema version %d %w", v, err)
+			}
+		}
+	}
+	fields["schema_version"] = SchemaVersion
+
+	upgraded, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode migrated entry %w", err)
+	}
+	*entry = LogEntry{}
+	return entry.UnmarshalJSON(upgraded)
+}
+
+// fieldDecoder returns the decoder registered for the latest version up to version
+func fieldDecoder(f Format, version int) FieldDecoder {
+	for v := version; v > 0; v-- {
+		if decode, ok := decoders[f][v]; ok {
+			return decode
+		}
+	}
+	return nil
+}
+
+func decodeJSONFields(data []byte) (map[string]any, error) {
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// decodeProtoFields decodes by field number, which renames keep
+func decodeProtoFields(data []byte) (map[string]any, error) {
+	return reencodeFields(FromProto(data))
+}
+
+// decodeLogfmtFields reads the keys of this build, logfmt carries no others
+func decodeLogfmtFields(data []byte) (map[string]any, error) {
+	return reencodeFields(FromLogfmt(data))
+}
+
+// decodeMsgpackFields and decodeCBORFields keep the names of the payload,
+// both formats being self-describing like JSON
+func decodeMsgpackFields(data []byte) (map[string]any, error) {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetMapDecoder(func(d *msgpack.Decoder) (any, error) {
+		return d.DecodeUntypedMap()
+	})
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return jsonValues(fields), nil
+}
+
+func decodeCBORFields(data []byte) (map[string]any, error) {
+	mode, err := cborDecMode()
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := mode.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return jsonValues(fields), nil
+}
+
+// reencodeFields returns the JSON fields of a decoded entry
+func reencodeFields(entry *LogEntry, err error) (map[string]any, error) {
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := entry.ToJson()
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONFields(encoded)
+}
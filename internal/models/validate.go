@@ -0,0 +1,194 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validation error codes, stable so clients can act on them
+const (
+	CodeMissing   = "missing"   //a required field is empty
+	CodeUnknown   = "unknown"   //the level isn't one of Levels
+	CodeTooLong   = "too_long"  //a value is longer than its limit in bytes
+	CodeTooMany   = "too_many"  //metadata has more keys than its limit
+	CodeMalformed = "malformed" //the payload couldn't be decoded
+)
+
+// MetadataTruncated is set on entries cut down to fit Limits. It doesn't
+// count towards MaxMetadataKeys.
+const MetadataTruncated = "truncated"
+
+// truncatedSuffix ends values cut down to fit Limits
+const truncatedSuffix = "…[truncated]"
+
+// ValidationError says which field of an entry is invalid and why
+type ValidationError struct {
+	//Field is the JSON name of the field, metadata values are metadata.<key>
+	Field string `json:"field"`
+	Code  string `json:"code"`
+	//Limit is the exceeded limit of too_long and too_many errors
+	Limit int `json:"limit,omitempty"`
+}
+
+func (e *ValidationError) Error() string {
+	switch e.Code {
+	case CodeMissing:
+		return "missing " + e.Field
+	case CodeUnknown:
+		return "unknown " + e.Field
+	case CodeTooLong:
+		return fmt.Sprintf("%s is longer than %d bytes", e.Field, e.Limit)
+	case CodeTooMany:
+		return fmt.Sprintf("%s has more than %d keys", e.Field, e.Limit)
+	}
+	return fmt.Sprintf("invalid %s", e.Field)
+}
+
+// Limits bound the size of an entry, zero fields don't limit
+type Limits struct {
+	MaxMessageBytes int
+	MaxMetadataKeys int
+	//MaxMetadataValueBytes bounds string values, and the JSON encoding of others
+	MaxMetadataValueBytes int
+}
+
+// DefaultLimits returns limits generous for logs that keep entries well
+// below Kafka's default message size of 1MB
+func DefaultLimits() Limits {
+	return Limits{MaxMessageBytes: 64 << 10, MaxMetadataKeys: 100, MaxMetadataValueBytes: 8 << 10}
+}
+
+// Validate reports the first field every downstream consumer relies on that
+// the entry is missing, or an unknown level, as a *ValidationError
+func (l *LogEntry) Validate() error {
+	switch {
+	case l.Timestamp.IsZero():
+		return &ValidationError{Field: "timestamp", Code: CodeMissing}
+	case l.Application == "":
+		return &ValidationError{Field: "application", Code: CodeMissing}
+	case l.Level == "":
+		return &ValidationError{Field: "level", Code: CodeMissing}
+	case l.Level.Severity() == 0:
+		return &ValidationError{Field: "level", Code: CodeUnknown}
+	case strings.TrimSpace(l.Message) == "":
+		return &ValidationError{Field: "message", Code: CodeMissing}
+	}
+	return nil
+}
+
+// CheckLimits reports the first limit the entry exceeds, as a *ValidationError
+func (l *LogEntry) CheckLimits(limits Limits) error {
+	if limits.MaxMessageBytes > 0 && len(l.Message) > limits.MaxMessageBytes {
+		return &ValidationError{Field: "message", Code: CodeTooLong, Limit: limits.MaxMessageBytes}
+	}
+	if limits.MaxMetadataKeys > 0 && metadataKeys(l.Metadata) > limits.MaxMetadataKeys {
+		return &ValidationError{Field: "metadata", Code: CodeTooMany, Limit: limits.MaxMetadataKeys}
+	}
+	if limits.MaxMetadataValueBytes > 0 {
+		for _, key := range sortedKeys(l.Metadata) {
+			if valueSize(l.Metadata[key]) > limits.MaxMetadataValueBytes {
+				return &ValidationError{Field: "metadata." + key, Code: CodeTooLong, Limit: limits.MaxMetadataValueBytes}
+			}
+		}
+	}
+	return nil
+}
+
+// Truncate cuts the entry down to fit limits and reports whether it had to.
+// Long values end in "…[truncated]", non-string values too long become
+// their truncated JSON encoding, metadata keys past the limit are dropped
+// in sorted order, and MetadataTruncated is set.
+func (l *LogEntry) Truncate(limits Limits) bool {
+	truncated := false
+	if limits.MaxMessageBytes > 0 && len(l.Message) > limits.MaxMessageBytes {
+		l.Message = truncate(l.Message, limits.MaxMessageBytes)
+		truncated = true
+	}
+
+	if limits.MaxMetadataKeys > 0 && metadataKeys(l.Metadata) > limits.MaxMetadataKeys {
+		kept := 0
+		for _, key := range sortedKeys(l.Metadata) {
+			if key == MetadataTruncated {
+				continue
+			}
+			if kept == limits.MaxMetadataKeys {
+				delete(l.Metadata, key)
+				continue
+			}
+			kept++
+		}
+		truncated = true
+	}
+	if limits.MaxMetadataValueBytes > 0 {
+		for key, value := range l.Metadata {
+			if valueSize(value) <= limits.MaxMetadataValueBytes {
+				continue
+			}
+			s, ok := value.(string)
+			if !ok {
+				s = string(encodeValue(value))
+			}
+			l.Metadata[key] = truncate(s, limits.MaxMetadataValueBytes)
+			truncated = true
+		}
+	}
+
+	if truncated {
+		l.WithField(MetadataTruncated, true)
+	}
+	return truncated
+}
+
+// truncate cuts s to at most limit bytes including the suffix, on a rune boundary
+func truncate(s string, limit int) string {
+	suffix := truncatedSuffix
+	if limit <= len(suffix) {
+		suffix = ""
+	}
+	cut := limit - len(suffix)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + suffix
+}
+
+// metadataKeys counts the keys counting towards MaxMetadataKeys
+func metadataKeys(metadata map[string]any) int {
+	n := len(metadata)
+	if _, ok := metadata[MetadataTruncated]; ok {
+		n--
+	}
+	return n
+}
+
+// valueSize is the length of a string value or the JSON encoding of another
+func valueSize(value any) int {
+	if s, ok := value.(string); ok {
+		return len(s)
+	}
+	switch value.(type) {
+	case nil, bool, int, int32, int64, float64:
+		return 0 //always short
+	}
+	return len(encodeValue(value))
+}
+
+func encodeValue(value any) []byte {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return []byte(fmt.Sprint(value))
+	}
+	return data
+}
+
+func sortedKeys(metadata map[string]any) []string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,185 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Validate rejects entries missing the fields every downstream consumer relies on
+type Validate struct{}
+
+func (Validate) Name() string { return "validate" }
+
+func (Validate) Process(record *Record) error {
+	return record.Entry.Validate()
+}
+
+// Enrich stamps entries with when and where they were processed and, with
+// a lookup, ownership fields for their application. Fields already set on
+// the entry are never overwritten.
+type Enrich struct {
+	hostname string
+	lookup   Lookup
+}
+
+// NewEnrich returns an enricher, lookup may be nil
+func NewEnrich(lookup Lookup) *Enrich {
+	hostname, _ := os.Hostname()
+	return &Enrich{hostname: hostname, lookup: lookup}
+}
+
+func (*Enrich) Name() string { return "enrich" }
+
+func (e *Enrich) Process(record *Record) error {
+	entry := record.Entry
+	entry.
+		WithField("processed_at", time.Now().UTC().Format(time.RFC3339Nano)).
+		WithField("processed_by", e.hostname)
+
+	if e.lookup == nil {
+		return nil
+	}
+	fields, err := e.lookup.Lookup(entry.Application)
+	if err != nil {
+		//missing ownership data shouldn't send the entry to the DLQ
+		slog.Warn("Error looking up enrichment fields", "err", err)
+	}
+	for key, value := range fields {
+		if _, exists := entry.Metadata[key]; !exists {
+			entry.WithField(key, value)
+		}
+	}
+	return nil
+}
+
+// Options configures the built-in processors
+type Options struct {
+	//Context stops background work such as reloading rules
+	Context context.Context
+	//RoutesFile holds the rules used by the route processor
+	RoutesFile string
+	//ReloadInterval is how often rule files are checked for changes
+	ReloadInterval time.Duration
+	//EnrichFile or EnrichURL supply lookup fields for the enrich processor,
+	//responses from EnrichURL are cached for EnrichTTL
+	EnrichFile string
+	EnrichURL  string
+	EnrichTTL  time.Duration
+	//RedactFile configures the redact processor, every built-in pattern is masked without it
+	RedactFile string
+	//SampleRate is N when the sample processor keeps 1 in N entries of a kind
+	SampleRate int
+	//DedupWindow is how long the dedup processor suppresses repeats of an
+	//entry, Emit publishes the summaries it emits when windows close
+	DedupWindow time.Duration
+	Emit        func(*Record)
+	//PatternSimilarity is the share of words a message must have in common
+	//with a pattern to join it, 0.5 when unset
+	PatternSimilarity float64
+	//LogMetrics is the logmetrics processor, built from metric rules by
+	//the caller since it also serves the metrics
+	LogMetrics *LogMetrics
+	//Metrics receives counts from processors that report them
+	Metrics *Metrics
+}
+
+// Build returns the built-in processors named in order, for the -processors flag
+func Build(names []string, opts Options) (Chain, error) {
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	if opts.ReloadInterval <= 0 {
+		opts.ReloadInterval = 5 * time.Second
+	}
+
+	var chain Chain
+	var dedup *Dedup
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case "validate":
+			chain = append(chain, Validate{})
+		case "enrich":
+			var lookup Lookup
+			switch {
+			case opts.EnrichFile != "":
+				fileLookup, err := LoadFileLookup(opts.EnrichFile)
+				if err != nil {
+					return nil, err
+				}
+				lookup = fileLookup
+			case opts.EnrichURL != "":
+				ttl := opts.EnrichTTL
+				if ttl <= 0 {
+					ttl = 5 * time.Minute
+				}
+				lookup = NewHTTPLookup(opts.EnrichURL, ttl)
+			}
+			chain = append(chain, NewEnrich(lookup))
+		case "redact":
+			cfg := DefaultRedactConfig()
+			if opts.RedactFile != "" {
+				var err error
+				if cfg, err = LoadRedactConfig(opts.RedactFile); err != nil {
+					return nil, err
+				}
+			}
+			redact, err := NewRedact(cfg, opts.Metrics)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, redact)
+		case "route":
+			if opts.RoutesFile == "" {
+				return nil, errors.New("route processor needs a routes file")
+			}
+			router, err := NewRouter(opts.RoutesFile)
+			if err != nil {
+				return nil, err
+			}
+			go router.Watch(opts.Context, opts.ReloadInterval)
+			chain = append(chain, router)
+		case "dedup":
+			if dedup != nil {
+				return nil, errors.New("dedup processor can only appear once")
+			}
+			window := opts.DedupWindow
+			if window <= 0 {
+				window = 30 * time.Second
+			}
+			dedup = NewDedup(window, opts.Emit, opts.Metrics)
+			chain = append(chain, dedup)
+		case "sample":
+			chain = append(chain, NewSample(opts.SampleRate, opts.Metrics))
+		case "pattern":
+			similarity := opts.PatternSimilarity
+			switch {
+			case similarity > 1:
+				return nil, fmt.Errorf("invalid pattern similarity %v, expected a share between 0 and 1", similarity)
+			case similarity <= 0:
+				similarity = 0.5
+			}
+			chain = append(chain, NewPattern(similarity))
+		case "logmetrics":
+			if opts.LogMetrics == nil {
+				return nil, errors.New("logmetrics processor needs metric rules")
+			}
+			chain = append(chain, opts.LogMetrics)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown processor %q", name)
+		}
+	}
+	if dedup != nil {
+		//summaries go through the processors after dedup, like the entries
+		//they stand for
+		dedup.next = chain[slices.Index(chain, Processor(dedup))+1:]
+		go dedup.Run(opts.Context)
+	}
+	return chain, nil
+}
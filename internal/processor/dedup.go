@@ -0,0 +1,146 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+// Metadata fields of the summaries emitted by the dedup processor
+const (
+	//MetadataRepeated counts the entries suppressed after the first one
+	MetadataRepeated = "repeated"
+	//MetadataFirstSeen and MetadataLastSeen bound the suppressed entries
+	MetadataFirstSeen = "first_seen"
+	MetadataLastSeen  = "last_seen"
+)
+
+// maxDedupKeys bounds the windows open at once, entries of new kinds pass
+// untracked past it
+const maxDedupKeys = 10000
+
+// Dedup forwards the first of identical entries, same application, level
+// and message, and suppresses the ones following within the window. When
+// the window closes a summary saying how often the entry repeated runs
+// through the processors after dedup and is handed to emit.
+type Dedup struct {
+	window  time.Duration
+	emit    func(*Record)
+	next    Chain //processors after dedup, set by Build
+	metrics *Metrics
+
+	mu      sync.Mutex
+	windows map[dedupKey]*dedupWindow
+}
+
+type dedupKey struct {
+	application string
+	level       models.LogLevel
+	message     string
+}
+
+// dedupWindow keeps what the summary needs, entries are recycled once
+// processed so they can't be kept
+type dedupWindow struct {
+	first    models.LogEntry
+	opened   time.Time
+	repeated int
+	lastSeen time.Time
+}
+
+// NewDedup returns a deduplicator with windows of window, summaries are
+// handed to emit and metrics may be nil
+func NewDedup(window time.Duration, emit func(*Record), metrics *Metrics) *Dedup {
+	return &Dedup{window: window, emit: emit, metrics: metrics, windows: make(map[dedupKey]*dedupWindow)}
+}
+
+func (*Dedup) Name() string { return "dedup" }
+
+func (d *Dedup) Process(record *Record) error {
+	entry := record.Entry
+	key := dedupKey{application: entry.Application, level: entry.Level, message: entry.Message}
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if w, ok := d.windows[key]; ok && now.Sub(w.opened) < d.window {
+		w.repeated++
+		w.lastSeen = entry.Timestamp
+		if d.metrics != nil {
+			d.metrics.Deduplicated.Add(1)
+		}
+		return ErrDrop
+	}
+	if len(d.windows) < maxDedupKeys {
+		d.windows[key] = &dedupWindow{
+			first: models.LogEntry{
+				Timestamp:   entry.Timestamp,
+				Level:       entry.Level,
+				Message:     entry.Message,
+				Application: entry.Application,
+				Hostname:    entry.Hostname,
+				Environment: entry.Environment,
+			},
+			opened: now,
+		}
+	}
+	return nil
+}
+
+// Run closes expired windows until ctx is done, emitting the summaries of
+// those that suppressed entries. Windows still open then are dropped.
+func (d *Dedup) Run(ctx context.Context) {
+	ticker := time.NewTicker(min(d.window, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, record := range d.expire(now) {
+				d.summarize(record)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// expire removes the windows closed by now and returns the summaries due
+func (d *Dedup) expire(now time.Time) []*Record {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var summaries []*Record
+	for key, w := range d.windows {
+		if now.Sub(w.opened) < d.window {
+			continue
+		}
+		delete(d.windows, key)
+		if w.repeated == 0 {
+			continue
+		}
+		summary := w.first
+		summary.Timestamp = w.lastSeen
+		summary.Message = fmt.Sprintf("%s (repeated %d times)", w.first.Message, w.repeated)
+		summary.WithField(MetadataRepeated, w.repeated).
+			WithField(MetadataFirstSeen, w.first.Timestamp.UTC().Format(time.RFC3339Nano)).
+			WithField(MetadataLastSeen, w.lastSeen.UTC().Format(time.RFC3339Nano))
+		summaries = append(summaries, &Record{Entry: &summary})
+	}
+	return summaries
+}
+
+func (d *Dedup) summarize(record *Record) {
+	if err := d.next.Process(record); err != nil {
+		if !errors.Is(err, ErrDrop) {
+			slog.Warn("Error processing repeated entries summary", "err", err)
+		}
+		return
+	}
+	if d.emit != nil {
+		d.emit(record)
+	}
+}
@@ -0,0 +1,383 @@
+package processor
+
+import (
+	"fmt"
+	"io"
+	"kafka-logging-system/internal/models"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Metric types a rule can produce
+const (
+	MetricCounter   = "counter"
+	MetricHistogram = "histogram"
+)
+
+// maxMetricSeries bounds the label combinations of one rule, entries
+// adding more are not counted
+const maxMetricSeries = 1000
+
+// DefaultBuckets are the histogram buckets of rules that set none, suited
+// to durations in milliseconds
+var DefaultBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+var (
+	metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelName  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// MetricRule turns matching entries into a metric. Every condition that is
+// set must match, like routing rules. A counter counts matches, or adds up
+// the value when one is extracted; a histogram observes the value.
+type MetricRule struct {
+	Name string `yaml:"name"`
+	Help string `yaml:"help"`
+	Type string `yaml:"type"`
+
+	Levels       []models.LogLevel `yaml:"levels"`
+	Applications []string          `yaml:"applications"`
+	//Message is a regular expression matched against the message
+	Message string `yaml:"message"`
+
+	//Value names the capture group of Message holding the value, by name
+	//or number, Field a metadata field holding it instead
+	Value string `yaml:"value"`
+	Field string `yaml:"field"`
+	//Labels are application, level or metadata fields, missing ones are empty
+	Labels  []string  `yaml:"labels"`
+	Buckets []float64 `yaml:"buckets"`
+
+	message *regexp.Regexp
+	group   int
+}
+
+func (r *MetricRule) matches(entry *models.LogEntry) ([]string, bool) {
+	if len(r.Levels) > 0 && !slices.Contains(r.Levels, entry.Level) {
+		return nil, false
+	}
+	if len(r.Applications) > 0 && !slices.Contains(r.Applications, entry.Application) {
+		return nil, false
+	}
+	if r.message == nil {
+		return nil, true
+	}
+	groups := r.message.FindStringSubmatch(entry.Message)
+	return groups, groups != nil
+}
+
+// value extracts the value of the rule from an entry, 1 when the rule
+// extracts none
+func (r *MetricRule) value(entry *models.LogEntry, groups []string) (float64, bool) {
+	var raw string
+	switch {
+	case r.Field != "":
+		s, ok := entry.GetString(r.Field)
+		if !ok {
+			return 0, false
+		}
+		raw = s
+	case r.Value != "":
+		raw = groups[r.group]
+	default:
+		return 1, true
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return value, true
+}
+
+func (r *MetricRule) labelValues(entry *models.LogEntry) []string {
+	values := make([]string, len(r.Labels))
+	for i, label := range r.Labels {
+		switch label {
+		case "application":
+			values[i] = entry.Application
+		case "level":
+			values[i] = string(entry.Level)
+		default:
+			values[i], _ = entry.GetString(label)
+		}
+	}
+	return values
+}
+
+func (r *MetricRule) compile() error {
+	if !metricName.MatchString(r.Name) {
+		return fmt.Errorf("invalid metric name %q", r.Name)
+	}
+	switch r.Type {
+	case "":
+		r.Type = MetricCounter
+	case MetricCounter, MetricHistogram:
+	default:
+		return fmt.Errorf("metric %s has unknown type %q, expected counter or histogram", r.Name, r.Type)
+	}
+	for _, label := range r.Labels {
+		if !labelName.MatchString(label) || strings.HasPrefix(label, "__") || label == "le" {
+			return fmt.Errorf("metric %s has invalid label %q", r.Name, label)
+		}
+	}
+
+	var err error
+	if r.Message != "" {
+		if r.message, err = regexp.Compile(r.Message); err != nil {
+			return fmt.Errorf("metric %s has invalid message pattern %w", r.Name, err)
+		}
+	}
+	switch {
+	case r.Value != "" && r.Field != "":
+		return fmt.Errorf("metric %s sets both value and field", r.Name)
+	case r.Value != "" && r.message == nil:
+		return fmt.Errorf("metric %s takes its value from a message pattern it doesn't have", r.Name)
+	case r.Value != "":
+		if r.group = r.message.SubexpIndex(r.Value); r.group < 0 {
+			r.group, err = strconv.Atoi(r.Value)
+			if err != nil || r.group <= 0 || r.group > r.message.NumSubexp() {
+				return fmt.Errorf("metric %s has no capture group %q", r.Name, r.Value)
+			}
+		}
+	case r.Type == MetricHistogram && r.Field == "":
+		return fmt.Errorf("histogram %s needs a value or field", r.Name)
+	}
+
+	if r.Type == MetricHistogram {
+		if len(r.Buckets) == 0 {
+			r.Buckets = DefaultBuckets
+		}
+		if !sort.Float64sAreSorted(r.Buckets) {
+			return fmt.Errorf("histogram %s has unsorted buckets", r.Name)
+		}
+	}
+	return nil
+}
+
+type metricFile struct {
+	Metrics []*MetricRule `yaml:"metrics"`
+}
+
+// LoadMetricRules reads and compiles log to metric rules from a YAML file
+func LoadMetricRules(path string) ([]*MetricRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metric rules %w", err)
+	}
+
+	var file metricFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse metric rules %w", err)
+	}
+
+	names := make(map[string]bool, len(file.Metrics))
+	for _, rule := range file.Metrics {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate metric %s", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return file.Metrics, nil
+}
+
+// metricSeries is one label combination of a metric
+type metricSeries struct {
+	labels  []string
+	value   float64 //counter total or histogram sum
+	count   uint64
+	buckets []uint64 //observations at most each bound, not cumulative
+}
+
+// LogMetrics turns entries into counters and histograms, served in the
+// Prometheus text format and snapshotted for publishing. Entries pass
+// through unchanged.
+type LogMetrics struct {
+	rules []*MetricRule
+
+	mu     sync.Mutex
+	series []map[string]*metricSeries //per rule, keyed by label values
+}
+
+func NewLogMetrics(rules []*MetricRule) *LogMetrics {
+	m := &LogMetrics{rules: rules, series: make([]map[string]*metricSeries, len(rules))}
+	for i := range rules {
+		m.series[i] = make(map[string]*metricSeries)
+	}
+	return m
+}
+
+func (*LogMetrics) Name() string { return "logmetrics" }
+
+func (m *LogMetrics) Process(record *Record) error {
+	entry := record.Entry
+	for i, rule := range m.rules {
+		groups, ok := rule.matches(entry)
+		if !ok {
+			continue
+		}
+		value, ok := rule.value(entry, groups)
+		if !ok {
+			continue
+		}
+		labels := rule.labelValues(entry)
+		m.observe(i, labels, value)
+	}
+	return nil
+}
+
+func (m *LogMetrics) observe(i int, labels []string, value float64) {
+	rule := m.rules[i]
+	key := strings.Join(labels, "\x00")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[i][key]
+	if !ok {
+		if len(m.series[i]) >= maxMetricSeries {
+			return
+		}
+		s = &metricSeries{labels: labels}
+		if rule.Type == MetricHistogram {
+			s.buckets = make([]uint64, len(rule.Buckets))
+		}
+		m.series[i][key] = s
+	}
+
+	s.value += value
+	s.count++
+	if rule.Type == MetricHistogram {
+		if b := sort.SearchFloat64s(rule.Buckets, value); b < len(rule.Buckets) {
+			s.buckets[b]++
+		}
+	}
+}
+
+// MetricSample is the state of one series, as published to a metrics topic
+type MetricSample struct {
+	Time   time.Time         `json:"time"`
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	//Value is the counter total or the histogram sum
+	Value float64 `json:"value"`
+	Count uint64  `json:"count"`
+	//Buckets are cumulative counts keyed by upper bound, for histograms
+	Buckets map[string]uint64 `json:"buckets,omitempty"`
+}
+
+// Snapshot returns every series, ordered by metric and labels
+func (m *LogMetrics) Snapshot(now time.Time) []MetricSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var samples []MetricSample
+	for i, rule := range m.rules {
+		for _, s := range m.sorted(i) {
+			sample := MetricSample{Time: now, Name: rule.Name, Type: rule.Type, Value: s.value, Count: s.count}
+			if len(rule.Labels) > 0 {
+				sample.Labels = make(map[string]string, len(rule.Labels))
+				for j, label := range rule.Labels {
+					sample.Labels[label] = s.labels[j]
+				}
+			}
+			if rule.Type == MetricHistogram {
+				sample.Buckets = make(map[string]uint64, len(rule.Buckets)+1)
+				var cumulative uint64
+				for j, bound := range rule.Buckets {
+					cumulative += s.buckets[j]
+					sample.Buckets[formatFloat(bound)] = cumulative
+				}
+				sample.Buckets["+Inf"] = s.count
+			}
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// sorted returns the series of rule i ordered by labels, m.mu must be held
+func (m *LogMetrics) sorted(i int) []*metricSeries {
+	keys := make([]string, 0, len(m.series[i]))
+	for key := range m.series[i] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]*metricSeries, len(keys))
+	for j, key := range keys {
+		series[j] = m.series[i][key]
+	}
+	return series
+}
+
+// WritePrometheus writes every metric in the Prometheus text format
+func (m *LogMetrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	for i, rule := range m.rules {
+		if rule.Help != "" {
+			fmt.Fprintf(&b, "# HELP %s %s\n", rule.Name, helpEscaper.Replace(rule.Help))
+		}
+		fmt.Fprintf(&b, "# TYPE %s %s\n", rule.Name, rule.Type)
+		for _, s := range m.sorted(i) {
+			if rule.Type == MetricCounter {
+				fmt.Fprintf(&b, "%s%s %s\n", rule.Name, promLabels(rule.Labels, s.labels, ""), formatFloat(s.value))
+				continue
+			}
+			var cumulative uint64
+			for j, bound := range rule.Buckets {
+				cumulative += s.buckets[j]
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", rule.Name, promLabels(rule.Labels, s.labels, formatFloat(bound)), cumulative)
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", rule.Name, promLabels(rule.Labels, s.labels, "+Inf"), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", rule.Name, promLabels(rule.Labels, s.labels, ""), formatFloat(s.value))
+			fmt.Fprintf(&b, "%s_count%s %d\n", rule.Name, promLabels(rule.Labels, s.labels, ""), s.count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP serves the metrics for Prometheus to scrape
+func (m *LogMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WritePrometheus(w)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// promLabels formats a label set, with an le label for histogram buckets
+func promLabels(names, values []string, le string) string {
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
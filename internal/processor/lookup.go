@@ -0,0 +1,111 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Lookup returns the fields attached to entries of an application, such as
+// team, tier, owner and runbook_url. Unknown applications return nil.
+type Lookup interface {
+	Lookup(application string) (map[string]any, error)
+}
+
+// FileLookup serves fields from a YAML file mapping application names to fields
+type FileLookup map[string]map[string]any
+
+func LoadFileLookup(path string) (FileLookup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lookup file %w", err)
+	}
+	var lookup FileLookup
+	if err := yaml.Unmarshal(data, &lookup); err != nil {
+		return nil, fmt.Errorf("failed to parse lookup file %w", err)
+	}
+	return lookup, nil
+}
+
+func (l FileLookup) Lookup(application string) (map[string]any, error) {
+	return l[application], nil
+}
+
+// HTTPLookup fetches fields from a service returning a JSON object per
+// application. {app} in the URL is replaced by the application name. Results,
+// including misses, are cached for ttl so the service sees one request per
+// application per ttl.
+type HTTPLookup struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedLookup
+}
+
+type cachedLookup struct {
+	fields  map[string]any
+	expires time.Time
+}
+
+func NewHTTPLookup(url string, ttl time.Duration) *HTTPLookup {
+	return &HTTPLookup{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+		cache:  make(map[string]cachedLookup),
+	}
+}
+
+func (l *HTTPLookup) Lookup(application string) (map[string]any, error) {
+	l.mu.Lock()
+	cached, ok := l.cache[application]
+	l.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.fields, nil
+	}
+
+	fields, err := l.fetch(application)
+	if err != nil {
+		//serve stale fields rather than nothing while the service is down
+		if ok {
+			return cached.fields, err
+		}
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.cache[application] = cachedLookup{fields: fields, expires: time.Now().Add(l.ttl)}
+	l.mu.Unlock()
+	return fields, nil
+}
+
+func (l *HTTPLookup) fetch(application string) (map[string]any, error) {
+	target := strings.ReplaceAll(l.url, "{app}", url.PathEscape(application))
+	resp, err := l.client.Get(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lookup service %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("lookup service returned %s", resp.Status)
+	}
+
+	var fields map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&fields); err != nil {
+		return nil, fmt.Errorf("failed to decode lookup response %w", err)
+	}
+	return fields, nil
+}
@@ -0,0 +1,79 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Metrics counts what happened to the records seen by the stage
+type Metrics struct {
+	Consumed     atomic.Int64
+	Published    atomic.Int64
+	Dropped      atomic.Int64
+	DeadLettered atomic.Int64
+	Failed       atomic.Int64 //records that could not be published anywhere
+	Sampled      atomic.Int64 //dropped records that were sampled out
+	Deduplicated atomic.Int64 //dropped records repeating an earlier one
+	Salvaged     atomic.Int64 //malformed messages published as degraded entries
+	Committed    atomic.Int64 //transactions committed in transactional mode
+	Aborted      atomic.Int64 //transactions aborted, their records are processed again
+
+	redactions sync.Map //pattern name -> *atomic.Int64
+}
+
+// AddRedaction counts one masked value for pattern
+func (m *Metrics) AddRedaction(pattern string) {
+	counter, _ := m.redactions.LoadOrStore(pattern, new(atomic.Int64))
+	counter.(*atomic.Int64).Add(1)
+}
+
+// Redactions returns the number of masked values per pattern
+func (m *Metrics) Redactions() map[string]int64 {
+	counts := make(map[string]int64)
+	m.redactions.Range(func(key, value any) bool {
+		counts[key.(string)] = value.(*atomic.Int64).Load()
+		return true
+	})
+	return counts
+}
+
+func (m *Metrics) String() string {
+	s := fmt.Sprintf("consumed=%d published=%d dropped=%d dlq=%d failed=%d",
+		m.Consumed.Load(),
+		m.Published.Load(),
+		m.Dropped.Load(),
+		m.DeadLettered.Load(),
+		m.Failed.Load(),
+	)
+
+	if sampled := m.Sampled.Load(); sampled > 0 {
+		s += fmt.Sprintf(" sampled=%d", sampled)
+	}
+	if deduplicated := m.Deduplicated.Load(); deduplicated > 0 {
+		s += fmt.Sprintf(" deduplicated=%d", deduplicated)
+	}
+	if salvaged := m.Salvaged.Load(); salvaged > 0 {
+		s += fmt.Sprintf(" salvaged=%d", salvaged)
+	}
+	if committed, aborted := m.Committed.Load(), m.Aborted.Load(); committed > 0 || aborted > 0 {
+		s += fmt.Sprintf(" committed=%d aborted=%d", committed, aborted)
+	}
+
+	redactions := m.Redactions()
+	if len(redactions) == 0 {
+		return s
+	}
+	names := make([]string, 0, len(redactions))
+	for name := range redactions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s:%d", name, redactions[name]))
+	}
+	return s + " redactions=" + strings.Join(pairs, ",")
+}
@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metadata fields set on entries by the pattern processor
+const (
+	//MetadataPatternID identifies the pattern, entries of one pattern share it
+	MetadataPatternID = "pattern_id"
+	//MetadataPattern is the message with its variable words replaced by <*>
+	MetadataPattern = "pattern"
+)
+
+const (
+	//maxPatterns bounds the patterns learned, messages matching none of them
+	//past it get the template of their own message
+	maxPatterns = 10000
+	//patternPrefix is how many leading words, with the word count and
+	//application, pick the patterns a message is compared with
+	patternPrefix = 2
+	wildcard      = "<*>"
+)
+
+// Pattern groups messages into patterns such as "User <*> logged in", the
+// way Drain does: a message is compared with the known patterns of its
+// application having as many words and the same first words, joins the
+// most similar one when enough of its words match, turning the others
+// into <*>, and starts a pattern of its own otherwise. Entries get the
+// pattern and its id, so the most frequent ones can be counted downstream.
+type Pattern struct {
+	similarity float64
+
+	mu       sync.Mutex
+	groups   map[string][]*pattern
+	patterns int
+}
+
+type pattern struct {
+	tokens []string
+}
+
+// NewPattern returns a miner joining a message to a pattern when at least
+// similarity, between 0 and 1, of their words match
+func NewPattern(similarity float64) *Pattern {
+	return &Pattern{similarity: similarity, groups: make(map[string][]*pattern)}
+}
+
+func (*Pattern) Name() string { return "pattern" }
+
+func (p *Pattern) Process(record *Record) error {
+	entry := record.Entry
+	template := p.Match(entry.Application, entry.Message)
+	if template == "" {
+		return nil
+	}
+	entry.WithField(MetadataPatternID, PatternID(template)).WithField(MetadataPattern, template)
+	return nil
+}
+
+// Match returns the pattern of message, learning a new one or widening the
+// closest known pattern of the application
+func (p *Pattern) Match(application, message string) string {
+	tokens := strings.Fields(MessageTemplate(message))
+	if len(tokens) == 0 {
+		return ""
+	}
+	key := patternKey(application, tokens)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var best *pattern
+	bestScore := -1.0
+	for _, candidate := range p.groups[key] {
+		if score := similarity(candidate.tokens, tokens); score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	if best != nil && bestScore >= p.similarity {
+		for i, token := range tokens {
+			if best.tokens[i] != token {
+				best.tokens[i] = wildcard
+			}
+		}
+		return strings.Join(best.tokens, " ")
+	}
+
+	if p.patterns < maxPatterns {
+		p.groups[key] = append(p.groups[key], &pattern{tokens: tokens})
+		p.patterns++
+	}
+	return strings.Join(tokens, " ")
+}
+
+// patternKey picks the patterns a message can join
+func patternKey(application string, tokens []string) string {
+	prefix := tokens[:min(patternPrefix, len(tokens))]
+	return application + "\x00" + strconv.Itoa(len(tokens)) + "\x00" + strings.Join(prefix, " ")
+}
+
+// similarity is the share of words of the pattern equal to those of the
+// message, the wildcards don't count so widened patterns aren't favoured
+func similarity(pattern, tokens []string) float64 {
+	var same int
+	for i, token := range pattern {
+		if token != wildcard && token == tokens[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(pattern))
+}
+
+// PatternID is a short id of a pattern. It follows the template, so a
+// pattern widened by a later message gets a new one.
+func PatternID(template string) string {
+	h := fnv.New64a()
+	h.Write([]byte(template))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,62 @@
+// Package processor implements the stage between raw-logs and processed-logs:
+// an ordered chain of processors that validate, enrich, redact and route entries.
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"kafka-logging-system/internal/models"
+)
+
+// Topics written by the processing stage
+const (
+	DefaultOutputTopic = "processed-logs"
+	DefaultDLQTopic    = "raw-logs-dlq"
+)
+
+// ErrDrop is returned by a processor to discard an entry without treating it as a failure
+var ErrDrop = errors.New("entry dropped")
+
+// Record is an entry travelling through the chain together with its destinations
+type Record struct {
+	Entry *models.LogEntry
+	//Topics the entry is published to, the output topic when left empty
+	Topics []string
+}
+
+// Processor transforms a record in place. Returning ErrDrop discards the
+// record, any other error sends the original message to the dead letter queue.
+type Processor interface {
+	Name() string
+	Process(record *Record) error
+}
+
+// Chain runs processors in order, stopping at the first error
+type Chain []Processor
+
+// Process runs the chain, wrapping failures with the name of the processor
+func (c Chain) Process(record *Record) error {
+	for _, p := range c {
+		if err := p.Process(record); err != nil {
+			if errors.Is(err, ErrDrop) {
+				return err
+			}
+			return &Error{Processor: p.Name(), Err: err}
+		}
+	}
+	return nil
+}
+
+// Error reports which processor rejected a record
+type Error struct {
+	Processor string
+	Err       error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Processor, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
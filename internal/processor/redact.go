@@ -0,0 +1,186 @@
+package processor
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactPattern finds one kind of sensitive value. validate, when set,
+// confirms a regex match so look-alikes such as order numbers are left alone.
+type redactPattern struct {
+	name     string
+	re       *regexp.Regexp
+	validate func(match string) bool
+}
+
+var builtinPatterns = map[string]redactPattern{
+	"email": {
+		name: "email",
+		re:   regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	},
+	"credit_card": {
+		name:     "credit_card",
+		re:       regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		validate: luhn,
+	},
+	"ipv4": {
+		name: "ipv4",
+		re:   regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
+		validate: func(match string) bool {
+			return net.ParseIP(match) != nil
+		},
+	},
+	"ipv6": {
+		name: "ipv6",
+		re:   regexp.MustCompile(`\b[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}\b`),
+		validate: func(match string) bool {
+			ip := net.ParseIP(match)
+			return ip != nil && ip.To4() == nil
+		},
+	},
+}
+
+// RedactConfig selects what is masked. Allow lists, per metadata field (or
+// "message", "error_message" and "stack_trace"), the patterns that may
+// appear there unmasked.
+type RedactConfig struct {
+	Builtins []string            `yaml:"builtins"`
+	Patterns []CustomPattern     `yaml:"patterns"`
+	Allow    map[string][]string `yaml:"allow"`
+}
+
+type CustomPattern struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+// DefaultRedactConfig masks every built-in pattern everywhere
+func DefaultRedactConfig() RedactConfig {
+	return RedactConfig{Builtins: []string{"email", "credit_card", "ipv4", "ipv6"}}
+}
+
+// LoadRedactConfig reads a redaction config from a YAML file
+func LoadRedactConfig(path string) (RedactConfig, error) {
+	var cfg RedactConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read redaction config %w", err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse redaction config %w", err)
+	}
+	return cfg, nil
+}
+
+// Redact masks personal data in the message, error message, stack trace and
+// metadata before entries are persisted or displayed, counting redactions
+// per pattern in Metrics
+type Redact struct {
+	patterns []redactPattern
+	allow    map[string][]string
+	metrics  *Metrics
+}
+
+func NewRedact(cfg RedactConfig, metrics *Metrics) (*Redact, error) {
+	r := &Redact{allow: cfg.Allow, metrics: metrics}
+	for _, name := range cfg.Builtins {
+		pattern, ok := builtinPatterns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction pattern %q", name)
+		}
+		r.patterns = append(r.patterns, pattern)
+	}
+	for _, custom := range cfg.Patterns {
+		re, err := regexp.Compile(custom.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %s %w", custom.Name, err)
+		}
+		r.patterns = append(r.patterns, redactPattern{name: custom.Name, re: re})
+	}
+	return r, nil
+}
+
+func (*Redact) Name() string { return "redact" }
+
+func (r *Redact) Process(record *Record) error {
+	entry := record.Entry
+	entry.Message = r.redactString("message", entry.Message)
+	entry.ErrorMessage = r.redactString("error_message", entry.ErrorMessage)
+	entry.StackTrace = r.redactString("stack_trace", entry.StackTrace)
+	for key, value := range entry.Metadata {
+		entry.Metadata[key] = r.redactValue(key, value)
+	}
+	return nil
+}
+
+func (r *Redact) redactValue(field string, value any) any {
+	switch v := value.(type) {
+	case string:
+		return r.redactString(field, v)
+	case map[string]any:
+		for key, nested := range v {
+			v[key] = r.redactValue(field+"."+key, nested)
+		}
+		return v
+	case []any:
+		for i, nested := range v {
+			v[i] = r.redactValue(field, nested)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+func (r *Redact) redactString(field, s string) string {
+	allowed := r.allow[field]
+	for _, pattern := range r.patterns {
+		if slices.Contains(allowed, pattern.name) {
+			continue
+		}
+		s = pattern.re.ReplaceAllStringFunc(s, func(match string) string {
+			if pattern.validate != nil && !pattern.validate(match) {
+				return match
+			}
+			if r.metrics != nil {
+				r.metrics.AddRedaction(pattern.name)
+			}
+			return "[REDACTED:" + pattern.name + "]"
+		})
+	}
+	return s
+}
+
+// luhn reports whether the digits in s pass the card number checksum
+func luhn(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,149 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"kafka-logging-system/internal/models"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RouteRule sends matching entries to topics or drops them. Every condition
+// that is set must match; an empty rule matches everything.
+type RouteRule struct {
+	Name         string            `yaml:"name"`
+	Levels       []models.LogLevel `yaml:"levels"`
+	Applications []string          `yaml:"applications"`
+	//Message is a regular expression matched against the message
+	Message string   `yaml:"message"`
+	Topics  []string `yaml:"topics"`
+	Drop    bool     `yaml:"drop"`
+
+	message *regexp.Regexp
+}
+
+func (r *RouteRule) matches(entry *models.LogEntry) bool {
+	if len(r.Levels) > 0 && !slices.Contains(r.Levels, entry.Level) {
+		return false
+	}
+	if len(r.Applications) > 0 && !slices.Contains(r.Applications, entry.Application) {
+		return false
+	}
+	if r.message != nil && !r.message.MatchString(entry.Message) {
+		return false
+	}
+	return true
+}
+
+type routeFile struct {
+	Rules []*RouteRule `yaml:"rules"`
+}
+
+// LoadRoutes reads and compiles routing rules from a YAML file
+func LoadRoutes(path string) ([]*RouteRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routes %w", err)
+	}
+
+	var file routeFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse routes %w", err)
+	}
+
+	for i, rule := range file.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if !rule.Drop && len(rule.Topics) == 0 {
+			return nil, fmt.Errorf("route %s needs topics or drop", rule.Name)
+		}
+		if rule.Message != "" {
+			if rule.message, err = regexp.Compile(rule.Message); err != nil {
+				return nil, fmt.Errorf("route %s has invalid message pattern %w", rule.Name, err)
+			}
+		}
+	}
+	return file.Rules, nil
+}
+
+// Router applies routing rules in order. Topics from every matching rule are
+// collected; a matching drop rule discards the entry. Entries no rule routes
+// go to the output topic. Rules are reloaded when the file changes.
+type Router struct {
+	path    string
+	rules   atomic.Pointer[[]*RouteRule]
+	modTime time.Time
+}
+
+// NewRouter loads the rules at path
+func NewRouter(path string) (*Router, error) {
+	r := &Router{path: path}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (*Router) Name() string { return "route" }
+
+func (r *Router) Process(record *Record) error {
+	for _, rule := range *r.rules.Load() {
+		if !rule.matches(record.Entry) {
+			continue
+		}
+		if rule.Drop {
+			return ErrDrop
+		}
+		for _, topic := range rule.Topics {
+			if !slices.Contains(record.Topics, topic) {
+				record.Topics = append(record.Topics, topic)
+			}
+		}
+	}
+	return nil
+}
+
+// Watch reloads the rules whenever the file changes until ctx is done. A
+// file that fails to load is reported and the previous rules stay active.
+func (r *Router) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(r.path)
+			if err != nil || info.ModTime().Equal(r.modTime) {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				slog.Error("Error reloading routes, keeping previous rules", "err", err)
+				continue
+			}
+			slog.Info("Reloaded routes", "routes", len(*r.rules.Load()), "path", r.path)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *Router) reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return fmt.Errorf("failed to read routes %w", err)
+	}
+	rules, err := LoadRoutes(r.path)
+	if err != nil {
+		return err
+	}
+	r.rules.Store(&rules)
+	r.modTime = info.ModTime()
+	return nil
+}
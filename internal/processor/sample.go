@@ -0,0 +1,94 @@
+package processor
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	"kafka-logging-system/internal/models"
+)
+
+// Metadata fields set on entries kept by the sample processor
+const (
+	//MetadataSampleRate is N when 1 in N entries of the kind are kept
+	MetadataSampleRate = "sample_rate"
+	//MetadataSampledOut counts the entries of the kind dropped since the
+	//previous one kept
+	MetadataSampledOut = "sampled_out"
+)
+
+// maxSampleKeys bounds the kinds of entries counted at once. Past it the
+// counts start over, so a flood of unique messages can't grow the map.
+const maxSampleKeys = 10000
+
+// Sample keeps 1 in Rate DEBUG, INFO and TRACE entries of each kind, an
+// application and message template, and passes WARN and above untouched.
+// Kept entries record the rate and how many were dropped before them, so
+// counts downstream can be scaled back up.
+type Sample struct {
+	rate    int
+	metrics *Metrics
+
+	mu   sync.Mutex
+	seen map[sampleKey]int //entries of the kind since the last one kept
+}
+
+type sampleKey struct {
+	application string
+	template    string
+}
+
+// NewSample returns a sampler keeping 1 in rate entries of each kind,
+// metrics may be nil
+func NewSample(rate int, metrics *Metrics) *Sample {
+	return &Sample{rate: max(rate, 1), metrics: metrics, seen: make(map[sampleKey]int)}
+}
+
+func (*Sample) Name() string { return "sample" }
+
+func (s *Sample) Process(record *Record) error {
+	entry := record.Entry
+	if entry.Level.Severity() >= models.WARN.Severity() || s.rate == 1 {
+		return nil
+	}
+	key := sampleKey{application: entry.Application, template: MessageTemplate(entry.Message)}
+
+	s.mu.Lock()
+	if len(s.seen) >= maxSampleKeys {
+		clear(s.seen)
+	}
+	//the first entry of a kind is kept, so rare messages always get through
+	skipped, counted := s.seen[key]
+	keep := !counted || skipped+1 >= s.rate
+	if keep {
+		s.seen[key] = 0
+	} else {
+		s.seen[key] = skipped + 1
+	}
+	s.mu.Unlock()
+
+	if !keep {
+		if s.metrics != nil {
+			s.metrics.Sampled.Add(1)
+		}
+		return ErrDrop
+	}
+	entry.WithField(MetadataSampleRate, s.rate)
+	if skipped > 0 {
+		entry.WithField(MetadataSampledOut, skipped)
+	}
+	return nil
+}
+
+// MessageTemplate replaces the variable words of a message, those holding
+// a digit such as ids, counts, durations and addresses, with <*>. Messages
+// logged by the same statement share a template.
+func MessageTemplate(message string) string {
+	words := strings.Fields(message)
+	for i, word := range words {
+		if strings.ContainsFunc(word, unicode.IsDigit) {
+			words[i] = "<*>"
+		}
+	}
+	return strings.Join(words, " ")
+}
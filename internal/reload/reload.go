@@ -0,0 +1,215 @@
+// Package reload changes the settings of a running program, so a consumer
+// keeps its partitions instead of restarting and triggering a rebalance.
+// SIGHUP re-reads a YAML file and POST /admin/config applies a JSON body.
+package reload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"kafka-logging-system/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxBody bounds the JSON accepted by POST /admin/config
+const maxBody = 64 * 1024
+
+// Settings can change while running. Fields missing from the file or a
+// request keep their value.
+type Settings struct {
+	//LogLevel is the least severe operational log written
+	LogLevel slog.Level `yaml:"log_level" json:"log_level"`
+	//MinLevel is the least severe entry producers publish, empty or TRACE
+	//publishes every level
+	MinLevel models.LogLevel `yaml:"min_level,omitempty" json:"min_level,omitempty"`
+	//Filters select the entries consumers display
+	Filters Filters `yaml:"filters" json:"filters"`
+}
+
+// Filters select displayed entries, an empty value matches everything
+type Filters struct {
+	TraceID     string             `yaml:"trace_id" json:"trace_id"`
+	Host        string             `yaml:"host" json:"host"`
+	Environment models.Environment `yaml:"env" json:"env"`
+}
+
+// Validate rejects values that would never match or publish anything
+func (s Settings) Validate() error {
+	if s.Filters.Environment != "" && !s.Filters.Environment.Valid() {
+		return fmt.Errorf("unknown environment %q, expected dev, stage or prod", s.Filters.Environment)
+	}
+	return nil
+}
+
+// Config says where changed settings come from
+type Config struct {
+	//File is read at start and again on SIGHUP, empty ignores the signal
+	File string
+	//Addr serves GET and POST /admin/config, empty disables it
+	Addr string
+	//Register adds the program's own endpoints to the admin server
+	Register func(mux *http.ServeMux)
+}
+
+// RegisterFlags binds the settings to flags
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.File, "runtime-config", c.File, "YAML file of log_level, min_level and filters, re-read on SIGHUP")
+	fs.StringVar(&c.Addr, "admin-addr", c.Addr, "address serving GET and POST /admin/config, empty to disable")
+}
+
+// Watcher holds the current settings and applies changes to them
+type Watcher struct {
+	file    string
+	initial Settings
+	apply   func(Settings)
+
+	//mu orders changes, so apply sees them one at a time
+	mu      sync.Mutex
+	current Settings
+}
+
+// Start applies the settings of cfg.File over initial, which come from
+// flags, then again on every SIGHUP and POST /admin/config until ctx is
+// done. apply is called with the settings after every change.
+func Start(ctx context.Context, cfg Config, initial Settings, apply func(Settings)) (*Watcher, error) {
+	w := &Watcher{file: cfg.File, initial: initial, apply: apply}
+	if err := w.set(initial); err != nil {
+		return nil, err
+	}
+
+	if cfg.File != "" {
+		if err := w.Reload(); err != nil {
+			return nil, err
+		}
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			defer signal.Stop(hup)
+			for {
+				select {
+				case <-hup:
+					if err := w.Reload(); err != nil {
+						slog.Error("Error reloading settings, keeping the current ones", "file", cfg.File, "err", err)
+						continue
+					}
+					slog.Info("Reloaded settings", "file", cfg.File)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	if cfg.Addr != "" {
+		listener, err := net.Listen("tcp", cfg.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen for admin requests %w", err)
+		}
+		mux := http.NewServeMux()
+		w.Register(mux)
+		if cfg.Register != nil {
+			cfg.Register(mux)
+		}
+		server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Error from admin server", "err", err)
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			server.Close()
+		}()
+		slog.Info("Serving runtime settings", "url", "http://"+listener.Addr().String()+"/admin/config")
+	}
+	return w, nil
+}
+
+// Current returns the settings in effect
+func (w *Watcher) Current() Settings {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.current
+}
+
+// Reload reads the file again. Its fields apply over the initial settings,
+// so removing one from the file restores the value given by flags.
+func (w *Watcher) Reload() error {
+	data, err := os.ReadFile(w.file)
+	if err != nil {
+		return fmt.Errorf("failed to read runtime config %w", err)
+	}
+	settings := w.initial
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), &settings); err != nil {
+		return fmt.Errorf("failed to parse runtime config %s %w", w.file, err)
+	}
+	return w.set(settings)
+}
+
+// Update applies the fields of a JSON object over the current settings
+func (w *Watcher) Update(data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	settings := w.current
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("failed to parse settings %w", err)
+	}
+	return w.setLocked(settings)
+}
+
+func (w *Watcher) set(settings Settings) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.setLocked(settings)
+}
+
+func (w *Watcher) setLocked(settings Settings) error {
+	if err := settings.Validate(); err != nil {
+		return err
+	}
+	w.current = settings
+	w.apply(settings)
+	return nil
+}
+
+// Register serves the settings on mux, GET returns them and POST applies
+// the fields of its JSON body
+func (w *Watcher) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/config", func(rw http.ResponseWriter, _ *http.Request) {
+		writeJSON(rw, http.StatusOK, w.Current())
+	})
+	mux.HandleFunc("POST /admin/config", func(rw http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxBody))
+		if err != nil {
+			writeJSON(rw, http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+			return
+		}
+		if err := w.Update(data); err != nil {
+			writeJSON(rw, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		slog.Info("Settings changed", "remote", r.RemoteAddr)
+		writeJSON(rw, http.StatusOK, w.Current())
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error writing response", "err", err)
+	}
+}
@@ -0,0 +1,153 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"kafka-logging-system/internal/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Formats a report can be written in
+const (
+	FormatJSON     = "json"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// Write renders the report in format
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case FormatMarkdown:
+		_, err := io.WriteString(w, r.Markdown())
+		return err
+	case FormatHTML:
+		return htmlReport.Execute(w, r)
+	}
+	return fmt.Errorf("unknown report format %q, expected json, markdown or html", format)
+}
+
+// Markdown renders the report as a Markdown document
+func (r *Report) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Log report for %s\n\n", r.Day)
+	fmt.Fprintf(&b, "%d entries from %d applications (%s).\n\n", r.Total, len(r.Applications), r.Location)
+
+	b.WriteString("| Application | Total | vs last week |")
+	for _, level := range models.Levels {
+		fmt.Fprintf(&b, " %s |", level)
+	}
+	b.WriteString(" Error rate |\n|---|---:|---:|")
+	b.WriteString(strings.Repeat("---:|", len(models.Levels)))
+	b.WriteString("---:|\n")
+	for _, a := range r.Applications {
+		fmt.Fprintf(&b, "| %s | %d | %s |", markdownEscaper.Replace(a.Name), a.Total, formatChange(a.Change))
+		for _, level := range models.Levels {
+			fmt.Fprintf(&b, " %d (%+d) |", a.Counts[level], a.LevelChange(level))
+		}
+		fmt.Fprintf(&b, " %.1f%% |\n", a.ErrorRate*100)
+	}
+
+	for _, a := range r.Applications {
+		fmt.Fprintf(&b, "\n## %s\n\n", a.Name)
+		if len(a.BusiestHours) > 0 {
+			hours := make([]string, len(a.BusiestHours))
+			for i, h := range a.BusiestHours {
+				hours[i] = fmt.Sprintf("%02d:00 (%d)", h.Hour, h.Count)
+			}
+			fmt.Fprintf(&b, "Busiest hours: %s\n\n", strings.Join(hours, ", "))
+		}
+		if len(a.TopErrors) == 0 {
+			b.WriteString("No errors.\n")
+			continue
+		}
+		b.WriteString("Top errors:\n\n")
+		for _, m := range a.TopErrors {
+			fmt.Fprintf(&b, "- %d × `%s`\n", m.Count, strings.ReplaceAll(m.Message, "`", "'"))
+		}
+	}
+	return b.String()
+}
+
+var markdownEscaper = strings.NewReplacer("|", `\|`)
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"levels":  func() []models.LogLevel { return models.Levels },
+	"change":  formatChange,
+	"percent": func(f float64) string { return fmt.Sprintf("%.1f%%", f*100) },
+	"hour":    func(h int) string { return fmt.Sprintf("%02d:00", h) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Log report for {{.Day}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.delta { color: #888; font-size: smaller; }
+code { background: #f4f4f4; }
+</style>
+</head>
+<body>
+<h1>Log report for {{.Day}}</h1>
+<p>{{.Total}} entries from {{len .Applications}} applications ({{.Location}}).</p>
+<table>
+<tr><th>Application</th><th>Total</th><th>vs last week</th>{{range levels}}<th>{{.}}</th>{{end}}<th>Error rate</th></tr>
+{{range $app := .Applications}}<tr><td>{{.Name}}</td><td>{{.Total}}</td><td>{{change .Change}}</td>{{range levels}}<td>{{index $app.Counts .}} <span class="delta">{{printf "%+d" ($app.LevelChange .)}}</span></td>{{end}}<td>{{percent .ErrorRate}}</td></tr>
+{{end}}</table>
+{{range .Applications}}
+<h2>{{.Name}}</h2>
+{{with .BusiestHours}}<p>Busiest hours: {{range $i, $h := .}}{{if $i}}, {{end}}{{hour $h.Hour}} ({{$h.Count}}){{end}}</p>{{end}}
+{{if .TopErrors}}<p>Top errors:</p>
+<ul>{{range .TopErrors}}<li>{{.Count}} × <code>{{.Message}}</code></li>{{end}}</ul>
+{{else}}<p>No errors.</p>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// PostSlack posts the overview of the report to a Slack incoming webhook
+func (r *Report) PostSlack(ctx context.Context, webhookURL string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Log report for %s*: %d entries from %d applications\n", r.Day, r.Total, len(r.Applications))
+	for _, a := range r.Applications {
+		fmt.Fprintf(&b, "• *%s*: %d (%s vs last week), %d errors, error rate %.1f%%",
+			a.Name, a.Total, formatChange(a.Change), a.Counts[models.ERROR]+a.Counts[models.FATAL], a.ErrorRate*100)
+		if len(a.TopErrors) > 0 {
+			fmt.Fprintf(&b, ", top: `%s`", strings.ReplaceAll(a.TopErrors[0].Message, "`", "'"))
+		}
+		b.WriteString("\n")
+	}
+
+	body, err := json.Marshal(map[string]string{"text": b.String()})
+	if err != nil {
+		return fmt.Errorf("failed to encode slack message %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to slack %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Package report summarises a day of stored logs per application, with the
+// change from the same day a week earlier, for daily reports.
+package report
+
+import (
+	"context"
+	"fmt"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/store"
+	"sort"
+	"time"
+)
+
+// busiestHours is how many hours each application lists
+const busiestHours = 3
+
+// Report is the summary of one day
+type Report struct {
+	Day          string        `json:"day"` //YYYY-MM-DD in Location
+	Location     string        `json:"location"`
+	From         time.Time     `json:"from"`
+	To           time.Time     `json:"to"`
+	Generated    time.Time     `json:"generated"`
+	Total        int64         `json:"total"`
+	Applications []Application `json:"applications"`
+}
+
+// Application is the summary of one application on the day
+type Application struct {
+	Name   string                    `json:"name"`
+	Total  int64                     `json:"total"`
+	Counts map[models.LogLevel]int64 `json:"counts"`
+	//ErrorRate is the share of ERROR and FATAL entries
+	ErrorRate float64 `json:"error_rate"`
+	//LastWeek are the counts of the same day a week earlier
+	LastWeek      map[models.LogLevel]int64 `json:"last_week"`
+	LastWeekTotal int64                     `json:"last_week_total"`
+	//Change is the relative change of the total from a week earlier, nil
+	//when the application logged nothing then
+	Change       *float64             `json:"change,omitempty"`
+	BusiestHours []HourCount          `json:"busiest_hours"`
+	TopErrors    []store.MessageCount `json:"top_errors"`
+	Hourly       [24]int64            `json:"hourly"`
+}
+
+// HourCount is the volume of one hour of the day, 0 to 23 in the report location
+type HourCount struct {
+	Hour  int   `json:"hour"`
+	Count int64 `json:"count"`
+}
+
+// LevelChange returns the change of a level from a week earlier, as a
+// signed count
+func (a Application) LevelChange(level models.LogLevel) int64 {
+	return a.Counts[level] - a.LastWeek[level]
+}
+
+// Build summarises the day in loc starting at day's midnight, listing the
+// topN most frequent ERROR and FATAL messages of each application
+func Build(ctx context.Context, st store.Store, day time.Time, loc *time.Location, topN int) (*Report, error) {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	to := from.AddDate(0, 0, 1)
+	report := &Report{
+		Day:       from.Format(time.DateOnly),
+		Location:  loc.String(),
+		From:      from,
+		To:        to,
+		Generated: time.Now(),
+	}
+
+	apps := make(map[string]*Application)
+	app := func(name string) *Application {
+		a, ok := apps[name]
+		if !ok {
+			a = &Application{Name: name, Counts: make(map[models.LogLevel]int64), LastWeek: make(map[models.LogLevel]int64)}
+			apps[name] = a
+		}
+		return a
+	}
+
+	//hourly buckets are aligned to UTC, fine for every zone a whole hour off it
+	counts, err := st.Counts(ctx, from, to, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range counts {
+		a := app(c.Application)
+		a.Counts[c.Level] += c.Count
+		a.Total += c.Count
+		a.Hourly[c.Bucket.In(loc).Hour()] += c.Count
+		report.Total += c.Count
+	}
+
+	lastWeek, err := st.Counts(ctx, from.AddDate(0, 0, -7), to.AddDate(0, 0, -7), 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range lastWeek {
+		a := app(c.Application)
+		a.LastWeek[c.Level] += c.Count
+		a.LastWeekTotal += c.Count
+	}
+
+	topErrors, err := st.TopMessages(ctx, from, to, []models.LogLevel{models.ERROR, models.FATAL}, topN)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range topErrors {
+		a := app(m.Application)
+		a.TopErrors = append(a.TopErrors, m)
+	}
+
+	names := make([]string, 0, len(apps))
+	for name := range apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		a := apps[name]
+		if a.Total > 0 {
+			a.ErrorRate = float64(a.Counts[models.ERROR]+a.Counts[models.FATAL]) / float64(a.Total)
+		}
+		if a.LastWeekTotal > 0 {
+			change := float64(a.Total-a.LastWeekTotal) / float64(a.LastWeekTotal)
+			a.Change = &change
+		}
+		a.BusiestHours = busiest(a.Hourly)
+		report.Applications = append(report.Applications, *a)
+	}
+	return report, nil
+}
+
+// busiest returns the hours with the most entries, most first
+func busiest(hourly [24]int64) []HourCount {
+	hours := make([]HourCount, 0, 24)
+	for hour, count := range hourly {
+		if count > 0 {
+			hours = append(hours, HourCount{Hour: hour, Count: count})
+		}
+	}
+	sort.SliceStable(hours, func(i, j int) bool { return hours[i].Count > hours[j].Count })
+	if len(hours) > busiestHours {
+		hours = hours[:busiestHours]
+	}
+	return hours
+}
+
+// formatChange formats a relative change such as +12.5% or new
+func formatChange(change *float64) string {
+	if change == nil {
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", *change*100)
+}
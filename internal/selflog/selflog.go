@@ -0,0 +1,233 @@
+// Package selflog sets up the operational logs of the services themselves.
+// They are written to stderr as text or JSON, and can also be shipped to a
+// Kafka topic so the logging system collects its own logs.
+package selflog
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/pkg/producer"
+	"kafka-logging-system/pkg/sloghandler"
+)
+
+// Output formats of stderr logs
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// queueSize bounds the records waiting to be shipped, more are dropped so a
+// slow or unreachable Kafka never blocks the service
+const queueSize = 1024
+
+// level is the least severe record written, SetLevel changes it while running
+var level slog.LevelVar
+
+// flush ships the queued records and closes the log producer, Fatal calls
+// it so the fatal record reaches Kafka too
+var flush atomic.Pointer[func()]
+
+// Config says how and where the service logs
+type Config struct {
+	Level  slog.Level
+	Format string
+	//Topic also ships records to Kafka when set. It can't be a topic the
+	//service consumes, or logs about a message would be consumed and logged
+	//about again.
+	Topic string
+}
+
+// Default returns the settings used without flags
+func Default() Config {
+	return Config{Level: slog.LevelInfo, Format: FormatText}
+}
+
+// RegisterFlags binds the settings to flags
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.TextVar(&c.Level, "log-level", c.Level, "least severe operational log written: debug, info, warn or error")
+	fs.StringVar(&c.Format, "log-format", c.Format, "format of operational logs on stderr: text or json")
+	fs.StringVar(&c.Topic, "log-topic", c.Topic, "also ship operational logs to this Kafka topic")
+}
+
+// Setup installs the default slog logger of service, which the standard log
+// package writes through as well. consumed lists the topics the service
+// reads, which logs can't be shipped to. The returned function ships the
+// records still queued and must be called before exiting.
+func Setup(cfg Config, service string, kafka kafkaconfig.Config, consumed ...string) (func(), error) {
+	if slices.Contains(consumed, cfg.Topic) && cfg.Topic != "" {
+		return nil, fmt.Errorf("logs can't be shipped to %s, which the service consumes", cfg.Topic)
+	}
+
+	level.Set(cfg.Level)
+	opts := &slog.HandlerOptions{Level: &level}
+	var stderr slog.Handler
+	switch cfg.Format {
+	case FormatText:
+		stderr = slog.NewTextHandler(os.Stderr, opts)
+	case FormatJSON:
+		stderr = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected text or json", cfg.Format)
+	}
+	stderr = stderr.WithAttrs([]slog.Attr{slog.String("service", service)})
+	if cfg.Topic == "" {
+		slog.SetDefault(slog.New(stderr))
+		return func() {}, nil
+	}
+
+	//the producer shipping the records logs to stderr only, so its own
+	//failures can't be shipped through it again
+	producerConfig := producer.DefaultConfig()
+	producerConfig.Kafka = kafka
+	producerConfig.Topic = cfg.Topic
+	producerConfig.Logger = slog.New(stderr)
+	p, err := producer.New(producerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log producer %w", err)
+	}
+
+	ship := &shipper{
+		stderr:  stderr,
+		records: make(chan queued, queueSize),
+		done:    make(chan struct{}),
+	}
+	go ship.run()
+	slog.SetDefault(slog.New(&tee{
+		stderr:  stderr,
+		ship:    sloghandler.New(p, sloghandler.Options{Application: service, Level: &level}),
+		shipper: ship,
+	}))
+
+	var once sync.Once
+	closeLogs := func() {
+		once.Do(func() {
+			//records logged while closing are written to stderr only
+			slog.SetDefault(slog.New(stderr))
+			ship.close()
+			if err := p.Close(); err != nil {
+				slog.Error("Error closing log producer", "err", err)
+			}
+		})
+	}
+	flush.Store(&closeLogs)
+	return closeLogs, nil
+}
+
+// SetLevel changes the least severe record written and shipped, without
+// restarting the service
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// Fatal logs an error and exits, like log.Fatal. Shipped logs are flushed
+// first.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	if closeLogs := flush.Load(); closeLogs != nil {
+		(*closeLogs)()
+	}
+	os.Exit(1)
+}
+
+// queued is a record waiting to be shipped by the handler of its logger
+type queued struct {
+	handler slog.Handler
+	record  slog.Record
+	//stack is where an error record was logged, captured before queueing
+	stack string
+}
+
+// shipper publishes queued records from one goroutine
+type shipper struct {
+	stderr  slog.Handler
+	records chan queued
+	done    chan struct{}
+	dropped atomic.Int64
+
+	//mu keeps records from being queued once the queue is closed
+	mu     sync.RWMutex
+	closed bool
+}
+
+// close stops queueing and waits for the queued records to be shipped
+func (s *shipper) close() {
+	s.mu.Lock()
+	s.closed = true
+	close(s.records)
+	s.mu.Unlock()
+	<-s.done
+}
+
+func (s *shipper) run() {
+	defer close(s.done)
+	failing := false
+	for q := range s.records {
+		err := q.handler.Handle(sloghandler.WithStack(context.Background(), q.stack), q.record)
+		//one line when shipping starts and stops failing, not one per record
+		if err != nil && !failing {
+			s.warn("Error shipping logs to Kafka, they are only written to stderr", "err", err)
+		} else if err == nil && failing {
+			s.warn("Shipping logs to Kafka again", "dropped", s.dropped.Swap(0))
+		}
+		failing = err != nil
+	}
+}
+
+func (s *shipper) enqueue(handler slog.Handler, record slog.Record, stack string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.records <- queued{handler: handler, record: record.Clone(), stack: stack}:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// warn writes to stderr only, records about shipping are never shipped
+func (s *shipper) warn(msg string, args ...any) {
+	record := slog.NewRecord(time.Now(), slog.LevelWarn, msg, 0)
+	record.Add(args...)
+	s.stderr.Handle(context.Background(), record)
+}
+
+// tee writes records to stderr and queues them for shipping
+type tee struct {
+	stderr  slog.Handler
+	ship    slog.Handler
+	shipper *shipper
+}
+
+func (t *tee) Enabled(ctx context.Context, level slog.Level) bool {
+	return t.stderr.Enabled(ctx, level)
+}
+
+func (t *tee) Handle(ctx context.Context, record slog.Record) error {
+	//the stack is taken here, shipping happens on another goroutine
+	var stack string
+	if record.Level >= slog.LevelError {
+		stack = models.CallerStack("log/slog.", "kafka-logging-system/internal/selflog.")
+	}
+	t.shipper.enqueue(t.ship, record, stack)
+	return t.stderr.Handle(ctx, record)
+}
+
+func (t *tee) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &tee{stderr: t.stderr.WithAttrs(attrs), ship: t.ship.WithAttrs(attrs), shipper: t.shipper}
+}
+
+func (t *tee) WithGroup(name string) slog.Handler {
+	return &tee{stderr: t.stderr.WithGroup(name), ship: t.ship.WithGroup(name), shipper: t.shipper}
+}
@@ -0,0 +1,239 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"kafka-logging-system/internal/models"
+)
+
+const (
+	//azureMaxBytes keeps requests below the Logs Ingestion API's 1MB limit
+	azureMaxBytes    = 1000000
+	azureAPIVersion  = "2023-01-01"
+	azureMonitorAuth = "https://monitor.azure.com"
+	//azureIMDS hands out managed identity tokens on Azure VMs and AKS nodes
+	azureIMDS = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+type AzureConfig struct {
+	//Endpoint is the data collection endpoint, such as
+	//https://my-dce-abcd.westeurope-1.ingest.monitor.azure.com
+	Endpoint string `yaml:"endpoint"`
+	//RuleID is the immutable id of the data collection rule, dcr-...
+	RuleID string `yaml:"rule_id"`
+	//Stream is the rule's input stream, such as Custom-KafkaLogs_CL
+	Stream string `yaml:"stream"`
+	//TenantID, ClientID and ClientSecret authenticate as an app
+	//registration. Without a secret the managed identity of the host is
+	//used, ClientID then picks a user-assigned identity.
+	TenantID     string `yaml:"tenant_id"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	//Retries of throttled or failed requests, defaults to 5
+	Retries int `yaml:"retries"`
+}
+
+// Azure sends entries to a Log Analytics workspace through the Logs
+// Ingestion API of Azure Monitor
+type Azure struct {
+	cfg    AzureConfig
+	url    string
+	client *http.Client
+}
+
+func NewAzure(ctx context.Context, cfg AzureConfig) (*Azure, error) {
+	if cfg.Endpoint == "" || cfg.RuleID == "" || cfg.Stream == "" {
+		return nil, errors.New("azure sink needs an endpoint, rule_id and stream")
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = 5
+	}
+
+	var tokens oauth2.TokenSource
+	if cfg.ClientSecret != "" {
+		if cfg.TenantID == "" || cfg.ClientID == "" {
+			return nil, errors.New("azure sink needs a tenant_id and client_id with a client_secret")
+		}
+		tokens = (&clientcredentials.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			TokenURL:     "https://login.microsoftonline.com/" + url.PathEscape(cfg.TenantID) + "/oauth2/v2.0/token",
+			Scopes:       []string{azureMonitorAuth + "/.default"},
+		}).TokenSource(ctx)
+	} else {
+		tokens = oauth2.ReuseTokenSource(nil, &managedIdentity{
+			clientID: cfg.ClientID,
+			client:   &http.Client{Timeout: 10 * time.Second},
+		})
+	}
+
+	client := oauth2.NewClient(ctx, tokens)
+	client.Timeout = 30 * time.Second
+	return &Azure{
+		cfg:    cfg,
+		url:    strings.TrimRight(cfg.Endpoint, "/") + "/dataCollectionRules/" + url.PathEscape(cfg.RuleID) + "/streams/" + url.PathEscape(cfg.Stream) + "?api-version=" + azureAPIVersion,
+		client: client,
+	}, nil
+}
+
+// azureRecord is a row of the rule's stream. The rule maps these columns
+// to the table, see the README for its declaration.
+type azureRecord struct {
+	TimeGenerated string          `json:"TimeGenerated"`
+	Application   string          `json:"Application"`
+	Level         models.LogLevel `json:"Level"`
+	SeverityLevel int             `json:"SeverityLevel"`
+	Message       string          `json:"Message"`
+	Hostname      string          `json:"Hostname,omitempty"`
+	Environment   string          `json:"Environment,omitempty"`
+	TraceID       string          `json:"TraceId,omitempty"`
+	SpanID        string          `json:"SpanId,omitempty"`
+	RequestID     string          `json:"RequestId,omitempty"`
+	PID           int             `json:"Pid,omitempty"`
+	Properties    map[string]any  `json:"Properties,omitempty"`
+	ErrorType     string          `json:"ErrorType,omitempty"`
+	ErrorMessage  string          `json:"ErrorMessage,omitempty"`
+	StackTrace    string          `json:"StackTrace,omitempty"`
+}
+
+func (a *Azure) Write(ctx context.Context, entries []*models.LogEntry) error {
+	var body bytes.Buffer
+	for _, entry := range entries {
+		data, err := json.Marshal(azureRecord{
+			TimeGenerated: entry.Timestamp.UTC().Format(time.RFC3339Nano),
+			Application:   entry.Application,
+			Level:         entry.Level,
+			SeverityLevel: azureSeverity(entry.Level),
+			Message:       entry.Message,
+			Hostname:      entry.Hostname,
+			Environment:   string(entry.Environment),
+			TraceID:       entry.TraceID,
+			SpanID:        entry.SpanID,
+			RequestID:     entry.RequestID,
+			PID:           entry.PID,
+			Properties:    entry.Metadata,
+			ErrorType:     entry.ErrorType,
+			ErrorMessage:  entry.ErrorMessage,
+			StackTrace:    entry.StackTrace,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode azure record %w", err)
+		}
+		if body.Len() > 0 && body.Len()+len(data)+2 > azureMaxBytes {
+			if err := a.send(ctx, body.Bytes()); err != nil {
+				return err
+			}
+			body.Reset()
+		}
+		if body.Len() == 0 {
+			body.WriteByte('[')
+		} else {
+			body.WriteByte(',')
+		}
+		body.Write(data)
+	}
+	if body.Len() == 0 {
+		return nil
+	}
+	return a.send(ctx, body.Bytes())
+}
+
+// send posts one array of records, retrying throttled requests
+func (a *Azure) send(ctx context.Context, array []byte) error {
+	body := append(array, ']')
+	return withRetries(ctx, a.cfg.Retries, func() (time.Duration, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+		if err != nil {
+			return -1, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := a.client.Do(req)
+		if err != nil {
+			return 0, fmt.Errorf("failed to post to azure monitor %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusOK {
+			return 0, nil
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return retryWait(resp), fmt.Errorf("azure monitor returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	})
+}
+
+// azureSeverity maps a level to the severity levels of Azure Monitor,
+// from 0 (verbose) to 4 (critical)
+func azureSeverity(level models.LogLevel) int {
+	switch level {
+	case models.FATAL:
+		return 4
+	case models.ERROR:
+		return 3
+	case models.WARN:
+		return 2
+	case models.DEBUG, models.TRACE:
+		return 0
+	}
+	return 1
+}
+
+func (a *Azure) Close() error {
+	a.client.CloseIdleConnections()
+	return nil
+}
+
+// managedIdentity gets tokens from the instance metadata service
+type managedIdentity struct {
+	clientID string
+	client   *http.Client
+}
+
+func (m *managedIdentity) Token() (*oauth2.Token, error) {
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {azureMonitorAuth}}
+	if m.clientID != "" {
+		query.Set("client_id", m.clientID)
+	}
+	req, err := http.NewRequest(http.MethodGet, azureIMDS+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get managed identity token %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("failed to get managed identity token: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresOn   string `json:"expires_on"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("invalid managed identity token %w", err)
+	}
+	expires, _ := strconv.ParseInt(token.ExpiresOn, 10, 64)
+	return &oauth2.Token{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+		Expiry:      time.Unix(expires, 0),
+	}, nil
+}
@@ -0,0 +1,217 @@
+package sink
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+
+	"kafka-logging-system/internal/models"
+)
+
+// Limits of PutLogEvents. Each event counts its message plus 26 bytes
+// towards a request's size, and a request may not span more than a day.
+const (
+	cloudWatchMaxEvents     = 10000
+	cloudWatchMaxBytes      = 1048576
+	cloudWatchEventOverhead = 26
+	cloudWatchMaxEventBytes = 262144 - cloudWatchEventOverhead
+	cloudWatchMaxSpan       = 24 * time.Hour
+)
+
+type CloudWatchConfig struct {
+	LogGroup string `yaml:"log_group"`
+	//Region defaults to the one of the AWS environment or profile
+	Region string `yaml:"region"`
+	//StreamPrefix is put in front of the application in stream names
+	StreamPrefix string `yaml:"stream_prefix"`
+	//CreateGroup creates the log group when it doesn't exist
+	CreateGroup bool `yaml:"create_group"`
+	//Endpoint overrides the CloudWatch Logs endpoint, such as LocalStack's
+	Endpoint string `yaml:"endpoint"`
+}
+
+// CloudWatch puts entries into one CloudWatch Logs group, in a log stream
+// per application created on first use. Entries are sent as JSON so Logs
+// Insights can query their fields. Credentials come from the usual AWS
+// chain: environment, shared config and credentials files, web identity,
+// and the ECS or EC2 instance role.
+type CloudWatch struct {
+	cfg    CloudWatchConfig
+	client *cloudwatchlogs.Client
+
+	mu sync.Mutex
+	//tokens holds the sequence token of each stream written to, streams
+	//CloudWatch no longer asks tokens for have an empty one
+	tokens map[string]*string
+}
+
+func NewCloudWatch(ctx context.Context, cfg CloudWatchConfig) (*CloudWatch, error) {
+	if cfg.LogGroup == "" {
+		return nil, errors.New("cloudwatch sink needs a log_group")
+	}
+	var opts []func(*config.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, config.WithRegion(cfg.Region))
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config %w", err)
+	}
+	if awsConfig.Region == "" {
+		return nil, errors.New("cloudwatch sink needs a region, set region or AWS_REGION")
+	}
+	client := cloudwatchlogs.NewFromConfig(awsConfig, func(o *cloudwatchlogs.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
+	return &CloudWatch{cfg: cfg, client: client, tokens: make(map[string]*string)}, nil
+}
+
+func (c *CloudWatch) Write(ctx context.Context, entries []*models.LogEntry) error {
+	streams := make(map[string][]types.InputLogEvent)
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode cloudwatch event %w", err)
+		}
+		name := c.streamName(entry.Application)
+		streams[name] = append(streams[name], types.InputLogEvent{
+			Message:   aws.String(truncateUTF8(string(data), cloudWatchMaxEventBytes)),
+			Timestamp: aws.Int64(entry.Timestamp.UnixMilli()),
+		})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, events := range streams {
+		//events of a request must be in chronological order
+		slices.SortStableFunc(events, func(a, b types.InputLogEvent) int {
+			return cmp.Compare(*a.Timestamp, *b.Timestamp)
+		})
+		for len(events) > 0 {
+			n := cloudWatchBatch(events)
+			if err := c.put(ctx, name, events[:n]); err != nil {
+				return err
+			}
+			events = events[n:]
+		}
+	}
+	return nil
+}
+
+// cloudWatchBatch returns how many of the sorted events fit in one request
+func cloudWatchBatch(events []types.InputLogEvent) int {
+	size := 0
+	first := *events[0].Timestamp
+	for i, event := range events {
+		size += len(*event.Message) + cloudWatchEventOverhead
+		if i == cloudWatchMaxEvents || size > cloudWatchMaxBytes ||
+			time.Duration(*event.Timestamp-first)*time.Millisecond >= cloudWatchMaxSpan {
+			return i
+		}
+	}
+	return len(events)
+}
+
+// put sends events to a stream, creating it when missing and catching up
+// with its sequence token when another writer moved it on
+func (c *CloudWatch) put(ctx context.Context, stream string, events []types.InputLogEvent) error {
+	for attempt := 0; ; attempt++ {
+		out, err := c.client.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(c.cfg.LogGroup),
+			LogStreamName: aws.String(stream),
+			LogEvents:     events,
+			SequenceToken: c.tokens[stream],
+		})
+		if err == nil {
+			c.tokens[stream] = out.NextSequenceToken
+			if rejected := out.RejectedLogEventsInfo; rejected != nil {
+				slog.Warn("CloudWatch rejected events too old or too far in the future", "stream", stream)
+			}
+			return nil
+		}
+		if attempt >= 2 {
+			return fmt.Errorf("failed to put events to cloudwatch stream %s %w", stream, err)
+		}
+
+		var notFound *types.ResourceNotFoundException
+		var invalidToken *types.InvalidSequenceTokenException
+		var accepted *types.DataAlreadyAcceptedException
+		switch {
+		case errors.As(err, &notFound):
+			if err := c.createStream(ctx, stream); err != nil {
+				return err
+			}
+		case errors.As(err, &invalidToken):
+			c.tokens[stream] = invalidToken.ExpectedSequenceToken
+		case errors.As(err, &accepted):
+			c.tokens[stream] = accepted.ExpectedSequenceToken
+			return nil
+		default:
+			return fmt.Errorf("failed to put events to cloudwatch stream %s %w", stream, err)
+		}
+	}
+}
+
+// createStream creates a log stream, and its group when CreateGroup is set
+func (c *CloudWatch) createStream(ctx context.Context, stream string) error {
+	input := &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(c.cfg.LogGroup),
+		LogStreamName: aws.String(stream),
+	}
+	_, err := c.client.CreateLogStream(ctx, input)
+	var notFound *types.ResourceNotFoundException
+	var exists *types.ResourceAlreadyExistsException
+	if errors.As(err, &notFound) && c.cfg.CreateGroup {
+		_, err = c.client.CreateLogGroup(ctx, &cloudwatchlogs.CreateLogGroupInput{
+			LogGroupName: aws.String(c.cfg.LogGroup),
+		})
+		if err != nil && !errors.As(err, &exists) {
+			return fmt.Errorf("failed to create cloudwatch log group %w", err)
+		}
+		_, err = c.client.CreateLogStream(ctx, input)
+	}
+	if err != nil && !errors.As(err, &exists) {
+		return fmt.Errorf("failed to create cloudwatch log stream %s %w", stream, err)
+	}
+	c.tokens[stream] = nil
+	return nil
+}
+
+// streamName returns the stream of an application. Stream names can't
+// contain colons or asterisks.
+func (c *CloudWatch) streamName(application string) string {
+	if application == "" {
+		application = "unknown"
+	}
+	return c.cfg.StreamPrefix + strings.NewReplacer(":", "_", "*", "_").Replace(application)
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (c *CloudWatch) Close() error {
+	return nil
+}
@@ -0,0 +1,35 @@
+package sink
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings of the sinks that need more than an address
+type Config struct {
+	//Sink selects the sink to write to, unless the forwarder is told another
+	Sink string `yaml:"sink"`
+
+	Splunk     *SplunkConfig     `yaml:"splunk"`
+	Datadog    *DatadogConfig    `yaml:"datadog"`
+	CloudWatch *CloudWatchConfig `yaml:"cloudwatch"`
+	GCP        *GCPConfig        `yaml:"gcp"`
+	Azure      *AzureConfig      `yaml:"azure"`
+	Sentry     *SentryConfig     `yaml:"sentry"`
+}
+
+// LoadConfig reads sink settings from a YAML file. ${VAR} references are
+// expanded from the environment so tokens can stay out of the file.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read sink config %w", err)
+	}
+	if err := yaml.Unmarshal([]byte(os.ExpandEnv(string(data))), &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse sink config %w", err)
+	}
+	return cfg, nil
+}
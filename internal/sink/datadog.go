@@ -0,0 +1,216 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+// Limits of the Datadog logs intake for one request
+const (
+	datadogMaxEntries = 1000
+	datadogMaxBytes   = 5000000
+)
+
+type DatadogConfig struct {
+	APIKey string `yaml:"api_key"`
+	//Site is the Datadog site of the account, defaults to datadoghq.com
+	Site string `yaml:"site"`
+	//URL overrides the intake endpoint derived from Site
+	URL string `yaml:"url"`
+	//Source is the ddsource of every log, defaults to kafka-logging-system
+	Source string `yaml:"source"`
+	//Tags are added to every log, such as team:payments
+	Tags []string `yaml:"tags"`
+	//MetadataTags are metadata fields turned into tags, next to the
+	//application, level and environment
+	MetadataTags []string `yaml:"metadata_tags"`
+	//Retries of requests that were throttled or failed on Datadog's side,
+	//defaults to 5
+	Retries int `yaml:"retries"`
+}
+
+// Datadog sends entries to the Datadog logs intake, as gzip compressed
+// JSON arrays split to the intake's limits
+type Datadog struct {
+	cfg    DatadogConfig
+	client *http.Client
+}
+
+func NewDatadog(cfg DatadogConfig) (*Datadog, error) {
+	if cfg.APIKey == "" {
+		return nil, errors.New("datadog sink needs an api_key")
+	}
+	if cfg.Site == "" {
+		cfg.Site = "datadoghq.com"
+	}
+	if cfg.URL == "" {
+		cfg.URL = "https://http-intake.logs." + cfg.Site + "/api/v2/logs"
+	}
+	if cfg.Source == "" {
+		cfg.Source = "kafka-logging-system"
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = 5
+	}
+	return &Datadog{cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// datadogLog is one log of the intake format. Attributes Datadog doesn't
+// reserve are searchable as facets.
+type datadogLog struct {
+	Source    string          `json:"ddsource"`
+	Tags      string          `json:"ddtags"`
+	Hostname  string          `json:"hostname,omitempty"`
+	Service   string          `json:"service"`
+	Status    string          `json:"status"`
+	Message   string          `json:"message"`
+	Timestamp int64           `json:"timestamp"`
+	Level     models.LogLevel `json:"level"`
+	TraceID   string          `json:"trace_id,omitempty"`
+	SpanID    string          `json:"span_id,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	PID       int             `json:"pid,omitempty"`
+	Metadata  map[string]any  `json:"metadata,omitempty"`
+	Error     *datadogError   `json:"error,omitempty"`
+}
+
+// datadogError holds Datadog's standard error attributes, which Error
+// Tracking groups errors by
+type datadogError struct {
+	Kind    string `json:"kind,omitempty"`
+	Message string `json:"message,omitempty"`
+	Stack   string `json:"stack,omitempty"`
+}
+
+func (d *Datadog) Write(ctx context.Context, entries []*models.LogEntry) error {
+	var body bytes.Buffer
+	count := 0
+	for _, entry := range entries {
+		data, err := json.Marshal(d.log(entry))
+		if err != nil {
+			return fmt.Errorf("failed to encode datadog log %w", err)
+		}
+		//the array's brackets and commas count towards the limit
+		if count == datadogMaxEntries || (count > 0 && body.Len()+len(data)+2 > datadogMaxBytes) {
+			if err := d.send(ctx, body.Bytes()); err != nil {
+				return err
+			}
+			body.Reset()
+			count = 0
+		}
+		if count == 0 {
+			body.WriteByte('[')
+		} else {
+			body.WriteByte(',')
+		}
+		body.Write(data)
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+	return d.send(ctx, body.Bytes())
+}
+
+func (d *Datadog) log(entry *models.LogEntry) datadogLog {
+	tags := make([]string, 0, len(d.cfg.Tags)+len(d.cfg.MetadataTags)+3)
+	tags = append(tags, d.cfg.Tags...)
+	tags = append(tags, "application:"+entry.Application, "level:"+strings.ToLower(string(entry.Level)))
+	if entry.Environment != "" {
+		tags = append(tags, "env:"+string(entry.Environment))
+	}
+	for _, key := range d.cfg.MetadataTags {
+		if value, ok := entry.Metadata[key]; ok {
+			tags = append(tags, key+":"+fmt.Sprint(value))
+		}
+	}
+	log := datadogLog{
+		Source:    d.cfg.Source,
+		Tags:      strings.Join(tags, ","),
+		Hostname:  entry.Hostname,
+		Service:   entry.Application,
+		Status:    datadogStatus(entry.Level),
+		Message:   entry.Message,
+		Timestamp: entry.Timestamp.UnixMilli(),
+		Level:     entry.Level,
+		TraceID:   entry.TraceID,
+		SpanID:    entry.SpanID,
+		RequestID: entry.RequestID,
+		PID:       entry.PID,
+		Metadata:  entry.Metadata,
+	}
+	if entry.ErrorType != "" || entry.ErrorMessage != "" || entry.StackTrace != "" {
+		log.Error = &datadogError{Kind: entry.ErrorType, Message: entry.ErrorMessage, Stack: entry.StackTrace}
+	}
+	return log
+}
+
+// send posts one array of logs, retrying throttled requests
+func (d *Datadog) send(ctx context.Context, array []byte) error {
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	gz.Write(array)
+	gz.Write([]byte{']'})
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress datadog logs %w", err)
+	}
+
+	return withRetries(ctx, d.cfg.Retries, func() (time.Duration, error) {
+		return d.post(ctx, body.Bytes())
+	})
+}
+
+// post sends one request. On failure it returns how long to wait before a
+// retry, zero for the usual backoff and negative when retrying won't help.
+func (d *Datadog) post(ctx context.Context, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("DD-API-KEY", d.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to post to datadog %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return 0, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return retryWait(resp), fmt.Errorf("datadog returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+// datadogStatus maps a level to a Datadog log status
+func datadogStatus(level models.LogLevel) string {
+	switch level {
+	case models.FATAL:
+		return "critical"
+	case models.ERROR:
+		return "error"
+	case models.WARN:
+		return "warning"
+	case models.DEBUG, models.TRACE:
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+func (d *Datadog) Close() error {
+	d.client.CloseIdleConnections()
+	return nil
+}
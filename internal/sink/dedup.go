@@ -0,0 +1,175 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"kafka-logging-system/internal/models"
+)
+
+// Dedup skips entries another sink already took, by their ID, for sinks
+// that can't drop duplicates themselves. The IDs of the last size entries
+// are appended to a file, so a restart or rebalance replaying a batch
+// doesn't deliver it again.
+type Dedup struct {
+	sink Sink
+	path string
+	size int
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+	//recent holds the remembered IDs oldest first from next, as a ring
+	recent []string
+	next   int
+	file   *os.File
+	lines  int //IDs in file, compacted to the remembered ones once it doubles
+}
+
+// NewDedup wraps s, remembering the IDs of the last size entries in the file at path
+func NewDedup(s Sink, path string, size int) (*Dedup, error) {
+	d := &Dedup{
+		sink:   s,
+		path:   path,
+		size:   max(size, 1),
+		seen:   make(map[string]struct{}),
+		recent: make([]string, 0, max(size, 1)),
+	}
+
+	file, err := os.Open(path)
+	switch {
+	case err == nil:
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			d.remember(scanner.Text())
+			d.lines++
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read dedup store %w", err)
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to open dedup store %w", err)
+	}
+
+	if err := d.compact(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Dedup) Write(ctx context.Context, entries []*models.LogEntry) error {
+	d.mu.Lock()
+	fresh := make([]*models.LogEntry, 0, len(entries))
+	batch := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		if entry.ID != "" {
+			if _, ok := d.seen[entry.ID]; ok {
+				continue
+			}
+			if _, ok := batch[entry.ID]; ok {
+				continue
+			}
+			batch[entry.ID] = struct{}{}
+		}
+		fresh = append(fresh, entry)
+	}
+	d.mu.Unlock()
+
+	if len(fresh) == 0 {
+		return nil
+	}
+	if err := d.sink.Write(ctx, fresh); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var lines []byte
+	for _, entry := range fresh {
+		if entry.ID != "" {
+			d.remember(entry.ID)
+			lines = append(append(lines, entry.ID...), '\n')
+			d.lines++
+		}
+	}
+	//the batch was delivered, failing to remember it only risks duplicates
+	//after a restart
+	if d.file == nil {
+		return nil
+	}
+	if _, err := d.file.Write(lines); err != nil {
+		slog.Warn("Error writing dedup store", "path", d.path, "err", err)
+	}
+	if d.lines >= 2*d.size {
+		if err := d.compact(); err != nil {
+			slog.Warn("Error compacting dedup store", "path", d.path, "err", err)
+		}
+	}
+	return nil
+}
+
+// remember adds id to the remembered IDs, forgetting the oldest when full.
+// d.mu must be held.
+func (d *Dedup) remember(id string) {
+	if _, ok := d.seen[id]; ok {
+		return
+	}
+	if len(d.recent) < d.size {
+		d.recent = append(d.recent, id)
+	} else {
+		delete(d.seen, d.recent[d.next])
+		d.recent[d.next] = id
+		d.next = (d.next + 1) % d.size
+	}
+	d.seen[id] = struct{}{}
+}
+
+// compact rewrites the file with only the remembered IDs and reopens it for
+// appending. d.mu must be held.
+func (d *Dedup) compact() error {
+	tmp := d.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to write dedup store %w", err)
+	}
+	w := bufio.NewWriter(file)
+	for i := range d.recent {
+		w.WriteString(d.recent[(d.next+i)%len(d.recent)])
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write dedup store %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write dedup store %w", err)
+	}
+	if err := os.Rename(tmp, d.path); err != nil {
+		return fmt.Errorf("failed to replace dedup store %w", err)
+	}
+
+	if d.file != nil {
+		d.file.Close()
+	}
+	if d.file, err = os.OpenFile(d.path, os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return fmt.Errorf("failed to open dedup store %w", err)
+	}
+	d.lines = len(d.recent)
+	return nil
+}
+
+func (d *Dedup) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.sink.Close()
+	if d.file != nil {
+		if cerr := d.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
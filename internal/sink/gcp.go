@@ -0,0 +1,232 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"kafka-logging-system/internal/models"
+)
+
+// Limits of entries.write, kept below Cloud Logging's 10MB per request
+const (
+	gcpMaxEntries = 1000
+	gcpMaxBytes   = 9 << 20
+	gcpWriteURL   = "https://logging.googleapis.com/v2/entries:write"
+	gcpScope      = "https://www.googleapis.com/auth/logging.write"
+)
+
+type GCPConfig struct {
+	//Project defaults to the project of the credentials
+	Project string `yaml:"project"`
+	//LogID names the log entries are written to, defaults to kafka-logging-system
+	LogID string `yaml:"log_id"`
+	//CredentialsFile is a service account key, application default
+	//credentials are used when empty
+	CredentialsFile string `yaml:"credentials_file"`
+	//ResourceType is the monitored resource of entries, defaults to global
+	ResourceType   string            `yaml:"resource_type"`
+	ResourceLabels map[string]string `yaml:"resource_labels"`
+	//MetadataLabels are metadata fields turned into labels, next to the
+	//application, environment and hostname
+	MetadataLabels []string `yaml:"metadata_labels"`
+	//URL overrides the entries.write endpoint
+	URL string `yaml:"url"`
+}
+
+// GCP writes entries to Google Cloud Logging as structured logs
+type GCP struct {
+	cfg    GCPConfig
+	client *http.Client
+}
+
+func NewGCP(ctx context.Context, cfg GCPConfig) (*GCP, error) {
+	var creds *google.Credentials
+	var err error
+	if cfg.CredentialsFile != "" {
+		var data []byte
+		if data, err = os.ReadFile(cfg.CredentialsFile); err != nil {
+			return nil, fmt.Errorf("failed to read GCP credentials %w", err)
+		}
+		creds, err = google.CredentialsFromJSON(ctx, data, gcpScope)
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, gcpScope)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find GCP credentials %w", err)
+	}
+
+	if cfg.Project == "" {
+		cfg.Project = creds.ProjectID
+	}
+	if cfg.Project == "" {
+		return nil, errors.New("gcp sink needs a project, the credentials don't name one")
+	}
+	if cfg.LogID == "" {
+		cfg.LogID = "kafka-logging-system"
+	}
+	if cfg.ResourceType == "" {
+		cfg.ResourceType = "global"
+	}
+	if cfg.URL == "" {
+		cfg.URL = gcpWriteURL
+	}
+	client := oauth2.NewClient(ctx, creds.TokenSource)
+	client.Timeout = 30 * time.Second
+	return &GCP{cfg: cfg, client: client}, nil
+}
+
+// gcpEntry is a LogEntry of the Cloud Logging API
+type gcpEntry struct {
+	//InsertID lets Cloud Logging drop entries it already has
+	InsertID    string            `json:"insertId,omitempty"`
+	Timestamp   string            `json:"timestamp"`
+	Severity    string            `json:"severity"`
+	Labels      map[string]string `json:"labels"`
+	JSONPayload map[string]any    `json:"jsonPayload"`
+	Trace       string            `json:"trace,omitempty"`
+	SpanID      string            `json:"spanId,omitempty"`
+}
+
+func (g *GCP) Write(ctx context.Context, entries []*models.LogEntry) error {
+	var batch []json.RawMessage
+	size := 0
+	for _, entry := range entries {
+		data, err := json.Marshal(g.entry(entry))
+		if err != nil {
+			return fmt.Errorf("failed to encode cloud logging entry %w", err)
+		}
+		if len(batch) == gcpMaxEntries || (len(batch) > 0 && size+len(data) > gcpMaxBytes) {
+			if err := g.write(ctx, batch); err != nil {
+				return err
+			}
+			batch, size = batch[:0], 0
+		}
+		batch = append(batch, data)
+		size += len(data) + 1
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return g.write(ctx, batch)
+}
+
+// entry maps an entry, its message and metadata become the JSON payload so
+// the console shows the message and can filter on every field
+func (g *GCP) entry(entry *models.LogEntry) gcpEntry {
+	labels := map[string]string{"application": entry.Application}
+	if entry.Environment != "" {
+		labels["environment"] = string(entry.Environment)
+	}
+	if entry.Hostname != "" {
+		labels["hostname"] = entry.Hostname
+	}
+	for _, key := range g.cfg.MetadataLabels {
+		if value, ok := entry.Metadata[key]; ok {
+			labels[key] = fmt.Sprint(value)
+		}
+	}
+
+	payload := make(map[string]any, len(entry.Metadata)+4)
+	for key, value := range entry.Metadata {
+		payload[key] = value
+	}
+	payload["message"] = entry.Message
+	payload["level"] = entry.Level
+	if entry.RequestID != "" {
+		payload["request_id"] = entry.RequestID
+	}
+	if entry.PID != 0 {
+		payload["pid"] = entry.PID
+	}
+	//Error Reporting picks up errors from a stack_trace field
+	for key, value := range map[string]string{
+		"error_type":    entry.ErrorType,
+		"error_message": entry.ErrorMessage,
+		"stack_trace":   entry.StackTrace,
+	} {
+		if value != "" {
+			payload[key] = value
+		}
+	}
+
+	e := gcpEntry{
+		InsertID:    entry.ID,
+		Timestamp:   entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		Severity:    gcpSeverity(entry.Level),
+		Labels:      labels,
+		JSONPayload: payload,
+		SpanID:      entry.SpanID,
+	}
+	if entry.TraceID != "" {
+		e.Trace = "projects/" + g.cfg.Project + "/traces/" + entry.TraceID
+	}
+	return e
+}
+
+func (g *GCP) write(ctx context.Context, entries []json.RawMessage) error {
+	body, err := json.Marshal(map[string]any{
+		"logName":        "projects/" + g.cfg.Project + "/logs/" + url.PathEscape(g.cfg.LogID),
+		"resource":       map[string]any{"type": g.cfg.ResourceType, "labels": g.cfg.ResourceLabels},
+		"entries":        entries,
+		"partialSuccess": true,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write to cloud logging %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	//with partialSuccess the valid entries were written, the invalid ones
+	//would be rejected again
+	if resp.StatusCode == http.StatusBadRequest && bytes.Contains(msg, []byte("WriteLogEntriesPartialErrors")) {
+		slog.Warn("Cloud Logging rejected some entries", "entries", len(entries), "response", string(bytes.TrimSpace(msg)))
+		return nil
+	}
+	return fmt.Errorf("cloud logging returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+// gcpSeverity maps a level to a Cloud Logging severity
+func gcpSeverity(level models.LogLevel) string {
+	switch level {
+	case models.FATAL:
+		return "CRITICAL"
+	case models.ERROR:
+		return "ERROR"
+	case models.WARN:
+		return "WARNING"
+	case models.INFO:
+		return "INFO"
+	case models.DEBUG, models.TRACE:
+		return "DEBUG"
+	}
+	return "DEFAULT"
+}
+
+func (g *GCP) Close() error {
+	g.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,118 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"kafka-logging-system/internal/gelf"
+	"kafka-logging-system/internal/models"
+)
+
+// GELFChunkSize keeps UDP datagrams below the usual WAN MTU
+const GELFChunkSize = 1420
+
+// GELF sends entries to Graylog, over UDP as gzip compressed and chunked
+// datagrams or over TCP as null terminated messages
+type GELF struct {
+	network string
+	addr    string
+	timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewGELF returns a sink for an address such as udp://graylog:12201 or
+// tcp://graylog:12201
+func NewGELF(address string) (*GELF, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GELF address %w", err)
+	}
+	if u.Scheme != "udp" && u.Scheme != "tcp" {
+		return nil, fmt.Errorf("GELF address %q must start with udp:// or tcp://", address)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "12201")
+	}
+	return &GELF{network: u.Scheme, addr: u.Host, timeout: 10 * time.Second}, nil
+}
+
+func (g *GELF) Write(ctx context.Context, entries []*models.LogEntry) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn == nil {
+		dialer := net.Dialer{Timeout: g.timeout}
+		conn, err := dialer.DialContext(ctx, g.network, g.addr)
+		if err != nil {
+			return fmt.Errorf("failed to connect to graylog %w", err)
+		}
+		g.conn = conn
+	}
+
+	deadline := time.Now().Add(g.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := g.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := g.send(entry); err != nil {
+			//reconnect for the retried batch
+			g.conn.Close()
+			g.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GELF) send(entry *models.LogEntry) error {
+	data, err := gelf.Encode(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode GELF message %w", err)
+	}
+	if g.network == "tcp" {
+		_, err := g.conn.Write(append(data, 0))
+		return err
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	chunks, err := gelf.Chunk(buf.Bytes(), GELFChunkSize)
+	if err != nil {
+		//too large even when chunked, Graylog would drop it anyway
+		slog.Warn("Dropping GELF message", "application", entry.Application, "err", err)
+		return nil
+	}
+	for _, chunk := range chunks {
+		if _, err := g.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GELF) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn == nil {
+		return nil
+	}
+	return g.conn.Close()
+}
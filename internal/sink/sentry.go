@@ -0,0 +1,340 @@
+package sink
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+type SentryConfig struct {
+	//DSN is the project's client key, https://<key>@<host>/<project id>
+	DSN string `yaml:"dsn"`
+	//MinLevel is the least severe level sent, defaults to ERROR
+	MinLevel models.LogLevel `yaml:"min_level"`
+	//Release tags events with the deployed version
+	Release string `yaml:"release"`
+	//Retries of rate limited or failed requests, defaults to 3
+	Retries int `yaml:"retries"`
+}
+
+// Sentry turns error entries into Sentry events, so exceptions show up as
+// issues. Events are grouped by application and message template, the
+// message with its ids, numbers and quoted values masked, so one issue
+// collects every occurrence of an error. Less severe entries are skipped.
+type Sentry struct {
+	cfg    SentryConfig
+	dsn    string
+	url    string
+	auth   string
+	client *http.Client
+}
+
+func NewSentry(cfg SentryConfig) (*Sentry, error) {
+	u, err := url.Parse(cfg.DSN)
+	if err != nil || u.User == nil || u.Host == "" {
+		return nil, errors.New("sentry sink needs a dsn like https://key@sentry.io/42")
+	}
+	path, project := "", strings.Trim(u.Path, "/")
+	if slash := strings.LastIndexByte(project, '/'); slash >= 0 {
+		path, project = "/"+project[:slash], project[slash+1:]
+	}
+	if project == "" {
+		return nil, fmt.Errorf("sentry dsn %q has no project id", cfg.DSN)
+	}
+	if cfg.MinLevel == "" {
+		cfg.MinLevel = models.ERROR
+	}
+	if cfg.MinLevel.Severity() == 0 {
+		return nil, fmt.Errorf("unknown sentry min_level %q", cfg.MinLevel)
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = 3
+	}
+	return &Sentry{
+		cfg:    cfg,
+		dsn:    cfg.DSN,
+		url:    u.Scheme + "://" + u.Host + path + "/api/" + project + "/envelope/",
+		auth:   "Sentry sentry_version=7, sentry_client=kafka-logging-system/1.0, sentry_key=" + u.User.Username(),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Metadata fields an entry's exception is read from when it has no error
+// fields, OpenTelemetry's semantic conventions first
+var (
+	exceptionTypeFields    = []string{"exception.type", "error.type", "exception_type"}
+	exceptionMessageFields = []string{"exception.message", "error.message", "error"}
+	stackTraceFields       = []string{"exception.stacktrace", "stack_trace", "stacktrace", "stack"}
+)
+
+// sentryEvent is the part of Sentry's event payload entries fill
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   float64           `json:"timestamp"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	Platform    string            `json:"platform"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Message     sentryMessage     `json:"logentry"`
+	Fingerprint []string          `json:"fingerprint"`
+	Tags        map[string]string `json:"tags"`
+	Extra       map[string]any    `json:"extra,omitempty"`
+	Exception   *sentryExceptions `json:"exception,omitempty"`
+	Contexts    map[string]any    `json:"contexts,omitempty"`
+}
+
+type sentryMessage struct {
+	Message   string `json:"message"`
+	Formatted string `json:"formatted"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function,omitempty"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Lineno   int    `json:"lineno,omitempty"`
+}
+
+func (s *Sentry) Write(ctx context.Context, entries []*models.LogEntry) error {
+	for _, entry := range entries {
+		if entry.Level.Severity() < s.cfg.MinLevel.Severity() {
+			continue
+		}
+		envelope, err := s.envelope(entry)
+		if err != nil {
+			return err
+		}
+		err = withRetries(ctx, s.cfg.Retries, func() (time.Duration, error) {
+			return s.post(ctx, envelope)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envelope wraps the event of an entry in Sentry's envelope format
+func (s *Sentry) envelope(entry *models.LogEntry) ([]byte, error) {
+	event := s.event(entry)
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sentry event %w", err)
+	}
+	header, err := json.Marshal(map[string]string{
+		"event_id": event.EventID,
+		"dsn":      s.dsn,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(header)
+	fmt.Fprintf(&buf, "\n{\"type\":\"event\",\"length\":%d}\n", len(payload))
+	buf.Write(payload)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func (s *Sentry) event(entry *models.LogEntry) sentryEvent {
+	//Sentry drops events whose ID it has seen, so redelivered entries keep theirs
+	id := make([]byte, 16)
+	if entry.ID != "" {
+		sum := sha256.Sum256([]byte(entry.ID))
+		copy(id, sum[:])
+	} else {
+		rand.Read(id)
+	}
+	template := messageTemplate(entry.Message)
+
+	event := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   float64(entry.Timestamp.UnixMicro()) / 1e6,
+		Level:       "error",
+		Logger:      entry.Application,
+		Platform:    "other",
+		ServerName:  entry.Hostname,
+		Environment: string(entry.Environment),
+		Release:     s.cfg.Release,
+		Message:     sentryMessage{Message: template, Formatted: entry.Message},
+		Fingerprint: []string{entry.Application, template},
+		Tags:        map[string]string{"application": entry.Application, "log_level": string(entry.Level)},
+	}
+	if entry.Level == models.FATAL {
+		event.Level = "fatal"
+	}
+	if entry.RequestID != "" {
+		event.Tags["request_id"] = entry.RequestID
+	}
+	if entry.TraceID != "" {
+		trace := map[string]string{"trace_id": entry.TraceID}
+		if entry.SpanID != "" {
+			trace["span_id"] = entry.SpanID
+		}
+		event.Contexts = map[string]any{"trace": trace}
+	}
+
+	metadata := make(map[string]any, len(entry.Metadata))
+	for key, value := range entry.Metadata {
+		metadata[key] = value
+	}
+	//the entry's error fields win over metadata of producers that predate them
+	exception := sentryException{
+		Type:  cmp.Or(entry.ErrorType, takeString(metadata, exceptionTypeFields)),
+		Value: cmp.Or(entry.ErrorMessage, takeString(metadata, exceptionMessageFields)),
+	}
+	stack := cmp.Or(entry.StackTrace, takeString(metadata, stackTraceFields))
+	if frames := parseStack(stack); len(frames) > 0 {
+		exception.Stacktrace = &sentryStacktrace{Frames: frames}
+	} else if stack != "" {
+		metadata["stack_trace"] = stack
+	}
+	if exception.Type != "" || exception.Stacktrace != nil {
+		if exception.Type == "" {
+			exception.Type = "Error"
+		}
+		if exception.Value == "" {
+			exception.Value = entry.Message
+		}
+		event.Exception = &sentryExceptions{Values: []sentryException{exception}}
+	}
+	if entry.PID != 0 {
+		metadata["pid"] = entry.PID
+	}
+	if len(metadata) > 0 {
+		event.Extra = metadata
+	}
+	return event
+}
+
+func (s *Sentry) post(ctx context.Context, envelope []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(envelope))
+	if err != nil {
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to post to sentry %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return 0, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return retryWait(resp), fmt.Errorf("sentry returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+func (s *Sentry) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// takeString removes the first of fields metadata has and returns its value
+func takeString(metadata map[string]any, fields []string) string {
+	for _, field := range fields {
+		if value, ok := metadata[field]; ok {
+			delete(metadata, field)
+			if s, ok := value.(string); ok {
+				return s
+			}
+			return fmt.Sprint(value)
+		}
+	}
+	return ""
+}
+
+// variablePart matches the parts of a message that differ between
+// occurrences of one error: quoted values, UUIDs, emails, IPs, hex ids and
+// numbers, with their unit such as 30s
+var variablePart = regexp.MustCompile(`"[^"]*"|'[^']*'|\b[0-9a-fA-F]{8}(?:-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}\b|[\w.+-]+@[\w-]+(?:\.[\w-]+)+|\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b|\b\d[\d.]*[a-zA-Z]{0,2}\b|\b(?:0x)?[0-9a-fA-F]*\d[0-9a-fA-F]*\b`)
+
+// messageTemplate masks the variable parts of a message
+func messageTemplate(message string) string {
+	first, _, _ := strings.Cut(message, "\n")
+	return variablePart.ReplaceAllStringFunc(first, func(part string) string {
+		switch {
+		case part[0] == '"' || part[0] == '\'':
+			return string(part[0]) + "*" + string(part[0])
+		case strings.Contains(part, "@"):
+			return "<email>"
+		case len(part) == 36 && strings.Count(part, "-") == 4:
+			return "<uuid>"
+		case strings.Count(part, ".") == 3:
+			return "<ip>"
+		}
+		return "<n>"
+	})
+}
+
+// Stack frame formats of Java, Python and Go
+var (
+	javaFrame   = regexp.MustCompile(`^\s*at ([\w$.<>]+)\.([\w$<>]+)\(([^:)]*)(?::(\d+))?\)`)
+	pythonFrame = regexp.MustCompile(`^\s*File "([^"]+)", line (\d+), in (.+)$`)
+	goFrame     = regexp.MustCompile(`^\t(\S+\.go):(\d+)`)
+)
+
+// parseStack reads the frames of a stack trace, oldest call first as
+// Sentry wants them. Traces in other formats give no frames.
+func parseStack(stack string) []sentryFrame {
+	var frames []sentryFrame
+	lines := strings.Split(stack, "\n")
+	calleeFirst := true
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if m := javaFrame.FindStringSubmatch(line); m != nil {
+			lineno, _ := strconv.Atoi(m[4])
+			frames = append(frames, sentryFrame{Module: m[1], Function: m[2], Filename: m[3], Lineno: lineno})
+		} else if m := pythonFrame.FindStringSubmatch(line); m != nil {
+			lineno, _ := strconv.Atoi(m[2])
+			frames = append(frames, sentryFrame{Filename: m[1], Lineno: lineno, Function: m[3]})
+			//Python prints the most recent call last
+			calleeFirst = false
+		} else if m := goFrame.FindStringSubmatch(line); m != nil && i > 0 {
+			lineno, _ := strconv.Atoi(m[2])
+			//the function is on the line before its location
+			function, _, _ := strings.Cut(strings.TrimSpace(lines[i-1]), "(")
+			frames = append(frames, sentryFrame{Function: function, Filename: m[1], Lineno: lineno})
+		}
+	}
+	if calleeFirst {
+		slices.Reverse(frames)
+	}
+	return frames
+}
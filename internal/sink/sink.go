@@ -0,0 +1,55 @@
+// Package sink forwards consumed log entries to systems outside Kafka.
+package sink
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+// Sink delivers batches of entries, Write may be called from several
+// goroutines at once. The forwarder only commits the offsets of a batch
+// once Write returned nil, so a failed batch is delivered again.
+type Sink interface {
+	Write(ctx context.Context, entries []*models.LogEntry) error
+	Close() error
+}
+
+// withRetries calls post until it succeeds, retrying up to retries times.
+// post returns how long to wait before a retry, zero for a backoff growing
+// from one second and negative when retrying won't help.
+func withRetries(ctx context.Context, retries int, post func() (time.Duration, error)) error {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		wait, err := post()
+		if err == nil || wait < 0 || attempt >= retries {
+			return err
+		}
+		if wait == 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryWait returns the wait withRetries expects for a failed response:
+// the Retry-After of throttled requests, a backoff for server errors and
+// no retry for rejected requests
+func retryWait(resp *http.Response) time.Duration {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return time.Duration(seconds) * time.Second
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		return 0
+	}
+	return -1
+}
@@ -0,0 +1,245 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+type SplunkConfig struct {
+	//URL is the HTTP Event Collector, such as https://splunk:8088
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+	//Index overrides the token's default index
+	Index string `yaml:"index"`
+	//Source of the events, defaults to kafka-logging-system
+	Source string `yaml:"source"`
+	//Sourcetype of events whose application isn't in Sourcetypes, defaults to _json
+	Sourcetype  string            `yaml:"sourcetype"`
+	Sourcetypes map[string]string `yaml:"sourcetypes"`
+	//Ack waits for indexer acknowledgment before a batch counts as written,
+	//the token must have it enabled
+	Ack bool `yaml:"ack"`
+	//AckTimeout bounds the wait for acknowledgment, defaults to 1m
+	AckTimeout time.Duration `yaml:"ack_timeout"`
+	//MaxRequestBytes splits batches into requests of at most this size,
+	//defaults to HEC's 1MB limit
+	MaxRequestBytes    int  `yaml:"max_request_bytes"`
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+// splunkAckInterval is how often acknowledgment is polled
+const splunkAckInterval = time.Second
+
+// Splunk posts entries to a Splunk HTTP Event Collector. With Ack enabled,
+// Write only returns once the indexers acknowledged every event, so the
+// forwarder doesn't commit offsets of events Splunk could still lose.
+type Splunk struct {
+	cfg    SplunkConfig
+	client *http.Client
+	//channel identifies this forwarder to HEC, acknowledgment is per channel
+	channel string
+}
+
+func NewSplunk(cfg SplunkConfig) (*Splunk, error) {
+	if cfg.URL == "" || cfg.Token == "" {
+		return nil, errors.New("splunk sink needs a url and token")
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	if cfg.Source == "" {
+		cfg.Source = "kafka-logging-system"
+	}
+	if cfg.Sourcetype == "" {
+		cfg.Sourcetype = "_json"
+	}
+	if cfg.AckTimeout <= 0 {
+		cfg.AckTimeout = time.Minute
+	}
+	if cfg.MaxRequestBytes <= 0 {
+		cfg.MaxRequestBytes = 1000000
+	}
+
+	channel := make([]byte, 16)
+	if _, err := rand.Read(channel); err != nil {
+		return nil, fmt.Errorf("failed to generate HEC channel %w", err)
+	}
+	//channels are GUIDs
+	channel[6] = channel[6]&0x0f | 0x40
+	channel[8] = channel[8]&0x3f | 0x80
+	id := hex.EncodeToString(channel)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	return &Splunk{
+		cfg:     cfg,
+		client:  &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		channel: id[0:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:],
+	}, nil
+}
+
+// splunkEvent is one event of the HEC JSON format
+type splunkEvent struct {
+	Time       float64           `json:"time"`
+	Host       string            `json:"host,omitempty"`
+	Source     string            `json:"source"`
+	Sourcetype string            `json:"sourcetype"`
+	Index      string            `json:"index,omitempty"`
+	Event      *models.LogEntry  `json:"event"`
+	Fields     map[string]string `json:"fields"`
+}
+
+func (s *Splunk) Write(ctx context.Context, entries []*models.LogEntry) error {
+	var acks []int64
+	var body bytes.Buffer
+	for _, entry := range entries {
+		event, err := s.encode(entry)
+		if err != nil {
+			return err
+		}
+		if body.Len() > 0 && body.Len()+len(event) > s.cfg.MaxRequestBytes {
+			ack, err := s.post(ctx, body.Bytes())
+			if err != nil {
+				return err
+			}
+			acks = append(acks, ack)
+			body.Reset()
+		}
+		body.Write(event)
+	}
+	if body.Len() > 0 {
+		ack, err := s.post(ctx, body.Bytes())
+		if err != nil {
+			return err
+		}
+		acks = append(acks, ack)
+	}
+
+	if !s.cfg.Ack {
+		return nil
+	}
+	return s.waitForAcks(ctx, acks)
+}
+
+// encode returns the event of an entry, indexing its application, level and
+// environment so searches don't have to extract them
+func (s *Splunk) encode(entry *models.LogEntry) ([]byte, error) {
+	sourcetype := s.cfg.Sourcetypes[entry.Application]
+	if sourcetype == "" {
+		sourcetype = s.cfg.Sourcetype
+	}
+	fields := map[string]string{
+		"application": entry.Application,
+		"level":       string(entry.Level),
+	}
+	if entry.Environment != "" {
+		fields["environment"] = string(entry.Environment)
+	}
+	data, err := json.Marshal(splunkEvent{
+		Time:       float64(entry.Timestamp.UnixMilli()) / 1e3,
+		Host:       entry.Hostname,
+		Source:     s.cfg.Source,
+		Sourcetype: sourcetype,
+		Index:      s.cfg.Index,
+		Event:      entry,
+		Fields:     fields,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode splunk event %w", err)
+	}
+	return data, nil
+}
+
+// splunkResponse is HEC's answer to events and acknowledgment queries
+type splunkResponse struct {
+	Text  string          `json:"text"`
+	Code  int             `json:"code"`
+	AckID int64           `json:"ackId"`
+	Acks  map[string]bool `json:"acks"`
+}
+
+// post sends one request of events and returns its acknowledgment id
+func (s *Splunk) post(ctx context.Context, body []byte) (int64, error) {
+	var resp splunkResponse
+	if err := s.do(ctx, "/services/collector/event", body, &resp); err != nil {
+		return 0, fmt.Errorf("failed to post events to splunk %w", err)
+	}
+	return resp.AckID, nil
+}
+
+// waitForAcks polls HEC until every request was indexed
+func (s *Splunk) waitForAcks(ctx context.Context, acks []int64) error {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.AckTimeout)
+	defer cancel()
+	ticker := time.NewTicker(splunkAckInterval)
+	defer ticker.Stop()
+
+	for len(acks) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("splunk didn't acknowledge %d requests in time", len(acks))
+		}
+
+		body, err := json.Marshal(map[string][]int64{"acks": acks})
+		if err != nil {
+			return err
+		}
+		var resp splunkResponse
+		if err := s.do(ctx, "/services/collector/ack", body, &resp); err != nil {
+			return fmt.Errorf("failed to query splunk acknowledgment %w", err)
+		}
+		pending := acks[:0]
+		for _, id := range acks {
+			if !resp.Acks[strconv.FormatInt(id, 10)] {
+				pending = append(pending, id)
+			}
+		}
+		acks = pending
+	}
+	return nil
+}
+
+func (s *Splunk) do(ctx context.Context, path string, body []byte, out *splunkResponse) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Splunk-Request-Channel", s.channel)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(data, out); err != nil && resp.StatusCode == http.StatusOK {
+		return fmt.Errorf("invalid response %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if out.Text != "" {
+			return fmt.Errorf("%s: %s (code %d)", resp.Status, out.Text, out.Code)
+		}
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+func (s *Splunk) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,146 @@
+// Package spool keeps log entries on disk while Kafka is unreachable. Entries
+// are appended to one file per hour and replayed oldest first.
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const fileSuffix = ".wal"
+
+type Spool struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Open returns a spool writing to dir, creating it if needed
+func Open(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory %w", err)
+	}
+	return &Spool{dir: dir}, nil
+}
+
+// Append writes one record to the file for the current hour
+func (s *Spool) Append(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := filepath.Join(s.dir, time.Now().UTC().Format("20060102-15")+fileSuffix)
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open spool file %w", err)
+	}
+	defer file.Close()
+
+	line := append(bytes.TrimRight(record, "\n"), '\n')
+	if _, err := file.Write(line); err != nil {
+		return fmt.Errorf("failed to write spool file %w", err)
+	}
+	return file.Sync()
+}
+
+// Pending reports whether any records are waiting to be replayed
+func (s *Spool) Pending() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.files()
+	return len(files) > 0, err
+}
+
+// Replay sends every spooled record in the order it was written. Records are
+// removed once sent; on the first failure the remainder is kept for the next
+// attempt and the error is returned.
+func (s *Spool) Replay(send func(record []byte) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		records, err := readRecords(name)
+		if err != nil {
+			return err
+		}
+
+		for i, record := range records {
+			if err := send(record); err != nil {
+				if rerr := rewrite(name, records[i:]); rerr != nil {
+					return fmt.Errorf("failed to keep unsent records %w", rerr)
+				}
+				return err
+			}
+		}
+
+		if err := os.Remove(name); err != nil {
+			return fmt.Errorf("failed to remove spool file %w", err)
+		}
+	}
+	return nil
+}
+
+// files lists spool files oldest first, their names sort chronologically
+func (s *Spool) files() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*"+fileSuffix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spool files %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func readRecords(name string) ([][]byte, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool file %w", err)
+	}
+	defer file.Close()
+
+	var records [][]byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		records = append(records, bytes.Clone(scanner.Bytes()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read spool file %w", err)
+	}
+	return records, nil
+}
+
+// rewrite atomically replaces name with the given records
+func rewrite(name string, records [][]byte) error {
+	tmp := name + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, record := range records {
+		writer.Write(record)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
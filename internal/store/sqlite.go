@@ -0,0 +1,525 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS logs (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	ts          INTEGER NOT NULL,
+	application TEXT NOT NULL,
+	level       TEXT NOT NULL,
+	message     TEXT NOT NULL,
+	trace_id    TEXT NOT NULL DEFAULT '',
+	span_id     TEXT NOT NULL DEFAULT '',
+	request_id  TEXT NOT NULL DEFAULT '',
+	hostname    TEXT NOT NULL DEFAULT '',
+	environment TEXT NOT NULL DEFAULT '',
+	pid         INTEGER NOT NULL DEFAULT 0,
+	metadata    TEXT,
+	entry_id    TEXT,
+	error_type    TEXT NOT NULL DEFAULT '',
+	error_message TEXT NOT NULL DEFAULT '',
+	stack_trace   TEXT NOT NULL DEFAULT '',
+	duration_ms   REAL NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS logs_ts ON logs (ts, id);
+CREATE INDEX IF NOT EXISTS logs_app_ts ON logs (application, ts, id);
+CREATE INDEX IF NOT EXISTS logs_trace ON logs (trace_id) WHERE trace_id != '';
+CREATE INDEX IF NOT EXISTS logs_request ON logs (request_id) WHERE request_id != '';
+CREATE TABLE IF NOT EXISTS log_rollups (
+	bucket      INTEGER NOT NULL,
+	application TEXT NOT NULL,
+	level       TEXT NOT NULL,
+	count       INTEGER NOT NULL,
+	PRIMARY KEY (bucket, application, level)
+);
+`
+
+// addedColumns are the columns of logs added since the first schema, which
+// databases created before them are migrated to
+var addedColumns = []struct{ name, definition string }{
+	{"entry_id", "TEXT"},
+	{"error_type", "TEXT NOT NULL DEFAULT ''"},
+	{"error_message", "TEXT NOT NULL DEFAULT ''"},
+	{"stack_trace", "TEXT NOT NULL DEFAULT ''"},
+	{"duration_ms", "REAL NOT NULL DEFAULT 0"},
+}
+
+// sqliteIndexes index added columns, once they exist. Entries without an
+// ID are stored as NULL, which doesn't conflict.
+const sqliteIndexes = `
+CREATE UNIQUE INDEX IF NOT EXISTS logs_entry_id ON logs (entry_id);
+CREATE INDEX IF NOT EXISTS logs_error_type ON logs (error_type, ts) WHERE error_type != '';
+CREATE INDEX IF NOT EXISTS logs_duration ON logs (application, ts) WHERE duration_ms > 0;
+`
+
+// SQLite stores entries in a single database file
+type SQLite struct {
+	db *sql.DB
+}
+
+func OpenSQLite(path string) (*SQLite, error) {
+	//WAL lets queries run while the ingester writes
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s %w", path, err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create schema %w", err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema %w", err)
+	}
+	return &SQLite{db: db}, nil
+}
+
+// migrate adds the columns missing from databases created by older builds
+func migrate(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('logs')`)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, column := range addedColumns {
+		if existing[column.name] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE logs ADD COLUMN ` + column.name + ` ` + column.definition); err != nil {
+			return err
+		}
+	}
+	_, err = db.Exec(sqliteIndexes)
+	return err
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// Insert writes entries in one transaction. Entries whose ID is already
+// stored are skipped, so redelivered batches don't duplicate rows.
+func (s *SQLite) Insert(ctx context.Context, entries []*models.LogEntry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO logs
+		(ts, application, level, message, trace_id, span_id, request_id, hostname, environment, pid, metadata, entry_id,
+		error_type, error_message, stack_trace, duration_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (entry_id) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range entries {
+		var metadata any
+		if len(e.Metadata) > 0 {
+			data, err := json.Marshal(e.Metadata)
+			if err != nil {
+				return fmt.Errorf("failed to encode metadata %w", err)
+			}
+			metadata = string(data)
+		}
+		var id any
+		if e.ID != "" {
+			id = e.ID
+		}
+
+		_, err := stmt.ExecContext(ctx, e.Timestamp.UnixNano(), e.Application, string(e.Level), e.Message,
+			e.TraceID, e.SpanID, e.RequestID, e.Hostname, string(e.Environment), e.PID, metadata, id,
+			e.ErrorType, e.ErrorMessage, e.StackTrace, e.DurationMs)
+		if err != nil {
+			return fmt.Errorf("failed to insert entry %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLite) Query(ctx context.Context, q Query) (Page, error) {
+	var where []string
+	var args []any
+
+	if q.Application != "" {
+		where = append(where, "application = ?")
+		args = append(args, q.Application)
+	}
+	if len(q.Levels) > 0 {
+		where = append(where, "level IN (?"+strings.Repeat(", ?", len(q.Levels)-1)+")")
+		for _, level := range q.Levels {
+			args = append(args, string(level))
+		}
+	}
+	if !q.From.IsZero() {
+		where = append(where, "ts >= ?")
+		args = append(args, q.From.UnixNano())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "ts < ?")
+		args = append(args, q.To.UnixNano())
+	}
+	if q.Text != "" {
+		where = append(where, `message LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(q.Text)+"%")
+	}
+	if q.TraceID != "" {
+		where = append(where, "trace_id = ?")
+		args = append(args, q.TraceID)
+	}
+	if q.RequestID != "" {
+		where = append(where, "request_id = ?")
+		args = append(args, q.RequestID)
+	}
+	if q.ErrorType != "" {
+		where = append(where, "error_type = ?")
+		args = append(args, q.ErrorType)
+	}
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		where = append(where, "(ts < ? OR (ts = ? AND id < ?))")
+		args = append(args, c.timestamp, c.timestamp, c.id)
+	}
+
+	query := `SELECT ` + entryColumns + ` FROM logs`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	//one extra row tells whether there is another page
+	limit := q.limit()
+	query += " ORDER BY ts DESC, id DESC LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return Page{}, fmt.Errorf("failed to query logs %w", err)
+	}
+	defer rows.Close()
+
+	var page Page
+	var last cursor
+	for rows.Next() {
+		if len(page.Entries) == limit {
+			page.Next = last.encode()
+			break
+		}
+
+		e, c, err := scanEntry(rows)
+		if err != nil {
+			return Page{}, err
+		}
+		last = c
+		page.Entries = append(page.Entries, e)
+	}
+	return page, rows.Err()
+}
+
+// entryColumns are the columns scanEntry reads, in order
+const entryColumns = `id, ts, application, level, message, trace_id, span_id, request_id,
+		hostname, environment, pid, metadata, entry_id, error_type, error_message, stack_trace, duration_ms`
+
+// scanEntry reads one row of entryColumns and the cursor pointing after it
+func scanEntry(rows *sql.Rows) (*models.LogEntry, cursor, error) {
+	var e models.LogEntry
+	var c cursor
+	var metadata, id sql.NullString
+	var level, environment string
+	if err := rows.Scan(&c.id, &c.timestamp, &e.Application, &level, &e.Message, &e.TraceID, &e.SpanID,
+		&e.RequestID, &e.Hostname, &environment, &e.PID, &metadata, &id,
+		&e.ErrorType, &e.ErrorMessage, &e.StackTrace, &e.DurationMs); err != nil {
+		return nil, cursor{}, err
+	}
+	e.Timestamp = time.Unix(0, c.timestamp)
+	e.Level = models.LogLevel(level)
+	e.Environment = models.Environment(environment)
+	e.ID = id.String
+	if metadata.Valid {
+		if err := json.Unmarshal([]byte(metadata.String), &e.Metadata); err != nil {
+			return nil, cursor{}, fmt.Errorf("failed to decode metadata %w", err)
+		}
+	}
+	return &e, c, nil
+}
+
+func (s *SQLite) Correlated(ctx context.Context, traceID, requestID string, limit int) ([]*models.LogEntry, bool, error) {
+	var where []string
+	var args []any
+	if traceID != "" {
+		where = append(where, "trace_id = ?")
+		args = append(args, traceID)
+	}
+	if requestID != "" {
+		where = append(where, "request_id = ?")
+		args = append(args, requestID)
+	}
+	if len(where) == 0 {
+		return nil, false, errors.New("a trace id or request id is required")
+	}
+	args = append(args, limit+1)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+entryColumns+` FROM logs WHERE `+strings.Join(where, " OR ")+
+		` ORDER BY ts, id LIMIT ?`, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query correlated logs %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*models.LogEntry
+	for rows.Next() {
+		if len(entries) == limit {
+			return entries, true, nil
+		}
+		e, _, err := scanEntry(rows)
+		if err != nil {
+			return nil, false, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, false, rows.Err()
+}
+
+func (s *SQLite) Counts(ctx context.Context, from, to time.Time, bucket time.Duration) ([]Count, error) {
+	if bucket <= 0 {
+		return nil, fmt.Errorf("invalid bucket size %s", bucket)
+	}
+	until := int64(math.MaxInt64)
+	if !to.IsZero() {
+		until = to.UnixNano()
+	}
+
+	//downsampled entries are counted at the start of their rollup bucket
+	rows, err := s.db.QueryContext(ctx, `SELECT (ts / ?) * ? AS bucket, application, level, SUM(n) FROM (
+			SELECT ts, application, level, 1 AS n FROM logs WHERE ts >= ? AND ts < ?
+			UNION ALL
+			SELECT bucket, application, level, count FROM log_rollups WHERE bucket >= ? AND bucket < ?
+		) GROUP BY bucket, application, level ORDER BY bucket`,
+		int64(bucket), int64(bucket), from.UnixNano(), until, from.UnixNano(), until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count logs %w", err)
+	}
+	defer rows.Close()
+
+	var counts []Count
+	for rows.Next() {
+		var c Count
+		var bucketStart int64
+		var level string
+		if err := rows.Scan(&bucketStart, &c.Application, &level, &c.Count); err != nil {
+			return nil, err
+		}
+		c.Bucket = time.Unix(0, bucketStart)
+		c.Level = models.LogLevel(level)
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+func (s *SQLite) TopMessages(ctx context.Context, from, to time.Time, levels []models.LogLevel, n int) ([]MessageCount, error) {
+	where := "ts >= ? AND ts < ?"
+	args := []any{from.UnixNano(), to.UnixNano()}
+	if len(levels) > 0 {
+		where += " AND level IN (?" + strings.Repeat(", ?", len(levels)-1) + ")"
+		for _, level := range levels {
+			args = append(args, string(level))
+		}
+	}
+	args = append(args, n)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT application, message, count FROM (
+			SELECT application, message, COUNT(*) AS count,
+				ROW_NUMBER() OVER (PARTITION BY application ORDER BY COUNT(*) DESC, message) AS position
+			FROM logs WHERE `+where+` GROUP BY application, message
+		) WHERE position <= ? ORDER BY application, count DESC, message`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages %w", err)
+	}
+	defer rows.Close()
+
+	var messages []MessageCount
+	for rows.Next() {
+		var m MessageCount
+		if err := rows.Scan(&m.Application, &m.Message, &m.Count); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+func (s *SQLite) Latencies(ctx context.Context, from, to time.Time, application string) ([]Latency, error) {
+	where := "duration_ms > 0 AND ts >= ? AND ts < ?"
+	until := int64(math.MaxInt64)
+	if !to.IsZero() {
+		until = to.UnixNano()
+	}
+	args := []any{from.UnixNano(), until}
+	if application != "" {
+		where += " AND application = ?"
+		args = append(args, application)
+	}
+
+	//exact nearest-rank percentiles, the rank of p being ceil(p * n)
+	rows, err := s.db.QueryContext(ctx, `SELECT application, n,
+			MAX(CASE WHEN position = (n * 50 + 99) / 100 THEN duration_ms END),
+			MAX(CASE WHEN position = (n * 95 + 99) / 100 THEN duration_ms END),
+			MAX(CASE WHEN position = (n * 99 + 99) / 100 THEN duration_ms END),
+			MAX(duration_ms), AVG(duration_ms)
+		FROM (
+			SELECT application, duration_ms,
+				ROW_NUMBER() OVER (PARTITION BY application ORDER BY duration_ms) AS position,
+				COUNT(*) OVER (PARTITION BY application) AS n
+			FROM logs WHERE `+where+`
+		) GROUP BY application, n ORDER BY application`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute latencies %w", err)
+	}
+	defer rows.Close()
+
+	var latencies []Latency
+	for rows.Next() {
+		var l Latency
+		if err := rows.Scan(&l.Application, &l.Count, &l.P50, &l.P95, &l.P99, &l.Max, &l.Mean); err != nil {
+			return nil, err
+		}
+		latencies = append(latencies, l)
+	}
+	return latencies, rows.Err()
+}
+
+func (s *SQLite) Patterns(ctx context.Context, from time.Time, application string, n int) ([]PatternCount, error) {
+	where := "ts >= ? AND json_extract(metadata, '$.pattern_id') IS NOT NULL"
+	args := []any{from.UnixNano()}
+	if application != "" {
+		where += " AND application = ?"
+		args = append(args, application)
+	}
+	args = append(args, n)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT application, pattern_id, pattern, count FROM (
+			SELECT application, json_extract(metadata, '$.pattern_id') AS pattern_id,
+				MAX(json_extract(metadata, '$.pattern')) AS pattern, COUNT(*) AS count,
+				ROW_NUMBER() OVER (PARTITION BY application ORDER BY COUNT(*) DESC) AS position
+			FROM logs WHERE `+where+` GROUP BY application, pattern_id
+		) WHERE position <= ? ORDER BY application, count DESC, pattern_id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count patterns %w", err)
+	}
+	defer rows.Close()
+
+	var patterns []PatternCount
+	for rows.Next() {
+		var p PatternCount
+		var pattern sql.NullString
+		if err := rows.Scan(&p.Application, &p.ID, &pattern, &p.Count); err != nil {
+			return nil, err
+		}
+		p.Pattern = pattern.String
+		patterns = append(patterns, p)
+	}
+	return patterns, rows.Err()
+}
+
+// Downsample replaces the entries of levels older than before with their
+// counts per application, level and bucket, which Counts keeps reporting.
+// It works through a day at a time, each in its own transaction, and
+// returns how many entries were removed.
+func (s *SQLite) Downsample(ctx context.Context, before time.Time, levels []models.LogLevel, bucket time.Duration) (int64, error) {
+	if bucket <= 0 || bucket > 24*time.Hour || (24*time.Hour)%bucket != 0 {
+		return 0, fmt.Errorf("invalid rollup bucket %s, expected a divisor of a day", bucket)
+	}
+	if len(levels) == 0 {
+		return 0, nil
+	}
+	//only whole buckets are rolled up, so a bucket is never counted twice
+	cutoff := before.Truncate(bucket).UnixNano()
+
+	var oldest sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, `SELECT MIN(ts) FROM logs`).Scan(&oldest); err != nil {
+		return 0, fmt.Errorf("failed to find the oldest entry %w", err)
+	}
+	if !oldest.Valid {
+		return 0, nil
+	}
+
+	in := "level IN (?" + strings.Repeat(", ?", len(levels)-1) + ")"
+	day := int64(24 * time.Hour)
+	var removed int64
+	for start := (oldest.Int64 / day) * day; start < cutoff; start += day {
+		end := min(start+day, cutoff)
+		n, err := s.downsample(ctx, start, end, in, levels, int64(bucket))
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+func (s *SQLite) downsample(ctx context.Context, start, end int64, in string, levels []models.LogLevel, bucket int64) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	args := []any{bucket, bucket, start, end}
+	for _, level := range levels {
+		args = append(args, string(level))
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO log_rollups (bucket, application, level, count)
+		SELECT (ts / ?) * ? AS b, application, level, COUNT(*) FROM logs
+		WHERE ts >= ? AND ts < ? AND `+in+` GROUP BY b, application, level
+		ON CONFLICT (bucket, application, level) DO UPDATE SET count = count + excluded.count`, args...); err != nil {
+		return 0, fmt.Errorf("failed to roll up entries %w", err)
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM logs WHERE ts >= ? AND ts < ? AND `+in, args[2:]...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete rolled up entries %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return removed, tx.Commit()
+}
+
+// Vacuum returns the space freed by deleted entries to the file system
+func (s *SQLite) Vacuum(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `VACUUM`)
+	return err
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
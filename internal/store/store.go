@@ -0,0 +1,145 @@
+// Package store persists log entries for search
+package store
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+	//MaxCorrelated bounds the entries of one trace or request
+	MaxCorrelated = 10000
+)
+
+// Query selects stored entries, newest first. Empty fields match everything.
+type Query struct {
+	Application string
+	Levels      []models.LogLevel
+	From        time.Time //inclusive
+	To          time.Time //exclusive
+	Text        string    //substring of the message, case-insensitive
+	TraceID     string
+	RequestID   string
+	ErrorType   string //such as *fs.PathError
+	Limit       int
+	//Cursor continues from the page that returned it
+	Cursor string
+}
+
+// Page is one page of query results
+type Page struct {
+	Entries []*models.LogEntry `json:"entries"`
+	//Next is the cursor of the following page, empty on the last page
+	Next string `json:"next_cursor,omitempty"`
+}
+
+// Count is the number of entries of one application and level in a time bucket
+type Count struct {
+	Bucket      time.Time       `json:"bucket"`
+	Application string          `json:"application"`
+	Level       models.LogLevel `json:"level"`
+	Count       int64           `json:"count"`
+}
+
+// MessageCount is the number of entries of one application with the same message
+type MessageCount struct {
+	Application string `json:"application"`
+	Message     string `json:"message"`
+	Count       int64  `json:"count"`
+}
+
+// PatternCount is the number of entries of one application sharing a
+// pattern, found by the processor's pattern stage
+type PatternCount struct {
+	Application string `json:"application"`
+	ID          string `json:"id"`
+	Pattern     string `json:"pattern"`
+	Count       int64  `json:"count"`
+}
+
+// Latency is the distribution of the durations of one application's
+// entries, in milliseconds
+type Latency struct {
+	Application string  `json:"application"`
+	Count       int64   `json:"count"`
+	P50         float64 `json:"p50_ms"`
+	P95         float64 `json:"p95_ms"`
+	P99         float64 `json:"p99_ms"`
+	Max         float64 `json:"max_ms"`
+	Mean        float64 `json:"mean_ms"`
+}
+
+// Store saves entries and searches them
+type Store interface {
+	Insert(ctx context.Context, entries []*models.LogEntry) error
+	Query(ctx context.Context, q Query) (Page, error)
+	//Counts returns entry counts from from until to, or now when to is zero,
+	//grouped into buckets of the given size, oldest first
+	Counts(ctx context.Context, from, to time.Time, bucket time.Duration) ([]Count, error)
+	//TopMessages returns the n most frequent messages of each application
+	//between from and to among entries of levels, every level when empty
+	TopMessages(ctx context.Context, from, to time.Time, levels []models.LogLevel, n int) ([]MessageCount, error)
+	//Patterns returns the n most frequent patterns of each application since
+	//from, or of application alone when it is set, most frequent first
+	Patterns(ctx context.Context, from time.Time, application string, n int) ([]PatternCount, error)
+	//Latencies returns the duration percentiles of each application's
+	//entries from from until to, or now when to is zero, or of application
+	//alone when it is set. Entries without a duration are left out.
+	Latencies(ctx context.Context, from, to time.Time, application string) ([]Latency, error)
+	//Correlated returns the entries of a trace or request, or of both when
+	//both are set, oldest first. It reports whether more than limit matched.
+	Correlated(ctx context.Context, traceID, requestID string, limit int) ([]*models.LogEntry, bool, error)
+	Close() error
+}
+
+// ErrInvalidCursor is returned for cursors not produced by the store
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor points after the last entry of a page, ordered by timestamp then id
+type cursor struct {
+	timestamp int64
+	id        int64
+}
+
+func (c cursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%d", c.timestamp, c.id))
+}
+
+func decodeCursor(s string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	if c.timestamp, err = strconv.ParseInt(ts, 10, 64); err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	if c.id, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+func (q Query) limit() int {
+	switch {
+	case q.Limit <= 0:
+		return DefaultLimit
+	case q.Limit > MaxLimit:
+		return MaxLimit
+	}
+	return q.Limit
+}
@@ -0,0 +1,238 @@
+// Package syslog receives syslog messages over UDP and TCP and turns them
+// into log entries. Both RFC 5424 and the older BSD format of RFC 3164 are
+// understood.
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+// severities maps syslog severities 0 (emergency) to 7 (debug) onto levels
+var severities = [8]models.LogLevel{
+	models.FATAL, //emergency
+	models.FATAL, //alert
+	models.FATAL, //critical
+	models.ERROR,
+	models.WARN,
+	models.INFO, //notice
+	models.INFO,
+	models.DEBUG,
+}
+
+// Level returns the level of a syslog severity, 0 (emergency) to 7 (debug)
+func Level(severity int) models.LogLevel {
+	return severities[min(max(severity, 0), 7)]
+}
+
+// Severity returns the syslog severity a level is sent as
+func Severity(level models.LogLevel) int {
+	switch level {
+	case models.FATAL:
+		return 2 //critical
+	case models.ERROR:
+		return 3
+	case models.WARN:
+		return 4
+	case models.DEBUG, models.TRACE:
+		return 7
+	}
+	return 6 //informational
+}
+
+var facilities = [24]string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// nilValue stands for an empty field in RFC 5424
+const nilValue = "-"
+
+// Parse turns one syslog message into an entry. Messages without an
+// application name are logged as defaultApp.
+func Parse(data []byte, defaultApp string, now time.Time) (*models.LogEntry, error) {
+	data = bytes.TrimRight(data, "\r\n\x00")
+	if len(data) == 0 {
+		return nil, errors.New("empty syslog message")
+	}
+
+	//without a priority the whole message is the text, as user.notice
+	pri, rest := 13, data
+	if data[0] == '<' {
+		end := bytes.IndexByte(data, '>')
+		if end < 2 || end > 4 {
+			return nil, errors.New("invalid syslog priority")
+		}
+		var err error
+		if pri, err = strconv.Atoi(string(data[1:end])); err != nil || pri > 191 {
+			return nil, fmt.Errorf("invalid syslog priority %q", data[1:end])
+		}
+		rest = data[end+1:]
+	}
+
+	entry := &models.LogEntry{
+		Level:    severities[pri%8],
+		Metadata: map[string]any{"facility": facilities[pri/8]},
+	}
+	var err error
+	if len(rest) > 1 && rest[0] == '1' && rest[1] == ' ' {
+		err = parse5424(entry, string(rest[2:]))
+	} else {
+		parse3164(entry, string(rest), now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = now
+	}
+	if entry.Application == "" {
+		entry.Application = defaultApp
+	}
+	if strings.TrimSpace(entry.Message) == "" {
+		return nil, errors.New("syslog message has no text")
+	}
+	return entry, nil
+}
+
+// parse5424 reads the fields after the version of an RFC 5424 message
+func parse5424(entry *models.LogEntry, msg string) error {
+	var fields [5]string
+	for i := range fields {
+		var ok bool
+		if fields[i], msg, ok = strings.Cut(msg, " "); !ok && i < len(fields)-1 {
+			return errors.New("truncated RFC 5424 header")
+		}
+	}
+	timestamp, hostname, app, procID, msgID := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	if timestamp != nilValue {
+		ts, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return fmt.Errorf("invalid RFC 5424 timestamp %w", err)
+		}
+		entry.Timestamp = ts
+	}
+	if hostname != nilValue {
+		entry.Hostname = hostname
+	}
+	if app != nilValue {
+		entry.Application = app
+	}
+	setProcID(entry, procID)
+	if msgID != nilValue {
+		entry.Metadata["msgid"] = msgID
+	}
+
+	msg, err := structuredData(entry, msg)
+	if err != nil {
+		return err
+	}
+	entry.Message = strings.TrimPrefix(strings.TrimPrefix(msg, " "), "\ufeff")
+	return nil
+}
+
+// structuredData copies SD-PARAMs into metadata as SD-ID.name and returns
+// the rest of the message
+func structuredData(entry *models.LogEntry, msg string) (string, error) {
+	if strings.HasPrefix(msg, nilValue) {
+		return msg[1:], nil
+	}
+	for strings.HasPrefix(msg, "[") {
+		end := strings.IndexAny(msg, " ]")
+		if end < 0 {
+			return "", errors.New("unterminated structured data")
+		}
+		id := msg[1:end]
+		msg = msg[end:]
+
+		for strings.HasPrefix(msg, " ") {
+			name, rest, ok := strings.Cut(msg[1:], "=\"")
+			if !ok {
+				return "", fmt.Errorf("invalid structured data param in %s", id)
+			}
+			value, rest, err := sdValue(rest)
+			if err != nil {
+				return "", err
+			}
+			entry.Metadata[id+"."+name] = value
+			msg = rest
+		}
+		if !strings.HasPrefix(msg, "]") {
+			return "", fmt.Errorf("unterminated structured data element %s", id)
+		}
+		msg = msg[1:]
+	}
+	return msg, nil
+}
+
+// sdValue reads a quoted param value up to its closing quote, unescaping \" \\ and \]
+func sdValue(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0:
+			i++
+			b.WriteByte(s[i])
+		case c == '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errors.New("unterminated structured data value")
+}
+
+// parse3164 reads a BSD syslog message: "Mmm dd hh:mm:ss host tag[pid]: text".
+// The format is loose, so anything that doesn't fit becomes the text.
+func parse3164(entry *models.LogEntry, msg string, now time.Time) {
+	const stampLen = len(time.Stamp)
+	if len(msg) > stampLen && msg[stampLen] == ' ' {
+		if ts, err := time.ParseInLocation(time.Stamp, msg[:stampLen], time.Local); err == nil {
+			//the year isn't sent, pick the one that puts the message closest to now
+			ts = ts.AddDate(now.Year(), 0, 0)
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			entry.Timestamp = ts
+			msg = msg[stampLen+1:]
+
+			//a hostname follows the timestamp unless the tag comes straight away
+			if host, rest, ok := strings.Cut(msg, " "); ok && !strings.HasSuffix(host, ":") && !strings.Contains(host, "[") {
+				entry.Hostname = host
+				msg = rest
+			}
+		}
+	}
+
+	//the tag is the program name, optionally with [pid], ending in a colon
+	if tag, rest, ok := strings.Cut(msg, ":"); ok && tag != "" && !strings.ContainsAny(tag, " \t") {
+		if name, pid, ok := strings.Cut(tag, "["); ok {
+			tag = name
+			setProcID(entry, strings.TrimSuffix(pid, "]"))
+		}
+		entry.Application = tag
+		msg = strings.TrimPrefix(rest, " ")
+	}
+	entry.Message = msg
+}
+
+// setProcID stores the process id as the PID when it is numeric
+func setProcID(entry *models.LogEntry, procID string) {
+	if procID == "" || procID == nilValue {
+		return
+	}
+	if pid, err := strconv.Atoi(procID); err == nil {
+		entry.PID = pid
+		return
+	}
+	entry.Metadata["procid"] = procID
+}
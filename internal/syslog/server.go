@@ -0,0 +1,178 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"kafka-logging-system/internal/models"
+)
+
+// maxMessageSize bounds a single message, larger TCP frames are rejected
+const maxMessageSize = 64 * 1024
+
+// Server parses the messages it receives and hands them to Handler, which
+// may be called from several goroutines at once
+type Server struct {
+	//DefaultApp names messages that don't carry an application
+	DefaultApp string
+	Handler    func(entry *models.LogEntry)
+	//Invalid is called for messages that can't be parsed, when set
+	Invalid func(remote string, err error)
+
+	wg sync.WaitGroup
+}
+
+func (s *Server) handle(data []byte, remote net.Addr) {
+	entry, err := Parse(data, s.DefaultApp, time.Now())
+	if err != nil {
+		if s.Invalid != nil {
+			s.Invalid(remote.String(), err)
+		}
+		return
+	}
+	if host, _, err := net.SplitHostPort(remote.String()); err == nil {
+		entry.Metadata["source_ip"] = host
+	}
+	s.Handler(entry)
+}
+
+// ListenUDP receives one message per datagram on addr until ctx is done
+func (s *Server) ListenUDP(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on udp %s %w", addr, err)
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		buf := make([]byte, maxMessageSize)
+		for {
+			n, remote, err := conn.ReadFrom(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("Syslog UDP listener stopped", "err", err)
+				}
+				return
+			}
+			s.handle(buf[:n], remote)
+		}
+	}()
+	return nil
+}
+
+// ListenTCP accepts connections on addr until ctx is done. Messages are
+// framed by octet counting (RFC 6587) or, when a frame doesn't start with
+// a length, by newlines.
+func (s *Server) ListenTCP(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on tcp %s %w", addr, err)
+	}
+
+	var mu sync.Mutex
+	conns := make(map[net.Conn]bool)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		<-ctx.Done()
+		listener.Close()
+		mu.Lock()
+		for conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+	}()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("Syslog TCP listener stopped", "err", err)
+				}
+				return
+			}
+			mu.Lock()
+			conns[conn] = true
+			mu.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.serveConn(conn)
+				mu.Lock()
+				delete(conns, conn)
+				mu.Unlock()
+				conn.Close()
+			}()
+		}
+	}()
+	return nil
+}
+
+// serveConn reads framed messages from one TCP connection
+func (s *Server) serveConn(conn net.Conn) {
+	r := bufio.NewReaderSize(conn, maxMessageSize)
+	for {
+		first, err := r.Peek(1)
+		if err != nil {
+			return
+		}
+
+		var msg []byte
+		if first[0] >= '1' && first[0] <= '9' {
+			msg, err = readOctetCounted(r)
+		} else {
+			msg, err = r.ReadSlice('\n')
+			if err == io.EOF && len(msg) > 0 {
+				err = nil
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				slog.Warn("Closing syslog connection", "remote", conn.RemoteAddr().String(), "err", err)
+			}
+			return
+		}
+		s.handle(msg, conn.RemoteAddr())
+	}
+}
+
+// readOctetCounted reads a "LEN SP MSG" frame
+func readOctetCounted(r *bufio.Reader) ([]byte, error) {
+	prefix, err := r.ReadSlice(' ')
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.Atoi(string(prefix[:len(prefix)-1]))
+	if err != nil || size <= 0 || size > maxMessageSize {
+		return nil, fmt.Errorf("invalid frame length %q", prefix)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Wait blocks until the listeners and connections have stopped
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
@@ -0,0 +1,77 @@
+package tailer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fingerprintSize is how much of the start of a file identifies it, so a
+// file renamed by rotation is recognised and a replaced one isn't
+const fingerprintSize = 1024
+
+// Position is how far a file has been read
+type Position struct {
+	Offset int64 `json:"offset"`
+	//Fingerprint is a hash of the first FingerprintSize bytes of the file
+	Fingerprint     string `json:"fingerprint"`
+	FingerprintSize int    `json:"fingerprint_size"`
+}
+
+// fingerprint hashes the start of f, up to fingerprintSize bytes
+func fingerprint(f *os.File) (string, int, error) {
+	buf := make([]byte, fingerprintSize)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return "", 0, fmt.Errorf("failed to read %s %w", f.Name(), err)
+	}
+	sum := sha256.Sum256(buf[:n])
+	return hex.EncodeToString(sum[:]), n, nil
+}
+
+// matches reports whether f starts with the bytes the position was saved for
+func (p Position) matches(f *os.File) bool {
+	buf := make([]byte, p.FingerprintSize)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		return false
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]) == p.Fingerprint
+}
+
+// loadPositions reads the position file, a missing file is not an error
+func loadPositions(path string) (map[string]Position, error) {
+	positions := make(map[string]Position)
+	if path == "" {
+		return positions, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		return positions, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read positions %w", err)
+	}
+	if err := json.Unmarshal(data, &positions); err != nil {
+		return nil, fmt.Errorf("failed to decode positions %w", err)
+	}
+	return positions, nil
+}
+
+// savePositions writes the position file atomically
+func savePositions(path string, positions map[string]Position) error {
+	data, err := json.MarshalIndent(positions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode positions %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write positions %w", err)
+	}
+	return os.Rename(tmp, path)
+}
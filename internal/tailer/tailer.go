@@ -0,0 +1,336 @@
+// Package tailer follows log files matching glob patterns like tail -F,
+// surviving rotation and truncation, and remembers how far it read in a
+// position file so a restarted agent resumes where it stopped.
+package tailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Config selects the files to follow
+type Config struct {
+	//Patterns are filepath.Glob patterns, files matching later are picked up too
+	Patterns []string
+	//PositionsFile keeps read offsets across restarts, none are kept when empty
+	PositionsFile string
+	PollInterval  time.Duration
+	//FromStart reads the files found at startup from the beginning. Otherwise
+	//only lines written after startup are read, unless a position was saved.
+	FromStart bool
+	//MaxLineSize splits longer lines
+	MaxLineSize int
+}
+
+// Line is one line of a file, without its line ending
+type Line struct {
+	Path string
+	Data []byte
+}
+
+type Tailer struct {
+	cfg       Config
+	positions map[string]Position
+	files     map[string]*file
+	started   bool
+}
+
+// file is an open file being followed
+type file struct {
+	path string
+	f    *os.File
+	info os.FileInfo
+	//offset is where the first unhandled line starts
+	offset  int64
+	partial []byte
+}
+
+// New returns a tailer for cfg, loading the saved positions
+func New(cfg Config) (*Tailer, error) {
+	if len(cfg.Patterns) == 0 {
+		return nil, errors.New("no files to follow")
+	}
+	for _, pattern := range cfg.Patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q %w", pattern, err)
+		}
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.MaxLineSize <= 0 {
+		cfg.MaxLineSize = 1 << 20
+	}
+
+	positions, err := loadPositions(cfg.PositionsFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Tailer{cfg: cfg, positions: positions, files: make(map[string]*file)}, nil
+}
+
+// Run follows the files until ctx is done, calling handle for every line in
+// the order it was written. A line counts as read once handle returns, and
+// an error from handle stops Run. Positions are saved after every poll.
+func (t *Tailer) Run(ctx context.Context, handle func(Line) error) error {
+	ticker := time.NewTicker(t.cfg.PollInterval)
+	defer ticker.Stop()
+	defer t.close()
+
+	for {
+		err := t.poll(ctx, handle)
+		if serr := t.save(); serr != nil {
+			slog.Error("Failed to save positions", "err", serr)
+		}
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll picks up new files, follows rotated ones and reads what was appended
+func (t *Tailer) poll(ctx context.Context, handle func(Line) error) error {
+	paths, err := t.glob()
+	if err != nil {
+		return err
+	}
+
+	tracked := make([]string, 0, len(t.files))
+	for path := range t.files {
+		tracked = append(tracked, path)
+	}
+	sort.Strings(tracked)
+
+	for _, path := range tracked {
+		if err := ctx.Err(); err != nil {
+			return nil
+		}
+		f := t.files[path]
+		info, err := os.Stat(path)
+		if err == nil && os.SameFile(info, f.info) {
+			if info.Size() < f.offset+int64(len(f.partial)) {
+				slog.Info("File was truncated, reading it from the start", "path", path)
+				if err := f.rewind(); err != nil {
+					return err
+				}
+			}
+			if err := t.read(ctx, f, handle); err != nil {
+				return err
+			}
+			continue
+		}
+
+		//The path holds another file or none now, finish the old one first
+		if err := t.read(ctx, f, handle); err != nil {
+			return err
+		}
+		delete(t.files, path)
+		if moved := t.renamed(f, paths); moved != "" {
+			slog.Info("File was rotated", "path", path, "moved", moved)
+			f.path = moved
+			t.files[moved] = f
+			continue
+		}
+		if err := f.flush(handle); err != nil {
+			return err
+		}
+		f.f.Close()
+	}
+
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return nil
+		}
+		if t.files[path] != nil {
+			continue
+		}
+		f, err := t.open(path)
+		if err != nil {
+			slog.Error("Failed to follow", "err", err)
+			continue
+		}
+		t.files[path] = f
+		if err := t.read(ctx, f, handle); err != nil {
+			return err
+		}
+	}
+	t.started = true
+	return nil
+}
+
+// glob returns the files matching any pattern
+func (t *Tailer) glob() ([]string, error) {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, pattern := range t.cfg.Patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q %w", pattern, err)
+		}
+		for _, path := range matches {
+			if info, err := os.Stat(path); err != nil || info.IsDir() || seen[path] {
+				continue
+			}
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// renamed returns the untracked path the file was rotated to, if it still matches
+func (t *Tailer) renamed(f *file, paths []string) string {
+	for _, path := range paths {
+		if t.files[path] != nil {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && os.SameFile(info, f.info) {
+			return path
+		}
+	}
+	return ""
+}
+
+// open starts following path from its saved position, or where the config says
+func (t *Tailer) open(path string) (*file, error) {
+	osFile, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := osFile.Stat()
+	if err != nil {
+		osFile.Close()
+		return nil, err
+	}
+	f := &file{path: path, f: osFile, info: info}
+
+	pos, ok := t.position(path, osFile)
+	_, replaced := t.positions[path]
+	switch {
+	case ok && pos.Offset <= info.Size():
+		f.offset = pos.Offset
+	case ok:
+		slog.Info("File is shorter than its saved position, reading it from the start", "path", path)
+	case !t.started && !t.cfg.FromStart && !replaced:
+		//a file replaced while the agent was stopped is read in full
+		f.offset = info.Size()
+	}
+	if _, err := osFile.Seek(f.offset, io.SeekStart); err != nil {
+		osFile.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// position returns the saved position of path, or of the file it was renamed
+// from, as long as the file still starts the same way
+func (t *Tailer) position(path string, f *os.File) (Position, bool) {
+	if pos, ok := t.positions[path]; ok && pos.matches(f) {
+		return pos, true
+	}
+	for _, pos := range t.positions {
+		if pos.FingerprintSize > 0 && pos.matches(f) {
+			return pos, true
+		}
+	}
+	return Position{}, false
+}
+
+// read handles every complete line appended to f
+func (t *Tailer) read(ctx context.Context, f *file, handle func(Line) error) error {
+	buf := make([]byte, 64*1024)
+	for ctx.Err() == nil {
+		n, err := f.f.Read(buf)
+		if n > 0 {
+			data := append(f.partial, buf[:n]...)
+			for {
+				end := bytes.IndexByte(data, '\n')
+				if end < 0 {
+					break
+				}
+				if err := f.emit(data[:end], end+1, handle); err != nil {
+					return err
+				}
+				data = data[end+1:]
+			}
+			for len(data) >= t.cfg.MaxLineSize {
+				if err := f.emit(data[:t.cfg.MaxLineSize], t.cfg.MaxLineSize, handle); err != nil {
+					return err
+				}
+				data = data[t.cfg.MaxLineSize:]
+			}
+			f.partial = bytes.Clone(data)
+		}
+		if err == io.EOF || n == 0 {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s %w", f.path, err)
+		}
+	}
+	return nil
+}
+
+// emit handles one line that took size bytes in the file
+func (f *file) emit(line []byte, size int, handle func(Line) error) error {
+	if err := handle(Line{Path: f.path, Data: bytes.TrimSuffix(line, []byte("\r"))}); err != nil {
+		return err
+	}
+	f.offset += int64(size)
+	return nil
+}
+
+// flush handles a last line that was never terminated
+func (f *file) flush(handle func(Line) error) error {
+	if len(f.partial) == 0 {
+		return nil
+	}
+	err := f.emit(f.partial, len(f.partial), handle)
+	f.partial = nil
+	return err
+}
+
+// rewind reads a truncated file from the start again
+func (f *file) rewind() error {
+	f.offset, f.partial = 0, nil
+	_, err := f.f.Seek(0, io.SeekStart)
+	return err
+}
+
+// save records the position of every followed file
+func (t *Tailer) save() error {
+	if t.cfg.PositionsFile == "" {
+		return nil
+	}
+	positions := make(map[string]Position, len(t.files))
+	for path, f := range t.files {
+		sum, size, err := fingerprint(f.f)
+		if err != nil {
+			return err
+		}
+		positions[path] = Position{Offset: f.offset, Fingerprint: sum, FingerprintSize: size}
+	}
+	t.positions = positions
+	return savePositions(t.cfg.PositionsFile, positions)
+}
+
+func (t *Tailer) close() {
+	for _, f := range t.files {
+		f.f.Close()
+	}
+}
@@ -0,0 +1,230 @@
+// Package topk tracks the most frequent keys of a stream over a sliding
+// window in fixed memory, such as the loudest applications and messages.
+package topk
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/processor"
+)
+
+// Sketch dimensions, an estimate exceeds the true count by at most
+// 2/sketchWidth of the window's total with probability 1-(1/2)^sketchDepth
+const (
+	sketchDepth = 4
+	sketchWidth = 2048
+)
+
+// Count is the estimated number of times a key was seen in the window
+type Count struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// sketch is a count-min sketch of one slice of the window
+type sketch struct {
+	start  time.Time
+	total  int64
+	counts [sketchDepth][sketchWidth]uint32
+}
+
+// Tracker estimates key counts over a sliding window with count-min
+// sketches, one per slice of the window so old slices can be dropped
+// whole, and keeps the keys most likely to be among the top k as
+// candidates. It is safe for concurrent use.
+type Tracker struct {
+	k      int
+	slice  time.Duration
+	slices int
+
+	mu     sync.Mutex
+	ring   []*sketch
+	latest int //index of the newest slice in ring
+	//candidates are the keys that may be among the top, with their
+	//estimate when last seen
+	candidates map[string]int64
+}
+
+// New returns a tracker of the k most frequent keys over window, which
+// slides by window/slices at a time
+func New(k int, window time.Duration, slices int) *Tracker {
+	slices = max(slices, 1)
+	t := &Tracker{
+		k:          max(k, 1),
+		slice:      max(window/time.Duration(slices), time.Millisecond),
+		slices:     slices,
+		ring:       make([]*sketch, slices),
+		candidates: make(map[string]int64),
+	}
+	for i := range t.ring {
+		t.ring[i] = &sketch{}
+	}
+	return t
+}
+
+// Add counts n occurrences of key at now
+func (t *Tracker) Add(key string, n int64, now time.Time) {
+	indexes := hashes(key)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	current := t.advance(now)
+	current.total += n
+	for row, col := range indexes {
+		current.counts[row][col] += uint32(n)
+	}
+	estimate := t.estimate(indexes)
+
+	if _, ok := t.candidates[key]; ok || len(t.candidates) < t.capacity() {
+		t.candidates[key] = estimate
+		return
+	}
+	//replace the weakest candidate when the key overtakes it
+	weakest, least := "", int64(-1)
+	for candidate, count := range t.candidates {
+		if least < 0 || count < least {
+			weakest, least = candidate, count
+		}
+	}
+	if estimate > least {
+		delete(t.candidates, weakest)
+		t.candidates[key] = estimate
+	}
+}
+
+// Top returns the k keys with the highest estimates over the window ending
+// at now, most frequent first, and the total count of the window
+func (t *Tracker) Top(now time.Time) ([]Count, int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.advance(now)
+
+	var total int64
+	for _, s := range t.ring {
+		total += s.total
+	}
+	top := make([]Count, 0, len(t.candidates))
+	for key, estimate := range t.candidates {
+		top = append(top, Count{Key: key, Count: estimate})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Key < top[j].Key
+	})
+	if len(top) > t.k {
+		top = top[:t.k]
+	}
+	return top, total
+}
+
+// capacity is how many candidates are kept, more than k so a key climbing
+// into the top isn't lost to one that is about to leave the window
+func (t *Tracker) capacity() int {
+	return 4 * t.k
+}
+
+// advance makes the slice containing now the newest, clearing the slices
+// that fell out of the window, and returns it. t.mu must be held.
+func (t *Tracker) advance(now time.Time) *sketch {
+	start := now.Truncate(t.slice)
+	current := t.ring[t.latest]
+	if !start.After(current.start) {
+		//late additions count in the newest slice
+		return current
+	}
+
+	steps := int(start.Sub(current.start) / t.slice)
+	if current.start.IsZero() || steps > t.slices {
+		steps = t.slices
+	}
+	for range steps {
+		t.latest = (t.latest + 1) % t.slices
+		*t.ring[t.latest] = sketch{}
+	}
+	t.ring[t.latest].start = start
+
+	//estimates only shrink as slices are dropped, keys with nothing left in
+	//the window make room for new ones
+	for key := range t.candidates {
+		if estimate := t.estimate(hashes(key)); estimate > 0 {
+			t.candidates[key] = estimate
+		} else {
+			delete(t.candidates, key)
+		}
+	}
+	return t.ring[t.latest]
+}
+
+// estimate is the smallest counter of the key summed over the window. t.mu
+// must be held.
+func (t *Tracker) estimate(indexes [sketchDepth]int) int64 {
+	var least int64 = -1
+	for row, col := range indexes {
+		var sum int64
+		for _, s := range t.ring {
+			sum += int64(s.counts[row][col])
+		}
+		if least < 0 || sum < least {
+			least = sum
+		}
+	}
+	return least
+}
+
+// hashes picks the counter of the key in each row, by double hashing
+func hashes(key string) [sketchDepth]int {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)|1
+
+	var indexes [sketchDepth]int
+	for row := range indexes {
+		indexes[row] = int((h1 + uint32(row)*h2) % sketchWidth)
+	}
+	return indexes
+}
+
+// Sources tracks the loudest applications and message patterns of a log stream
+type Sources struct {
+	Applications *Tracker
+	Patterns     *Tracker
+}
+
+// Noisy lists the loudest sources over the window
+type Noisy struct {
+	Window       string  `json:"window"`
+	Total        int64   `json:"total"`
+	Applications []Count `json:"applications"`
+	//Patterns are keyed by application and message template
+	Patterns []Count `json:"patterns"`
+}
+
+// NewSources tracks the k loudest applications and patterns over window
+func NewSources(k int, window time.Duration) *Sources {
+	return &Sources{Applications: New(k, window, 10), Patterns: New(k, window, 10)}
+}
+
+// Observe counts one entry at now
+func (s *Sources) Observe(entry *models.LogEntry, now time.Time) {
+	s.Applications.Add(entry.Application, 1, now)
+	s.Patterns.Add(entry.Application+": "+processor.MessageTemplate(entry.Message), 1, now)
+}
+
+// Top returns the loudest sources over the window ending at now
+func (s *Sources) Top(now time.Time) Noisy {
+	apps, total := s.Applications.Top(now)
+	patterns, _ := s.Patterns.Top(now)
+	return Noisy{
+		Window:       (s.Applications.slice * time.Duration(s.Applications.slices)).String(),
+		Total:        total,
+		Applications: apps,
+		Patterns:     patterns,
+	}
+}
@@ -0,0 +1,188 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/pkg/consumer"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// producerCarrier reads and writes the trace context in the headers of a
+// message being produced
+type producerCarrier struct{ msg *sarama.ProducerMessage }
+
+func (c producerCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set replaces the header, forwarded messages already carry the context of
+// the span they were consumed in
+func (c producerCarrier) Set(key, value string) {
+	for i, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c producerCarrier) Keys() []string {
+	keys := make([]string, len(c.msg.Headers))
+	for i, h := range c.msg.Headers {
+		keys[i] = string(h.Key)
+	}
+	return keys
+}
+
+// consumerCarrier reads the trace context from the headers of a consumed message
+type consumerCarrier []*sarama.RecordHeader
+
+func (c consumerCarrier) Get(key string) string {
+	for _, h := range c {
+		if h != nil && string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c consumerCarrier) Set(string, string) {}
+
+func (c consumerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for _, h := range c {
+		if h != nil {
+			keys = append(keys, string(h.Key))
+		}
+	}
+	return keys
+}
+
+// EntryContext returns the context a span about entry starts from. Entries
+// carrying W3C trace and span ids join the trace of the request that logged
+// them, unless ctx already belongs to it. The span of ctx is then returned
+// as a link, so the two traces stay connected.
+func EntryContext(ctx context.Context, entry *models.LogEntry) (context.Context, []trace.Link) {
+	traceID, err := trace.TraceIDFromHex(entry.TraceID)
+	if err != nil {
+		return ctx, nil
+	}
+	spanID, err := trace.SpanIDFromHex(entry.SpanID)
+	if err != nil {
+		return ctx, nil
+	}
+	current := trace.SpanContextFromContext(ctx)
+	if current.TraceID() == traceID {
+		return ctx, nil
+	}
+
+	var links []trace.Link
+	if current.IsValid() {
+		links = append(links, trace.Link{SpanContext: current})
+	}
+	//entries don't say whether their trace was sampled, Setup samples such
+	//parents by their trace id so every service decides the same way
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Remote:  true,
+	})
+	return trace.ContextWithRemoteSpanContext(ctx, parent), links
+}
+
+// StartPublish starts the producer span of a message and writes its context
+// into the message headers, so consumers continue the trace
+func StartPublish(ctx context.Context, msg *sarama.ProducerMessage, links ...trace.Link) trace.Span {
+	ctx, span := Tracer().Start(ctx, msg.Topic+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingOperationTypeSend,
+			semconv.MessagingDestinationName(msg.Topic),
+		),
+	)
+	otel.GetTextMapPropagator().Inject(ctx, producerCarrier{msg})
+	return span
+}
+
+// EndPublish records where a message was written and ends its span.
+// Queued messages of async producers have no partition yet, reported as -1.
+func EndPublish(span trace.Span, partition int32, offset int64, err error) {
+	if err == nil && partition >= 0 {
+		span.SetAttributes(
+			semconv.MessagingDestinationPartitionID(strconv.Itoa(int(partition))),
+			semconv.MessagingKafkaOffset(int(offset)),
+		)
+	}
+	End(span, err)
+}
+
+// MessageContext returns ctx carrying the trace context of a consumed message
+func MessageContext(ctx context.Context, message *sarama.ConsumerMessage) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, consumerCarrier(message.Headers))
+}
+
+// MessageLink links a span to the one that published message, for spans
+// covering many messages such as a forwarded batch
+func MessageLink(message *sarama.ConsumerMessage) (trace.Link, bool) {
+	sc := trace.SpanContextFromContext(MessageContext(context.Background(), message))
+	return trace.Link{SpanContext: sc}, sc.IsValid()
+}
+
+// StartBatch starts the span of handling many consumed messages at once,
+// linked to the spans that published them
+func StartBatch(ctx context.Context, name string, links []trace.Link, size int) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithLinks(links...),
+		trace.WithAttributes(semconv.MessagingBatchMessageCount(size)),
+	)
+}
+
+// Middleware wraps the handling of each message in a consumer span, child
+// of the span that published it
+func Middleware(group string) consumer.Middleware {
+	return func(next consumer.Handler) consumer.Handler {
+		return consumer.HandlerFunc(func(ctx context.Context, message *sarama.ConsumerMessage) error {
+			ctx, span := Tracer().Start(MessageContext(ctx, message), message.Topic+" process",
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(
+					semconv.MessagingSystemKafka,
+					semconv.MessagingOperationTypeProcess,
+					semconv.MessagingDestinationName(message.Topic),
+					semconv.MessagingConsumerGroupName(group),
+					semconv.MessagingDestinationPartitionID(strconv.Itoa(int(message.Partition))),
+					semconv.MessagingKafkaOffset(int(message.Offset)),
+				),
+			)
+			err := next.Handle(ctx, message)
+			End(span, err)
+			return err
+		})
+	}
+}
+
+// StartRequest starts the server span of an HTTP request, continuing the
+// trace of the caller when it sent a traceparent header
+func StartRequest(r *http.Request, name string) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method), semconv.URLPath(r.URL.Path)),
+	)
+}
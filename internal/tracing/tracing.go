@@ -0,0 +1,105 @@
+// Package tracing follows logs through the pipeline with OpenTelemetry. The
+// trace context travels in Kafka headers, so the spans of publishing a log,
+// processing it and forwarding it to a sink join one trace, exported over
+// OTLP.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation names the spans' origin
+const instrumentation = "kafka-logging-system"
+
+// Config says where spans are exported to
+type Config struct {
+	//Endpoint is the host:port of an OTLP gRPC collector, spans are only
+	//exported when it is set. Trace context is propagated either way.
+	Endpoint string
+	//Insecure sends spans without TLS, as to a local collector
+	Insecure bool
+	//SampleRatio is the fraction of traces recorded. Traces sampled
+	//upstream are always recorded.
+	SampleRatio float64
+}
+
+// Default returns the settings used without flags, the endpoint is read
+// from OTEL_EXPORTER_OTLP_ENDPOINT
+func Default() Config {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	return Config{
+		Endpoint:    strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://"),
+		Insecure:    strings.HasPrefix(endpoint, "http://"),
+		SampleRatio: 1,
+	}
+}
+
+// RegisterFlags binds the settings to flags
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Endpoint, "otlp-endpoint", c.Endpoint, "OTLP gRPC collector spans are exported to, such as localhost:4317 (default $OTEL_EXPORTER_OTLP_ENDPOINT, empty disables tracing)")
+	fs.BoolVar(&c.Insecure, "otlp-insecure", c.Insecure, "export spans without TLS")
+	fs.Float64Var(&c.SampleRatio, "trace-sample-ratio", c.SampleRatio, "fraction of new traces recorded, between 0 and 1")
+}
+
+// Setup installs the global tracer provider and W3C propagator for service.
+// The returned function flushes buffered spans and must be called before
+// exiting.
+func Setup(ctx context.Context, cfg Config, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, errors.New("trace sample ratio must be between 0 and 1")
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create span exporter %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(service)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe service %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio),
+			sdktrace.WithRemoteParentNotSampled(sdktrace.TraceIDRatioBased(cfg.SampleRatio)))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer spans are started with
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// End records err on span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
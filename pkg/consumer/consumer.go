@@ -0,0 +1,91 @@
+// Package consumer runs consumed messages through a chain of middleware, so
+// features such as metrics, tracing, rate limiting or redaction wrap message
+// handling without changing the services' consumer loops. Programs embedding
+// the services add their own middleware with Use.
+package consumer
+
+import (
+	"context"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// Handler processes one consumed message. An error means the message wasn't
+// handled and must be consumed again.
+type Handler interface {
+	Handle(ctx context.Context, message *sarama.ConsumerMessage) error
+}
+
+// HandlerFunc adapts a function to a Handler
+type HandlerFunc func(ctx context.Context, message *sarama.ConsumerMessage) error
+
+func (f HandlerFunc) Handle(ctx context.Context, message *sarama.ConsumerMessage) error {
+	return f(ctx, message)
+}
+
+// Middleware wraps a handler with behaviour of its own. It may change the
+// message, skip next or handle its error.
+type Middleware func(next Handler) Handler
+
+// Chain wraps h with middleware, the first one being the outermost so it
+// sees every message first
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// registered holds the middleware added with Use
+var registered struct {
+	mu         sync.Mutex
+	middleware []Middleware
+}
+
+// Use registers middleware that Wrap applies to every handler built after
+// the call, in the order they were registered. Embedders call it before
+// starting a service, for instance from an init function. Every consumer
+// group wraps its handling: the Processor, Aggregator, Alerter, Forwarder,
+// Mirror and klog consume. klog tail reads partitions without a group and
+// doesn't.
+func Use(middleware ...Middleware) {
+	registered.mu.Lock()
+	defer registered.mu.Unlock()
+	registered.middleware = append(registered.middleware, middleware...)
+}
+
+// Wrap returns h with the middleware registered with Use, inside the given
+// middleware
+func Wrap(h Handler, middleware ...Middleware) Handler {
+	registered.mu.Lock()
+	all := append(middleware[:len(middleware):len(middleware)], registered.middleware...)
+	registered.mu.Unlock()
+	return Chain(h, all...)
+}
+
+// ConsumeClaim hands the messages of a claim to h until the session ends,
+// marking each one once it was handled. An error ends the session, so the
+// message is consumed again by the partition's next owner.
+func ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim, h Handler) error {
+	for {
+		select {
+		case message := <-claim.Messages():
+			if message == nil {
+				return nil
+			}
+
+			if err := h.Handle(session.Context(), message); err != nil {
+				if session.Context().Err() != nil {
+					return nil
+				}
+				return err
+			}
+
+			session.MarkMessage(message, "")
+
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
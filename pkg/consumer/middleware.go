@@ -0,0 +1,63 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Recover turns a panic while handling a message into an error, so one bad
+// message ends the session instead of the whole program
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, message *sarama.ConsumerMessage) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic handling %s/%d/%d: %v\n%s", message.Topic, message.Partition, message.Offset, r, debug.Stack())
+				}
+			}()
+			return next.Handle(ctx, message)
+		})
+	}
+}
+
+// RateLimit handles at most perSecond messages a second across all claims,
+// waiting before the ones over the limit. 0 disables the limit.
+func RateLimit(perSecond float64) Middleware {
+	if perSecond <= 0 {
+		return func(next Handler) Handler { return next }
+	}
+	interval := time.Duration(float64(time.Second) / perSecond)
+
+	var mu sync.Mutex
+	var next time.Time
+	return func(h Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, message *sarama.ConsumerMessage) error {
+			//reserve the next free slot, slots left unused while idle don't
+			//add up to a burst
+			mu.Lock()
+			now := time.Now()
+			if next.Before(now) {
+				next = now
+			}
+			wait := next.Sub(now)
+			next = next.Add(interval)
+			mu.Unlock()
+
+			if wait > 0 {
+				timer := time.NewTimer(wait)
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return h.Handle(ctx, message)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Package logrushook provides a logrus Hook that forwards entries into the Kafka pipeline.
+package logrushook
+
+import (
+	"fmt"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/pkg/producer"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Hook struct {
+	publisher   producer.Publisher
+	application string
+	levels      []logrus.Level
+}
+
+// New returns a hook publishing entries at the given levels for application,
+// every level is published when none are given
+func New(publisher producer.Publisher, application string, levels ...logrus.Level) *Hook {
+	if len(levels) == 0 {
+		levels = logrus.AllLevels
+	}
+	return &Hook{
+		publisher:   publisher,
+		application: application,
+		levels:      levels,
+	}
+}
+
+func (h *Hook) Levels() []logrus.Level {
+	return h.levels
+}
+
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	//The error set with WithError describes the error, with the stack of the
+	//logging call when the entry is an error
+	var stack string
+	err, _ := entry.Data[logrus.ErrorKey].(error)
+	if err != nil && entry.Level <= logrus.ErrorLevel {
+		stack = models.CallerStack("github.com/sirupsen/logrus.", "kafka-logging-system/pkg/logrushook.")
+	}
+	logEntry := models.NewEntry(h.application, Level(entry.Level), entry.Message,
+		models.WithTime(entry.Time),
+		models.WithErrorStack(err, stack),
+	)
+	//Preserve fields as metadata, errors don't marshal to JSON so keep their text
+	for key, value := range entry.Data {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		logEntry.WithField(key, value)
+	}
+
+	if err := h.publisher.Publish(logEntry); err != nil {
+		return fmt.Errorf("failed to publish logrus entry %w", err)
+	}
+	return nil
+}
+
+// Level maps a logrus level onto models.LogLevel
+func Level(level logrus.Level) models.LogLevel {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return models.FATAL
+	case logrus.ErrorLevel:
+		return models.ERROR
+	case logrus.WarnLevel:
+		return models.WARN
+	case logrus.InfoLevel:
+		return models.INFO
+	case logrus.DebugLevel:
+		return models.DEBUG
+	default:
+		return models.TRACE
+	}
+}
@@ -0,0 +1,115 @@
+// Package logwriter adapts the Kafka pipeline to io.Writer so code using the
+// standard log package can stream into it via log.SetOutput.
+package logwriter
+
+import (
+	"bytes"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/pkg/producer"
+	"strings"
+	"sync"
+)
+
+// prefixFields is how many leading fields are checked for a level marker,
+// enough to skip the date and time written by log.LstdFlags
+const prefixFields = 4
+
+var levelPrefixes = map[string]models.LogLevel{
+	"TRACE":   models.TRACE,
+	"DEBUG":   models.DEBUG,
+	"INFO":    models.INFO,
+	"WARN":    models.WARN,
+	"WARNING": models.WARN,
+	"ERROR":   models.ERROR,
+	"ERR":     models.ERROR,
+	"FATAL":   models.FATAL,
+	"PANIC":   models.FATAL,
+}
+
+type KafkaWriter struct {
+	publisher    producer.Publisher
+	application  string
+	defaultLevel models.LogLevel
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// New returns a writer publishing every complete line as a log entry for application
+func New(publisher producer.Publisher, application string) *KafkaWriter {
+	return &KafkaWriter{
+		publisher:    publisher,
+		application:  application,
+		defaultLevel: models.INFO,
+	}
+}
+
+// SetDefaultLevel sets the level used for lines without a recognised level prefix
+func (w *KafkaWriter) SetDefaultLevel(level models.LogLevel) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.defaultLevel = level
+}
+
+// Write buffers p and publishes each complete line. Partial lines are kept
+// until the rest arrives or Flush is called.
+func (w *KafkaWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		idx := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if idx < 0 {
+			break
+		}
+		line := string(w.buf.Next(idx + 1))
+		if err := w.publish(line); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush publishes any buffered partial line
+func (w *KafkaWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	line := w.buf.String()
+	w.buf.Reset()
+	return w.publish(line)
+}
+
+func (w *KafkaWriter) publish(line string) error {
+	line = strings.TrimRight(line, "\r\n")
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+
+	level, ok := InferLevel(line)
+	if !ok {
+		level = w.defaultLevel
+	}
+
+	return w.publisher.Publish(models.NewEntry(w.application, level, line))
+}
+
+// InferLevel looks for a level marker such as "ERROR", "[WARN]" or "info:"
+// among the leading fields of a line
+func InferLevel(line string) (models.LogLevel, bool) {
+	fields := strings.Fields(line)
+	if len(fields) > prefixFields {
+		fields = fields[:prefixFields]
+	}
+	for _, field := range fields {
+		token := strings.ToUpper(strings.Trim(field, "[]():"))
+		if level, ok := levelPrefixes[token]; ok {
+			return level, true
+		}
+	}
+	return "", false
+}
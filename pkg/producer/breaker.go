@@ -0,0 +1,92 @@
+package producer
+
+import (
+	"errors"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// ErrCircuitOpen is returned while the circuit breaker is rejecting sends
+var ErrCircuitOpen = errors.New("circuit breaker open, kafka unavailable")
+
+// breaker stops sends after threshold consecutive failures until a probe
+// shows the broker is reachable again
+type breaker struct {
+	threshold int
+	gauge     metrics.Gauge //1 while open, registered as circuit-breaker-open
+	logger    *slog.Logger
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+}
+
+func newBreaker(threshold int, registry metrics.Registry, logger *slog.Logger) *breaker {
+	return &breaker{
+		threshold: threshold,
+		gauge:     metrics.GetOrRegisterGauge("circuit-breaker-open", registry),
+		logger:    logger,
+	}
+}
+
+// allow reports whether a send may be attempted
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.open
+}
+
+func (b *breaker) isOpen() bool {
+	return !b.allow()
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if !b.open && b.failures >= b.threshold {
+		b.open = true
+		b.gauge.Update(1)
+		b.logger.Warn("Circuit breaker opened", "failures", b.failures)
+	}
+}
+
+// close resumes sends after a successful probe
+func (b *breaker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.open {
+		b.logger.Info("Circuit breaker closed, kafka reachable again")
+	}
+	b.open = false
+	b.failures = 0
+	b.gauge.Update(0)
+}
+
+// exponentialBackoff doubles the wait on every retry up to max, with up to
+// 20% jitter so producers don't retry in lockstep
+func exponentialBackoff(initial, max time.Duration) func(retries, maxRetries int) time.Duration {
+	return func(retries, maxRetries int) time.Duration {
+		backoff := initial
+		for i := 0; i < retries && backoff < max; i++ {
+			backoff *= 2
+		}
+		if backoff > max {
+			backoff = max
+		}
+		jitter := time.Duration(rand.Int63n(int64(backoff)/5 + 1))
+		return backoff - jitter
+	}
+}
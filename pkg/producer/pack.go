@@ -0,0 +1,185 @@
+package producer
+
+import (
+	"context"
+	"fmt"
+	"kafka-logging-system/internal/models"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// packer holds the entries of each topic and message key, the application
+// unless partitioned otherwise, until they fill a batch message or have
+// waited the linger
+type packer struct {
+	size        int
+	compression models.Compression
+
+	//mu is held while batches are sent, so the batches of a key go out in
+	//order
+	mu      sync.Mutex
+	pending map[packKey]*packedBatch
+}
+
+type packKey struct {
+	topic     string
+	key       string
+	partition int32 //with PartitionManual
+}
+
+// packedBatch is the batch of one topic and message key
+type packedBatch struct {
+	key       packKey
+	timestamp time.Time //of the first entry
+	batch     models.LogBatch
+}
+
+// add packs an encoded entry and returns its batch once full. k.mu must be held.
+func (k *packer) add(key packKey, entry *models.LogEntry, data []byte) *packedBatch {
+	b := k.pending[key]
+	if b == nil {
+		b = &packedBatch{key: key, timestamp: entry.Timestamp}
+		b.batch.Entries = make([][]byte, 0, k.size)
+		k.pending[key] = b
+	}
+	b.batch.Entries = append(b.batch.Entries, data)
+	if len(b.batch.Entries) < k.size {
+		return nil
+	}
+	delete(k.pending, key)
+	return b
+}
+
+// packKey returns the batch an entry to topic is packed in
+func (p *Producer) packKey(topic string, entry *models.LogEntry) packKey {
+	return packKey{topic: topic, key: p.messageKey(entry), partition: p.partition(entry)}
+}
+
+// take removes the batch of key, nil when it has none. k.mu must be held.
+func (k *packer) take(key packKey) *packedBatch {
+	b := k.pending[key]
+	delete(k.pending, key)
+	return b
+}
+
+// startPacker sends the held entries every PackLinger
+func (p *Producer) startPacker(cfg Config) {
+	p.packer = &packer{
+		size:        cfg.PackEntries,
+		compression: cfg.PackCompression,
+		pending:     make(map[packKey]*packedBatch),
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(cfg.PackLinger)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.flushPacked()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// pack holds an entry in the batch of its topic and message key, sending
+// the batch once it is full
+func (p *Producer) pack(ctx context.Context, topic string, entry *models.LogEntry) error {
+	data, err := p.encode(entry)
+	if err != nil {
+		return err
+	}
+
+	k := p.packer
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if b := k.add(p.packKey(topic, entry), entry, data); b != nil {
+		return p.sendPacked(ctx, []*packedBatch{b})
+	}
+	return nil
+}
+
+// packBatch packs entries to the topic of their level and sends every batch
+// they were added to, full or not
+func (p *Producer) packBatch(ctx context.Context, entries []*models.LogEntry) error {
+	//encode them all first, so a failure doesn't leave some of them held
+	encoded := make([][]byte, len(entries))
+	for i, entry := range entries {
+		data, err := p.encode(entry)
+		if err != nil {
+			return err
+		}
+		encoded[i] = data
+	}
+
+	k := p.packer
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var ready []*packedBatch
+	var keys []packKey
+	for i, entry := range entries {
+		key := p.packKey(p.topicFor(entry), entry)
+		if b := k.add(key, entry, encoded[i]); b != nil {
+			ready = append(ready, b)
+		}
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if b := k.take(key); b != nil {
+			ready = append(ready, b)
+		}
+	}
+	return p.sendPacked(ctx, ready)
+}
+
+// flushPacked sends every held entry, reporting failures to OnError
+func (p *Producer) flushPacked() {
+	k := p.packer
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if len(k.pending) == 0 {
+		return
+	}
+	ready := make([]*packedBatch, 0, len(k.pending))
+	for key := range k.pending {
+		ready = append(ready, k.take(key))
+	}
+	if err := p.sendPacked(context.Background(), ready); err != nil {
+		p.onError(err)
+	}
+}
+
+// sendPacked publishes batches, one message each. p.packer.mu must be held.
+func (p *Producer) sendPacked(ctx context.Context, batches []*packedBatch) error {
+	if len(batches) == 0 {
+		return nil
+	}
+	msgs := make([]*sarama.ProducerMessage, len(batches))
+	for i, b := range batches {
+		b.batch.Format = p.format
+		data, err := b.batch.Encode(p.packer.compression)
+		if err != nil {
+			return fmt.Errorf("failed to encode batch %w", err)
+		}
+		//keyed like single entries, so the logs sharing the key stay ordered
+		msgs[i] = &sarama.ProducerMessage{
+			Topic:     b.key.topic,
+			Key:       sarama.StringEncoder(b.key.key),
+			Partition: b.key.partition,
+			Value:     sarama.ByteEncoder(data),
+			Headers:   p.senderHeaders(models.ContentTypeBatch),
+			Timestamp: b.timestamp,
+		}
+	}
+	return p.sendAll(msgs, func(int) (context.Context, []trace.Link) {
+		return ctx, nil
+	})
+}
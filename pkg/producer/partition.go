@@ -0,0 +1,105 @@
+package producer
+
+import (
+	"errors"
+	"fmt"
+	"kafka-logging-system/internal/models"
+
+	"github.com/IBM/sarama"
+)
+
+// Partitioner says how entries are spread over the partitions of a topic
+type Partitioner string
+
+const (
+	//PartitionByApplication hashes the application, so the logs of an
+	//application stay ordered
+	PartitionByApplication Partitioner = "application"
+	//PartitionByField hashes the value of PartitionField, such as a tenant or
+	//trace id, so the logs sharing it stay ordered
+	PartitionByField Partitioner = "field"
+	//PartitionRoundRobin spreads entries evenly, giving up their order
+	PartitionRoundRobin Partitioner = "round-robin"
+	//PartitionManual sends entries to the partition PartitionFunc picks
+	PartitionManual Partitioner = "manual"
+)
+
+// saramaPartitioner returns the sarama partitioner placing messages as p says
+func (p Partitioner) saramaPartitioner() sarama.PartitionerConstructor {
+	switch p {
+	case PartitionRoundRobin:
+		return sarama.NewRoundRobinPartitioner
+	case PartitionManual:
+		return sarama.NewManualPartitioner
+	}
+	return sarama.NewHashPartitioner
+}
+
+// validate checks the settings p needs
+func (p Partitioner) validate(field string, fn func(*models.LogEntry) int32) error {
+	switch p {
+	case "", PartitionByApplication, PartitionRoundRobin:
+	case PartitionByField:
+		if field == "" {
+			return errors.New("partitioning by field requires a partition field")
+		}
+	case PartitionManual:
+		if fn == nil {
+			return errors.New("manual partitioning requires a partition function")
+		}
+	default:
+		return fmt.Errorf("unknown partitioner %q, expected application, field, round-robin or manual", p)
+	}
+	return nil
+}
+
+// messageKey returns the key of the message of an entry: the value of the
+// partition field with PartitionByField, else or when the entry lacks it
+// the application
+func (p *Producer) messageKey(entry *models.LogEntry) string {
+	if p.partitioner == PartitionByField {
+		if value := fieldValue(entry, p.partitionField); value != "" {
+			return value
+		}
+	}
+	return entry.Application
+}
+
+// partition returns the partition of an entry with PartitionManual, 0
+// otherwise where the sarama partitioner picks it
+func (p *Producer) partition(entry *models.LogEntry) int32 {
+	if p.partitioner == PartitionManual {
+		return p.partitionFunc(entry)
+	}
+	return 0
+}
+
+// fieldValue returns the value of an entry field by its JSON name, or of
+// the metadata key for other names
+func fieldValue(entry *models.LogEntry, field string) string {
+	switch field {
+	case "application":
+		return entry.Application
+	case "level":
+		return string(entry.Level)
+	case "trace_id":
+		return entry.TraceID
+	case "span_id":
+		return entry.SpanID
+	case "request_id":
+		return entry.RequestID
+	case "hostname":
+		return entry.Hostname
+	case "environment":
+		return string(entry.Environment)
+	case "id":
+		return entry.ID
+	case "error_type":
+		return entry.ErrorType
+	}
+	value, ok := entry.Metadata[field]
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,862 @@
+// Package producer publishes log entries to Kafka. It is shared by the
+// producer binary and the logging adapters under pkg/.
+package producer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kafka-logging-system/internal/buildinfo"
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/internal/spool"
+	"kafka-logging-system/internal/tracing"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultTopic is the topic raw log entries are published to
+const DefaultTopic = "raw-logs"
+
+// Publisher is implemented by anything that can ship a log entry
+type Publisher interface {
+	Publish(entry *models.LogEntry) error
+}
+
+type Config struct {
+	//Kafka holds the brokers and how the client connects to them
+	Kafka kafkaconfig.Config
+	Topic string
+	//Format is the wire encoding of entries, advertised in the content-type header
+	Format models.Format
+	//ProducerID is sent in the producer-id header, defaults to hostname-pid
+	ProducerID string
+	//Environment stamped on entries that don't set one, defaults to
+	//$ENVIRONMENT when it is dev, stage or prod
+	Environment models.Environment
+	//MinLevel drops entries less severe than it, empty publishes every level.
+	//SetMinLevel changes it while running.
+	MinLevel models.LogLevel
+	//Limits bound the size of entries, which are truncated to fit unless
+	//RejectOversize makes sending them fail with a *models.ValidationError
+	Limits         models.Limits
+	RejectOversize bool
+	//Partitioner says how entries are spread over partitions, by default
+	//hashing the application. PartitionField is the entry field, such as
+	//trace_id, or metadata key, such as tenant, PartitionByField hashes;
+	//entries without it are keyed by application. PartitionFunc picks the
+	//partition of every entry with PartitionManual.
+	Partitioner    Partitioner
+	PartitionField string
+	PartitionFunc  func(entry *models.LogEntry) int32
+
+	//RequiredAcks and RetryMax control delivery guarantees per message
+	RequiredAcks sarama.RequiredAcks
+	RetryMax     int
+	//Retries wait RetryBackoff, doubling on every attempt up to RetryMaxBackoff
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+	//BreakerThreshold consecutive failures open the circuit breaker, zero disables it.
+	//While open, sends fail fast and the broker is probed every BreakerProbeInterval.
+	BreakerThreshold     int
+	BreakerProbeInterval time.Duration
+	//MaxOpenRequests limits in-flight requests per broker, zero leaves the sarama default
+	MaxOpenRequests int
+	//Idempotent stops retries from writing duplicates on the broker
+	Idempotent bool
+	//TransactionalID makes the producer transactional, sends are only
+	//visible to read committed consumers once CommitTxn is called. It
+	//requires Idempotent and fences off older producers using the same ID.
+	TransactionalID string
+
+	//Async switches from one blocking request per message to batched sends
+	Async bool
+	//Flush thresholds for async batching, zero leaves the sarama default
+	FlushMessages  int
+	FlushBytes     int
+	FlushFrequency time.Duration
+	//MaxInFlight bounds unacknowledged async messages, Send blocks once reached
+	MaxInFlight int
+	//Compression codec applied to each batch, CompressionLevel only affects gzip and zstd
+	Compression      sarama.CompressionCodec
+	CompressionLevel int
+	//PackEntries packs up to this many entries of one message key into each
+	//message as a models.LogBatch, saving the per message overhead of chatty
+	//services. Send holds entries until their batch is full or PackLinger
+	//old. Zero or one sends a message per entry.
+	PackEntries int
+	PackLinger  time.Duration
+	//PackCompression compresses the entries of a batch, on top of Compression
+	PackCompression models.Compression
+	//RateLimit bounds the entries published per second, zero disables it.
+	//RateBurst entries may go out at once, defaulting to a second's worth.
+	RateLimit float64
+	RateBurst int
+	//LevelRateLimits bound the entries of single levels per second, on top
+	//of RateLimit
+	LevelRateLimits map[models.LogLevel]float64
+	//LevelTopics route the entries of single levels to their own topic
+	//instead of Topic, such as ERROR to raw-logs-errors
+	LevelTopics map[models.LogLevel]string
+	//Overflow says what happens to entries over a limit, defaults to blocking
+	Overflow OverflowPolicy
+	//SampleEvery is how many entries over the limit one kept entry stands
+	//for with OverflowSample
+	SampleEvery int
+	//SpoolDir keeps entries on disk while Kafka is unreachable, empty disables spooling.
+	//Spooling is only available in sync mode so per application order is kept.
+	SpoolDir string
+	//SpoolReplayInterval is how often spooled entries are retried
+	SpoolReplayInterval time.Duration
+	//OnError is called for every async delivery failure, and packed entries
+	//that failed to send after lingering, defaults to logging it
+	OnError func(err error)
+	//Logger receives the producer's own logs, defaults to slog.Default()
+	Logger *slog.Logger
+}
+
+// DefaultConfig returns the settings used by the producer binary
+func DefaultConfig() Config {
+	return Config{
+		Kafka:                kafkaconfig.Default(),
+		Topic:                DefaultTopic,
+		Format:               models.FormatJSON,
+		Limits:               models.DefaultLimits(),
+		Environment:          envEnvironment(),
+		Partitioner:          PartitionByApplication,
+		RequiredAcks:         sarama.WaitForAll, //wait for all replicas
+		RetryMax:             3,
+		BreakerProbeInterval: 5 * time.Second,
+		FlushMessages:        100,
+		FlushFrequency:       500 * time.Millisecond,
+		MaxInFlight:          10000,
+		Compression:          sarama.CompressionNone,
+		CompressionLevel:     sarama.CompressionLevelDefault,
+		PackLinger:           100 * time.Millisecond,
+		SpoolReplayInterval:  10 * time.Second,
+		Overflow:             OverflowBlock,
+		SampleEvery:          100,
+	}
+}
+
+// envEnvironment returns $ENVIRONMENT when it names a known environment,
+// else none so unrelated values such as production don't fail New
+func envEnvironment() models.Environment {
+	if env := models.Environment(os.Getenv("ENVIRONMENT")); env.Valid() {
+		return env
+	}
+	return ""
+}
+
+// Validate rejects settings that cannot be combined
+func (c Config) Validate() error {
+	if err := c.Kafka.Validate(); err != nil {
+		return err
+	}
+	if c.Topic == "" {
+		return errors.New("topic is required")
+	}
+
+	if _, err := models.ParseFormat(string(c.Format)); err != nil {
+		return err
+	}
+
+	if c.Environment != "" && !c.Environment.Valid() {
+		return fmt.Errorf("unknown environment %q, expected dev, stage or prod", c.Environment)
+	}
+
+	if c.MinLevel != "" {
+		if _, err := models.ParseLevel(string(c.MinLevel)); err != nil {
+			return err
+		}
+	}
+
+	if c.Limits.MaxMessageBytes < 0 || c.Limits.MaxMetadataKeys < 0 || c.Limits.MaxMetadataValueBytes < 0 {
+		return errors.New("entry limits can't be negative")
+	}
+
+	if c.BreakerThreshold > 0 && c.BreakerProbeInterval <= 0 {
+		return errors.New("the circuit breaker requires a positive probe interval")
+	}
+
+	if c.PackEntries < 0 {
+		return errors.New("entries packed per message can't be negative")
+	}
+	if c.PackEntries > 1 && c.PackLinger <= 0 {
+		return errors.New("packing entries requires a positive linger")
+	}
+	if _, err := models.ParseCompression(string(c.PackCompression)); err != nil {
+		return err
+	}
+
+	if c.RateLimit < 0 || c.RateBurst < 0 {
+		return errors.New("rate limit and burst can't be negative")
+	}
+	for level, rate := range c.LevelRateLimits {
+		if rate <= 0 {
+			return fmt.Errorf("rate limit of %s must be positive", level)
+		}
+	}
+	if err := c.Partitioner.validate(c.PartitionField, c.PartitionFunc); err != nil {
+		return err
+	}
+	for level, topic := range c.LevelTopics {
+		if level.Severity() == 0 {
+			return fmt.Errorf("unknown log level %q in level topics", level)
+		}
+		if topic == "" {
+			return fmt.Errorf("topic of %s is required", level)
+		}
+	}
+	switch c.Overflow {
+	case "", OverflowBlock, OverflowDrop:
+	case OverflowSample:
+		if c.SampleEvery < 1 {
+			return errors.New("sampling over the rate limit requires keeping 1 in at least 1 entries")
+		}
+	default:
+		return fmt.Errorf("unknown overflow policy %q, expected block, drop or sample", c.Overflow)
+	}
+
+	if c.SpoolDir != "" && c.Async {
+		return errors.New("spooling is not supported by the async producer")
+	}
+
+	if c.TransactionalID != "" {
+		if !c.Idempotent {
+			return errors.New("transactional producer requires the idempotent producer")
+		}
+		if c.Async || c.SpoolDir != "" {
+			return errors.New("transactional producer can't be async or spool")
+		}
+		if c.PackEntries > 1 {
+			return errors.New("transactional producer can't pack entries")
+		}
+	}
+
+	if c.Idempotent {
+		if c.RequiredAcks != sarama.WaitForAll {
+			return errors.New("idempotent producer requires acks from all replicas")
+		}
+		if c.RetryMax < 1 {
+			return errors.New("idempotent producer requires at least one retry")
+		}
+		if c.MaxOpenRequests > 1 {
+			return fmt.Errorf("idempotent producer requires max open requests of 1, got %d", c.MaxOpenRequests)
+		}
+	}
+	return nil
+}
+
+type Producer struct {
+	client   sarama.Client
+	producer sarama.SyncProducer
+	async    sarama.AsyncProducer
+	topic    string
+	format   models.Format
+	//levelTopics override topic for the entries of their level
+	levelTopics map[models.LogLevel]string
+	//how entries are spread over partitions, see Config.Partitioner
+	partitioner    Partitioner
+	partitionField string
+	partitionFunc  func(entry *models.LogEntry) int32
+
+	//process context stamped on every entry
+	hostname    string
+	environment models.Environment
+	pid         int
+	producerID  string
+	version     string
+	//minSeverity is the Severity of the least severe level published
+	minSeverity atomic.Int32
+	//limits bound entries, which are truncated to fit or else rejected
+	limits   models.Limits
+	truncate bool
+
+	inflight chan struct{} //semaphore bounding unacknowledged async messages
+	onError  func(err error)
+	//wg tracks the spool, probe and packer loops, drain the async results
+	wg    sync.WaitGroup
+	drain sync.WaitGroup
+
+	spool    *spool.Spool
+	spoolMu  sync.Mutex
+	spooling bool //set while entries are waiting on disk, new entries queue behind them
+
+	breaker *breaker
+	limiter *limiter //nil without rate limits
+	packer  *packer  //nil unless entries are packed
+	logger  *slog.Logger
+	stop    chan struct{}
+}
+
+// New creates a producer connected to the brokers of cfg.Kafka
+func New(cfg Config) (*Producer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid producer config %w", err)
+	}
+
+	//Kafka Configuration
+	config := cfg.Kafka.Sarama()
+	config.Producer.Return.Successes = true
+	config.Producer.RequiredAcks = cfg.RequiredAcks
+	config.Producer.Retry.Max = cfg.RetryMax
+	if cfg.RetryBackoff > 0 {
+		config.Producer.Retry.BackoffFunc = exponentialBackoff(cfg.RetryBackoff, max(cfg.RetryBackoff, cfg.RetryMaxBackoff))
+	}
+	if cfg.MaxOpenRequests > 0 {
+		config.Net.MaxOpenRequests = cfg.MaxOpenRequests
+	}
+	if cfg.Idempotent {
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1
+	}
+	config.Producer.Transaction.ID = cfg.TransactionalID
+	config.Producer.Compression = cfg.Compression
+	config.Producer.CompressionLevel = cfg.CompressionLevel
+	config.Producer.Partitioner = cfg.Partitioner.saramaPartitioner()
+
+	//Share one client so the breaker can probe the cluster the producer uses
+	addrs, err := cfg.Kafka.Addrs(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(addrs, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka client %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+
+	p := &Producer{
+		client:         client,
+		topic:          cfg.Topic,
+		levelTopics:    cfg.LevelTopics,
+		partitioner:    cfg.Partitioner,
+		partitionField: cfg.PartitionField,
+		partitionFunc:  cfg.PartitionFunc,
+		format:         cfg.Format,
+		hostname:       hostname,
+		environment:    cfg.Environment,
+		pid:            os.Getpid(),
+		producerID:     cfg.ProducerID,
+		limits:         cfg.Limits,
+		truncate:       !cfg.RejectOversize,
+		version:        buildinfo.Get().Version,
+		onError:        cfg.OnError,
+		logger:         cfg.Logger,
+		stop:           make(chan struct{}),
+	}
+	if p.logger == nil {
+		p.logger = slog.Default()
+	}
+	if env := os.Getenv("ENVIRONMENT"); cfg.Environment == "" && env != "" && !models.Environment(env).Valid() {
+		p.logger.Warn("Ignoring unknown ENVIRONMENT, expected dev, stage or prod", "environment", env)
+	}
+	p.SetMinLevel(cfg.MinLevel)
+	if p.producerID == "" {
+		p.producerID = fmt.Sprintf("%s-%d", p.hostname, p.pid)
+	}
+	if cfg.RateLimit > 0 || len(cfg.LevelRateLimits) > 0 {
+		p.limiter = newLimiter(cfg, config.MetricRegistry, p.logger)
+	}
+	if cfg.BreakerThreshold > 0 {
+		p.breaker = newBreaker(cfg.BreakerThreshold, config.MetricRegistry, p.logger)
+		p.startProbe(cfg.BreakerProbeInterval)
+	}
+	if cfg.PackEntries > 1 {
+		p.startPacker(cfg)
+	}
+	if p.onError == nil {
+		p.onError = func(err error) {
+			p.logger.Error("Error delivering log", "err", err)
+		}
+	}
+
+	if !cfg.Async {
+		//Create producer
+		producer, err := sarama.NewSyncProducerFromClient(client)
+		if err != nil {
+			p.shutdown()
+			return nil, fmt.Errorf("failed to create producer %w", err)
+		}
+		p.producer = producer
+
+		if cfg.SpoolDir != "" {
+			if err := p.startSpool(cfg.SpoolDir, cfg.SpoolReplayInterval); err != nil {
+				producer.Close()
+				p.shutdown()
+				return nil, err
+			}
+		}
+		return p, nil
+	}
+
+	config.Producer.Return.Errors = true
+	config.Producer.Flush.Messages = cfg.FlushMessages
+	config.Producer.Flush.Bytes = cfg.FlushBytes
+	config.Producer.Flush.Frequency = cfg.FlushFrequency
+
+	async, err := sarama.NewAsyncProducerFromClient(client)
+	if err != nil {
+		p.shutdown()
+		return nil, fmt.Errorf("failed to create async producer %w", err)
+	}
+	p.async = async
+
+	maxInFlight := cfg.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultConfig().MaxInFlight
+	}
+	p.inflight = make(chan struct{}, maxInFlight)
+
+	//Successes and Errors must both be drained or the producer deadlocks
+	p.drain.Add(2)
+	go func() {
+		defer p.drain.Done()
+		for range async.Successes() {
+			<-p.inflight
+			p.recordResult(nil)
+		}
+	}()
+	go func() {
+		defer p.drain.Done()
+		for err := range async.Errors() {
+			<-p.inflight
+			p.recordResult(err)
+			p.onError(err)
+		}
+	}()
+
+	return p, nil
+}
+
+// Send publishes the entry to the configured topic, or that of its level,
+// and reports where it was written. In async mode the entry is only
+// queued, and packed entries are held until their batch is sent, so
+// partition and offset are reported as -1, as are entries dropped by
+// MinLevel or a rate limit.
+func (p *Producer) Send(entry *models.LogEntry) (int32, int64, error) {
+	return p.SendTo(p.topicFor(entry), entry)
+}
+
+// topicFor returns the topic of the entry's level, or the configured one
+func (p *Producer) topicFor(entry *models.LogEntry) string {
+	if topic, ok := p.levelTopics[entry.Level]; ok {
+		return topic
+	}
+	return p.topic
+}
+
+// ParseLevelTopics reads per level topics such as "ERROR=raw-logs-errors,FATAL=raw-logs-errors"
+func ParseLevelTopics(s string) (map[models.LogLevel]string, error) {
+	topics := make(map[models.LogLevel]string)
+	for _, part := range kafkaconfig.SplitList(s) {
+		name, topic, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid level topic %q, expected LEVEL=TOPIC", part)
+		}
+		level, err := models.ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		topic = strings.TrimSpace(topic)
+		if topic == "" {
+			return nil, fmt.Errorf("missing topic for %s", level)
+		}
+		topics[level] = topic
+	}
+	return topics, nil
+}
+
+// SendTo publishes the entry to topic instead of the configured one, whatever
+// its level
+func (p *Producer) SendTo(topic string, entry *models.LogEntry) (int32, int64, error) {
+	return p.SendToContext(context.Background(), topic, entry)
+}
+
+// SendToContext is SendTo with the trace context the message continues. An
+// entry naming its own trace joins that one instead, linked to ctx.
+func (p *Producer) SendToContext(ctx context.Context, topic string, entry *models.LogEntry) (int32, int64, error) {
+	if !p.Enabled(entry.Level) {
+		return -1, -1, nil
+	}
+	if p.limiter != nil {
+		if ok, err := p.limiter.admit(ctx, entry); !ok {
+			return -1, -1, err
+		}
+	}
+	if p.packer != nil {
+		return -1, -1, p.pack(ctx, topic, entry)
+	}
+	msg, err := p.message(entry)
+	if err != nil {
+		return 0, 0, err
+	}
+	msg.Topic = topic
+	ctx, links := tracing.EntryContext(ctx, entry)
+	return p.sendMessage(ctx, msg, links)
+}
+
+// SendMessage publishes a prebuilt message, for callers that forward
+// payloads as is, with the same async, spool and breaker handling as Send
+func (p *Producer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	return p.SendMessageContext(context.Background(), msg)
+}
+
+// SendMessageContext is SendMessage with the trace context the message continues
+func (p *Producer) SendMessageContext(ctx context.Context, msg *sarama.ProducerMessage) (int32, int64, error) {
+	return p.sendMessage(ctx, msg, nil)
+}
+
+// sendMessage publishes msg in a producer span, whose context is added to
+// the message headers
+func (p *Producer) sendMessage(ctx context.Context, msg *sarama.ProducerMessage, links []trace.Link) (int32, int64, error) {
+	span := tracing.StartPublish(ctx, msg, links...)
+	partition, offset, err := p.send(msg)
+	tracing.EndPublish(span, partition, offset, err)
+	return partition, offset, err
+}
+
+func (p *Producer) send(msg *sarama.ProducerMessage) (int32, int64, error) {
+	if p.async != nil {
+		if p.breaker != nil && !p.breaker.allow() {
+			return 0, 0, ErrCircuitOpen
+		}
+		//Block while the in-flight buffer is full so callers feel backpressure
+		p.inflight <- struct{}{}
+		p.async.Input() <- msg
+		return -1, -1, nil
+	}
+
+	if p.spool != nil {
+		return p.sendOrSpool(msg)
+	}
+
+	if p.breaker != nil && !p.breaker.allow() {
+		return 0, 0, ErrCircuitOpen
+	}
+
+	//send message
+	partition, offset, err := p.producer.SendMessage(msg)
+	p.recordResult(err)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to send message %w", err)
+	}
+
+	return partition, offset, nil
+}
+
+// SendBatch publishes entries to the configured topic, or that of their
+// level. In sync mode they go out in one request per broker and either all
+// succeed or an error is returned; async and spooling producers handle
+// them one by one.
+func (p *Producer) SendBatch(entries []*models.LogEntry) error {
+	return p.SendBatchContext(context.Background(), entries)
+}
+
+// SendBatchContext is SendBatch with the trace context the messages
+// continue, each entry naming its own trace joins that one instead
+func (p *Producer) SendBatchContext(ctx context.Context, entries []*models.LogEntry) error {
+	if p.minSeverity.Load() > 0 || p.limiter != nil {
+		var err error
+		entries = slices.DeleteFunc(slices.Clone(entries), func(entry *models.LogEntry) bool {
+			if err != nil || !p.Enabled(entry.Level) {
+				return true
+			}
+			if p.limiter == nil {
+				return false
+			}
+			ok, admitErr := p.limiter.admit(ctx, entry)
+			err = admitErr
+			return !ok
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if p.packer != nil {
+		return p.packBatch(ctx, entries)
+	}
+
+	msgs := make([]*sarama.ProducerMessage, len(entries))
+	for i, entry := range entries {
+		msg, err := p.message(entry)
+		if err != nil {
+			return err
+		}
+		msgs[i] = msg
+	}
+	return p.sendAll(msgs, func(i int) (context.Context, []trace.Link) {
+		return tracing.EntryContext(ctx, entries[i])
+	})
+}
+
+// sendAll publishes msgs, each in the trace context returned by contexts
+// for its index, in one request per broker unless the producer is async or
+// spooling
+func (p *Producer) sendAll(msgs []*sarama.ProducerMessage, contexts func(i int) (context.Context, []trace.Link)) error {
+	if p.async != nil || p.spool != nil {
+		for i, msg := range msgs {
+			msgCtx, links := contexts(i)
+			if _, _, err := p.sendMessage(msgCtx, msg, links); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	spans := make([]trace.Span, len(msgs))
+	for i, msg := range msgs {
+		msgCtx, links := contexts(i)
+		spans[i] = tracing.StartPublish(msgCtx, msg, links...)
+	}
+	err := p.sendMessages(msgs)
+	for i, span := range spans {
+		//sarama sets where each message was written once it succeeded
+		tracing.EndPublish(span, msgs[i].Partition, msgs[i].Offset, err)
+	}
+	return err
+}
+
+func (p *Producer) sendMessages(msgs []*sarama.ProducerMessage) error {
+	if p.breaker != nil && !p.breaker.allow() {
+		return ErrCircuitOpen
+	}
+	err := p.producer.SendMessages(msgs)
+	p.recordResult(err)
+	if err != nil {
+		return fmt.Errorf("failed to send messages %w", err)
+	}
+	return nil
+}
+
+// BeginTxn starts a transaction, the messages sent until it is committed or
+// aborted belong to it
+func (p *Producer) BeginTxn() error {
+	if err := p.producer.BeginTxn(); err != nil {
+		return fmt.Errorf("failed to begin transaction %w", err)
+	}
+	return nil
+}
+
+// AddMessageToTxn commits the offset of a consumed message along with the
+// open transaction, as consumer group groupID
+func (p *Producer) AddMessageToTxn(msg *sarama.ConsumerMessage, groupID string) error {
+	if err := p.producer.AddMessageToTxn(msg, groupID, nil); err != nil {
+		return fmt.Errorf("failed to add offset to transaction %w", err)
+	}
+	return nil
+}
+
+// CommitTxn commits the open transaction, making its messages and offsets visible
+func (p *Producer) CommitTxn() error {
+	if err := p.producer.CommitTxn(); err != nil {
+		return fmt.Errorf("failed to commit transaction %w", err)
+	}
+	return nil
+}
+
+// AbortTxn aborts the open transaction, read committed consumers skip its
+// messages and its offsets aren't committed
+func (p *Producer) AbortTxn() error {
+	if err := p.producer.AbortTxn(); err != nil {
+		return fmt.Errorf("failed to abort transaction %w", err)
+	}
+	return nil
+}
+
+// TxnFailed reports whether the producer can't start another transaction
+// and must be closed
+func (p *Producer) TxnFailed() bool {
+	return p.producer.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0
+}
+
+// SetMinLevel changes the least severe level published, so a running
+// program can be made quieter or more verbose. Empty publishes every level.
+func (p *Producer) SetMinLevel(level models.LogLevel) {
+	p.minSeverity.Store(int32(level.Severity()))
+}
+
+// Enabled reports whether entries of level are published rather than dropped
+func (p *Producer) Enabled(level models.LogLevel) bool {
+	return level.Severity() >= int(p.minSeverity.Load())
+}
+
+// message builds the kafka message for an entry
+func (p *Producer) message(entry *models.LogEntry) (*sarama.ProducerMessage, error) {
+	data, err := p.encode(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	//create kafka message, keyed by application or the partition field so
+	//the logs sharing it stay ordered
+	return &sarama.ProducerMessage{
+		Topic:     p.topicFor(entry),
+		Key:       sarama.StringEncoder(p.messageKey(entry)),
+		Partition: p.partition(entry),
+		Value:     sarama.ByteEncoder(data),
+		Headers:   p.headers(entry),
+		Timestamp: entry.Timestamp,
+	}, nil
+}
+
+// encode fills in what the producer knows about an entry, fits it to the
+// limits and encodes it in the configured wire format
+func (p *Producer) encode(entry *models.LogEntry) ([]byte, error) {
+	//fill in where the entry came from unless the caller already did
+	if entry.Hostname == "" {
+		entry.Hostname = p.hostname
+	}
+	if entry.Environment == "" {
+		entry.Environment = p.environment
+	}
+	if entry.PID == 0 {
+		entry.PID = p.pid
+	}
+	//the ID is kept by retries and replays, so they can be told apart from new entries
+	if entry.ID == "" {
+		entry.ID = models.NewID()
+	}
+	entry.SchemaVersion = models.SchemaVersion
+	if err := entry.CheckLimits(p.limits); err != nil {
+		if !p.truncate {
+			return nil, err
+		}
+		entry.Truncate(p.limits)
+	}
+
+	//encode in the configured wire format
+	data, err := entry.Encode(p.format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal logentry %w", err)
+	}
+	return data, nil
+}
+
+// headers describes the payload encoding and sender, and copies the correlation IDs of an entry
+func (p *Producer) headers(entry *models.LogEntry) []sarama.RecordHeader {
+	headers := p.senderHeaders(p.format.ContentType())
+	headers = appendHeader(headers, models.HeaderTraceID, entry.TraceID)
+	headers = appendHeader(headers, models.HeaderSpanID, entry.SpanID)
+	headers = appendHeader(headers, models.HeaderRequestID, entry.RequestID)
+	headers = appendHeader(headers, models.HeaderEntryID, entry.ID)
+	return headers
+}
+
+// senderHeaders describes the payload encoding and sender
+func (p *Producer) senderHeaders(contentType string) []sarama.RecordHeader {
+	var headers []sarama.RecordHeader
+	headers = appendHeader(headers, models.HeaderContentType, contentType)
+	headers = appendHeader(headers, models.HeaderSchemaVersion, strconv.Itoa(models.SchemaVersion))
+	headers = appendHeader(headers, models.HeaderProducerID, p.producerID)
+	headers = appendHeader(headers, models.HeaderProducerVersion, p.version)
+	headers = appendHeader(headers, models.HeaderHost, p.hostname)
+	headers = appendHeader(headers, models.HeaderSentAt, strconv.FormatInt(time.Now().UnixMicro(), 10))
+	return headers
+}
+
+// appendHeader adds a header unless value is empty
+func appendHeader(headers []sarama.RecordHeader, key, value string) []sarama.RecordHeader {
+	if value == "" {
+		return headers
+	}
+	return append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+// Publish implements Publisher
+func (p *Producer) Publish(entry *models.LogEntry) error {
+	_, _, err := p.Send(entry)
+	return err
+}
+
+// PublishContext is Publish with the trace context the message continues
+func (p *Producer) PublishContext(ctx context.Context, entry *models.LogEntry) error {
+	_, _, err := p.SendToContext(ctx, p.topicFor(entry), entry)
+	return err
+}
+
+// Close flushes any buffered async messages and waits for their
+// acknowledgements before shutting down
+func (p *Producer) Close() error {
+	if p.packer != nil {
+		p.flushPacked()
+	}
+
+	//the spool, probe and packer loops send through the sarama producer, so
+	//they are stopped before it is closed
+	close(p.stop)
+	p.wg.Wait()
+
+	var err error
+	if p.async == nil {
+		err = p.producer.Close()
+	} else {
+		p.async.AsyncClose()
+		p.drain.Wait()
+	}
+
+	if cerr := p.client.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// shutdown releases the client when construction fails part way
+func (p *Producer) shutdown() {
+	close(p.stop)
+	p.wg.Wait()
+	p.client.Close()
+}
+
+// recordResult feeds a delivery outcome to the circuit breaker
+func (p *Producer) recordResult(err error) {
+	if p.breaker == nil {
+		return
+	}
+	if err != nil {
+		p.breaker.failure()
+		return
+	}
+	p.breaker.success()
+}
+
+// startProbe checks the cluster every interval while the breaker is open
+// and closes it once metadata can be fetched again
+func (p *Producer) startProbe(interval time.Duration) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if !p.breaker.isOpen() {
+					continue
+				}
+				if err := p.client.RefreshMetadata(p.topic); err != nil {
+					p.logger.Warn("Circuit breaker probe failed", "err", err)
+					continue
+				}
+				p.breaker.close()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,222 @@
+package producer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kafka-logging-system/internal/kafkaconfig"
+	"kafka-logging-system/internal/models"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// OverflowPolicy says what happens to entries over the rate limit
+type OverflowPolicy string
+
+const (
+	//OverflowBlock makes Send wait until the entry fits the limit
+	OverflowBlock OverflowPolicy = "block"
+	//OverflowDrop drops entries over the limit, the least severe ones first
+	OverflowDrop OverflowPolicy = "drop"
+	//OverflowSample keeps one in SampleEvery entries over the limit
+	OverflowSample OverflowPolicy = "sample"
+)
+
+// MetadataSampled is set on entries kept by OverflowSample, to the number
+// of entries each one stands for
+const MetadataSampled = "rate_limit_sampled"
+
+// reportInterval is how often dropped entries are logged, once per entry
+// would feed the runaway it is reporting
+const reportInterval = 10 * time.Second
+
+// bucket is a token bucket refilled at rate tokens per second up to burst
+type bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int) *bucket {
+	b := float64(burst)
+	if b <= 0 {
+		//a second's worth, so bursts up to the rate pass untouched
+		b = max(rate, 1)
+	}
+	return &bucket{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// reserved is the number of tokens an entry of level must leave in the
+// bucket, at most all but one so a full bucket admits every level even
+// when the burst is small
+func (b *bucket) reserved(level models.LogLevel) float64 {
+	return min(b.burst*reserve(level), b.burst-1)
+}
+
+// wait is how long until the bucket holds a token again
+func (b *bucket) wait() time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// limiter bounds the entries published per second, overall and per level
+type limiter struct {
+	policy      OverflowPolicy
+	sampleEvery int
+	limited     metrics.Counter //entries dropped or sampled out, registered as rate-limited
+	logger      *slog.Logger
+
+	mu       sync.Mutex
+	global   *bucket
+	levels   map[models.LogLevel]*bucket
+	overflow int //entries over the limit since the last kept sample
+	dropped  int64
+	reported time.Time
+}
+
+func newLimiter(cfg Config, registry metrics.Registry, logger *slog.Logger) *limiter {
+	l := &limiter{
+		policy:      cfg.Overflow,
+		sampleEvery: cfg.SampleEvery,
+		limited:     metrics.GetOrRegisterCounter("rate-limited", registry),
+		logger:      logger,
+		levels:      make(map[models.LogLevel]*bucket),
+		reported:    time.Now(),
+	}
+	if l.policy == "" {
+		l.policy = OverflowBlock
+	}
+	if cfg.RateLimit > 0 {
+		l.global = newBucket(cfg.RateLimit, cfg.RateBurst)
+	}
+	for level, rate := range cfg.LevelRateLimits {
+		l.levels[level] = newBucket(rate, 0)
+	}
+	return l
+}
+
+// reserve is the share of the global burst kept for more severe levels
+// under OverflowDrop, so TRACE and DEBUG are dropped first, then INFO.
+// take never reserves the last token, see reserved.
+func reserve(level models.LogLevel) float64 {
+	switch {
+	case level.Severity() <= models.DEBUG.Severity():
+		return 0.5
+	case level == models.INFO:
+		return 0.25
+	}
+	return 0
+}
+
+// admit reports whether entry is published, waiting for the limit under
+// OverflowBlock. Sampled entries get MetadataSampled.
+func (l *limiter) admit(ctx context.Context, entry *models.LogEntry) (bool, error) {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		ok, wait := l.take(entry.Level, now)
+		if ok {
+			l.mu.Unlock()
+			return true, nil
+		}
+
+		switch l.policy {
+		case OverflowBlock:
+			l.mu.Unlock()
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+				continue
+			case <-ctx.Done():
+				timer.Stop()
+				return false, ctx.Err()
+			}
+		case OverflowSample:
+			l.overflow++
+			if l.overflow >= l.sampleEvery {
+				entry.WithField(MetadataSampled, l.overflow)
+				l.overflow = 0
+				l.mu.Unlock()
+				return true, nil
+			}
+		}
+		l.drop(now)
+		l.mu.Unlock()
+		return false, nil
+	}
+}
+
+// take removes a token from the buckets level draws from, or reports how
+// long until they all hold one. l.mu must be held.
+func (l *limiter) take(level models.LogLevel, now time.Time) (bool, time.Duration) {
+	buckets := make([]*bucket, 0, 2)
+	if l.global != nil {
+		buckets = append(buckets, l.global)
+	}
+	if b := l.levels[level]; b != nil {
+		buckets = append(buckets, b)
+	}
+
+	var wait time.Duration
+	for _, b := range buckets {
+		b.refill(now)
+		wait = max(wait, b.wait())
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	//less severe levels leave part of the burst to more severe ones
+	if l.policy == OverflowDrop && l.global != nil && l.global.tokens-1 < l.global.reserved(level) {
+		return false, 0
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true, 0
+}
+
+// drop counts an entry over the limit and reports the count every
+// reportInterval, with l.mu held
+func (l *limiter) drop(now time.Time) {
+	l.limited.Inc(1)
+	l.dropped++
+	if now.Sub(l.reported) >= reportInterval {
+		l.logger.Warn("Rate limit exceeded, logs were dropped", "dropped", l.dropped, "policy", l.policy, "interval", now.Sub(l.reported).Round(time.Second))
+		l.dropped = 0
+		l.reported = now
+	}
+}
+
+// ParseLevelRates reads per level limits such as "DEBUG=100,INFO=1000"
+func ParseLevelRates(s string) (map[models.LogLevel]float64, error) {
+	rates := make(map[models.LogLevel]float64)
+	for _, part := range kafkaconfig.SplitList(s) {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid level rate %q, expected LEVEL=PER_SECOND", part)
+		}
+		level, err := models.ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("invalid rate %q for %s, expected a positive number", value, level)
+		}
+		rates[level] = rate
+	}
+	return rates, nil
+}
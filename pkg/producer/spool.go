@@ -0,0 +1,166 @@
+package producer
+
+import (
+	"encoding/json"
+	"fmt"
+	"kafka-logging-system/internal/spool"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// startSpool opens the spool and starts replaying it in the background.
+// Entries left over from a previous run are replayed first.
+func (p *Producer) startSpool(dir string, interval time.Duration) error {
+	s, err := spool.Open(dir)
+	if err != nil {
+		return err
+	}
+	pending, err := s.Pending()
+	if err != nil {
+		return err
+	}
+
+	p.spool = s
+	p.spooling = pending
+
+	if interval <= 0 {
+		interval = DefaultConfig().SpoolReplayInterval
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.replaySpool()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// sendOrSpool sends msg, writing it to the spool instead when Kafka is failing
+// or older entries are still waiting there
+func (p *Producer) sendOrSpool(msg *sarama.ProducerMessage) (int32, int64, error) {
+	p.spoolMu.Lock()
+	spooling := p.spooling
+	p.spoolMu.Unlock()
+
+	if !spooling && (p.breaker == nil || p.breaker.allow()) {
+		partition, offset, err := p.producer.SendMessage(msg)
+		p.recordResult(err)
+		if err == nil {
+			return partition, offset, nil
+		}
+		p.logger.Warn("Kafka unavailable, spooling logs to disk", "err", err)
+	}
+
+	p.spoolMu.Lock()
+	defer p.spoolMu.Unlock()
+
+	p.spooling = true
+	record, err := encodeSpoolRecord(msg, p.partitioner == PartitionManual)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to encode message %w", err)
+	}
+	if err := p.spool.Append(record); err != nil {
+		return 0, 0, fmt.Errorf("failed to spool message %w", err)
+	}
+	return -1, -1, nil
+}
+
+// spoolRecord keeps everything needed to resend a message. Byte fields are
+// base64 encoded by encoding/json, so binary payloads stay on one line.
+type spoolRecord struct {
+	Topic string `json:"topic"`
+	//Partition is set when PartitionManual chose it, else or in files
+	//spooled before it was recorded the partitioner chooses again
+	Partition *int32                `json:"partition,omitempty"`
+	Key       []byte                `json:"key,omitempty"`
+	Value     []byte                `json:"value"`
+	Headers   []sarama.RecordHeader `json:"headers,omitempty"`
+	Timestamp time.Time             `json:"timestamp"`
+}
+
+// encodeSpoolRecord encodes msg for the spool, with its partition when
+// manual says it was chosen by PartitionFunc
+func encodeSpoolRecord(msg *sarama.ProducerMessage, manual bool) ([]byte, error) {
+	record := spoolRecord{
+		Topic:     msg.Topic,
+		Headers:   msg.Headers,
+		Timestamp: msg.Timestamp,
+	}
+	if manual {
+		record.Partition = &msg.Partition
+	}
+
+	var err error
+	if msg.Key != nil {
+		if record.Key, err = msg.Key.Encode(); err != nil {
+			return nil, err
+		}
+	}
+	if record.Value, err = msg.Value.Encode(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(record)
+}
+
+func decodeSpoolRecord(data []byte) (*sarama.ProducerMessage, error) {
+	var record spoolRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic:     record.Topic,
+		Value:     sarama.ByteEncoder(record.Value),
+		Headers:   record.Headers,
+		Timestamp: record.Timestamp,
+	}
+	if record.Key != nil {
+		msg.Key = sarama.ByteEncoder(record.Key)
+	}
+	if record.Partition != nil {
+		msg.Partition = *record.Partition
+	}
+	return msg, nil
+}
+
+// replaySpool resends spooled entries oldest first. Sends are held back
+// while it runs so nothing overtakes the replayed entries.
+func (p *Producer) replaySpool() {
+	p.spoolMu.Lock()
+	defer p.spoolMu.Unlock()
+
+	if !p.spooling || (p.breaker != nil && p.breaker.isOpen()) {
+		return
+	}
+
+	err := p.spool.Replay(func(record []byte) error {
+		msg, err := decodeSpoolRecord(record)
+		if err != nil {
+			//a corrupt record would block the spool forever, so it is dropped
+			p.logger.Error("Dropping unreadable spooled log", "err", err)
+			return nil
+		}
+
+		_, _, err = p.producer.SendMessage(msg)
+		p.recordResult(err)
+		return err
+	})
+	if err != nil {
+		p.logger.Warn("Kafka still unavailable, keeping spooled logs", "err", err)
+		return
+	}
+
+	p.spooling = false
+	p.logger.Info("Replayed spooled logs to Kafka")
+}
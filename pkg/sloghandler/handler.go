@@ -0,0 +1,157 @@
+// Package sloghandler provides a log/slog Handler that ships records to Kafka,
+// so services can adopt the pipeline by swapping their handler.
+package sloghandler
+
+import (
+	"context"
+	"fmt"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/pkg/producer"
+	"log/slog"
+	"maps"
+	"strings"
+)
+
+// LevelTrace and LevelFatal are the slog levels mapped onto models.TRACE and models.FATAL
+const (
+	LevelTrace = slog.LevelDebug - 4
+	LevelFatal = slog.LevelError + 4
+)
+
+type Options struct {
+	//Application is used as the LogEntry application name
+	Application string
+	//Level is the minimum level that is published, defaults to slog.LevelInfo
+	Level slog.Leveler
+}
+
+type Handler struct {
+	publisher producer.Publisher
+	opts      Options
+	attrs     map[string]any //flattened attributes from WithAttrs
+	groups    []string
+}
+
+// New returns a handler publishing records through the given publisher
+func New(publisher producer.Publisher, opts Options) *Handler {
+	if opts.Level == nil {
+		opts.Level = slog.LevelInfo
+	}
+	return &Handler{
+		publisher: publisher,
+		opts:      opts,
+	}
+}
+
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.opts.Level.Level()
+}
+
+// stackKey carries the stack of a logging call to Handle
+type stackKey struct{}
+
+// WithStack returns a context making Handle use stack for error records
+// instead of the stack of its own caller. Handlers passing records to
+// another goroutine capture it at the logging call and hand it on this way.
+func WithStack(ctx context.Context, stack string) context.Context {
+	return context.WithValue(ctx, stackKey{}, stack)
+}
+
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	metadata := maps.Clone(h.attrs)
+	if metadata == nil && record.NumAttrs() > 0 {
+		metadata = make(map[string]any, record.NumAttrs())
+	}
+	var recordErr error
+	record.Attrs(func(attr slog.Attr) bool {
+		if err, ok := attr.Value.Resolve().Any().(error); ok && recordErr == nil {
+			recordErr = err
+		}
+		addAttr(metadata, h.groups, attr)
+		return true
+	})
+
+	//The first error attribute describes the error, with the stack of the
+	//logging call when the record is an error
+	var stack string
+	if recordErr != nil && record.Level >= slog.LevelError {
+		if captured, ok := ctx.Value(stackKey{}).(string); ok {
+			stack = captured
+		} else {
+			stack = models.CallerStack("log/slog.", "kafka-logging-system/pkg/sloghandler.")
+		}
+	}
+	entry := models.NewEntry(h.opts.Application, Level(record.Level), record.Message,
+		models.WithTime(record.Time),
+		models.WithMetadata(metadata),
+		models.WithErrorStack(recordErr, stack),
+	)
+	if err := h.publisher.Publish(entry); err != nil {
+		return fmt.Errorf("failed to publish log record %w", err)
+	}
+	return nil
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = maps.Clone(h.attrs)
+	if clone.attrs == nil {
+		clone.attrs = make(map[string]any, len(attrs))
+	}
+	for _, attr := range attrs {
+		addAttr(clone.attrs, h.groups, attr)
+	}
+	return &clone
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.groups = append(append([]string{}, h.groups...), name)
+	return &clone
+}
+
+// Level maps a slog level onto the closest models.LogLevel
+func Level(level slog.Level) models.LogLevel {
+	switch {
+	case level >= LevelFatal:
+		return models.FATAL
+	case level >= slog.LevelError:
+		return models.ERROR
+	case level >= slog.LevelWarn:
+		return models.WARN
+	case level >= slog.LevelInfo:
+		return models.INFO
+	case level >= slog.LevelDebug:
+		return models.DEBUG
+	default:
+		return models.TRACE
+	}
+}
+
+// addAttr flattens an attribute into metadata, prefixing keys with their groups
+func addAttr(metadata map[string]any, groups []string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			groups = append(append([]string{}, groups...), attr.Key)
+		}
+		for _, child := range attr.Value.Group() {
+			addAttr(metadata, groups, child)
+		}
+		return
+	}
+
+	key := strings.Join(append(append([]string{}, groups...), attr.Key), ".")
+	value := attr.Value.Any()
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	metadata[key] = value
+}
@@ -0,0 +1,97 @@
+// Package zapcore provides a zap Core that forwards entries into the Kafka pipeline.
+package zapcore
+
+import (
+	"fmt"
+	"kafka-logging-system/internal/models"
+	"kafka-logging-system/pkg/producer"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type Core struct {
+	zapcore.LevelEnabler
+	publisher   producer.Publisher
+	application string
+	fields      []zapcore.Field
+}
+
+// New returns a core publishing entries at or above enabler for application.
+// Combine it with an existing core using zapcore.NewTee to keep local output.
+func New(publisher producer.Publisher, application string, enabler zapcore.LevelEnabler) *Core {
+	return &Core{
+		LevelEnabler: enabler,
+		publisher:    publisher,
+		application:  application,
+	}
+}
+
+func (c *Core) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(append([]zapcore.Field{}, c.fields...), fields...)
+	return &clone
+}
+
+func (c *Core) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *Core) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	//Collect the structured fields, including those added via With, as metadata
+	enc := zapcore.NewMapObjectEncoder()
+	for _, field := range c.fields {
+		field.AddTo(enc)
+	}
+	var fieldErr error
+	for _, field := range fields {
+		if err, ok := field.Interface.(error); ok && field.Type == zapcore.ErrorType && fieldErr == nil {
+			fieldErr = err
+		}
+		field.AddTo(enc)
+	}
+
+	//zap captures the stack itself when configured with AddStacktrace,
+	//otherwise error entries get the stack of the logging call
+	stack := entry.Stack
+	if stack == "" && fieldErr != nil && entry.Level >= zapcore.ErrorLevel {
+		stack = models.CallerStack("go.uber.org/zap.", "go.uber.org/zap/", "kafka-logging-system/pkg/zapcore.")
+	}
+
+	application := c.application
+	if entry.LoggerName != "" {
+		application = entry.LoggerName
+	}
+
+	err := c.publisher.Publish(models.NewEntry(application, Level(entry.Level), entry.Message,
+		models.WithTime(entry.Time),
+		models.WithMetadata(enc.Fields),
+		models.WithErrorStack(fieldErr, stack),
+	))
+	if err != nil {
+		return fmt.Errorf("failed to publish zap entry %w", err)
+	}
+	return nil
+}
+
+func (c *Core) Sync() error {
+	return nil
+}
+
+// Level maps a zap level onto models.LogLevel
+func Level(level zapcore.Level) models.LogLevel {
+	switch {
+	case level >= zapcore.DPanicLevel:
+		return models.FATAL
+	case level == zapcore.ErrorLevel:
+		return models.ERROR
+	case level == zapcore.WarnLevel:
+		return models.WARN
+	case level == zapcore.InfoLevel:
+		return models.INFO
+	default:
+		return models.DEBUG
+	}
+}